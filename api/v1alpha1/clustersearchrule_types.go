@@ -0,0 +1,68 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
+// +kubebuilder:printcolumn:name="AlertStatus",type="string",JSONPath=".status.conditions[?(@.type==\"State\")].reason",description=""
+// +kubebuilder:printcolumn:name="LastValue",type="string",JSONPath=".status.lastValue",description=""
+// +kubebuilder:printcolumn:name="LastEvaluation",type="date",JSONPath=".status.lastEvaluationTime",description=""
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
+
+// ClusterSearchRule is the Schema for the clustersearchrules API.
+type ClusterSearchRule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SearchRuleSpec   `json:"spec,omitempty"`
+	Status SearchRuleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterSearchRuleList contains a list of ClusterSearchRule.
+type ClusterSearchRuleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterSearchRule `json:"items"`
+}
+
+// ToSearchRule returns a SearchRule with a copy of the metadata, spec and status of the ClusterSearchRule, so
+// cluster scoped rules are evaluated as SearchRules without namespace. The kind is kept to reference the
+// ClusterSearchRule in the events
+func (in *ClusterSearchRule) ToSearchRule() *SearchRule {
+	out := &SearchRule{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GroupVersion.String(),
+			Kind:       "ClusterSearchRule",
+		},
+	}
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return out
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterSearchRule{}, &ClusterSearchRuleList{})
+}
@@ -2,8 +2,11 @@ package v1alpha1
 
 // SecretRef TODO
 type SecretRef struct {
-	Name        string `json:"name"`
-	Namespace   string `json:"namespace,omitempty"`
-	KeyUsername string `json:"keyUsername"`
-	KeyPassword string `json:"keyPassword"`
+	Name           string `json:"name"`
+	Namespace      string `json:"namespace,omitempty"`
+	KeyUsername    string `json:"keyUsername,omitempty"`
+	KeyPassword    string `json:"keyPassword,omitempty"`
+	KeyBearerToken string `json:"keyBearerToken,omitempty"`
+	KeyApiKey      string `json:"keyApiKey,omitempty"`
+	KeyUrl         string `json:"keyUrl,omitempty"`
 }
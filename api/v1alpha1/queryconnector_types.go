@@ -26,17 +26,46 @@ type QueryConnectorCredentials struct {
 	SecretRef    SecretRef `json:"secretRef"`
 }
 
+// TlsSecretRef TODO
+type TlsSecretRef struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	KeyCert   string `json:"keyCert,omitempty"`
+	KeyKey    string `json:"keyKey,omitempty"`
+	KeyCA     string `json:"keyCA,omitempty"`
+}
+
 // QueryConnectorSpec defines the desired state of QueryConnector.
 type QueryConnectorSpec struct {
-	URL           string                    `json:"url"`
-	Headers       map[string]string         `json:"headers,omitempty"`
-	TlsSkipVerify bool                      `json:"tlsSkipVerify,omitempty"`
-	Credentials   QueryConnectorCredentials `json:"credentials,omitempty"`
+	// +kubebuilder:validation:Enum=elasticsearch;loki;prometheus
+	Type            string                    `json:"type,omitempty"`
+	URL             string                    `json:"url"`
+	Headers         map[string]string         `json:"headers,omitempty"`
+	TlsSkipVerify   bool                      `json:"tlsSkipVerify,omitempty"`
+	TlsSecretRef    TlsSecretRef              `json:"tlsSecretRef,omitempty"`
+	CaBundle        string                    `json:"caBundle,omitempty"`
+	CacheTTL        string                    `json:"cacheTTL,omitempty"`
+	MaxResponseSize string                    `json:"maxResponseSize,omitempty"`
+	Credentials     QueryConnectorCredentials `json:"credentials,omitempty"`
+	Probe           bool                      `json:"probe,omitempty"`
+	Proxy           string                    `json:"proxy,omitempty"`
+	UserAgent       string                    `json:"userAgent,omitempty"`
+
+	// ResponseFormat is the format of the responses of the backend. With ndjson, the newline-delimited
+	// JSON documents of the responses are parsed as a single document, selected by ndjsonSelect
+	// +kubebuilder:validation:Enum=json;ndjson
+	ResponseFormat string `json:"responseFormat,omitempty"`
+
+	// NdjsonSelect is the document of the ndjson responses evaluated by the rules: the first line, the last
+	// line or an array with all the lines, which is the default
+	// +kubebuilder:validation:Enum=first;last;array
+	NdjsonSelect string `json:"ndjsonSelect,omitempty"`
 }
 
 // QueryConnectorStatus defines the observed state of QueryConnector.
 type QueryConnectorStatus struct {
-	Conditions []metav1.Condition `json:"conditions"`
+	Conditions  []metav1.Condition `json:"conditions"`
+	SearchRules []string           `json:"searchRules,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -25,24 +26,137 @@ type RulerActionCredentials struct {
 	SecretRef SecretRef `json:"secretRef"`
 }
 
+// WebhookRetry TODO
+type WebhookRetry struct {
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	MaxRetries int    `json:"maxRetries,omitempty"`
+	Backoff    string `json:"backoff,omitempty"`
+}
+
 // WebHook TODO
 type Webhook struct {
-	Url           string                 `json:"url"`
+	Url string `json:"url"`
+
+	// +kubebuilder:validation:Enum=POST;PUT;PATCH
 	Verb          string                 `json:"verb"`
 	Headers       map[string]string      `json:"headers,omitempty"`
 	TlsSkipVerify bool                   `json:"tlsSkipVerify,omitempty"`
 	Validator     string                 `json:"validator,omitempty"`
 	Credentials   RulerActionCredentials `json:"credentials,omitempty"`
+	Retry         WebhookRetry           `json:"retry,omitempty"`
+
+	// SuccessStatusCodes are the status codes of the responses of the webhook taken as delivered.
+	// Any 2xx status code is a success when they are not defined
+	// +kubebuilder:validation:items:Minimum=100
+	// +kubebuilder:validation:items:Maximum=599
+	SuccessStatusCodes []int `json:"successStatusCodes,omitempty"`
+}
+
+// Teams TODO
+type Teams struct {
+	SecretRef SecretRef `json:"secretRef"`
+	Title     string    `json:"title,omitempty"`
+}
+
+// Discord TODO
+type Discord struct {
+	SecretRef SecretRef `json:"secretRef"`
+	Title     string    `json:"title,omitempty"`
+}
+
+// Email TODO
+type Email struct {
+	Host string   `json:"host"`
+	Port int      `json:"port"`
+	From string   `json:"from"`
+	To   []string `json:"to"`
+
+	Subject string `json:"subject,omitempty"`
+
+	// +kubebuilder:validation:Enum=starttls;tls;none
+	TlsMode       string                 `json:"tlsMode,omitempty"`
+	TlsSkipVerify bool                   `json:"tlsSkipVerify,omitempty"`
+	Credentials   RulerActionCredentials `json:"credentials,omitempty"`
+}
+
+// Opsgenie TODO
+type Opsgenie struct {
+	Url       string    `json:"url,omitempty"`
+	SecretRef SecretRef `json:"secretRef"`
+	Message   string    `json:"message,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+}
+
+// Alertmanager TODO
+type Alertmanager struct {
+	Url           string                 `json:"url"`
+	Headers       map[string]string      `json:"headers,omitempty"`
+	TlsSkipVerify bool                   `json:"tlsSkipVerify,omitempty"`
+	Credentials   RulerActionCredentials `json:"credentials,omitempty"`
+}
+
+// InhibitRule TODO
+type InhibitRule struct {
+	SourceSelector metav1.LabelSelector `json:"sourceSelector"`
+	TargetSelector metav1.LabelSelector `json:"targetSelector"`
+	Equal          []string             `json:"equal,omitempty"`
+}
+
+// CircuitBreaker TODO
+type CircuitBreaker struct {
+	// FailureThreshold is the number of deliveries failing in a row which opens the circuit breaker
+	// +kubebuilder:validation:Minimum=1
+	FailureThreshold int `json:"failureThreshold"`
+
+	// Cooldown is the time the deliveries are skipped once the circuit breaker is open. Default is 1m
+	Cooldown string `json:"cooldown,omitempty"`
 }
 
 // RulerActionSpec defines the desired state of RulerAction.
 type RulerActionSpec struct {
-	Webhook Webhook `json:"webhook"`
+	Webhook      Webhook       `json:"webhook,omitempty"`
+	Teams        Teams         `json:"teams,omitempty"`
+	Discord      Discord       `json:"discord,omitempty"`
+	Email        Email         `json:"email,omitempty"`
+	Opsgenie     Opsgenie      `json:"opsgenie,omitempty"`
+	Alertmanager Alertmanager  `json:"alertmanager,omitempty"`
+	GroupBy      []string      `json:"groupBy,omitempty"`
+	GroupWindow  string        `json:"groupWindow,omitempty"`
+	InhibitRules []InhibitRule `json:"inhibitRules,omitempty"`
+	MinInterval  string        `json:"minInterval,omitempty"`
+	Proxy        string        `json:"proxy,omitempty"`
+	UserAgent    string        `json:"userAgent,omitempty"`
+
+	PayloadSchema *apiextensionsv1.JSON `json:"payloadSchema,omitempty"`
+
+	// CircuitBreaker skips the deliveries to the integration after the failureThreshold deliveries fail
+	// in a row. Once the cooldown expires, a single notification is sent to test its recovery
+	CircuitBreaker CircuitBreaker `json:"circuitBreaker,omitempty"`
+}
+
+// InhibitedAlert TODO
+type InhibitedAlert struct {
+	SearchRule  string `json:"searchRule"`
+	InhibitedBy string `json:"inhibitedBy"`
+}
+
+// TestNotificationResult TODO
+type TestNotificationResult struct {
+	// Value is the value of the test-notification annotation which triggered the test notification
+	Value     string      `json:"value"`
+	Delivered bool        `json:"delivered"`
+	Message   string      `json:"message,omitempty"`
+	SentTime  metav1.Time `json:"sentTime"`
 }
 
 // RulerActionStatus defines the observed state of RulerAction.
 type RulerActionStatus struct {
-	Conditions []metav1.Condition `json:"conditions"`
+	Conditions      []metav1.Condition `json:"conditions"`
+	InhibitedAlerts []InhibitedAlert   `json:"inhibitedAlerts,omitempty"`
+
+	// TestNotification is the outcome of the last test notification requested with the test-notification annotation
+	TestNotification *TestNotificationResult `json:"testNotification,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -17,32 +17,159 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"strings"
+
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// Baseline TODO
+type Baseline struct {
+	Index          string                `json:"index,omitempty"`
+	ThresholdField string                `json:"thresholdField"`
+	QueryJSON      string                `json:"queryJSON,omitempty"`
+	Query          *apiextensionsv1.JSON `json:"query,omitempty"`
+}
+
+// QueryConfigMapRef TODO
+type QueryConfigMapRef struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Key       string `json:"key"`
+}
+
+// Pagination TODO
+type Pagination struct {
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	MaxPages int `json:"maxPages"`
+}
+
 // Elasticsearch TODO
 type Elasticsearch struct {
-	Index string `json:"index"`
+	// Index is the index to search in. Several indices can be given separated by commas, or in
+	// the list of indices, which are joined to the index
+	Index        string            `json:"index,omitempty"`
+	Indices      []string          `json:"indices,omitempty"`
+	SearchPath   string            `json:"searchPath,omitempty"`
+	SearchParams map[string]string `json:"searchParams,omitempty"`
 
 	ConditionField string `json:"conditionField"`
 
-	QueryJSON string                `json:"queryJSON,omitempty"`
-	Query     *apiextensionsv1.JSON `json:"query,omitempty"`
+	QueryJSON         string                `json:"queryJSON,omitempty"`
+	Query             *apiextensionsv1.JSON `json:"query,omitempty"`
+	QueryConfigMapRef *QueryConfigMapRef    `json:"queryConfigMapRef,omitempty"`
+
+	Baseline   Baseline   `json:"baseline,omitempty"`
+	Pagination Pagination `json:"pagination,omitempty"`
+
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	SampleSize int `json:"sampleSize,omitempty"`
+
+	// MinDocCount is the min number of documents matching the query to evaluate the rule. Below it,
+	// the rule is in NoData state instead of evaluating the condition
+	// +kubebuilder:validation:Minimum=0
+	MinDocCount int64 `json:"minDocCount,omitempty"`
+
+	// CheckIndex checks whether the index exists when the backend answers the query with an error,
+	// so a missing index is reported as IndexNotFound instead of a generic error response
+	CheckIndex bool `json:"checkIndex,omitempty"`
+
+	// ResolveQuery is executed instead of the query while the alert of the rule is firing, so its resolution
+	// is confirmed with other data. ResolveConditionField defaults to the conditionField
+	ResolveQuery          *apiextensionsv1.JSON `json:"resolveQuery,omitempty"`
+	ResolveConditionField string                `json:"resolveConditionField,omitempty"`
+}
+
+// GetIndex returns the index and the list of indices joined with commas, as in the multi-index
+// syntax of elasticsearch. Blank indices are skipped
+func (in *Elasticsearch) GetIndex() string {
+	indices := []string{}
+	for _, index := range append(strings.Split(in.Index, ","), in.Indices...) {
+		index = strings.TrimSpace(index)
+		if index != "" {
+			indices = append(indices, index)
+		}
+	}
+	return strings.Join(indices, ",")
+}
+
+// Loki TODO
+type Loki struct {
+	Query          string `json:"query"`
+	ConditionField string `json:"conditionField"`
+	Range          string `json:"range,omitempty"`
+	Step           string `json:"step,omitempty"`
+
+	// ResolveQuery is executed instead of the query while the alert of the rule is firing, so its resolution
+	// is confirmed with other data. ResolveConditionField defaults to the conditionField
+	ResolveQuery          string `json:"resolveQuery,omitempty"`
+	ResolveConditionField string `json:"resolveConditionField,omitempty"`
+}
+
+// Prometheus TODO
+type Prometheus struct {
+	Query          string `json:"query"`
+	ConditionField string `json:"conditionField,omitempty"`
+
+	// ResolveQuery is executed instead of the query while the alert of the rule is firing, so its resolution
+	// is confirmed with other data. ResolveConditionField defaults to the conditionField
+	ResolveQuery          string `json:"resolveQuery,omitempty"`
+	ResolveConditionField string `json:"resolveConditionField,omitempty"`
+}
+
+// Buckets TODO
+type Buckets struct {
+	KeyField   string `json:"keyField,omitempty"`
+	ValueField string `json:"valueField"`
+	Label      string `json:"label,omitempty"`
 }
 
 // Condition TODO
 type Condition struct {
-	Operator  string `json:"operator"`
-	Threshold string `json:"threshold"`
-	For       string `json:"for"`
+	Operator   string `json:"operator"`
+	Threshold  string `json:"threshold"`
+	For        string `json:"for"`
+	ResolveFor string `json:"resolveFor,omitempty"`
+	Cooldown   string `json:"cooldown,omitempty"`
+
+	MaxFiringDuration string `json:"maxFiringDuration,omitempty"`
+
+	// Buckets evaluates the condition for every bucket of the list in the conditionField,
+	// so every bucket fires separately
+	Buckets *Buckets `json:"buckets,omitempty"`
+
+	// NoDataPolicy is what happens when the query returns no data: the rule is evaluated as firing,
+	// as resolved, or it keeps its previous state, which is the default
+	// +kubebuilder:validation:Enum=firing;resolved;keep
+	NoDataPolicy string `json:"noDataPolicy,omitempty"`
+
+	// ChangeOperator evaluates the condition against the change of the value since changeIntervals evaluations
+	// ago instead of against the value: percent is the change in percentage and delta the difference
+	// +kubebuilder:validation:Enum=percent;delta
+	ChangeOperator string `json:"changeOperator,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=99
+	ChangeIntervals int `json:"changeIntervals,omitempty"`
+
+	// SmoothingSamples evaluates the condition against the moving average of the value over the last samples,
+	// so spiky values do not make the rule flap
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	SmoothingSamples int `json:"smoothingSamples,omitempty"`
+
+	// Absent fires the rule when the condition is true continuously for the `for` duration since the last
+	// evaluation where it was false, even across restarts, as a dead man's switch for missing data
+	Absent bool `json:"absent,omitempty"`
 }
 
 // ActionRef TODO
 type ActionRef struct {
 	Name      string `json:"name"`
 	Namespace string `json:"namespace"`
-	Data      string `json:"data"`
+	Data      string `json:"data,omitempty"`
 }
 
 // QueryConnectorRef TODO
@@ -67,26 +194,75 @@ type CustomMetric struct {
 	Value          string        `json:"value"`
 }
 
+// ActiveWindow TODO
+type ActiveWindow struct {
+	Days     []string `json:"days,omitempty"`
+	Start    string   `json:"start,omitempty"`
+	End      string   `json:"end,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+}
+
 // SearchRuleSpec defines the desired state of SearchRule.
 type SearchRuleSpec struct {
 	Description       string            `json:"description,omitempty"`
 	QueryConnectorRef QueryConnectorRef `json:"queryConnectorRef"`
 	CheckInterval     string            `json:"checkInterval"`
-	Elasticsearch     Elasticsearch     `json:"elasticsearch"`
+	CheckJitter       string            `json:"checkJitter,omitempty"`
+	Elasticsearch     Elasticsearch     `json:"elasticsearch,omitempty"`
+	Loki              Loki              `json:"loki,omitempty"`
+	Prometheus        Prometheus        `json:"prometheus,omitempty"`
 	Condition         Condition         `json:"condition"`
 	ActionRef         ActionRef         `json:"actionRef"`
+	MessageTemplate   string            `json:"messageTemplate,omitempty"`
 	CustomMetrics     []CustomMetric    `json:"customMetrics,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	ActiveWindows     []ActiveWindow    `json:"activeWindows,omitempty"`
+
+	// +kubebuilder:validation:Enum=critical;high;warning;low;info
+	Severity string `json:"severity,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+
+	// QueryTimeout is the max time the requests of the rule to the backend can take. When it expires,
+	// the request is cancelled and the evaluation fails. Requests have no deadline when it is not defined
+	QueryTimeout string `json:"queryTimeout,omitempty"`
+}
+
+// DryRunResult TODO
+type DryRunResult struct {
+	Value          string      `json:"value"`
+	Firing         bool        `json:"firing"`
+	EvaluationTime metav1.Time `json:"evaluationTime"`
 }
 
 // SearchRuleStatus defines the observed state of SearchRule.
 type SearchRuleStatus struct {
-	Conditions []metav1.Condition `json:"conditions"`
+	Conditions         []metav1.Condition `json:"conditions"`
+	LastValue          string             `json:"lastValue,omitempty"`
+	LastEvaluationTime metav1.Time        `json:"lastEvaluationTime,omitempty"`
+	DryRun             *DryRunResult      `json:"dryRun,omitempty"`
+
+	// LastSmoothedValue is the moving average of the last value evaluated by the condition with smoothingSamples
+	LastSmoothedValue string `json:"lastSmoothedValue,omitempty"`
+
+	// LastSeenTime is the last evaluation where the condition of an absent rule was false
+	LastSeenTime metav1.Time `json:"lastSeenTime,omitempty"`
+
+	// ConsecutiveFailures is the number of evaluations in a row whose query failed
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+
+	// LastEvaluateNow is the last value of the evaluate-now annotation that triggered an evaluation
+	LastEvaluateNow string `json:"lastEvaluateNow,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
-// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"ResourceSynced\")].status",description=""
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
 // +kubebuilder:printcolumn:name="AlertStatus",type="string",JSONPath=".status.conditions[?(@.type==\"State\")].reason",description=""
+// +kubebuilder:printcolumn:name="LastValue",type="string",JSONPath=".status.lastValue",description=""
+// +kubebuilder:printcolumn:name="LastEvaluation",type="date",JSONPath=".status.lastEvaluationTime",description=""
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
 
 // SearchRule is the Schema for the searchrules API.
@@ -21,15 +21,20 @@ import (
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -43,6 +48,8 @@ import (
 	"prosimcorp.com/SearchRuler/internal/globals"
 	"prosimcorp.com/SearchRuler/internal/metrics"
 	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/tracing"
+	webhooksearchrulerv1alpha1 "prosimcorp.com/SearchRuler/internal/webhook/v1alpha1"
 	"prosimcorp.com/SearchRuler/internal/webserver"
 	// +kubebuilder:scaffold:imports
 )
@@ -61,6 +68,12 @@ var (
 	AlertsPool = &pools.AlertsStore{
 		Store: make(map[string]*pools.Alert),
 	}
+	QueryCachePool = &pools.QueryCacheStore{
+		Store: make(map[string]*pools.QueryCacheEntry),
+	}
+	HttpClientsPool = &pools.HttpClientsStore{
+		Store: make(map[string]*pools.HttpClient),
+	}
 )
 
 func init() {
@@ -79,6 +92,14 @@ func main() {
 	var webserverAddr string
 	var rulesMetricsAddr string
 	var rulesMetricsRefreshSec int
+	var maxConcurrentQueries int
+	var maxConcurrentRules int
+	var msearchWindow time.Duration
+	var watchNamespaces string
+	var shutdownGracePeriod time.Duration
+	var requireTeamLabel bool
+	var errorBackoffMaxInterval time.Duration
+	var readyOnConnectorSynced bool
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -96,14 +117,44 @@ func main() {
 		"The address the rules custom metrics will bind to. Leave as 0 to disable the rule metrics server.")
 	flag.IntVar(&rulesMetricsRefreshSec, "rules-metrics-refresh-rate", 10,
 		"The refresh rate in seconds for the rules custom metrics.")
+	flag.IntVar(&maxConcurrentQueries, "max-concurrent-queries", 10,
+		"The max number of queries executed at once against the backends of the QueryConnectors. Use 0 for no limit.")
+	flag.IntVar(&maxConcurrentRules, "max-concurrent-rules", 10,
+		"The max number of SearchRules and ClusterSearchRules evaluated at once.")
+	flag.DurationVar(&msearchWindow, "elasticsearch-msearch-window", 0,
+		"The time the responses of the elasticsearch queries batched with _msearch are reused by the rules. Use 0 to disable batching.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma-separated list of namespaces the namespaced resources are watched in. "+
+			"Cluster scoped resources are always watched. Leave empty to watch all the namespaces.")
+	flag.DurationVar(&shutdownGracePeriod, "shutdown-grace-period", 30*time.Second,
+		"The time given on shutdown to deliver the pending alerts. Use 0 to disable the delivery.")
+	flag.BoolVar(&requireTeamLabel, "require-team-label", false,
+		"If set, the validating webhook rejects the SearchRules without the searchruler.prosimcorp.com/team label.")
+	flag.DurationVar(&errorBackoffMaxInterval, "error-backoff-max-interval", 15*time.Minute,
+		"The max time between the evaluations of the rules failing in a row, which are requeued with increasing backoff. Use 0 to disable the backoff.")
+	flag.BoolVar(&readyOnConnectorSynced, "ready-on-connector-synced", false,
+		"If set, the readiness probe fails until at least one QueryConnector or ClusterQueryConnector is synced and reachable.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
+	globals.Application.WatchNamespaces = globals.ParseNamespaces(watchNamespaces)
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	// Set up the exporter of traces from the standard OTEL environment variables
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			setupLog.Error(err, "unable to flush the pending traces")
+		}
+	}()
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -147,13 +198,21 @@ func main() {
 		metricsServerOptions.FilterProvider = filters.WithAuthenticationAndAuthorization
 	}
 
+	// The manager waits for the running reconciles during the grace period too, before the pending alerts are delivered
+	var gracefulShutdownTimeout *time.Duration
+	if shutdownGracePeriod > 0 {
+		gracefulShutdownTimeout = &shutdownGracePeriod
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		Metrics:                metricsServerOptions,
-		WebhookServer:          webhookServer,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "75b1a88b.prosimcorp.com",
+		Scheme:                  scheme,
+		Cache:                   getCacheOptions(globals.Application.WatchNamespaces, globals.GetControllerNamespace()),
+		Metrics:                 metricsServerOptions,
+		WebhookServer:           webhookServer,
+		HealthProbeBindAddress:  probeAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "75b1a88b.prosimcorp.com",
+		GracefulShutdownTimeout: gracefulShutdownTimeout,
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -196,11 +255,19 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&ruleraction.RulerActionReconciler{
-		Client:     mgr.GetClient(),
-		Scheme:     mgr.GetScheme(),
-		AlertsPool: AlertsPool,
-	}).SetupWithManager(mgr); err != nil {
+	// The rules are evaluated once the state of the last shutdown is restored in the pools
+	stateRestored := make(chan struct{})
+	rulerActionReconciler := &ruleraction.RulerActionReconciler{
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		AlertsPool:          AlertsPool,
+		RulesPool:           RulesPool,
+		ShutdownGracePeriod: shutdownGracePeriod,
+		StateNamespace:      globals.GetControllerNamespace(),
+		StateRestored:       stateRestored,
+		ControllerNamespace: globals.GetControllerNamespace(),
+	}
+	if err = rulerActionReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "RulerAction")
 		os.Exit(1)
 	}
@@ -211,18 +278,41 @@ func main() {
 		QueryConnectorCredentialsPool: QueryConnectorCredentialsPool,
 		RulesPool:                     RulesPool,
 		AlertsPool:                    AlertsPool,
+		QueryCachePool:                QueryCachePool,
+		HttpClientsPool:               HttpClientsPool,
+		QueriesSemaphore:              searchrule.NewQueriesSemaphore(maxConcurrentQueries),
+		MaxConcurrentReconciles:       maxConcurrentRules,
+		MsearchWindow:                 msearchWindow,
+		ErrorBackoffMaxInterval:       errorBackoffMaxInterval,
+		StateRestored:                 stateRestored,
+		ControllerNamespace:           globals.GetControllerNamespace(),
+		Elected:                       mgr.Elected(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SearchRule")
 		os.Exit(1)
 	}
-	if err = (&queryconnector.QueryConnectorReconciler{
+	queryConnectorReconciler := &queryconnector.QueryConnectorReconciler{
 		Client:          mgr.GetClient(),
 		Scheme:          mgr.GetScheme(),
 		CredentialsPool: QueryConnectorCredentialsPool,
-	}).SetupWithManager(mgr); err != nil {
+		HttpClientsPool: HttpClientsPool,
+		QueryCachePool:  QueryCachePool,
+	}
+	if err = queryConnectorReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "QueryConnector")
 		os.Exit(1)
 	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = webhooksearchrulerv1alpha1.SetupSearchRuleWebhookWithManager(mgr, requireTeamLabel); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SearchRule")
+			os.Exit(1)
+		}
+		if err = webhooksearchrulerv1alpha1.SetupClusterSearchRuleWebhookWithManager(mgr, requireTeamLabel); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterSearchRule")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -233,10 +323,66 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if readyOnConnectorSynced {
+		if err := mgr.AddReadyzCheck("queryconnectors", queryConnectorReconciler.ReadyzCheck); err != nil {
+			setupLog.Error(err, "unable to set up ready check")
+			os.Exit(1)
+		}
+	}
+
+	// The pending alerts are delivered once the manager is stopped, when its cache is not available anymore,
+	// so they are delivered with a client reading from the API
+	apiClient, err := client.New(mgr.GetConfig(), client.Options{
+		Scheme:     mgr.GetScheme(),
+		HTTPClient: mgr.GetHTTPClient(),
+		Mapper:     mgr.GetRESTMapper(),
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to create the client of the shutdown")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := rulerActionReconciler.StartManager(ctrl.SetupSignalHandler(), mgr, apiClient); err != nil {
 		setupLog.Error(err, "problem running manager")
+		_ = shutdownTracing(context.Background())
 		os.Exit(1)
 	}
 }
+
+// getCacheOptions returns the options of the manager cache restricting the namespaced resources to the
+// watched namespaces. Cluster scoped resources are always watched in the whole cluster
+func getCacheOptions(watchNamespaces []string, controllerNamespace string) cache.Options {
+	namespaces := map[string]cache.Config{}
+	for _, namespace := range watchNamespaces {
+		namespaces[namespace] = cache.Config{}
+	}
+	if len(namespaces) == 0 {
+		return cache.Options{}
+	}
+
+	// Events of the ClusterSearchRules are created in the default namespace, so it is always
+	// watched for them to reach the RulerActions
+	eventNamespaces := map[string]cache.Config{metav1.NamespaceDefault: {}}
+	for namespace := range namespaces {
+		eventNamespaces[namespace] = cache.Config{}
+	}
+
+	// Silences of the ClusterSearchRules are in the namespace of the controller, so it is always
+	// watched for them
+	silenceNamespaces := map[string]cache.Config{}
+	for namespace := range namespaces {
+		silenceNamespaces[namespace] = cache.Config{}
+	}
+	if controllerNamespace != "" {
+		silenceNamespaces[controllerNamespace] = cache.Config{}
+	}
+
+	return cache.Options{
+		DefaultNamespaces: namespaces,
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.Event{}:                {Namespaces: eventNamespaces},
+			&searchrulerv1alpha1.Silence{}: {Namespaces: silenceNamespaces},
+		},
+	}
+}
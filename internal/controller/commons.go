@@ -4,6 +4,7 @@ const (
 
 	// Resource types
 	SearchRuleResourceType            = "SearchRule"
+	ClusterSearchRuleResourceType     = "ClusterSearchRule"
 	RulerActionResourceType           = "RulerAction"
 	QueryConnectorResourceType        = "QueryConnector"
 	ClusterQueryConnectorResourceType = "ClusterQueryConnector"
@@ -13,33 +14,101 @@ const (
 	DefaultSyncInterval = "1m"
 
 	// Error messages
-	ResourceNotFoundError                  = "%s '%s' resource not found. Ignoring since object must be deleted."
-	CanNotGetResourceError                 = "%s '%s' resource not found. Error: %v"
-	ResourceFinalizersUpdateError          = "Failed to update finalizer of %s '%s': %s"
-	ResourceConditionUpdateError           = "Failed to update the condition on %s '%s': %s"
-	ResourceSyncTimeRetrievalError         = "can not get synchronization time from the %s '%s': %s"
-	SyncTargetError                        = "can not sync the target for the %s '%s': %s"
-	ValidatorNotFoundErrorMessage          = "validator %s not found"
-	ValidationFailedErrorMessage           = "validation failed: %s"
-	HttpRequestCreationErrorMessage        = "error creating http request: %s"
-	HttpRequestSendingErrorMessage         = "error sending http request: %s"
-	AlertFiringInfoMessage                 = "alert firing for searchRule with namespaced name %s/%s. Description: %s"
-	SecretNotFoundErrorMessage             = "error fetching secret %s: %v"
-	MissingCredentialsMessage              = "missing credentials in secret %s"
-	EvaluateTemplateErrorMessage           = "error evaluating template message: %v"
-	AlertsPoolErrorMessage                 = "error getting alerts pool: %v"
-	QueryConnectorNotFoundMessage          = "queryConnector %s not found in the resource namespace %s"
-	QueryNotDefinedErrorMessage            = "query not defined in resource %s"
-	QueryDefinedInBothErrorMessage         = "both query and queryJSON are defined in resource %s. Only one of them must be defined"
-	JSONMarshalErrorMessage                = "error marshaling json: %v"
-	ElasticsearchQueryErrorMessage         = "error executing elasticsearch request %s: %v"
-	ResponseBodyReadErrorMessage           = "error reading response body: %v"
-	ElasticsearchQueryResponseErrorMessage = "error response from Elasticsearch executing request %s: %s"
-	ConditionFieldNotFoundMessage          = "conditionField %s not found in the response: %s"
-	EvaluatingConditionErrorMessage        = "error evaluating condition: %v"
-	ForValueParseErrorMessage              = "error parsing `for` time: %v"
-	KubeEventCreationErrorMessage          = "error creating kube event: %v"
+	ResourceNotFoundError                = "%s '%s' resource not found. Ignoring since object must be deleted."
+	CanNotGetResourceError               = "%s '%s' resource not found. Error: %v"
+	ResourceFinalizersUpdateError        = "Failed to update finalizer of %s '%s': %s"
+	ResourceConditionUpdateError         = "Failed to update the condition on %s '%s': %s"
+	ResourceSyncTimeRetrievalError       = "can not get synchronization time from the %s '%s': %s"
+	SyncTargetError                      = "can not sync the target for the %s '%s': %s"
+	ResourceListError                    = "can not list the %s resources: %s"
+	ResourceInUseError                   = "%s '%s' is referenced by %s, waiting for them to be deleted"
+	ValidatorNotFoundErrorMessage        = "validator %s not found"
+	ValidationFailedErrorMessage         = "validation failed: %s"
+	HttpRequestCreationErrorMessage      = "error creating http request: %s"
+	HttpRequestSendingErrorMessage       = "error sending http request: %s"
+	HttpResponseErrorMessage             = "error response from %s: %s"
+	WebhookVerbNotAllowedErrorMessage    = "webhook verb %s not allowed, it must be one of POST, PUT or PATCH"
+	WebhookBackoffParseErrorMessage      = "error parsing webhook retry `backoff` time: %v"
+	WebhookResponseErrorMessage          = "error response from webhook %s with status %s: %s"
+	WebhookRejectedErrorMessage          = "webhook %s rejected the request with status %s, it is not retried: %s"
+	WebhookRetriesExhaustedErrorMessage  = "webhook delivery failed after %d attempts: %w"
+	IntegrationNotDefinedErrorMessage    = "no integration defined in RulerAction %s"
+	SmtpConnectionErrorMessage           = "error connecting to smtp server %s: %v"
+	SmtpSendingErrorMessage              = "error sending email: %v"
+	SecretNotFoundErrorMessage           = "error fetching secret %s: %v"
+	ConfigMapNotFoundErrorMessage        = "error fetching configmap %s: %v"
+	ConfigMapKeyNotFoundErrorMessage     = "key %s not found in configmap %s"
+	MissingCredentialsMessage            = "missing credentials in secret %s"
+	TlsClientCertificateErrorMessage     = "error loading tls client certificate from secret %s: %v"
+	TlsCABundleErrorMessage              = "error loading CA bundle from secret %s: no valid PEM certificates found"
+	TlsInlineCABundleErrorMessage        = "error loading caBundle of %s: no valid PEM certificates found"
+	CredentialsConflictErrorMessage      = "more than one of basic auth keys, bearer token key or api key are defined in the secretRef of %s. Only one of them must be defined"
+	EvaluateTemplateErrorMessage         = "error evaluating template message: %v"
+	AlertsPoolErrorMessage               = "error getting alerts pool: %v"
+	QueryConnectorNotFoundMessage        = "queryConnector %s not found in the resource namespace %s"
+	NamespaceNotWatchedErrorMessage      = "%s %s is in the namespace %s, which is not watched"
+	QueryNotDefinedErrorMessage          = "query not defined in resource %s"
+	QueryDefinedInBothErrorMessage       = "more than one of query, queryJSON or queryConfigMapRef are defined in resource %s. Only one of them must be defined"
+	JSONMarshalErrorMessage              = "error marshaling json: %v"
+	QueryErrorMessage                    = "error executing request to %s with body %s: %v"
+	ResponseBodyReadErrorMessage         = "error reading response body: %v"
+	ResponseDecompressErrorMessage       = "error decompressing gzip response body: %v"
+	QueryResponseErrorMessage            = "error response from %s executing request %s: %s"
+	ConditionFieldNotFoundMessage        = "conditionField %s not found in the response: %s"
+	InvalidResponseErrorMessage          = "response from %s is not a valid JSON: %s"
+	InvalidResponseStatusErrorMessage    = "response from %s with status %d is not a valid JSON: %s"
+	IndexNotFoundErrorMessage            = "index %s not found in %s"
+	IndexNotDefinedErrorMessage          = "index not defined in resource %s"
+	ConditionValueNotNumericMessage      = "conditionField value %s is not numeric"
+	ConditionValueNotBucketsMessage      = "conditionField value %s is not a list of buckets"
+	BucketKeyNotFoundMessage             = "keyField %s not found in bucket %s"
+	ThresholdFieldNotFoundMessage        = "baseline thresholdField %s not found in the response: %s"
+	BaselineQueryNotDefinedErrorMessage  = "baseline query not defined or defined in both query and queryJSON in resource %s"
+	EvaluatingConditionErrorMessage      = "error evaluating condition: %v"
+	ForValueParseErrorMessage            = "error parsing `for` time: %v"
+	ResolveForValueParseErrorMessage     = "error parsing `resolveFor` time: %v"
+	CooldownValueParseErrorMessage       = "error parsing `cooldown` time: %v"
+	MaxFiringDurationParseErrorMessage   = "error parsing `maxFiringDuration` time: %v"
+	KubeEventCreationErrorMessage        = "error creating kube event: %v"
+	SearchPathInvalidErrorMessage        = "invalid elasticsearch search path %s: %v"
+	LokiRangeParseErrorMessage           = "error parsing loki `range` time: %v"
+	CacheTTLParseErrorMessage            = "error parsing `cacheTTL` time: %v"
+	GroupWindowParseErrorMessage         = "error parsing `groupWindow` time: %v"
+	MinIntervalParseErrorMessage         = "error parsing `minInterval` time: %v"
+	PayloadSchemaParseErrorMessage       = "error parsing `payloadSchema`: %v"
+	PayloadSchemaValidationErrorMessage  = "payload does not match the `payloadSchema`: %s"
+	SilencesListErrorMessage             = "error listing silences in namespace %s: %v"
+	SilenceSelectorErrorMessage          = "error parsing selector of silence %s: %v"
+	InhibitRuleSelectorErrorMessage      = "error parsing selector of inhibit rule %d: %v"
+	ActiveWindowParseErrorMessage        = "error parsing active window %d: %v"
+	CheckIntervalParseErrorMessage       = "error parsing `checkInterval` %s as duration (%v) or as cron expression (%v)"
+	CheckJitterParseErrorMessage         = "error parsing `checkJitter` time: %v"
+	QueryTimeoutParseErrorMessage        = "error parsing `queryTimeout` time: %v"
+	QueryTimeoutErrorMessage             = "request to %s with body %s cancelled after the query timeout of %s"
+	InvalidUrlErrorMessage               = "invalid url %s: %s"
+	ProxyUrlParseErrorMessage            = "error parsing proxy url %s: %v"
+	MaxResponseSizeParseErrorMessage     = "error parsing `maxResponseSize` %s: %v"
+	ResponseTooLargeErrorMessage         = "response from %s is larger than the max response size of %d bytes"
+	QueriesLimitReachedErrorMessage      = "max number of concurrent queries reached, query to %s not executed after waiting %s"
+	PaginationSortMissingErrorMessage    = "pagination needs a sort defined in the query of resource %s"
+	MsearchResponseErrorMessage          = "_msearch request with %d searches returned %d responses"
+	ResolveQueryNotSupportedErrorMessage = "resolveQuery can not be used with buckets, changeOperator or smoothingSamples"
+	StateSaveErrorMessage                = "error saving the state in configmap %s: %v"
+	StateRestoreErrorMessage             = "error restoring the state from configmap %s: %v"
+	TeamLabelMissingErrorMessage         = "label %s with the team owning the rule is required"
+	NoQueryConnectorReadyErrorMessage    = "no QueryConnector or ClusterQueryConnector is synced and reachable yet"
+	CircuitBreakerCooldownErrorMessage   = "error parsing `cooldown` of the circuit breaker: %v"
+	CircuitBreakerOpenErrorMessage       = "circuit breaker is open after %d deliveries failing in a row, deliveries are skipped until %s"
+	TestNotificationErrorMessage         = "error sending the test notification: %v"
 
 	// Finalizer
 	ResourceFinalizer = "searchruler.prosimcorp.com/finalizer"
+
+	// Annotations
+	DryRunAnnotation           = "searchruler.prosimcorp.com/dry-run"
+	EvaluateNowAnnotation      = "searchruler.prosimcorp.com/evaluate-now"
+	TestNotificationAnnotation = "searchruler.prosimcorp.com/test-notification"
+
+	// Labels
+	TeamLabel = "searchruler.prosimcorp.com/team"
 )
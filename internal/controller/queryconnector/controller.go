@@ -20,18 +20,24 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	//
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	//
 	searchrulerv1alpha1 "prosimcorp.com/SearchRuler/api/v1alpha1"
@@ -44,6 +50,11 @@ type QueryConnectorReconciler struct {
 	client.Client
 	Scheme          *runtime.Scheme
 	CredentialsPool *pools.CredentialsStore
+	HttpClientsPool *pools.HttpClientsStore
+	QueryCachePool  *pools.QueryCacheStore
+
+	// Set once a QueryConnector is ready, see ReadyzCheck
+	connectorReady atomic.Bool
 }
 
 type CompoundQueryConnectorResource struct {
@@ -60,6 +71,8 @@ var (
 // +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=queryconnectors/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=queryconnectors/finalizers,verbs=update
 
+// +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=searchrules;clustersearchrules,verbs=get;list;watch
+
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -111,7 +124,31 @@ func (r *QueryConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	if !deletionTimestamp.IsZero() {
 		if containsFinalizer {
 
-			// 3.1 Delete the resources associated with the QueryConnector
+			// 3.1 Keep the QueryConnector while rules reference it, so they do not start failing.
+			// The rules are checked again in the next sync interval
+			searchRules, err := r.getSearchRules(ctx, req.Namespace, req.Name)
+			if err != nil {
+				return result, err
+			}
+			if len(searchRules) > 0 {
+				logger.Info(fmt.Sprintf(controller.ResourceInUseError, resourceType, req.NamespacedName, strings.Join(searchRules, ", ")))
+				r.UpdateSearchRules(CompoundQueryConnectorResource, resourceType, searchRules)
+				r.UpdateConditionInUse(CompoundQueryConnectorResource, resourceType)
+				switch resourceType {
+				case controller.ClusterQueryConnectorResourceType:
+					err = r.Status().Update(ctx, CompoundQueryConnectorResource.ClusterQueryConnectorResource)
+				default:
+					err = r.Status().Update(ctx, CompoundQueryConnectorResource.QueryConnectorResource)
+				}
+				if err != nil {
+					logger.Info(fmt.Sprintf(controller.ResourceConditionUpdateError, resourceType, req.NamespacedName, err.Error()))
+				}
+
+				RequeueTime, err := time.ParseDuration(controller.DefaultSyncInterval)
+				return ctrl.Result{RequeueAfter: RequeueTime}, err
+			}
+
+			// 3.2 Delete the resources associated with the QueryConnector
 			err = r.Sync(ctx, watch.Deleted, CompoundQueryConnectorResource, resourceType)
 
 			// Remove the finalizers on Patch CR
@@ -183,33 +220,122 @@ func (r *QueryConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		RequeueAfter: RequeueTime,
 	}
 
-	// 7. Sync credentials if defined
-	credentials := CompoundQueryConnectorResource.QueryConnectorResource.Spec.Credentials
-	if resourceType == controller.ClusterQueryConnectorResourceType {
-		credentials = CompoundQueryConnectorResource.ClusterQueryConnectorResource.Spec.Credentials
+	// 7. Sync credentials, TLS certificates and CA bundle
+	err = r.Sync(ctx, watch.Modified, CompoundQueryConnectorResource, resourceType)
+	if err != nil {
+		r.UpdateConditionKubernetesApiCallFailure(CompoundQueryConnectorResource, resourceType)
+		logger.Info(fmt.Sprintf(controller.SyncTargetError, resourceType, req.NamespacedName, err.Error()))
+		return result, err
 	}
 
-	if !reflect.ValueOf(credentials).IsZero() {
-		err = r.Sync(ctx, watch.Modified, CompoundQueryConnectorResource, resourceType)
-		if err != nil {
-			r.UpdateConditionKubernetesApiCallFailure(CompoundQueryConnectorResource, resourceType)
-			logger.Info(fmt.Sprintf(controller.SyncTargetError, resourceType, req.NamespacedName, err.Error()))
-			return result, err
-		}
+	// 8. Show the rules referencing the QueryConnector in the status
+	searchRules, err := r.getSearchRules(ctx, req.Namespace, req.Name)
+	if err != nil {
+		r.UpdateConditionKubernetesApiCallFailure(CompoundQueryConnectorResource, resourceType)
+		logger.Info(fmt.Sprintf(controller.SyncTargetError, resourceType, req.NamespacedName, err.Error()))
+		return result, err
 	}
+	r.UpdateSearchRules(CompoundQueryConnectorResource, resourceType, searchRules)
 
-	// 8. Success, update the status
+	// 9. Success, update the status
 	r.UpdateConditionSuccess(CompoundQueryConnectorResource, resourceType)
 
 	return result, err
 }
 
+// getSearchRules returns the SearchRules, as namespace/name, and the ClusterSearchRules, as name, referencing
+// the QueryConnector. ClusterQueryConnectors have no namespace, as in the references of the rules
+func (r *QueryConnectorReconciler) getSearchRules(ctx context.Context, namespace, name string) ([]string, error) {
+
+	searchRules := []string{}
+
+	searchRuleList := &searchrulerv1alpha1.SearchRuleList{}
+	err := r.List(ctx, searchRuleList)
+	if err != nil {
+		return nil, fmt.Errorf(controller.ResourceListError, controller.SearchRuleResourceType, err.Error())
+	}
+	for _, searchRule := range searchRuleList.Items {
+		if isQueryConnectorRef(searchRule.Spec.QueryConnectorRef, namespace, name) {
+			searchRules = append(searchRules, fmt.Sprintf("%s/%s", searchRule.Namespace, searchRule.Name))
+		}
+	}
+
+	clusterSearchRuleList := &searchrulerv1alpha1.ClusterSearchRuleList{}
+	err = r.List(ctx, clusterSearchRuleList)
+	if err != nil {
+		return nil, fmt.Errorf(controller.ResourceListError, controller.ClusterSearchRuleResourceType, err.Error())
+	}
+	for _, clusterSearchRule := range clusterSearchRuleList.Items {
+		if isQueryConnectorRef(clusterSearchRule.Spec.QueryConnectorRef, namespace, name) {
+			searchRules = append(searchRules, clusterSearchRule.Name)
+		}
+	}
+
+	sort.Strings(searchRules)
+	return searchRules, nil
+}
+
+// isQueryConnectorRef returns true when the reference points to the QueryConnector
+func isQueryConnectorRef(ref searchrulerv1alpha1.QueryConnectorRef, namespace, name string) bool {
+	return ref.Namespace == namespace && ref.Name == name
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *QueryConnectorReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	connectorsFilter := builder.WithPredicates(predicate.GenerationChangedPredicate{})
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&searchrulerv1alpha1.QueryConnector{}).
-		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		For(&searchrulerv1alpha1.QueryConnector{}, connectorsFilter).
 		Named("QueryConnector").
-		Watches(&searchrulerv1alpha1.ClusterQueryConnector{}, &handler.EnqueueRequestForObject{}).
+		Watches(&searchrulerv1alpha1.ClusterQueryConnector{}, &handler.EnqueueRequestForObject{}, connectorsFilter).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.getSecretQueryConnectors)). // Sync the credentials as soon as the secrets are rotated
 		Complete(r)
 }
+
+// getSecretQueryConnectors returns the requests of the QueryConnectors and ClusterQueryConnectors using the secret
+// for their credentials or TLS certificates
+func (r *QueryConnectorReconciler) getSecretQueryConnectors(ctx context.Context, secret client.Object) []reconcile.Request {
+	logger := log.FromContext(ctx)
+	requests := []reconcile.Request{}
+
+	queryConnectors := &searchrulerv1alpha1.QueryConnectorList{}
+	err := r.List(ctx, queryConnectors)
+	if err != nil {
+		logger.Info(fmt.Sprintf(controller.ResourceListError, controller.QueryConnectorResourceType, err.Error()))
+	}
+	for _, queryConnector := range queryConnectors.Items {
+		if usesSecret(queryConnector.Spec, queryConnector.Namespace, secret.GetNamespace(), secret.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&queryConnector)})
+		}
+	}
+
+	clusterQueryConnectors := &searchrulerv1alpha1.ClusterQueryConnectorList{}
+	err = r.List(ctx, clusterQueryConnectors)
+	if err != nil {
+		logger.Info(fmt.Sprintf(controller.ResourceListError, controller.ClusterQueryConnectorResourceType, err.Error()))
+	}
+	for _, clusterQueryConnector := range clusterQueryConnectors.Items {
+		if usesSecret(clusterQueryConnector.Spec, "", secret.GetNamespace(), secret.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&clusterQueryConnector)})
+		}
+	}
+
+	return requests
+}
+
+// usesSecret returns true when the credentials or the TLS certificates of the QueryConnector are in the secret.
+// The secrets without namespace are in the namespace of the QueryConnector
+func usesSecret(spec searchrulerv1alpha1.QueryConnectorSpec, connectorNamespace, namespace, name string) bool {
+	secretRefs := []struct{ name, namespace string }{
+		{spec.Credentials.SecretRef.Name, spec.Credentials.SecretRef.Namespace},
+		{spec.TlsSecretRef.Name, spec.TlsSecretRef.Namespace},
+	}
+	for _, secretRef := range secretRefs {
+		if secretRef.namespace == "" {
+			secretRef.namespace = connectorNamespace
+		}
+		if secretRef.name == name && secretRef.namespace == namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queryconnector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/globals"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+var _ = Describe("Sync", func() {
+
+	It("should evict the credentials, the HTTP client and the cached responses of a deleted QueryConnector", func() {
+		reconciler := &QueryConnectorReconciler{
+			CredentialsPool: &pools.CredentialsStore{Store: map[string]*pools.Credentials{}},
+			HttpClientsPool: &pools.HttpClientsStore{Store: map[string]*pools.HttpClient{}},
+			QueryCachePool:  &pools.QueryCacheStore{Store: map[string]*pools.QueryCacheEntry{}},
+		}
+		for _, connectorKey := range []string{"monitoring_elasticsearch", "monitoring_loki"} {
+			reconciler.CredentialsPool.Set(connectorKey, &pools.Credentials{Username: "admin"})
+			reconciler.HttpClientsPool.Set(connectorKey, &pools.HttpClient{Client: &http.Client{}})
+			reconciler.QueryCachePool.Set(pools.GetQueryCacheKey(connectorKey, "query"), []byte("{}"), time.Minute)
+		}
+
+		err := reconciler.Sync(context.Background(), watch.Deleted, &CompoundQueryConnectorResource{
+			QueryConnectorResource: &v1alpha1.QueryConnector{
+				ObjectMeta: metav1.ObjectMeta{Name: "elasticsearch", Namespace: "monitoring"},
+			},
+		}, controller.QueryConnectorResourceType)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, credsExist := reconciler.CredentialsPool.Get("monitoring_elasticsearch")
+		Expect(credsExist).To(BeFalse())
+		_, clientExists := reconciler.HttpClientsPool.Get("monitoring_elasticsearch")
+		Expect(clientExists).To(BeFalse())
+		_, responseExists := reconciler.QueryCachePool.Get(pools.GetQueryCacheKey("monitoring_elasticsearch", "query"))
+		Expect(responseExists).To(BeFalse())
+
+		_, clientExists = reconciler.HttpClientsPool.Get("monitoring_loki")
+		Expect(clientExists).To(BeTrue())
+		_, responseExists = reconciler.QueryCachePool.Get(pools.GetQueryCacheKey("monitoring_loki", "query"))
+		Expect(responseExists).To(BeTrue())
+	})
+})
+
+var _ = Describe("getSearchRules", func() {
+
+	var reconciler *QueryConnectorReconciler
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		searchRule := func(namespace, name string, ref v1alpha1.QueryConnectorRef) *v1alpha1.SearchRule {
+			return &v1alpha1.SearchRule{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Spec:       v1alpha1.SearchRuleSpec{QueryConnectorRef: ref},
+			}
+		}
+		clusterSearchRule := &v1alpha1.ClusterSearchRule{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster-errors"},
+			Spec:       v1alpha1.SearchRuleSpec{QueryConnectorRef: v1alpha1.QueryConnectorRef{Name: "elasticsearch"}},
+		}
+
+		reconciler = &QueryConnectorReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				searchRule("team-a", "errors", v1alpha1.QueryConnectorRef{Name: "elasticsearch", Namespace: "monitoring"}),
+				searchRule("team-b", "latency", v1alpha1.QueryConnectorRef{Name: "elasticsearch", Namespace: "monitoring"}),
+				searchRule("team-b", "other", v1alpha1.QueryConnectorRef{Name: "loki", Namespace: "monitoring"}),
+				searchRule("team-c", "cluster", v1alpha1.QueryConnectorRef{Name: "elasticsearch"}),
+				clusterSearchRule,
+			).Build(),
+			Scheme: scheme,
+		}
+	})
+
+	It("should return the rules referencing a QueryConnector from any namespace", func() {
+		searchRules, err := reconciler.getSearchRules(context.Background(), "monitoring", "elasticsearch")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(searchRules).To(Equal([]string{"team-a/errors", "team-b/latency"}))
+	})
+
+	It("should return the rules referencing a ClusterQueryConnector", func() {
+		searchRules, err := reconciler.getSearchRules(context.Background(), "", "elasticsearch")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(searchRules).To(Equal([]string{"cluster-errors", "team-c/cluster"}))
+	})
+
+	It("should return no rules for unused QueryConnectors", func() {
+		searchRules, err := reconciler.getSearchRules(context.Background(), "monitoring", "prometheus")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(searchRules).To(BeEmpty())
+	})
+})
+
+var _ = Describe("usesSecret", func() {
+
+	It("should match the credentials secret in the namespace of the QueryConnector", func() {
+		spec := v1alpha1.QueryConnectorSpec{}
+		spec.Credentials.SecretRef.Name = "elasticsearch-credentials"
+		Expect(usesSecret(spec, "monitoring", "monitoring", "elasticsearch-credentials")).To(BeTrue())
+		Expect(usesSecret(spec, "monitoring", "default", "elasticsearch-credentials")).To(BeFalse())
+	})
+
+	It("should match the TLS secret in the namespace of the reference", func() {
+		spec := v1alpha1.QueryConnectorSpec{}
+		spec.TlsSecretRef.Name = "elasticsearch-tls"
+		spec.TlsSecretRef.Namespace = "certificates"
+		Expect(usesSecret(spec, "", "certificates", "elasticsearch-tls")).To(BeTrue())
+		Expect(usesSecret(spec, "", "certificates", "elasticsearch-credentials")).To(BeFalse())
+	})
+})
+
+var _ = Describe("ReadyzCheck", func() {
+
+	var scheme *runtime.Scheme
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+	})
+
+	queryConnector := func(name string, conditions ...metav1.Condition) *v1alpha1.QueryConnector {
+		return &v1alpha1.QueryConnector{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "monitoring"},
+			Status:     v1alpha1.QueryConnectorStatus{Conditions: conditions},
+		}
+	}
+	synced := globals.NewCondition(globals.ConditionTypeResourceSynced, metav1.ConditionTrue,
+		globals.ConditionReasonTargetSynced, globals.ConditionReasonTargetSyncedMessage)
+	apiCallFailed := globals.NewCondition(globals.ConditionTypeResourceSynced, metav1.ConditionTrue,
+		globals.ConditionReasonKubernetesApiCallErrorType, globals.ConditionReasonKubernetesApiCallErrorMessage)
+	unreachable := globals.NewCondition(globals.ConditionTypeReachable, metav1.ConditionFalse,
+		globals.ConditionReasonProbeFailedType, "connection refused")
+
+	It("should not be ready without connectors synced and reachable", func() {
+		reconciler := &QueryConnectorReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				queryConnector("new"),
+				queryConnector("failing", apiCallFailed),
+				queryConnector("unreachable", synced, unreachable),
+			).Build(),
+		}
+		Expect(reconciler.ReadyzCheck(httptest.NewRequest("GET", "/readyz", nil))).To(HaveOccurred())
+	})
+
+	It("should keep ready once a connector is synced", func() {
+		connector := queryConnector("elasticsearch", synced)
+		fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(connector).Build()
+		reconciler := &QueryConnectorReconciler{Client: fakeClient}
+		Expect(reconciler.ReadyzCheck(httptest.NewRequest("GET", "/readyz", nil))).To(Succeed())
+
+		Expect(fakeClient.Delete(context.Background(), connector)).To(Succeed())
+		Expect(reconciler.ReadyzCheck(httptest.NewRequest("GET", "/readyz", nil))).To(Succeed())
+	})
+
+	It("should be ready with a ClusterQueryConnector synced", func() {
+		reconciler := &QueryConnectorReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1alpha1.ClusterQueryConnector{
+				ObjectMeta: metav1.ObjectMeta{Name: "elasticsearch"},
+				Status:     v1alpha1.QueryConnectorStatus{Conditions: []metav1.Condition{synced}},
+			}).Build(),
+		}
+		Expect(reconciler.ReadyzCheck(httptest.NewRequest("GET", "/readyz", nil))).To(Succeed())
+	})
+})
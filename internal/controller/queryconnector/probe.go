@@ -0,0 +1,103 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queryconnector
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/globals"
+	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/template"
+)
+
+const (
+	// Timeout of the connectivity probe to the backend
+	probeTimeout = 5 * time.Second
+)
+
+// validateURL checks that the URL of the QueryConnector is a well-formed http(s) URL
+func validateURL(rawURL string) error {
+	err := globals.ValidateURL(rawURL)
+	if err != nil {
+		return fmt.Errorf(controller.InvalidUrlErrorMessage, rawURL, err.Error())
+	}
+	return nil
+}
+
+// probeConnectivity executes a request to the root of the backend of the QueryConnector with its TLS
+// configuration and credentials. Any response below 500 means the backend is reachable
+func probeConnectivity(connectorSpec v1alpha1.QueryConnectorSpec, credentials *pools.Credentials) error {
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: connectorSpec.TlsSkipVerify && credentials.RootCAs == nil,
+		RootCAs:            credentials.RootCAs,
+	}
+	if credentials.TlsCertificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*credentials.TlsCertificate}
+	}
+	proxy, err := globals.GetProxy(connectorSpec.Proxy)
+	if err != nil {
+		return fmt.Errorf(controller.ProxyUrlParseErrorMessage, connectorSpec.Proxy, err)
+	}
+	httpClient := &http.Client{
+		Timeout: probeTimeout,
+		Transport: globals.NewUserAgentTransport(&http.Transport{
+			Proxy:           proxy,
+			TLSClientConfig: tlsConfig,
+		}, connectorSpec.UserAgent),
+	}
+
+	req, err := http.NewRequest(http.MethodGet, connectorSpec.URL, nil)
+	if err != nil {
+		return fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
+	}
+
+	// Headers are evaluated without a rule, so just the environment and the current time are available in them
+	headers, err := template.EvaluateHeaders(connectorSpec.Headers, map[string]interface{}{"now": time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf(controller.EvaluateTemplateErrorMessage, err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	switch {
+	case credentials.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+credentials.BearerToken)
+	case credentials.ApiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+credentials.ApiKey)
+	case credentials.Username != "":
+		req.SetBasicAuth(credentials.Username, credentials.Password)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf(controller.HttpRequestSendingErrorMessage, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf(controller.HttpResponseErrorMessage, connectorSpec.URL, resp.Status)
+	}
+
+	return nil
+}
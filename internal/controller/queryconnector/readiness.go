@@ -0,0 +1,76 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queryconnector
+
+import (
+	"errors"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	//
+	searchrulerv1alpha1 "prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/globals"
+)
+
+// isConnectorReady returns true when the QueryConnector was synced and its backend was not reported as unreachable
+// by the connectivity probe. Connectors without probe are ready once synced
+func isConnectorReady(conditions []metav1.Condition) bool {
+	synced := meta.FindStatusCondition(conditions, globals.ConditionTypeResourceSynced)
+	if synced == nil || synced.Status != metav1.ConditionTrue || synced.Reason != globals.ConditionReasonTargetSynced {
+		return false
+	}
+	return !meta.IsStatusConditionFalse(conditions, globals.ConditionTypeReachable)
+}
+
+// ReadyzCheck is a healthz.Checker reporting not-ready until at least one QueryConnector or ClusterQueryConnector
+// is ready, so rollouts do not cut over to an instance unable to query any backend. The status of the connectors
+// is read from the cache, so every replica reports it, not only the leader. Once ready, it keeps ready, so
+// a backend going down later does not remove the webhooks of the controller from the service
+func (r *QueryConnectorReconciler) ReadyzCheck(req *http.Request) error {
+	if r.connectorReady.Load() {
+		return nil
+	}
+
+	queryConnectorList := &searchrulerv1alpha1.QueryConnectorList{}
+	err := r.List(req.Context(), queryConnectorList)
+	if err != nil {
+		return err
+	}
+	for _, queryConnector := range queryConnectorList.Items {
+		if isConnectorReady(queryConnector.Status.Conditions) {
+			r.connectorReady.Store(true)
+			return nil
+		}
+	}
+
+	clusterQueryConnectorList := &searchrulerv1alpha1.ClusterQueryConnectorList{}
+	err = r.List(req.Context(), clusterQueryConnectorList)
+	if err != nil {
+		return err
+	}
+	for _, clusterQueryConnector := range clusterQueryConnectorList.Items {
+		if isConnectorReady(clusterQueryConnector.Status.Conditions) {
+			r.connectorReady.Store(true)
+			return nil
+		}
+	}
+
+	return errors.New(controller.NoQueryConnectorReadyErrorMessage)
+}
@@ -87,3 +87,143 @@ func (r *QueryConnectorReconciler) UpdateConditionNoCredsFound(resource *Compoun
 		globals.UpdateCondition(&resource.QueryConnectorResource.Status.Conditions, condition)
 	}
 }
+
+// UpdateConditionInvalidCredentials updates the status of the resource with an InvalidCredentials condition
+func (r *QueryConnectorReconciler) UpdateConditionInvalidCredentials(resource *CompoundQueryConnectorResource, resourceType string) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonInvalidCredentialsType, globals.ConditionReasonInvalidCredentialsMessage)
+
+	// Update the status of the QueryConnector resource
+	switch resourceType {
+	case controller.ClusterQueryConnectorResourceType:
+		globals.UpdateCondition(&resource.ClusterQueryConnectorResource.Status.Conditions, condition)
+	default:
+		globals.UpdateCondition(&resource.QueryConnectorResource.Status.Conditions, condition)
+	}
+}
+
+// UpdateConditionInvalidTls updates the status of the resource with an InvalidTls condition
+func (r *QueryConnectorReconciler) UpdateConditionInvalidTls(resource *CompoundQueryConnectorResource, resourceType string) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonInvalidTlsType, globals.ConditionReasonInvalidTlsMessage)
+
+	// Update the status of the QueryConnector resource
+	switch resourceType {
+	case controller.ClusterQueryConnectorResourceType:
+		globals.UpdateCondition(&resource.ClusterQueryConnectorResource.Status.Conditions, condition)
+	default:
+		globals.UpdateCondition(&resource.QueryConnectorResource.Status.Conditions, condition)
+	}
+}
+
+// UpdateConditionNoWarnings updates the status of the resource with a NoWarnings condition
+func (r *QueryConnectorReconciler) UpdateConditionNoWarnings(resource *CompoundQueryConnectorResource, resourceType string) {
+
+	// Create the new condition with the warning status
+	condition := globals.NewCondition(globals.ConditionTypeWarning, metav1.ConditionFalse,
+		globals.ConditionReasonNoWarningsType, globals.ConditionReasonNoWarningsMessage)
+
+	// Update the status of the QueryConnector resource
+	switch resourceType {
+	case controller.ClusterQueryConnectorResourceType:
+		globals.UpdateCondition(&resource.ClusterQueryConnectorResource.Status.Conditions, condition)
+	default:
+		globals.UpdateCondition(&resource.QueryConnectorResource.Status.Conditions, condition)
+	}
+}
+
+// UpdateConditionTlsSkipVerifyIgnored updates the status of the resource with a TlsSkipVerifyIgnored warning condition
+func (r *QueryConnectorReconciler) UpdateConditionTlsSkipVerifyIgnored(resource *CompoundQueryConnectorResource, resourceType string) {
+
+	// Create the new condition with the warning status
+	condition := globals.NewCondition(globals.ConditionTypeWarning, metav1.ConditionTrue,
+		globals.ConditionReasonTlsSkipVerifyIgnoredType, globals.ConditionReasonTlsSkipVerifyIgnoredMessage)
+
+	// Update the status of the QueryConnector resource
+	switch resourceType {
+	case controller.ClusterQueryConnectorResourceType:
+		globals.UpdateCondition(&resource.ClusterQueryConnectorResource.Status.Conditions, condition)
+	default:
+		globals.UpdateCondition(&resource.QueryConnectorResource.Status.Conditions, condition)
+	}
+}
+
+// UpdateConditionInvalidUrl updates the status of the resource with an InvalidUrl condition
+func (r *QueryConnectorReconciler) UpdateConditionInvalidUrl(resource *CompoundQueryConnectorResource, resourceType string) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonInvalidUrlType, globals.ConditionReasonInvalidUrlMessage)
+
+	// Update the status of the QueryConnector resource
+	switch resourceType {
+	case controller.ClusterQueryConnectorResourceType:
+		globals.UpdateCondition(&resource.ClusterQueryConnectorResource.Status.Conditions, condition)
+	default:
+		globals.UpdateCondition(&resource.QueryConnectorResource.Status.Conditions, condition)
+	}
+}
+
+// UpdateConditionProbeSucceeded updates the status of the resource with a Reachable condition
+func (r *QueryConnectorReconciler) UpdateConditionProbeSucceeded(resource *CompoundQueryConnectorResource, resourceType string) {
+
+	// Create the new condition with the success status
+	condition := globals.NewCondition(globals.ConditionTypeReachable, metav1.ConditionTrue,
+		globals.ConditionReasonProbeSucceededType, globals.ConditionReasonProbeSucceededMessage)
+
+	// Update the status of the QueryConnector resource
+	switch resourceType {
+	case controller.ClusterQueryConnectorResourceType:
+		globals.UpdateCondition(&resource.ClusterQueryConnectorResource.Status.Conditions, condition)
+	default:
+		globals.UpdateCondition(&resource.QueryConnectorResource.Status.Conditions, condition)
+	}
+}
+
+// UpdateConditionProbeFailed updates the status of the resource with a not Reachable condition including the error of the probe
+func (r *QueryConnectorReconciler) UpdateConditionProbeFailed(resource *CompoundQueryConnectorResource, resourceType string, probeErr error) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeReachable, metav1.ConditionFalse,
+		globals.ConditionReasonProbeFailedType, probeErr.Error())
+
+	// Update the status of the QueryConnector resource
+	switch resourceType {
+	case controller.ClusterQueryConnectorResourceType:
+		globals.UpdateCondition(&resource.ClusterQueryConnectorResource.Status.Conditions, condition)
+	default:
+		globals.UpdateCondition(&resource.QueryConnectorResource.Status.Conditions, condition)
+	}
+}
+
+// UpdateConditionInUse updates the status of the resource with an InUse condition, as its deletion is waiting
+// for the rules referencing it to be removed
+func (r *QueryConnectorReconciler) UpdateConditionInUse(resource *CompoundQueryConnectorResource, resourceType string) {
+
+	// Create the new condition with the in use status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonInUseType, globals.ConditionReasonInUseMessage)
+
+	// Update the status of the QueryConnector resource
+	switch resourceType {
+	case controller.ClusterQueryConnectorResourceType:
+		globals.UpdateCondition(&resource.ClusterQueryConnectorResource.Status.Conditions, condition)
+	default:
+		globals.UpdateCondition(&resource.QueryConnectorResource.Status.Conditions, condition)
+	}
+}
+
+// UpdateSearchRules updates the status of the resource with the rules referencing it
+func (r *QueryConnectorReconciler) UpdateSearchRules(resource *CompoundQueryConnectorResource, resourceType string, searchRules []string) {
+
+	switch resourceType {
+	case controller.ClusterQueryConnectorResourceType:
+		resource.ClusterQueryConnectorResource.Status.SearchRules = searchRules
+	default:
+		resource.QueryConnectorResource.Status.SearchRules = searchRules
+	}
+}
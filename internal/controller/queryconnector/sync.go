@@ -18,16 +18,21 @@ package queryconnector
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"reflect"
 
 	//
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	//
 	"prosimcorp.com/SearchRuler/api/v1alpha1"
 	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/globals"
 	"prosimcorp.com/SearchRuler/internal/pools"
 )
 
@@ -38,9 +43,11 @@ var (
 )
 
 // Sync function is used to synchronize the QueryConnector resource with the credentials. Adds the credentials to the
-// credentials pool to be used in SearchRule resources. Just executed when the resource has a secretRef defined.
+// credentials pool to be used in SearchRule resources, with the TLS certificates and CA bundle if defined.
 func (r *QueryConnectorReconciler) Sync(ctx context.Context, eventType watch.EventType, resource *CompoundQueryConnectorResource, resourceType string) (err error) {
 
+	logger := log.FromContext(ctx)
+
 	// Get the resource values depending on the resourceType
 	switch resourceType {
 	case controller.ClusterQueryConnectorResourceType:
@@ -53,26 +60,122 @@ func (r *QueryConnectorReconciler) Sync(ctx context.Context, eventType watch.Eve
 		resourceSpec = resource.QueryConnectorResource.Spec
 	}
 
-	// If the eventType is Deleted, remove the credentials from the pool
+	// If the eventType is Deleted, remove the credentials, the HTTP client and the cached responses from the pools
 	// In other cases get the credentials from the secret and add them to the pool
 	if eventType == watch.Deleted {
-		credentialsKey := fmt.Sprintf("%s_%s", resourceNamespace, resourceName)
-		r.CredentialsPool.Delete(credentialsKey)
+		connectorKey := pools.GetKey(resourceNamespace, resourceName)
+		r.CredentialsPool.Delete(connectorKey)
+		if httpClient, clientExists := r.HttpClientsPool.Get(connectorKey); clientExists {
+			httpClient.Client.CloseIdleConnections()
+			r.HttpClientsPool.Delete(connectorKey)
+		}
+		r.QueryCachePool.DeleteConnector(connectorKey)
 		return nil
 	}
 
+	// Check the URL of the QueryConnector before using it in any SearchRule
+	err = validateURL(resourceSpec.URL)
+	if err != nil {
+		r.UpdateConditionInvalidUrl(resource, resourceType)
+		return err
+	}
+	_, err = globals.GetProxy(resourceSpec.Proxy)
+	if err != nil {
+		r.UpdateConditionInvalidUrl(resource, resourceType)
+		return fmt.Errorf(controller.ProxyUrlParseErrorMessage, resourceSpec.Proxy, err)
+	}
+
+	credentials := &pools.Credentials{}
+
+	// Get the authentication credentials from the secret when defined
+	if !reflect.ValueOf(resourceSpec.Credentials).IsZero() {
+		err = r.getSecretCredentials(ctx, resource, resourceType, credentials)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Get the TLS client certificate and CA from the secret when defined
+	if !reflect.ValueOf(resourceSpec.TlsSecretRef).IsZero() {
+		err = r.getSecretTls(ctx, resource, resourceType, credentials)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Load the inline CA bundle when defined. It is added to the CA bundle of the secret if any
+	if resourceSpec.CaBundle != "" {
+		if credentials.RootCAs == nil {
+			credentials.RootCAs = x509.NewCertPool()
+		}
+		if !credentials.RootCAs.AppendCertsFromPEM([]byte(resourceSpec.CaBundle)) {
+			r.UpdateConditionInvalidTls(resource, resourceType)
+			return fmt.Errorf(controller.TlsInlineCABundleErrorMessage, fmt.Sprintf("%s/%s", resourceNamespace, resourceName))
+		}
+		credentials.RootCAsPEM = append(credentials.RootCAsPEM, []byte(resourceSpec.CaBundle)...)
+	}
+
+	// When a CA bundle is defined, the server certificate is always verified. Warn the user
+	// when tlsSkipVerify is also set because it is ignored
+	r.UpdateConditionNoWarnings(resource, resourceType)
+	if credentials.RootCAs != nil && resourceSpec.TlsSkipVerify {
+		r.UpdateConditionTlsSkipVerifyIgnored(resource, resourceType)
+	}
+
+	// Save credentials in the credentials pool
+	key := pools.GetKey(resourceNamespace, resourceName)
+	r.CredentialsPool.Set(key, credentials)
+
+	// Probe the connectivity to the backend when enabled. The result is just informative in the
+	// status of the QueryConnector, so it does not fail the synchronization
+	if resourceSpec.Probe {
+		err = probeConnectivity(resourceSpec, credentials)
+		if err != nil {
+			logger.Info("Connectivity probe failed", "connector", resourceName, "error", err.Error())
+			r.UpdateConditionProbeFailed(resource, resourceType, err)
+		} else {
+			r.UpdateConditionProbeSucceeded(resource, resourceType)
+		}
+	}
+
+	// Updates status to Success
+	r.UpdateStateSuccess(resource, resourceType)
+	return nil
+}
+
+// getSecretCredentials gets the authentication credentials of the QueryConnector from the secret associated
+func (r *QueryConnectorReconciler) getSecretCredentials(ctx context.Context, resource *CompoundQueryConnectorResource, resourceType string, credentials *pools.Credentials) (err error) {
+
 	// Get credentials for the queryConnector in the secret associated
 	// First get secret with the credentials. The secret must be in the same
 	// namespace as the QueryConnector resource.
 	QueryConnectorCredsSecret := &v1.Secret{}
-	secretNamespace := resourceSpec.Credentials.SecretRef.Namespace
+	secretRef := resourceSpec.Credentials.SecretRef
+	secretNamespace := secretRef.Namespace
 	if secretNamespace == "" {
 		secretNamespace = resourceNamespace
 	}
 	namespacedName := types.NamespacedName{
 		Namespace: secretNamespace,
-		Name:      resourceSpec.Credentials.SecretRef.Name,
+		Name:      secretRef.Name,
 	}
+
+	// Basic auth, bearer token and api key are mutually exclusive
+	authMethods := 0
+	for _, defined := range []bool{
+		secretRef.KeyUsername != "" || secretRef.KeyPassword != "",
+		secretRef.KeyBearerToken != "",
+		secretRef.KeyApiKey != "",
+	} {
+		if defined {
+			authMethods++
+		}
+	}
+	if authMethods > 1 {
+		r.UpdateConditionInvalidCredentials(resource, resourceType)
+		return fmt.Errorf(controller.CredentialsConflictErrorMessage, namespacedName)
+	}
+
 	err = r.Get(ctx, namespacedName, QueryConnectorCredsSecret)
 	if err != nil {
 		// Updates status to NoCredsFound
@@ -80,25 +183,102 @@ func (r *QueryConnectorReconciler) Sync(ctx context.Context, eventType watch.Eve
 		return fmt.Errorf(controller.SecretNotFoundErrorMessage, namespacedName, err)
 	}
 
-	// Get username and password from the secret data
-	username := string(QueryConnectorCredsSecret.Data[resourceSpec.Credentials.SecretRef.KeyUsername])
-	password := string(QueryConnectorCredsSecret.Data[resourceSpec.Credentials.SecretRef.KeyPassword])
+	// Get the bearer token from the secret data when defined
+	if secretRef.KeyBearerToken != "" {
+		credentials.BearerToken = string(QueryConnectorCredsSecret.Data[secretRef.KeyBearerToken])
 
-	// If username or password are empty, return an error
-	if username == "" || password == "" {
+		// If the token is empty, return an error
+		if credentials.BearerToken == "" {
+			// Updates status to NoCredsFound
+			r.UpdateConditionNoCredsFound(resource, resourceType)
+			return fmt.Errorf(controller.MissingCredentialsMessage, namespacedName)
+		}
+	}
+
+	// Get the api key from the secret data when defined
+	if secretRef.KeyApiKey != "" {
+		credentials.ApiKey = string(QueryConnectorCredsSecret.Data[secretRef.KeyApiKey])
+
+		// If the api key is empty, return an error
+		if credentials.ApiKey == "" {
+			// Updates status to NoCredsFound
+			r.UpdateConditionNoCredsFound(resource, resourceType)
+			return fmt.Errorf(controller.MissingCredentialsMessage, namespacedName)
+		}
+	}
+
+	// Get username and password from the secret data in other case
+	if secretRef.KeyBearerToken == "" && secretRef.KeyApiKey == "" {
+		credentials.Username = string(QueryConnectorCredsSecret.Data[secretRef.KeyUsername])
+		credentials.Password = string(QueryConnectorCredsSecret.Data[secretRef.KeyPassword])
+
+		// If username or password are empty, return an error
+		if credentials.Username == "" || credentials.Password == "" {
+			// Updates status to NoCredsFound
+			r.UpdateConditionNoCredsFound(resource, resourceType)
+			return fmt.Errorf(controller.MissingCredentialsMessage, namespacedName)
+		}
+	}
+
+	return nil
+}
+
+// getSecretTls gets the TLS client certificate and the CA bundle of the QueryConnector from the secret associated
+func (r *QueryConnectorReconciler) getSecretTls(ctx context.Context, resource *CompoundQueryConnectorResource, resourceType string, credentials *pools.Credentials) (err error) {
+
+	// Get the secret with the certificates. When the namespace is not defined, the secret must be
+	// in the same namespace as the QueryConnector resource.
+	QueryConnectorTlsSecret := &v1.Secret{}
+	tlsSecretRef := resourceSpec.TlsSecretRef
+	secretNamespace := tlsSecretRef.Namespace
+	if secretNamespace == "" {
+		secretNamespace = resourceNamespace
+	}
+	namespacedName := types.NamespacedName{
+		Namespace: secretNamespace,
+		Name:      tlsSecretRef.Name,
+	}
+	err = r.Get(ctx, namespacedName, QueryConnectorTlsSecret)
+	if err != nil {
 		// Updates status to NoCredsFound
 		r.UpdateConditionNoCredsFound(resource, resourceType)
-		return fmt.Errorf(controller.MissingCredentialsMessage, namespacedName)
+		return fmt.Errorf(controller.SecretNotFoundErrorMessage, namespacedName, err)
 	}
 
-	// Save credentials in the credentials pool
-	key := fmt.Sprintf("%s_%s", resourceNamespace, resourceName)
-	r.CredentialsPool.Set(key, &pools.Credentials{
-		Username: username,
-		Password: password,
-	})
+	// Get the client certificate and key from the secret data. Default keys are the
+	// ones used in kubernetes.io/tls secrets
+	keyCert := tlsSecretRef.KeyCert
+	if keyCert == "" {
+		keyCert = v1.TLSCertKey
+	}
+	keyKey := tlsSecretRef.KeyKey
+	if keyKey == "" {
+		keyKey = v1.TLSPrivateKeyKey
+	}
+	clientCert := QueryConnectorTlsSecret.Data[keyCert]
+	clientKey := QueryConnectorTlsSecret.Data[keyKey]
+
+	// Load the client certificate when both certificate and key are present in the secret
+	if len(clientCert) > 0 || len(clientKey) > 0 {
+		certificate, err := tls.X509KeyPair(clientCert, clientKey)
+		if err != nil {
+			r.UpdateConditionInvalidTls(resource, resourceType)
+			return fmt.Errorf(controller.TlsClientCertificateErrorMessage, namespacedName, err)
+		}
+		credentials.TlsCertificate = &certificate
+	}
+
+	// Load the CA bundle when defined
+	if tlsSecretRef.KeyCA != "" {
+		caBundle := QueryConnectorTlsSecret.Data[tlsSecretRef.KeyCA]
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			r.UpdateConditionInvalidTls(resource, resourceType)
+			return fmt.Errorf(controller.TlsCABundleErrorMessage, namespacedName)
+		}
+		credentials.RootCAs = rootCAs
+		credentials.RootCAsPEM = caBundle
+	}
 
-	// Updates status to Success
-	r.UpdateStateSuccess(resource, resourceType)
 	return nil
 }
@@ -0,0 +1,167 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	//
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/validators"
+)
+
+const (
+
+	// Alertmanager API path to push alerts. It is appended to the Alertmanager URL
+	alertmanagerAlertsPath = "/api/v2/alerts"
+)
+
+// getAlertmanagerSender returns the sender for the Alertmanager integration. The alerts are pushed to
+// the Alertmanager API, so they are routed by the existing Alertmanager configuration
+func (r *RulerActionReconciler) getAlertmanagerSender(ctx context.Context, resource *CompoundRulerActionResource, resourceType string) (notificationSender, error) {
+
+	action := getRulerAction(resource, resourceType)
+
+	// Get credentials for Alertmanager in the secret associated if defined
+	username := ""
+	password := ""
+	if !reflect.ValueOf(action.spec.Alertmanager.Credentials).IsZero() {
+		secretRef := action.spec.Alertmanager.Credentials.SecretRef
+		alertmanagerSecret, err := r.getSecret(ctx, resource, resourceType, secretRef)
+		if err != nil {
+			return nil, err
+		}
+
+		// Get username and password
+		username = string(alertmanagerSecret.Data[secretRef.KeyUsername])
+		password = string(alertmanagerSecret.Data[secretRef.KeyPassword])
+		if username == "" || password == "" {
+			r.UpdateConditionNoCredsFound(resource, resourceType)
+			return nil, fmt.Errorf(controller.MissingCredentialsMessage, secretRef.Name)
+		}
+	}
+
+	httpClient, err := getHttpClient(action.spec, &tls.Config{
+		InsecureSkipVerify: action.spec.Alertmanager.TlsSkipVerify,
+	})
+	if err != nil {
+		return nil, err
+	}
+	alertsUrl := strings.TrimSuffix(action.spec.Alertmanager.Url, "/") + alertmanagerAlertsPath
+	headers := action.spec.Alertmanager.Headers
+
+	return func(ctx context.Context, notification *notification, payload []byte) error {
+		body, err := json.Marshal(getAlertmanagerAlerts(notification, string(payload)))
+		if err != nil {
+			return fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+		}
+		return sendAlertmanagerRequest(ctx, httpClient, alertsUrl, headers, username, password, body)
+	}, nil
+}
+
+// getAlertmanagerAlerts returns the Alertmanager alerts of the notification, one per SearchRule. Resolved
+// alerts are sent with endsAt, so Alertmanager resolves them. The evaluated template of the notification
+// is sent in the summary annotation, unless it is defined in the annotations of the SearchRule
+func getAlertmanagerAlerts(notification *notification, summary string) validators.AlertmanagerAlertList {
+
+	alerts := validators.AlertmanagerAlertList{}
+	for _, alert := range notification.alerts {
+
+		// Alertmanager identifies the alerts by their labels, so they must not change between
+		// the firing and the resolved notifications
+		labels := map[string]string{}
+		for key, value := range alert.Labels {
+			labels[key] = value
+		}
+		labels["alertname"] = alert.SearchRule.Name
+		if alert.SearchRule.Namespace != "" {
+			labels["namespace"] = alert.SearchRule.Namespace
+		}
+		if alert.Severity != "" {
+			labels["severity"] = alert.Severity
+		}
+		if team := alert.SearchRule.Labels[controller.TeamLabel]; team != "" && labels["team"] == "" {
+			labels["team"] = team
+		}
+
+		annotations := map[string]string{}
+		if alert.SearchRule.Spec.Description != "" {
+			annotations["description"] = alert.SearchRule.Spec.Description
+		}
+		if summary != "" {
+			annotations["summary"] = summary
+		}
+		for key, value := range alert.Annotations {
+			annotations[key] = value
+		}
+
+		alertmanagerAlert := validators.AlertmanagerAlert{
+			Labels:       labels,
+			Annotations:  annotations,
+			StartsAt:     alert.FiringTime.Format(time.RFC3339),
+			GeneratorUrl: alert.ConnectorURL,
+		}
+		if alert.Status == pools.AlertStatusResolved {
+			alertmanagerAlert.EndsAt = alert.ResolvedTime.Format(time.RFC3339)
+		}
+		alerts = append(alerts, alertmanagerAlert)
+	}
+
+	return alerts
+}
+
+// sendAlertmanagerRequest pushes the alerts to the Alertmanager API with the headers of the integration
+func sendAlertmanagerRequest(ctx context.Context, httpClient *http.Client, requestUrl string, headers map[string]string,
+	username, password string, payload []byte) error {
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, requestUrl, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
+	}
+
+	// Add headers to the request if set
+	httpRequest.Header.Set("Content-Type", "application/json")
+	for headerKey, headerValue := range headers {
+		httpRequest.Header.Set(headerKey, headerValue)
+	}
+
+	// Add authentication if set for Alertmanager
+	if username != "" && password != "" {
+		httpRequest.SetBasicAuth(username, password)
+	}
+
+	httpResponse, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf(controller.HttpRequestSendingErrorMessage, err)
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf(controller.HttpResponseErrorMessage, requestUrl, httpResponse.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"time"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+)
+
+const (
+	// States of the circuit breaker of a RulerAction
+	circuitBreakerClosed   = "Closed"
+	circuitBreakerOpen     = "Open"
+	circuitBreakerHalfOpen = "HalfOpen"
+
+	// Default time the deliveries are skipped once the circuit breaker is open
+	circuitBreakerDefaultCooldown = time.Minute
+)
+
+// circuitBreaker is the state of the deliveries of a RulerAction
+type circuitBreaker struct {
+	state               string
+	consecutiveFailures int
+
+	// retryAt is the time the open circuit breaker tests the recovery of the integration
+	retryAt time.Time
+}
+
+// isCircuitBreakerEnabled returns whether the circuit breaker is configured in the RulerAction
+func isCircuitBreakerEnabled(circuitBreakerSpec v1alpha1.CircuitBreaker) bool {
+	return circuitBreakerSpec.FailureThreshold > 0
+}
+
+// getCircuitBreakerCooldown returns the time the deliveries are skipped once the circuit breaker is open
+func getCircuitBreakerCooldown(circuitBreakerSpec v1alpha1.CircuitBreaker) (time.Duration, error) {
+	if circuitBreakerSpec.Cooldown == "" {
+		return circuitBreakerDefaultCooldown, nil
+	}
+	return time.ParseDuration(circuitBreakerSpec.Cooldown)
+}
+
+// checkCircuitBreaker returns the circuit breaker of the RulerAction before the deliveries. Open circuit
+// breakers are half-open once their cooldown expires, so the next delivery tests the recovery
+func (r *RulerActionReconciler) checkCircuitBreaker(breakerKey string, now time.Time) circuitBreaker {
+	r.breakersMutex.Lock()
+	defer r.breakersMutex.Unlock()
+
+	breaker, breakerExists := r.circuitBreakers[breakerKey]
+	if !breakerExists {
+		return circuitBreaker{state: circuitBreakerClosed}
+	}
+	if breaker.state == circuitBreakerOpen && !now.Before(breaker.retryAt) {
+		breaker.state = circuitBreakerHalfOpen
+	}
+	return *breaker
+}
+
+// recordDeliveries updates the circuit breaker of the RulerAction with the result of the deliveries. Any
+// delivered notification closes it. Failed ones open it once the failures in a row reach the failureThreshold,
+// or right away when the circuit breaker is half-open, as the integration did not recover
+func (r *RulerActionReconciler) recordDeliveries(breakerKey string, failureThreshold, delivered, failed int,
+	cooldown time.Duration, now time.Time) circuitBreaker {
+
+	r.breakersMutex.Lock()
+	defer r.breakersMutex.Unlock()
+
+	if r.circuitBreakers == nil {
+		r.circuitBreakers = map[string]*circuitBreaker{}
+	}
+	breaker, breakerExists := r.circuitBreakers[breakerKey]
+	if !breakerExists {
+		breaker = &circuitBreaker{state: circuitBreakerClosed}
+		r.circuitBreakers[breakerKey] = breaker
+	}
+
+	switch {
+	case delivered > 0:
+		breaker.state = circuitBreakerClosed
+		breaker.consecutiveFailures = 0
+	case failed > 0:
+		breaker.consecutiveFailures += failed
+		if breaker.state == circuitBreakerHalfOpen ||
+			breaker.consecutiveFailures >= failureThreshold {
+			breaker.state = circuitBreakerOpen
+			breaker.retryAt = now.Add(cooldown)
+		}
+	}
+	return *breaker
+}
+
+// getCircuitBreakerRetry returns the time until the open circuit breaker of the RulerAction tests the recovery
+// of the integration. It is 0 when the circuit breaker is not open
+func (r *RulerActionReconciler) getCircuitBreakerRetry(breakerKey string, now time.Time) time.Duration {
+	r.breakersMutex.Lock()
+	defer r.breakersMutex.Unlock()
+
+	breaker, breakerExists := r.circuitBreakers[breakerKey]
+	if !breakerExists || breaker.state != circuitBreakerOpen || !now.Before(breaker.retryAt) {
+		return 0
+	}
+	return breaker.retryAt.Sub(now)
+}
+
+// forgetCircuitBreaker removes the circuit breaker of the RulerAction, when it is deleted or the
+// circuit breaker is not configured anymore
+func (r *RulerActionReconciler) forgetCircuitBreaker(breakerKey string) {
+	r.breakersMutex.Lock()
+	defer r.breakersMutex.Unlock()
+	delete(r.circuitBreakers, breakerKey)
+}
@@ -19,6 +19,11 @@ package ruleraction
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -36,6 +41,7 @@ import (
 	"prosimcorp.com/SearchRuler/internal/controller"
 	"prosimcorp.com/SearchRuler/internal/globals"
 	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/tracing"
 )
 
 // RulerActionReconciler reconciles a RulerAction object
@@ -43,6 +49,36 @@ type RulerActionReconciler struct {
 	client.Client
 	Scheme     *runtime.Scheme
 	AlertsPool *pools.AlertsStore
+
+	// notifiedGroups stores the last time every group of alerts was notified
+	groupsMutex    sync.Mutex
+	notifiedGroups map[string]time.Time
+
+	// notifiedAlerts stores the last time every firing alert was notified
+	alertsMutex    sync.Mutex
+	notifiedAlerts map[string]time.Time
+
+	// ShutdownGracePeriod is the time given to deliver the pending alerts on shutdown. 0 disables the delivery
+	ShutdownGracePeriod time.Duration
+
+	// StateNamespace is the namespace where the state of the pools is saved on shutdown.
+	// Empty disables saving it
+	StateNamespace string
+	restoreOnce    sync.Once
+
+	// RulesPool is saved with the alerts on shutdown, so the timers of the rules survive the restart
+	RulesPool *pools.RulesStore
+
+	// StateRestored is closed once the state saved on the last shutdown is restored
+	StateRestored chan struct{}
+
+	// ControllerNamespace is the namespace of the Silences muting the alerts of the ClusterSearchRules.
+	// Empty disables silencing them
+	ControllerNamespace string
+
+	// circuitBreakers stores the state of the deliveries of every RulerAction with a circuit breaker
+	breakersMutex   sync.Mutex
+	circuitBreakers map[string]*circuitBreaker
 }
 
 type CompoundRulerActionResource struct {
@@ -60,8 +96,12 @@ var (
 // +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=ruleractions/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=ruleractions/finalizers,verbs=update
 
+// +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=searchrules;clustersearchrules,verbs=get;list;watch
+// +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=silences,verbs=get;list;watch
+
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;update;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -72,6 +112,16 @@ func (r *RulerActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	logger := log.FromContext(ctx)
 
+	// Trace the reconcile. The span is the parent of the notifications sent to the integrations
+	ctx, span := tracing.Start(ctx, "RulerAction.Reconcile", trace.WithAttributes(
+		attribute.String("searchruler.namespace", req.Namespace),
+		attribute.String("searchruler.name", req.Name),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	// Restore the state saved on the last shutdown before sending the first notifications
+	r.restoreStateOnce(ctx)
+
 	// 1. Get the content of the Patch
 	CompoundRulerActionResource := &CompoundRulerActionResource{
 		RulerActionResource:        &searchrulerv1alpha1.RulerAction{},
@@ -100,6 +150,7 @@ func (r *RulerActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 		// 2.1 It does NOT exist: manage removal
 		if err = client.IgnoreNotFound(err); err == nil {
+			r.forgetCircuitBreaker(pools.GetKey(req.Namespace, req.Name))
 			logger.Info(fmt.Sprintf(controller.ResourceNotFoundError, controller.RulerActionResourceType, req.NamespacedName))
 			return result, err
 		}
@@ -168,7 +219,11 @@ func (r *RulerActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}()
 
-	// 6. Schedule periodical request
+	// 6. Send the test notification requested with the test-notification annotation. Changes of the annotation
+	// trigger the reconcile, and the value is acknowledged in the status once it is sent
+	r.checkTestNotification(ctx, CompoundRulerActionResource, resourceType)
+
+	// 7. Schedule periodical request
 	// if !triggeredByEvent {
 	// 	RequeueTime, err := time.ParseDuration(RulerActionResource.Spec.FiringInterval)
 	// 	if err != nil {
@@ -180,16 +235,22 @@ func (r *RulerActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// 	}
 	// }
 
-	// 7. Sync credentials if defined
+	// 8. Sync credentials if defined
 processEvent:
 	err = r.Sync(ctx, CompoundRulerActionResource, resourceType)
+
+	// Requeue when the cooldown of the open circuit breaker expires, so the pending alerts are delivered
+	action := getRulerAction(CompoundRulerActionResource, resourceType)
+	if retry := r.getCircuitBreakerRetry(pools.GetKey(action.namespace, action.name), time.Now()); retry > 0 {
+		result.RequeueAfter = retry
+	}
 	if err != nil {
 		r.UpdateConditionKubernetesApiCallFailure(CompoundRulerActionResource, resourceType)
 		logger.Info(fmt.Sprintf(controller.SyncTargetError, controller.RulerActionResourceType, req.NamespacedName, err.Error()))
 		return result, err
 	}
 
-	// 8. Success, update the status
+	// 9. Success, update the status
 	r.UpdateConditionSuccess(CompoundRulerActionResource, resourceType)
 
 	return result, err
@@ -200,10 +261,16 @@ func (r *RulerActionReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// Just watch for SearchRuler event resources that starts with "searchruler-alert-"
 	prefixFilter := globals.PrefixFilterPredicate{Prefix: "searchruler-alert-"}
 
+	// Restore the state of the last shutdown once elected. The pending alerts are delivered by StartManager
+	// when the manager is stopped
+	if err := mgr.Add(&stateRestorer{reconciler: r}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&searchrulerv1alpha1.RulerAction{}).
 		Named("RulerAction").
-		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		WithEventFilter(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{})).
 		Watches(&searchrulerv1alpha1.ClusterRulerAction{}, &handler.EnqueueRequestForObject{}).
 		Watches(&corev1.Event{}, &handler.EnqueueRequestForObject{}, builder.WithPredicates(prefixFilter)). // Also watch for events, so SearchRule controller throws events when a rule is firing
 		Complete(r)
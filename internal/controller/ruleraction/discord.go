@@ -0,0 +1,136 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	//
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/template"
+)
+
+const (
+
+	// Default key of the Discord webhook URL in the secret
+	discordDefaultKeyUrl = "url"
+
+	// Default title of the Discord embeds
+	discordDefaultTitle = `[{{ .status | upper }}] {{ .object.Namespace }}/{{ .object.Name }}`
+
+	// Max length of the title and the description of the Discord embeds
+	discordTitleMaxLength       = 256
+	discordDescriptionMaxLength = 4096
+
+	// Color of the Discord embeds for resolved alerts
+	discordResolvedColor = 0x2EB886
+)
+
+var (
+	// discordSeverityColors is a map of SearchRule severities and the color of the Discord embeds
+	discordSeverityColors = map[string]int{
+		"critical": 0xD50000,
+		"high":     0xFF6D00,
+		"warning":  0xFFC400,
+		"low":      0x2962FF,
+		"info":     0x2962FF,
+	}
+	discordDefaultColor = 0xFFC400
+)
+
+// discordMessage is the payload of a Discord webhook
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+// discordEmbed is an embed of a Discord message
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Color       int    `json:"color"`
+}
+
+// getDiscordSender returns the sender for the Discord integration. The URL of the webhook
+// is read from the secret associated
+func (r *RulerActionReconciler) getDiscordSender(ctx context.Context, resource *CompoundRulerActionResource, resourceType string) (notificationSender, error) {
+
+	action := getRulerAction(resource, resourceType)
+
+	// Get the URL of the webhook from the secret
+	secretRef := action.spec.Discord.SecretRef
+	discordSecret, err := r.getSecret(ctx, resource, resourceType, secretRef)
+	if err != nil {
+		return nil, err
+	}
+	keyUrl := secretRef.KeyUrl
+	if keyUrl == "" {
+		keyUrl = discordDefaultKeyUrl
+	}
+	webhookUrl := string(discordSecret.Data[keyUrl])
+	if webhookUrl == "" {
+		r.UpdateConditionNoCredsFound(resource, resourceType)
+		return nil, fmt.Errorf(controller.MissingCredentialsMessage, secretRef.Name)
+	}
+
+	httpClient, err := getHttpClient(action.spec, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, notification *notification, payload []byte) error {
+		message, err := getDiscordMessage(notification, action.spec.Discord.Title, string(payload))
+		if err != nil {
+			return err
+		}
+		return postJSON(ctx, httpClient, webhookUrl, message)
+	}, nil
+}
+
+// getDiscordMessage returns the Discord message for the notification. The description of the embed is the
+// evaluated template of the notification and the color depends on the state and the severity of the SearchRule
+func getDiscordMessage(notification *notification, titleTemplate, description string) ([]byte, error) {
+
+	// Evaluate the title template with the data of the notification
+	if titleTemplate == "" {
+		titleTemplate = discordDefaultTitle
+	}
+	title, err := template.EvaluateTemplate(titleTemplate, notification.data)
+	if err != nil {
+		return nil, fmt.Errorf(controller.EvaluateTemplateErrorMessage, err)
+	}
+
+	// Color the embed by the severity of the SearchRule, or green when it is resolved
+	alert := notification.alerts[0]
+	color, severityFound := discordSeverityColors[alert.SearchRule.Spec.Severity]
+	if !severityFound {
+		color = discordDefaultColor
+	}
+	if alert.Status == pools.AlertStatusResolved {
+		color = discordResolvedColor
+	}
+
+	return json.Marshal(discordMessage{
+		Embeds: []discordEmbed{{
+			Title:       truncate(title, discordTitleMaxLength),
+			Description: truncate(description, discordDescriptionMaxLength),
+			Color:       color,
+		}},
+	})
+}
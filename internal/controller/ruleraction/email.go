@@ -0,0 +1,196 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/template"
+)
+
+const (
+
+	// Email TLS modes
+	emailTlsModeStartTLS = "starttls"
+	emailTlsModeTLS      = "tls"
+	emailTlsModeNone     = "none"
+
+	// Default subject of the emails
+	emailDefaultSubject = `[{{ .status | upper }}] {{ .object.Namespace }}/{{ .object.Name }}`
+
+	// Max time to connect and talk to the SMTP server, so an unresponsive server does not block the deliveries
+	emailTimeout = 30 * time.Second
+)
+
+var (
+	// emailHeaderReplacer replaces the line breaks in the headers, so templates can not inject new headers
+	emailHeaderReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+)
+
+// getEmailSender returns the sender for the email integration. Credentials for the SMTP server
+// are read from the secret associated if defined
+func (r *RulerActionReconciler) getEmailSender(ctx context.Context, resource *CompoundRulerActionResource, resourceType string) (notificationSender, error) {
+
+	emailSpec := &getRulerAction(resource, resourceType).spec.Email
+
+	// Get credentials for the SMTP server in the secret associated if defined
+	var auth smtp.Auth
+	if !reflect.ValueOf(emailSpec.Credentials).IsZero() {
+		secretRef := emailSpec.Credentials.SecretRef
+		emailSecret, err := r.getSecret(ctx, resource, resourceType, secretRef)
+		if err != nil {
+			return nil, err
+		}
+
+		// Get username and password
+		username := string(emailSecret.Data[secretRef.KeyUsername])
+		password := string(emailSecret.Data[secretRef.KeyPassword])
+		if username == "" || password == "" {
+			r.UpdateConditionNoCredsFound(resource, resourceType)
+			return nil, fmt.Errorf(controller.MissingCredentialsMessage, secretRef.Name)
+		}
+		auth = smtp.PlainAuth("", username, password, emailSpec.Host)
+	}
+
+	return func(ctx context.Context, notification *notification, payload []byte) error {
+
+		// Evaluate the subject template with the data of the notification
+		subjectTemplate := emailSpec.Subject
+		if subjectTemplate == "" {
+			subjectTemplate = emailDefaultSubject
+		}
+		subject, err := template.EvaluateTemplate(subjectTemplate, notification.data)
+		if err != nil {
+			return fmt.Errorf(controller.EvaluateTemplateErrorMessage, err)
+		}
+
+		return sendEmail(ctx, emailSpec, auth, subject, payload)
+	}, nil
+}
+
+// sendEmail sends an email with the subject and the body to the recipients of the email integration
+func sendEmail(ctx context.Context, emailSpec *v1alpha1.Email, auth smtp.Auth, subject string, body []byte) (err error) {
+
+	address := net.JoinHostPort(emailSpec.Host, strconv.Itoa(emailSpec.Port))
+	tlsConfig := &tls.Config{
+		ServerName:         emailSpec.Host,
+		InsecureSkipVerify: emailSpec.TlsSkipVerify,
+	}
+
+	// The whole conversation with the SMTP server is limited by the timeout or the deadline of the context
+	deadline := time.Now().Add(emailTimeout)
+	if ctxDeadline, hasDeadline := ctx.Deadline(); hasDeadline && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	// Connect to the SMTP server. With tls mode, the connection is encrypted from the beginning
+	var conn net.Conn
+	dialer := &net.Dialer{Deadline: deadline}
+	switch emailSpec.TlsMode {
+	case emailTlsModeTLS:
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", address)
+	default:
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf(controller.SmtpConnectionErrorMessage, address, err)
+	}
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf(controller.SmtpConnectionErrorMessage, address, err)
+	}
+
+	client, err := smtp.NewClient(conn, emailSpec.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf(controller.SmtpConnectionErrorMessage, address, err)
+	}
+	defer client.Close()
+
+	// Upgrade the connection with STARTTLS, which is the default mode
+	if emailSpec.TlsMode == "" || emailSpec.TlsMode == emailTlsModeStartTLS {
+		err = client.StartTLS(tlsConfig)
+		if err != nil {
+			return fmt.Errorf(controller.SmtpSendingErrorMessage, err)
+		}
+	}
+
+	if auth != nil {
+		err = client.Auth(auth)
+		if err != nil {
+			return fmt.Errorf(controller.SmtpSendingErrorMessage, err)
+		}
+	}
+
+	// Send the email to every recipient
+	err = client.Mail(emailSpec.From)
+	if err != nil {
+		return fmt.Errorf(controller.SmtpSendingErrorMessage, err)
+	}
+	for _, to := range emailSpec.To {
+		err = client.Rcpt(to)
+		if err != nil {
+			return fmt.Errorf(controller.SmtpSendingErrorMessage, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf(controller.SmtpSendingErrorMessage, err)
+	}
+	_, err = writer.Write(getEmailMessage(emailSpec, subject, body, time.Now()))
+	if err != nil {
+		return fmt.Errorf(controller.SmtpSendingErrorMessage, err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf(controller.SmtpSendingErrorMessage, err)
+	}
+
+	return client.Quit()
+}
+
+// getEmailMessage returns the message of the email with the headers and the body. Line breaks are removed
+// from the subject, and non-ASCII subjects are encoded as RFC 2047 requires
+func getEmailMessage(emailSpec *v1alpha1.Email, subject string, body []byte, now time.Time) []byte {
+	subject = mime.QEncoding.Encode("UTF-8", emailHeaderReplacer.Replace(subject))
+
+	message := strings.Builder{}
+	message.WriteString(fmt.Sprintf("From: %s\r\n", emailSpec.From))
+	message.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(emailSpec.To, ", ")))
+	message.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	message.WriteString(fmt.Sprintf("Date: %s\r\n", now.Format(time.RFC1123Z)))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
+	message.WriteString("\r\n")
+	message.Write(body)
+	return []byte(message.String())
+}
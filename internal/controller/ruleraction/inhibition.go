@@ -0,0 +1,139 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+// getAlertLabels returns the labels of an alert. Labels of the SearchRule spec take precedence
+// over the metadata labels of the SearchRule
+func getAlertLabels(alert *pools.Alert) labels.Set {
+	alertLabels := labels.Set{}
+	for key, value := range alert.SearchRule.GetLabels() {
+		alertLabels[key] = value
+	}
+	for key, value := range alert.Labels {
+		alertLabels[key] = value
+	}
+	return alertLabels
+}
+
+// filterInhibitedAlerts removes from the alerts the ones inhibited by the inhibitRules of the RulerAction.
+// An alert is inhibited when it matches the targetSelector of a rule while another firing alert of the pool,
+// from any RulerAction, matches the sourceSelector and has the same values for the `equal` labels. Resolutions of the
+// alerts already notified are never inhibited, so the receivers do not keep them firing forever
+func (r *RulerActionReconciler) filterInhibitedAlerts(inhibitRules []v1alpha1.InhibitRule, alerts map[string]*pools.Alert) (notInhibited map[string]*pools.Alert,
+	inhibited []v1alpha1.InhibitedAlert, inhibitedKeys []string, err error) {
+
+	notInhibited = alerts
+	if len(inhibitRules) == 0 {
+		return notInhibited, inhibited, inhibitedKeys, nil
+	}
+
+	// Parse the selectors of the inhibit rules
+	sourceSelectors := make([]labels.Selector, len(inhibitRules))
+	targetSelectors := make([]labels.Selector, len(inhibitRules))
+	for i, inhibitRule := range inhibitRules {
+		sourceSelectors[i], err = metav1.LabelSelectorAsSelector(&inhibitRule.SourceSelector)
+		if err != nil {
+			return notInhibited, inhibited, inhibitedKeys, fmt.Errorf(controller.InhibitRuleSelectorErrorMessage, i, err)
+		}
+		targetSelectors[i], err = metav1.LabelSelectorAsSelector(&inhibitRule.TargetSelector)
+		if err != nil {
+			return notInhibited, inhibited, inhibitedKeys, fmt.Errorf(controller.InhibitRuleSelectorErrorMessage, i, err)
+		}
+	}
+
+	// Sources of the inhibitions are the firing alerts of the whole pool
+	sources := map[string]labels.Set{}
+	for key, alert := range r.AlertsPool.GetAll() {
+		if alert.Status == pools.AlertStatusFiring {
+			sources[key] = getAlertLabels(alert)
+		}
+	}
+	sourceKeys := make([]string, 0, len(sources))
+	for key := range sources {
+		sourceKeys = append(sourceKeys, key)
+	}
+	sort.Strings(sourceKeys)
+
+	notInhibited = map[string]*pools.Alert{}
+	for alertKey, alert := range alerts {
+		inhibitedBy := getInhibitingAlert(inhibitRules, alertKey, getAlertLabels(alert), sources, sourceKeys, sourceSelectors, targetSelectors)
+		if inhibitedBy == "" || (alert.Status == pools.AlertStatusResolved && r.isAlertNotified(alertKey)) {
+			notInhibited[alertKey] = alert
+			continue
+		}
+
+		inhibitedKeys = append(inhibitedKeys, alertKey)
+		if alert.Status == pools.AlertStatusFiring {
+			inhibited = append(inhibited, v1alpha1.InhibitedAlert{
+				SearchRule:  fmt.Sprintf("%s/%s", alert.SearchRule.Namespace, alert.SearchRule.Name),
+				InhibitedBy: inhibitedBy,
+			})
+		}
+	}
+
+	sort.Strings(inhibitedKeys)
+	sort.Slice(inhibited, func(i, j int) bool {
+		return inhibited[i].SearchRule < inhibited[j].SearchRule
+	})
+
+	return notInhibited, inhibited, inhibitedKeys, nil
+}
+
+// getInhibitingAlert returns the key of the first source alert inhibiting the target alert, or an empty
+// string when the alert is not inhibited. An alert never inhibits itself
+func getInhibitingAlert(inhibitRules []v1alpha1.InhibitRule, targetKey string, targetLabels labels.Set, sources map[string]labels.Set, sourceKeys []string,
+	sourceSelectors, targetSelectors []labels.Selector) string {
+
+	for i, inhibitRule := range inhibitRules {
+		if !targetSelectors[i].Matches(targetLabels) {
+			continue
+		}
+
+		for _, sourceKey := range sourceKeys {
+			sourceLabels := sources[sourceKey]
+			if sourceKey == targetKey || !sourceSelectors[i].Matches(sourceLabels) {
+				continue
+			}
+
+			equal := true
+			for _, label := range inhibitRule.Equal {
+				if sourceLabels[label] != targetLabels[label] {
+					equal = false
+					break
+				}
+			}
+			if equal {
+				return sourceKey
+			}
+		}
+	}
+
+	return ""
+}
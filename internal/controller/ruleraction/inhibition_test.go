@@ -0,0 +1,168 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+var _ = Describe("filterInhibitedAlerts", func() {
+
+	var (
+		reconciler   *RulerActionReconciler
+		alertsStore  *pools.AlertsStore
+		inhibitRules []v1alpha1.InhibitRule
+	)
+
+	newAlert := func(name, status string, labels map[string]string) *pools.Alert {
+		alert := &pools.Alert{RulerActionName: "webhook", Status: status, Labels: labels}
+		alert.SearchRule.Namespace = "default"
+		alert.SearchRule.Name = name
+		alert.SearchRule.Spec.ActionRef = v1alpha1.ActionRef{Namespace: "default", Name: "webhook", Data: `{"rule":"{{ .object.Name }}","status":"{{ .status }}"}`}
+		return alert
+	}
+
+	BeforeEach(func() {
+		inhibitRules = []v1alpha1.InhibitRule{{
+			SourceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"severity": "critical"}},
+			TargetSelector: metav1.LabelSelector{MatchLabels: map[string]string{"severity": "warning"}},
+			Equal:          []string{"cluster"},
+		}}
+
+		alertsStore = &pools.AlertsStore{Store: map[string]*pools.Alert{}}
+		alertsStore.Set("default_down", newAlert("down", pools.AlertStatusFiring, map[string]string{"severity": "critical", "cluster": "prod"}))
+		reconciler = &RulerActionReconciler{AlertsPool: alertsStore}
+	})
+
+	It("should inhibit the alerts matching the target selector with the same equal labels", func() {
+		alerts := map[string]*pools.Alert{
+			"default_latency": newAlert("latency", pools.AlertStatusFiring, map[string]string{"severity": "warning", "cluster": "prod"}),
+			"default_errors":  newAlert("errors", pools.AlertStatusFiring, map[string]string{"severity": "warning", "cluster": "dev"}),
+			"default_disk":    newAlert("disk", pools.AlertStatusFiring, map[string]string{"severity": "info", "cluster": "prod"}),
+		}
+
+		notInhibited, inhibited, inhibitedKeys, err := reconciler.filterInhibitedAlerts(inhibitRules, alerts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(notInhibited).To(HaveLen(2))
+		Expect(notInhibited).To(HaveKey("default_errors"))
+		Expect(notInhibited).To(HaveKey("default_disk"))
+		Expect(inhibitedKeys).To(Equal([]string{"default_latency"}))
+		Expect(inhibited).To(Equal([]v1alpha1.InhibitedAlert{{SearchRule: "default/latency", InhibitedBy: "default_down"}}))
+	})
+
+	It("should not inhibit the alerts when the source alert is resolved", func() {
+		alertsStore.Set("default_down", newAlert("down", pools.AlertStatusResolved, map[string]string{"severity": "critical", "cluster": "prod"}))
+		alerts := map[string]*pools.Alert{
+			"default_latency": newAlert("latency", pools.AlertStatusFiring, map[string]string{"severity": "warning", "cluster": "prod"}),
+		}
+
+		notInhibited, _, inhibitedKeys, err := reconciler.filterInhibitedAlerts(inhibitRules, alerts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(notInhibited).To(HaveKey("default_latency"))
+		Expect(inhibitedKeys).To(BeEmpty())
+	})
+
+	It("should never inhibit an alert by itself", func() {
+		inhibitRules[0].TargetSelector = inhibitRules[0].SourceSelector
+		alerts := map[string]*pools.Alert{"default_down": alertsStore.Store["default_down"]}
+
+		notInhibited, _, _, err := reconciler.filterInhibitedAlerts(inhibitRules, alerts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(notInhibited).To(HaveKey("default_down"))
+	})
+
+	It("should inhibit the resolutions of the alerts never notified", func() {
+		alerts := map[string]*pools.Alert{
+			"default_latency": newAlert("latency", pools.AlertStatusResolved, map[string]string{"severity": "warning", "cluster": "prod"}),
+		}
+
+		notInhibited, inhibited, inhibitedKeys, err := reconciler.filterInhibitedAlerts(inhibitRules, alerts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(notInhibited).To(BeEmpty())
+		Expect(inhibitedKeys).To(Equal([]string{"default_latency"}))
+		Expect(inhibited).To(BeEmpty())
+	})
+
+	It("should not inhibit the resolutions of the alerts already notified", func() {
+		reconciler.setAlertNotified("default_latency", pools.AlertStatusFiring, time.Now())
+		alerts := map[string]*pools.Alert{
+			"default_latency": newAlert("latency", pools.AlertStatusResolved, map[string]string{"severity": "warning", "cluster": "prod"}),
+		}
+
+		notInhibited, _, inhibitedKeys, err := reconciler.filterInhibitedAlerts(inhibitRules, alerts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(notInhibited).To(HaveKey("default_latency"))
+		Expect(inhibitedKeys).To(BeEmpty())
+	})
+
+	It("should fail with an invalid selector", func() {
+		inhibitRules[0].SourceSelector = metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "severity", Operator: "Unknown"},
+		}}
+
+		_, _, _, err := reconciler.filterInhibitedAlerts(inhibitRules, map[string]*pools.Alert{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should deliver the resolution of a notified alert which is inhibited", func() {
+		payloads := make(chan string, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			payloads <- string(body)
+		}))
+		defer server.Close()
+
+		resource := &CompoundRulerActionResource{RulerActionResource: &v1alpha1.RulerAction{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "webhook"},
+			Spec: v1alpha1.RulerActionSpec{
+				Webhook:      v1alpha1.Webhook{Url: server.URL, Verb: http.MethodPost},
+				InhibitRules: inhibitRules,
+			},
+		}}
+		scheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		reconciler.Client = fake.NewClientBuilder().WithScheme(scheme).Build()
+
+		// The source alert belongs to another RulerAction, so just the resolution is delivered by this one
+		alertsStore.Store["default_down"].RulerActionName = "pager"
+
+		alertsStore.Set("default_latency", newAlert("latency", pools.AlertStatusResolved, map[string]string{"severity": "warning", "cluster": "prod"}))
+		reconciler.setAlertNotified("default_latency", pools.AlertStatusFiring, time.Now())
+
+		Expect(reconciler.Sync(context.Background(), resource, controller.RulerActionResourceType)).To(Succeed())
+		Expect(payloads).To(HaveLen(1))
+		Expect(<-payloads).To(Equal(`{"rule":"latency","status":"resolved"}`))
+		_, alertInPool := alertsStore.Get("default_latency")
+		Expect(alertInPool).To(BeFalse())
+	})
+})
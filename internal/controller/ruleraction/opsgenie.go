@@ -0,0 +1,236 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+
+	//
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/template"
+)
+
+const (
+
+	// Default URL of the Opsgenie API
+	opsgenieDefaultUrl = "https://api.opsgenie.com"
+
+	// Opsgenie alerts API paths
+	opsgenieCreateAlertPath = "/v2/alerts"
+	opsgenieCloseAlertPath  = "/v2/alerts/%s/close?identifierType=alias"
+
+	// Default message of the Opsgenie alerts
+	opsgenieDefaultMessage = `{{ .object.Namespace }}/{{ .object.Name }}: {{ .object.Spec.Description }}`
+
+	// Limits of the Opsgenie alerts fields
+	opsgenieMessageMaxLength     = 130
+	opsgenieDescriptionMaxLength = 15000
+
+	// Default priority of the Opsgenie alerts
+	opsgenieDefaultPriority = "P3"
+
+	// Source of the Opsgenie alerts
+	opsgenieSource = "searchruler"
+)
+
+var (
+	// opsgeniePriorities is a map of SearchRule severities and the priority of the Opsgenie alerts
+	opsgeniePriorities = map[string]string{
+		"critical": "P1",
+		"high":     "P2",
+		"warning":  "P3",
+		"low":      "P4",
+		"info":     "P5",
+	}
+)
+
+// opsgenieAlert is the payload to create an Opsgenie alert
+type opsgenieAlert struct {
+	Message     string   `json:"message"`
+	Alias       string   `json:"alias"`
+	Description string   `json:"description"`
+	Priority    string   `json:"priority"`
+	Tags        []string `json:"tags,omitempty"`
+	Source      string   `json:"source"`
+}
+
+// opsgenieCloseAlert is the payload to close an Opsgenie alert
+type opsgenieCloseAlert struct {
+	Note   string `json:"note"`
+	Source string `json:"source"`
+}
+
+// getOpsgenieSender returns the sender for the Opsgenie integration. Firing alerts create an Opsgenie alert
+// and resolved alerts close it. Both are correlated by the alias, derived from the SearchRule
+func (r *RulerActionReconciler) getOpsgenieSender(ctx context.Context, resource *CompoundRulerActionResource, resourceType string) (notificationSender, error) {
+
+	action := getRulerAction(resource, resourceType)
+
+	// Get the API key from the secret
+	secretRef := action.spec.Opsgenie.SecretRef
+	opsgenieSecret, err := r.getSecret(ctx, resource, resourceType, secretRef)
+	if err != nil {
+		return nil, err
+	}
+	apiKey := string(opsgenieSecret.Data[secretRef.KeyApiKey])
+	if apiKey == "" {
+		r.UpdateConditionNoCredsFound(resource, resourceType)
+		return nil, fmt.Errorf(controller.MissingCredentialsMessage, secretRef.Name)
+	}
+
+	apiUrl := action.spec.Opsgenie.Url
+	if apiUrl == "" {
+		apiUrl = opsgenieDefaultUrl
+	}
+
+	httpClient, err := getHttpClient(action.spec, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, notification *notification, payload []byte) error {
+		alias := getOpsgenieAlias(notification)
+
+		firingAlerts := []*pools.Alert{}
+		for _, alert := range notification.alerts {
+			if alert.Status == pools.AlertStatusFiring {
+				firingAlerts = append(firingAlerts, alert)
+			}
+		}
+
+		// Close the Opsgenie alert when the alerts are resolved. Grouped alerts share the alias, so it is
+		// closed just when every alert of the group is resolved
+		if len(firingAlerts) == 0 {
+			groupFiring, err := r.isOpsgenieGroupFiring(action, notification)
+			if err != nil || groupFiring {
+				return err
+			}
+
+			body, err := json.Marshal(opsgenieCloseAlert{
+				Note:   truncate(string(payload), opsgenieDescriptionMaxLength),
+				Source: opsgenieSource,
+			})
+			if err != nil {
+				return fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+			}
+			return sendOpsgenieRequest(ctx, httpClient, apiUrl+fmt.Sprintf(opsgenieCloseAlertPath, url.PathEscape(alias)), apiKey, body)
+		}
+
+		// Evaluate the message template with the data of the notification
+		messageTemplate := action.spec.Opsgenie.Message
+		if messageTemplate == "" {
+			messageTemplate = opsgenieDefaultMessage
+		}
+		message, err := template.EvaluateTemplate(messageTemplate, notification.data)
+		if err != nil {
+			return fmt.Errorf(controller.EvaluateTemplateErrorMessage, err)
+		}
+
+		// Map the severity of the SearchRules to the priority of the Opsgenie alert. Grouped alerts take
+		// the highest priority of their firing alerts
+		priority := ""
+		for _, alert := range firingAlerts {
+			alertPriority, severityFound := opsgeniePriorities[alert.SearchRule.Spec.Severity]
+			if !severityFound {
+				alertPriority = opsgenieDefaultPriority
+			}
+			if priority == "" || alertPriority < priority {
+				priority = alertPriority
+			}
+		}
+
+		body, err := json.Marshal(opsgenieAlert{
+			Message:     truncate(message, opsgenieMessageMaxLength),
+			Alias:       alias,
+			Description: truncate(string(payload), opsgenieDescriptionMaxLength),
+			Priority:    priority,
+			Tags:        action.spec.Opsgenie.Tags,
+			Source:      opsgenieSource,
+		})
+		if err != nil {
+			return fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+		}
+		return sendOpsgenieRequest(ctx, httpClient, apiUrl+opsgenieCreateAlertPath, apiKey, body)
+	}, nil
+}
+
+// getOpsgenieAlias returns the alias of the Opsgenie alert for the notification. It is derived from
+// the SearchRule, or from the group when the alerts are grouped
+func getOpsgenieAlias(notification *notification) string {
+	if notification.groupKey != "" {
+		return notification.groupKey
+	}
+	alert := notification.alerts[0]
+	return pools.GetKey(alert.SearchRule.Namespace, alert.SearchRule.Name)
+}
+
+// isOpsgenieGroupFiring returns whether the group of the notification has firing alerts in the pool which are
+// not in the notification, like the throttled ones. It is false for the notifications without group
+func (r *RulerActionReconciler) isOpsgenieGroupFiring(action *rulerAction, notification *notification) (bool, error) {
+	if notification.groupKey == "" {
+		return false, nil
+	}
+
+	alerts, err := r.getRulerActionAssociatedAlerts(action.namespace, action.name)
+	if err != nil {
+		return false, fmt.Errorf(controller.AlertsPoolErrorMessage, err)
+	}
+	for _, alert := range alerts {
+		if groupKey, _ := getAlertGroup(action, alert); alert.Status == pools.AlertStatusFiring && groupKey == notification.groupKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sendOpsgenieRequest sends the payload to the Opsgenie API authenticated with the API key
+func sendOpsgenieRequest(ctx context.Context, httpClient *http.Client, requestUrl string, apiKey string, payload []byte) error {
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, requestUrl, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Authorization", "GenieKey "+apiKey)
+
+	httpResponse, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf(controller.HttpRequestSendingErrorMessage, err)
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf(controller.HttpResponseErrorMessage, requestUrl, httpResponse.Status)
+	}
+
+	return nil
+}
+
+// truncate returns the text truncated to the max number of characters, so multi-byte characters are never split
+func truncate(text string, maxLength int) string {
+	if utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+	return string([]rune(text)[:maxLength])
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+
+	//
+	"prosimcorp.com/SearchRuler/internal/controller"
+)
+
+// validatePayloadSchema checks the payload against the JSON Schema of the RulerAction. The schema
+// is validated with the same validator Kubernetes uses for the CRDs
+func validatePayloadSchema(schema *apiextensionsv1.JSON, payload string) error {
+
+	// Parse the schema of the RulerAction
+	schemaProps := &apiextensionsv1.JSONSchemaProps{}
+	err := json.Unmarshal(schema.Raw, schemaProps)
+	if err != nil {
+		return fmt.Errorf(controller.PayloadSchemaParseErrorMessage, err)
+	}
+	internalSchemaProps := &apiextensions.JSONSchemaProps{}
+	err = apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(schemaProps, internalSchemaProps, nil)
+	if err != nil {
+		return fmt.Errorf(controller.PayloadSchemaParseErrorMessage, err)
+	}
+	validator, _, err := validation.NewSchemaValidator(internalSchemaProps)
+	if err != nil {
+		return fmt.Errorf(controller.PayloadSchemaParseErrorMessage, err)
+	}
+
+	// Validate the payload against the schema
+	var payloadObject interface{}
+	err = json.Unmarshal([]byte(payload), &payloadObject)
+	if err != nil {
+		return fmt.Errorf(controller.PayloadSchemaValidationErrorMessage, err)
+	}
+	validationErrs := validation.ValidateCustomResource(nil, payloadObject, validator)
+	if len(validationErrs) > 0 {
+		return fmt.Errorf(controller.PayloadSchemaValidationErrorMessage, validationErrs.ToAggregate())
+	}
+
+	return nil
+}
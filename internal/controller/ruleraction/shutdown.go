@@ -0,0 +1,291 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/globals"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+const (
+	// ConfigMap where the state of the pools is saved on shutdown, so the alerts not delivered yet, the alerts
+	// already notified and the timers of the rules survive the restart
+	stateConfigMapName = "searchruler-state"
+	stateAlertsKey     = "alerts.json"
+	stateRulesKey      = "rules.json"
+	stateNotifiedKey   = "notified.json"
+)
+
+// notifiedState are the last times the firing alerts and the groups of alerts were notified
+type notifiedState struct {
+	Alerts map[string]time.Time `json:"alerts,omitempty"`
+	Groups map[string]time.Time `json:"groups,omitempty"`
+}
+
+// StartManager starts the manager and, once it is stopped, delivers the pending notifications of the AlertsPool and
+// saves the state of the pools. The manager returns when the running reconciles are done, so the delivery never
+// races with them. Its cache is stopped by then, so the resources are read from the API with the apiClient
+func (r *RulerActionReconciler) StartManager(ctx context.Context, mgr ctrl.Manager, apiClient client.Client) error {
+	err := mgr.Start(ctx)
+
+	if r.ShutdownGracePeriod > 0 {
+		r.Client = apiClient
+		flushCtx, cancel := context.WithTimeout(context.Background(), r.ShutdownGracePeriod)
+		defer cancel()
+		r.FlushPendingAlerts(flushCtx)
+	}
+	return err
+}
+
+// stateRestorer restores the state saved on the last shutdown once this replica is elected as leader, so it is
+// in the pools before the rules are evaluated
+type stateRestorer struct {
+	reconciler *RulerActionReconciler
+}
+
+func (s *stateRestorer) NeedLeaderElection() bool {
+	return true
+}
+
+func (s *stateRestorer) Start(ctx context.Context) error {
+	s.reconciler.restoreStateOnce(ctx)
+	return nil
+}
+
+// isAlertPending returns true when the notification of the alert was not delivered yet. Resolved alerts are removed
+// from the pool once notified, and firing alerts are pending until their first notification
+func (r *RulerActionReconciler) isAlertPending(alertKey string, alert *pools.Alert) bool {
+	if alert.Status == pools.AlertStatusResolved {
+		return true
+	}
+	return !r.isAlertNotified(alertKey)
+}
+
+// FlushPendingAlerts delivers the pending notifications of the AlertsPool, grouped by their RulerAction, until the
+// context expires. Afterwards, the state of the pools is saved to be restored after the restart
+func (r *RulerActionReconciler) FlushPendingAlerts(ctx context.Context) {
+	logger := log.FromContext(ctx)
+
+	// Save the state of the pools once the pending alerts are delivered, even when none of them is pending
+	defer func() {
+		if err := r.saveState(ctx); err != nil {
+			logger.Info(err.Error())
+		}
+	}()
+
+	// Get the RulerActions with pending alerts
+	rulerActions := map[types.NamespacedName]bool{}
+	for alertKey, alert := range r.AlertsPool.GetAll() {
+		if r.isAlertPending(alertKey, alert) {
+			rulerActions[types.NamespacedName{
+				Namespace: alert.SearchRule.Spec.ActionRef.Namespace,
+				Name:      alert.RulerActionName,
+			}] = true
+		}
+	}
+	if len(rulerActions) == 0 {
+		return
+	}
+
+	rulerActionNames := make([]types.NamespacedName, 0, len(rulerActions))
+	for rulerActionName := range rulerActions {
+		rulerActionNames = append(rulerActionNames, rulerActionName)
+	}
+	sort.Slice(rulerActionNames, func(i, j int) bool {
+		return rulerActionNames[i].String() < rulerActionNames[j].String()
+	})
+
+	logger.Info("Delivering pending alerts before shutdown", "ruleractions", len(rulerActionNames))
+	for _, rulerActionName := range rulerActionNames {
+		if ctx.Err() != nil {
+			break
+		}
+
+		resource := &CompoundRulerActionResource{
+			RulerActionResource:        &v1alpha1.RulerAction{},
+			ClusterRulerActionResource: &v1alpha1.ClusterRulerAction{},
+		}
+		resourceType := controller.RulerActionResourceType
+		var err error
+		if rulerActionName.Namespace == "" {
+			resourceType = controller.ClusterRulerActionResourceType
+			err = r.Get(ctx, rulerActionName, resource.ClusterRulerActionResource)
+		} else {
+			err = r.Get(ctx, rulerActionName, resource.RulerActionResource)
+		}
+		if err != nil {
+			logger.Info(fmt.Sprintf(controller.CanNotGetResourceError, resourceType, rulerActionName, err.Error()))
+			continue
+		}
+
+		err = r.sync(ctx, resource, resourceType, true)
+		if err != nil {
+			logger.Info(fmt.Sprintf(controller.SyncTargetError, resourceType, rulerActionName, err.Error()))
+		}
+	}
+}
+
+// saveState saves the state of the pools in a ConfigMap in the namespace of the controller: the alerts, both the
+// firing ones and the resolutions not delivered yet, the last times they were notified, and the state of the
+// rules, so their firing times and pending `for` timers are kept across the restart
+func (r *RulerActionReconciler) saveState(ctx context.Context) error {
+
+	if r.StateNamespace == "" {
+		return nil
+	}
+
+	alerts := r.AlertsPool.GetAll()
+	rules := map[string]*pools.Rule{}
+	if r.RulesPool != nil {
+		rules = r.RulesPool.GetAll()
+	}
+	if len(alerts) == 0 && len(rules) == 0 {
+		return nil
+	}
+
+	r.alertsMutex.Lock()
+	r.groupsMutex.Lock()
+	notified := notifiedState{
+		Alerts: maps.Clone(r.notifiedAlerts),
+		Groups: maps.Clone(r.notifiedGroups),
+	}
+	r.groupsMutex.Unlock()
+	r.alertsMutex.Unlock()
+
+	// Use a fresh context, as the grace period can be expired, so the state is saved anyway
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      stateConfigMapName,
+			Namespace: r.StateNamespace,
+		},
+		Data: map[string]string{},
+	}
+	for key, value := range map[string]interface{}{stateAlertsKey: alerts, stateRulesKey: rules, stateNotifiedKey: notified} {
+		valueJSON, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf(controller.StateSaveErrorMessage, stateConfigMapName, err)
+		}
+		configMap.Data[key] = string(valueJSON)
+	}
+
+	configMaps := globals.Application.KubeRawCoreClient.CoreV1().ConfigMaps(r.StateNamespace)
+	_, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf(controller.StateSaveErrorMessage, stateConfigMapName, err)
+	}
+
+	log.FromContext(ctx).Info("State saved to be restored after the restart", "alerts", len(alerts), "rules", len(rules))
+	return nil
+}
+
+// restoreStateOnce restores the state saved on the last shutdown just once, and closes StateRestored afterwards
+func (r *RulerActionReconciler) restoreStateOnce(ctx context.Context) {
+	r.restoreOnce.Do(func() {
+		if err := r.restoreState(ctx); err != nil {
+			log.FromContext(ctx).Info(err.Error())
+		}
+		if r.StateRestored != nil {
+			close(r.StateRestored)
+		}
+	})
+}
+
+// restoreState adds the alerts and the rules saved on the last shutdown to the pools and removes the ConfigMap,
+// so the pending alerts are delivered by the reconciles of their RulerActions, and the alerts already notified
+// are not notified again. Alerts and rules already in the pools are kept
+func (r *RulerActionReconciler) restoreState(ctx context.Context) error {
+	if r.StateNamespace == "" {
+		return nil
+	}
+
+	configMaps := globals.Application.KubeRawCoreClient.CoreV1().ConfigMaps(r.StateNamespace)
+	configMap, err := configMaps.Get(ctx, stateConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf(controller.StateRestoreErrorMessage, stateConfigMapName, err)
+	}
+
+	alerts := map[string]*pools.Alert{}
+	rules := map[string]*pools.Rule{}
+	notified := notifiedState{}
+	for key, value := range map[string]interface{}{stateAlertsKey: &alerts, stateRulesKey: &rules, stateNotifiedKey: &notified} {
+		valueJSON, exists := configMap.Data[key]
+		if !exists {
+			continue
+		}
+		err = json.Unmarshal([]byte(valueJSON), value)
+		if err != nil {
+			return fmt.Errorf(controller.StateRestoreErrorMessage, stateConfigMapName, err)
+		}
+	}
+
+	for alertKey, alert := range alerts {
+		if _, alertInPool := r.AlertsPool.Get(alertKey); alertInPool {
+			continue
+		}
+		r.AlertsPool.Set(alertKey, alert)
+		if lastNotified, alertNotified := notified.Alerts[alertKey]; alertNotified {
+			r.setAlertNotified(alertKey, alert.Status, lastNotified)
+		}
+	}
+	for groupKey, lastNotified := range notified.Groups {
+		if _, groupNotified := r.getGroupNotified(groupKey); !groupNotified {
+			r.setGroupNotified(groupKey, lastNotified)
+		}
+	}
+	if r.RulesPool != nil {
+		for ruleKey, rule := range rules {
+			if _, ruleInPool := r.RulesPool.Get(ruleKey); !ruleInPool {
+				r.RulesPool.Set(ruleKey, rule)
+			}
+		}
+	}
+
+	err = configMaps.Delete(ctx, stateConfigMapName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf(controller.StateRestoreErrorMessage, stateConfigMapName, err)
+	}
+
+	log.FromContext(ctx).Info("State of the last shutdown restored", "alerts", len(alerts), "rules", len(rules))
+	return nil
+}
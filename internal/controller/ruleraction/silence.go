@@ -0,0 +1,52 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	//
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+// getSilencedAlerts returns the keys of the firing alerts matched by an active Silence. Alerts already in the
+// pool when the silence starts are not notified until it expires. Resolved alerts are never silenced, so the
+// resolution of an alert already notified is always delivered
+func (r *RulerActionReconciler) getSilencedAlerts(ctx context.Context, alerts map[string]*pools.Alert) (silencedKeys []string, err error) {
+
+	now := time.Now()
+	for alertKey, alert := range alerts {
+		if alert.Status != pools.AlertStatusFiring {
+			continue
+		}
+
+		namespace := controller.GetSilencesNamespace(&alert.SearchRule, r.ControllerNamespace)
+		silence, err := controller.GetActiveSilence(ctx, r.Client, namespace, getAlertLabels(alert), now)
+		if err != nil {
+			return nil, err
+		}
+		if silence != nil {
+			silencedKeys = append(silencedKeys, alertKey)
+		}
+	}
+
+	sort.Strings(silencedKeys)
+	return silencedKeys, nil
+}
@@ -17,10 +17,14 @@ limitations under the License.
 package ruleraction
 
 import (
+	"fmt"
+	"time"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	//
 
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
 	"prosimcorp.com/SearchRuler/internal/controller"
 	"prosimcorp.com/SearchRuler/internal/globals"
 )
@@ -89,6 +93,22 @@ func (r *RulerActionReconciler) UpdateConditionConnectionError(resource *Compoun
 	}
 }
 
+// UpdateConditionWebhookErrorResponse updates the status of the RulerAction resource with a WebhookErrorResponse condition
+func (r *RulerActionReconciler) UpdateConditionWebhookErrorResponse(resource *CompoundRulerActionResource, resourceType string) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonWebhookErrorResponseType, globals.ConditionReasonWebhookErrorResponseMessage)
+
+	// Update the status of the RulerAction resource
+	switch resourceType {
+	case controller.ClusterRulerActionResourceType:
+		globals.UpdateCondition(&resource.ClusterRulerActionResource.Status.Conditions, condition)
+	default:
+		globals.UpdateCondition(&resource.RulerActionResource.Status.Conditions, condition)
+	}
+}
+
 // UpdateConditionEvaluateTemplateError updates the status of the RulerAction resource with a EvaluateTemplateError condition
 func (r *RulerActionReconciler) UpdateConditionEvaluateTemplateError(resource *CompoundRulerActionResource, resourceType string) {
 
@@ -120,3 +140,57 @@ func (r *RulerActionReconciler) UpdateConditionNoCredsFound(resource *CompoundRu
 		globals.UpdateCondition(&resource.RulerActionResource.Status.Conditions, condition)
 	}
 }
+
+// UpdateConditionCircuitBreaker updates the status of the RulerAction resource with the state of its circuit breaker
+func (r *RulerActionReconciler) UpdateConditionCircuitBreaker(resource *CompoundRulerActionResource, resourceType string, breaker circuitBreaker) {
+
+	// Create the new condition with the state of the circuit breaker
+	condition := globals.NewCondition(globals.ConditionTypeCircuitBreakerOpen, metav1.ConditionFalse,
+		globals.ConditionReasonCircuitBreakerClosedType, globals.ConditionReasonCircuitBreakerClosedMessage)
+	if breaker.state == circuitBreakerOpen {
+		condition = globals.NewCondition(globals.ConditionTypeCircuitBreakerOpen, metav1.ConditionTrue,
+			globals.ConditionReasonCircuitBreakerOpenType, fmt.Sprintf(globals.ConditionReasonCircuitBreakerOpenMessage,
+				breaker.consecutiveFailures, breaker.retryAt.UTC().Format(time.RFC3339)))
+	}
+
+	// Update the status of the RulerAction resource
+	switch resourceType {
+	case controller.ClusterRulerActionResourceType:
+		globals.UpdateCondition(&resource.ClusterRulerActionResource.Status.Conditions, condition)
+	default:
+		globals.UpdateCondition(&resource.RulerActionResource.Status.Conditions, condition)
+	}
+}
+
+// UpdateInhibitedAlerts updates the status of the RulerAction resource with the firing alerts which are inhibited
+func (r *RulerActionReconciler) UpdateInhibitedAlerts(resource *CompoundRulerActionResource, resourceType string, inhibitedAlerts []v1alpha1.InhibitedAlert) {
+
+	// Update the status of the RulerAction resource
+	switch resourceType {
+	case controller.ClusterRulerActionResourceType:
+		resource.ClusterRulerActionResource.Status.InhibitedAlerts = inhibitedAlerts
+	default:
+		resource.RulerActionResource.Status.InhibitedAlerts = inhibitedAlerts
+	}
+}
+
+// UpdateTestNotification updates the status of the RulerAction resource with the outcome of the test notification
+func (r *RulerActionReconciler) UpdateTestNotification(resource *CompoundRulerActionResource, resourceType string, value string, err error) {
+
+	testNotification := &v1alpha1.TestNotificationResult{
+		Value:     value,
+		Delivered: err == nil,
+		SentTime:  metav1.Now(),
+	}
+	if err != nil {
+		testNotification.Message = err.Error()
+	}
+
+	// Update the status of the RulerAction resource
+	switch resourceType {
+	case controller.ClusterRulerActionResourceType:
+		resource.ClusterRulerActionResource.Status.TestNotification = testNotification
+	default:
+		resource.RulerActionResource.Status.TestNotification = testNotification
+	}
+}
@@ -21,14 +21,21 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"net/http"
 	"prosimcorp.com/SearchRuler/internal/globals"
 	"reflect"
-
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -38,171 +45,407 @@ import (
 	"prosimcorp.com/SearchRuler/internal/controller"
 	"prosimcorp.com/SearchRuler/internal/pools"
 	"prosimcorp.com/SearchRuler/internal/template"
+	"prosimcorp.com/SearchRuler/internal/tracing"
 	"prosimcorp.com/SearchRuler/internal/validators"
 )
 
+const (
+	// Max number of notifications sent concurrently
+	notificationWorkers = 5
+)
+
 var (
 	// validatorsMap is a map of integration names and their respective validation functions
 	validatorsMap = map[string]func(data string) (result bool, hint string, err error){
 		"alertmanager": validators.ValidateAlertmanager,
+		"slack":        validators.ValidateSlack,
 	}
-	resourceNamespace string
-	resourceName      string
-	resourceSpec      v1alpha1.RulerActionSpec
 )
 
+// rulerAction are the namespace, the name and the spec of the RulerAction or ClusterRulerAction being synced.
+// They are passed along the sync, so concurrent syncs never read the values of each other
+type rulerAction struct {
+	namespace string
+	name      string
+	spec      *v1alpha1.RulerActionSpec
+}
+
 // Sync function is used to synchronize the RulerAction resource with the alerts. Executes the webhook defined in the
 // resource for each alert found in the AlertsPool.
 func (r *RulerActionReconciler) Sync(ctx context.Context, resource *CompoundRulerActionResource, resourceType string) (err error) {
+	return r.sync(ctx, resource, resourceType, false)
+}
+
+// sync sends the notifications of the alerts of the RulerAction. When pendingOnly is true, just the alerts not
+// notified yet are sent, so the firing alerts already delivered are not repeated
+func (r *RulerActionReconciler) sync(ctx context.Context, resource *CompoundRulerActionResource, resourceType string, pendingOnly bool) (err error) {
 
-	logger := log.FromContext(ctx)
 	// Get the resource values depending on the resourceType
-	switch resourceType {
-	case controller.ClusterRulerActionResourceType:
-		resourceNamespace = ""
-		resourceName = resource.ClusterRulerActionResource.Name
-		resourceSpec = resource.ClusterRulerActionResource.Spec
-	case controller.RulerActionResourceType:
-		resourceNamespace = resource.RulerActionResource.Namespace
-		resourceName = resource.RulerActionResource.Name
-		resourceSpec = resource.RulerActionResource.Spec
-	}
-
-	// Get credentials for the Action in the secret associated if defined
-	username := ""
-	password := ""
-	if !reflect.ValueOf(resourceSpec.Webhook.Credentials).IsZero() {
-		// First get secret with the credentials
-		RulerActionCredsSecret := &corev1.Secret{}
-		secretNamespace := resourceSpec.Webhook.Credentials.SecretRef.Namespace
-		if secretNamespace == "" {
-			secretNamespace = resourceNamespace
-		}
-		namespacedName := types.NamespacedName{
-			Namespace: secretNamespace,
-			Name:      resourceSpec.Webhook.Credentials.SecretRef.Name,
+	action := getRulerAction(resource, resourceType)
+
+	// Attach the context of the RulerAction to every log line
+	logger := log.FromContext(ctx).WithValues("ruleraction", action.name)
+
+	// Check alert pool for alerts related to this rulerAction
+	alerts, err := r.getRulerActionAssociatedAlerts(action.namespace, action.name)
+	if err != nil {
+		return fmt.Errorf(controller.AlertsPoolErrorMessage, err)
+	}
+	if pendingOnly {
+		for alertKey, alert := range alerts {
+			if !r.isAlertPending(alertKey, alert) {
+				delete(alerts, alertKey)
+			}
 		}
-		err = r.Get(ctx, namespacedName, RulerActionCredsSecret)
-		if err != nil {
-			r.UpdateConditionNoCredsFound(resource, resourceType)
-			return fmt.Errorf(controller.SecretNotFoundErrorMessage, namespacedName, err)
+	}
+
+	// Discard the alerts inhibited by other firing alerts. Firing inhibited alerts are kept in the status of the
+	// RulerAction and resolved inhibited alerts, which were never notified, are removed from the pool
+	alerts, inhibitedAlerts, inhibitedKeys, err := r.filterInhibitedAlerts(action.spec.InhibitRules, alerts)
+	if err != nil {
+		return err
+	}
+	for _, alertKey := range inhibitedKeys {
+		logger.Info("Alert is inhibited by the inhibitRules of the RulerAction", "alert", alertKey)
+		if alert, alertInPool := r.AlertsPool.Get(alertKey); alertInPool && alert.Status == pools.AlertStatusResolved {
+			r.AlertsPool.Delete(alertKey)
 		}
+	}
+	r.UpdateInhibitedAlerts(resource, resourceType, inhibitedAlerts)
 
-		// Get username and password
-		username = string(RulerActionCredsSecret.Data[resourceSpec.Webhook.Credentials.SecretRef.KeyUsername])
-		password = string(RulerActionCredsSecret.Data[resourceSpec.Webhook.Credentials.SecretRef.KeyPassword])
-		if username == "" || password == "" {
-			r.UpdateConditionNoCredsFound(resource, resourceType)
-			return fmt.Errorf(controller.MissingCredentialsMessage, namespacedName)
+	// Discard the firing alerts muted by a Silence. They are kept in the pool, so they are notified when the
+	// silence expires while they are still firing
+	silencedKeys, err := r.getSilencedAlerts(ctx, alerts)
+	if err != nil {
+		return err
+	}
+	for _, alertKey := range silencedKeys {
+		logger.Info("Alert is muted by a Silence", "alert", alertKey)
+		delete(alerts, alertKey)
+	}
+
+	// Discard the firing alerts notified inside the min interval of the RulerAction
+	minInterval := time.Duration(0)
+	if action.spec.MinInterval != "" {
+		minInterval, err = time.ParseDuration(action.spec.MinInterval)
+		if err != nil {
+			return fmt.Errorf(controller.MinIntervalParseErrorMessage, err)
 		}
 	}
+	for _, alertKey := range r.getThrottledAlerts(alerts, minInterval, time.Now()) {
+		logger.Info("Alert is throttled by the minInterval of the RulerAction", "alert", alertKey)
+		delete(alerts, alertKey)
+	}
 
-	// Check alert pool for alerts related to this rulerAction
-	// Alerts key pattern: namespace/rulerActionName/searchRuleName
-	alerts, err := r.getRulerActionAssociatedAlerts(resourceName)
+	// Build the notifications to send. Alerts are grouped when groupBy is defined
+	// in the RulerAction, so every group of alerts is sent in a single webhook call
+	notifications, err := r.buildNotifications(action, alerts)
 	if err != nil {
-		return fmt.Errorf(controller.AlertsPoolErrorMessage, err)
+		return fmt.Errorf(controller.GroupWindowParseErrorMessage, err)
 	}
 
-	// If there are alerts for the rulerAction, initialize the HTTP client
-	if len(alerts) > 0 {
-		// Create the HTTP client
-		httpClient := &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: resourceSpec.Webhook.TlsSkipVerify,
-				},
-			},
+	// Evaluate the payload of every notification. Failing notifications are skipped
+	// and reported at the end, so they do not block the rest of notifications
+	errs := []error{}
+	payloads := map[*notification][]byte{}
+	for _, notification := range notifications {
+
+		// Log alerts firing or resolved
+		for _, alert := range notification.alerts {
+			logger.Info("Alert received",
+				"rule", fmt.Sprintf("%s/%s", alert.SearchRule.Namespace, alert.SearchRule.Name),
+				"state", alert.Status,
+				"description", alert.SearchRule.Spec.Description)
 		}
 
-		// Create the request with the configured verb and URL
-		httpRequest, err := http.NewRequest(resourceSpec.Webhook.Verb, resourceSpec.Webhook.Url, nil)
+		payload, err := r.getNotificationPayload(resource, resourceType, notification)
 		if err != nil {
-			return fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
+			errs = append(errs, err)
+			continue
 		}
+		payloads[notification] = payload
+	}
 
-		// Add headers to the request if set
-		httpRequest.Header.Set("Content-Type", "application/json")
-		for headerKey, headerValue := range resourceSpec.Webhook.Headers {
-			httpRequest.Header.Set(headerKey, headerValue)
+	// Send the notifications concurrently with a bounded number of workers
+	if len(payloads) > 0 {
+		// Get the sender of the integration configured in the RulerAction
+		sendNotification, err := r.getNotificationSender(ctx, resource, resourceType)
+		if err != nil {
+			return err
 		}
 
-		// Add authentication if set for the webhook
-		if username == "" || password == "" {
-			httpRequest.SetBasicAuth(username, password)
+		// Skip the deliveries while the circuit breaker of the RulerAction is open, so an integration which is down
+		// does not slow down every reconcile. Once the cooldown expires, a single notification tests its recovery
+		// and the rest of them are sent just when it is delivered
+		breakerKey := pools.GetKey(action.namespace, action.name)
+		if !isCircuitBreakerEnabled(action.spec.CircuitBreaker) {
+			r.forgetCircuitBreaker(breakerKey)
+		}
+		cooldown, err := getCircuitBreakerCooldown(action.spec.CircuitBreaker)
+		if err != nil {
+			return fmt.Errorf(controller.CircuitBreakerCooldownErrorMessage, err)
+		}
+		breaker := r.checkCircuitBreaker(breakerKey, time.Now())
+		if breaker.state == circuitBreakerOpen {
+			logger.Info("Deliveries are skipped by the open circuit breaker", "retryAt", breaker.retryAt)
+			r.UpdateConditionCircuitBreaker(resource, resourceType, breaker)
+			return fmt.Errorf(controller.CircuitBreakerOpenErrorMessage, breaker.consecutiveFailures, breaker.retryAt.Format(time.RFC3339))
 		}
 
-		// For every alert found in the pool, execute the
-		// webhook configured in the RulerAction resource
-		for _, alert := range alerts {
-
-			// Log alert firing
-			logger.Info(fmt.Sprintf(
-				controller.AlertFiringInfoMessage,
-				alert.SearchRule.Namespace,
-				alert.SearchRule.Name,
-				alert.SearchRule.Spec.Description,
-			))
-
-			// Add parsed data to the request
-			// object is the SearchRule object and value is the value of the alert
-			// to be accessible in the template
-			templateInjectedObject := map[string]interface{}{}
-			templateInjectedObject["value"] = alert.Value
-			templateInjectedObject["object"] = alert.SearchRule
-			templateInjectedObject["aggregations"] = alert.Aggregations
-
-			// Evaluate the data template with the injected object
-			parsedMessage, err := template.EvaluateTemplate(alert.SearchRule.Spec.ActionRef.Data, templateInjectedObject)
-			if err != nil {
-				r.UpdateConditionEvaluateTemplateError(resource, resourceType)
-				return fmt.Errorf(controller.EvaluateTemplateErrorMessage, err)
+		delivered, sendErrs := 0, []error{}
+		if breaker.state == circuitBreakerHalfOpen {
+			probe := getProbeNotification(notifications, payloads)
+			logger.Info("Testing the recovery of the integration of the half-open circuit breaker")
+			delivered, sendErrs = r.sendNotifications(ctx, sendNotification, map[*notification][]byte{probe: payloads[probe]})
+			delete(payloads, probe)
+			if len(sendErrs) > 0 {
+				payloads = nil
 			}
+		}
+		moreDelivered, moreSendErrs := r.sendNotifications(ctx, sendNotification, payloads)
+		delivered += moreDelivered
+		sendErrs = append(sendErrs, moreSendErrs...)
 
-			// Check if the webhook has a validator and execute it when available
-			if resourceSpec.Webhook.Validator != "" {
+		if isCircuitBreakerEnabled(action.spec.CircuitBreaker) {
+			breaker = r.recordDeliveries(breakerKey, action.spec.CircuitBreaker.FailureThreshold, delivered, len(sendErrs), cooldown, time.Now())
+			r.UpdateConditionCircuitBreaker(resource, resourceType, breaker)
+		}
 
-				// Check if the validator is available
-				_, validatorFound := validatorsMap[resourceSpec.Webhook.Validator]
-				if !validatorFound {
-					r.UpdateConditionEvaluateTemplateError(resource, resourceType)
-					return fmt.Errorf(controller.ValidatorNotFoundErrorMessage, resourceSpec.Webhook.Validator)
-				}
+		if len(sendErrs) > 0 {
+			var responseErr *webhookResponseError
+			if errors.As(errors.Join(sendErrs...), &responseErr) {
+				r.UpdateConditionWebhookErrorResponse(resource, resourceType)
+			} else {
+				r.UpdateConditionConnectionError(resource, resourceType)
+			}
+			errs = append(errs, sendErrs...)
+		}
+	}
 
-				// Execute the validator to the data of the alert
-				validatorResult, validatorHint, err := validatorsMap[resourceSpec.Webhook.Validator](parsedMessage)
-				if err != nil {
-					r.UpdateConditionEvaluateTemplateError(resource, resourceType)
-					return fmt.Errorf(controller.ValidationFailedErrorMessage, err.Error())
-				}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	// Updates status to Success
+	r.UpdateStateSuccess(resource, resourceType)
+	return nil
+}
+
+// getRulerAction returns the namespace, the name and the spec of the RulerAction depending on the resourceType
+func getRulerAction(resource *CompoundRulerActionResource, resourceType string) *rulerAction {
+	if resourceType == controller.ClusterRulerActionResourceType {
+		return &rulerAction{
+			name: resource.ClusterRulerActionResource.Name,
+			spec: &resource.ClusterRulerActionResource.Spec,
+		}
+	}
+	return &rulerAction{
+		namespace: resource.RulerActionResource.Namespace,
+		name:      resource.RulerActionResource.Name,
+		spec:      &resource.RulerActionResource.Spec,
+	}
+}
 
-				// Check the result of the validator
-				if !validatorResult {
-					r.UpdateConditionEvaluateTemplateError(resource, resourceType)
-					return fmt.Errorf(controller.ValidationFailedErrorMessage, validatorHint)
+// sendNotifications sends the payloads of the notifications concurrently with a bounded number of workers.
+// It returns the number of notifications delivered and the errors of the failed ones
+func (r *RulerActionReconciler) sendNotifications(ctx context.Context, sendNotification notificationSender,
+	payloads map[*notification][]byte) (delivered int, sendErrs []error) {
+
+	var wg sync.WaitGroup
+	var resultsMutex sync.Mutex
+	workers := make(chan struct{}, notificationWorkers)
+	for pendingNotification, payload := range payloads {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(sentNotification *notification, payload []byte) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			// Trace the notification linked to the evaluations of its alerts, which can happen
+			// in other reconciles, so slow alerts can be followed from the query to the receiver
+			links := []trace.Link{}
+			for _, alert := range sentNotification.alerts {
+				if alert.SpanContext.IsValid() {
+					links = append(links, trace.Link{SpanContext: alert.SpanContext})
 				}
 			}
+			notificationCtx, span := tracing.Start(ctx, "RulerAction.Notify", trace.WithLinks(links...),
+				trace.WithAttributes(attribute.Int("searchruler.alerts", len(sentNotification.alerts))))
 
-			// Add data to the payload of the request
-			payload := []byte(parsedMessage)
-			httpRequest.Body = io.NopCloser(bytes.NewBuffer(payload))
-
-			// Send HTTP request to the webhook
-			httpResponse, err := httpClient.Do(httpRequest)
+			err := sendNotification(notificationCtx, sentNotification, payload)
+			tracing.End(span, err)
+			resultsMutex.Lock()
 			if err != nil {
-				r.UpdateConditionConnectionError(resource, resourceType)
-				return fmt.Errorf(controller.HttpRequestSendingErrorMessage, err)
+				sendErrs = append(sendErrs, err)
+				resultsMutex.Unlock()
+				return
+			}
+			delivered++
+			resultsMutex.Unlock()
+
+			// Save the time of the notification for the group
+			if sentNotification.groupKey != "" {
+				r.setGroupNotified(sentNotification.groupKey, time.Now())
 			}
 
-			defer httpResponse.Body.Close()
+			// Resolved alerts are notified just once, so remove them from the pool
+			for i, alert := range sentNotification.alerts {
+				r.setAlertNotified(sentNotification.alertKeys[i], alert.Status, time.Now())
+				if alert.Status == pools.AlertStatusResolved {
+					r.AlertsPool.Delete(sentNotification.alertKeys[i])
+				}
+			}
+		}(pendingNotification, payload)
+	}
+	wg.Wait()
+	return delivered, sendErrs
+}
+
+// getProbeNotification returns the notification sent to test the recovery of the integration when the circuit
+// breaker is half-open. It is the first notification with a payload, so the same one is retried every time
+func getProbeNotification(notifications []*notification, payloads map[*notification][]byte) *notification {
+	for _, notification := range notifications {
+		if _, hasPayload := payloads[notification]; hasPayload {
+			return notification
 		}
 	}
+	return nil
+}
+
+// getNotificationPayload evaluates the template of the notification and executes the validator of the
+// webhook and the payload schema, if defined, returning the payload to send
+func (r *RulerActionReconciler) getNotificationPayload(resource *CompoundRulerActionResource, resourceType string, notification *notification) (payload []byte, err error) {
+
+	action := getRulerAction(resource, resourceType)
+
+	// Evaluate the data template with the injected object
+	parsedMessage, err := template.EvaluateTemplate(notification.template, notification.data)
+	if err != nil {
+		r.UpdateConditionEvaluateTemplateError(resource, resourceType)
+		return nil, fmt.Errorf(controller.EvaluateTemplateErrorMessage, err)
+	}
+
+	// Check if the webhook has a validator and execute it when available
+	if action.spec.Webhook.Validator != "" {
+
+		// Check if the validator is available
+		_, validatorFound := validatorsMap[action.spec.Webhook.Validator]
+		if !validatorFound {
+			r.UpdateConditionEvaluateTemplateError(resource, resourceType)
+			return nil, fmt.Errorf(controller.ValidatorNotFoundErrorMessage, action.spec.Webhook.Validator)
+		}
+
+		// Execute the validator to the data of the alert
+		validatorResult, validatorHint, err := validatorsMap[action.spec.Webhook.Validator](parsedMessage)
+		if err != nil {
+			r.UpdateConditionEvaluateTemplateError(resource, resourceType)
+			return nil, fmt.Errorf(controller.ValidationFailedErrorMessage, err.Error())
+		}
+
+		// Check the result of the validator
+		if !validatorResult {
+			r.UpdateConditionEvaluateTemplateError(resource, resourceType)
+			return nil, fmt.Errorf(controller.ValidationFailedErrorMessage, validatorHint)
+		}
+	}
+
+	// Check the payload against the JSON Schema of the receiver when defined. Payloads not
+	// matching it are not sent
+	if action.spec.PayloadSchema != nil {
+		err = validatePayloadSchema(action.spec.PayloadSchema, parsedMessage)
+		if err != nil {
+			r.UpdateConditionEvaluateTemplateError(resource, resourceType)
+			return nil, err
+		}
+	}
+
+	return []byte(parsedMessage), nil
+}
+
+// notificationSender sends the payload of a notification to the integration configured in the RulerAction
+type notificationSender func(ctx context.Context, notification *notification, payload []byte) error
+
+// getNotificationSender returns the sender of the integration configured in the RulerAction
+func (r *RulerActionReconciler) getNotificationSender(ctx context.Context, resource *CompoundRulerActionResource, resourceType string) (notificationSender, error) {
+	action := getRulerAction(resource, resourceType)
+	switch {
+	case !reflect.ValueOf(action.spec.Teams).IsZero():
+		return r.getTeamsSender(ctx, resource, resourceType)
+	case !reflect.ValueOf(action.spec.Discord).IsZero():
+		return r.getDiscordSender(ctx, resource, resourceType)
+	case !reflect.ValueOf(action.spec.Email).IsZero():
+		return r.getEmailSender(ctx, resource, resourceType)
+	case !reflect.ValueOf(action.spec.Opsgenie).IsZero():
+		return r.getOpsgenieSender(ctx, resource, resourceType)
+	case !reflect.ValueOf(action.spec.Alertmanager).IsZero():
+		return r.getAlertmanagerSender(ctx, resource, resourceType)
+	case !reflect.ValueOf(action.spec.Webhook).IsZero():
+		return r.getWebhookSender(ctx, resource, resourceType)
+	}
+	return nil, fmt.Errorf(controller.IntegrationNotDefinedErrorMessage, action.name)
+}
+
+// getSecret returns the secret of the secretRef. When the namespace is not defined in the secretRef,
+// the secret must be in the same namespace as the RulerAction resource
+func (r *RulerActionReconciler) getSecret(ctx context.Context, resource *CompoundRulerActionResource, resourceType string,
+	secretRef v1alpha1.SecretRef) (*corev1.Secret, error) {
+
+	secret := &corev1.Secret{}
+	secretNamespace := secretRef.Namespace
+	if secretNamespace == "" {
+		secretNamespace = getRulerAction(resource, resourceType).namespace
+	}
+	namespacedName := types.NamespacedName{
+		Namespace: secretNamespace,
+		Name:      secretRef.Name,
+	}
+	err := r.Get(ctx, namespacedName, secret)
+	if err != nil {
+		r.UpdateConditionNoCredsFound(resource, resourceType)
+		return nil, fmt.Errorf(controller.SecretNotFoundErrorMessage, namespacedName, err)
+	}
+
+	return secret, nil
+}
+
+// postJSON sends the payload to the URL with a POST request
+func postJSON(ctx context.Context, httpClient *http.Client, url string, payload []byte) error {
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	httpResponse, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf(controller.HttpRequestSendingErrorMessage, err)
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf(controller.HttpResponseErrorMessage, url, httpResponse.Status)
+	}
 
-	// Updates status to Success
-	r.UpdateStateSuccess(resource, resourceType)
 	return nil
 }
 
+// getHttpClient returns the http client for the requests of the integration. Requests go through the proxy
+// of the RulerAction, or the proxy of the environment when it is not defined, and are identified with the
+// User-Agent of the RulerAction
+func getHttpClient(spec *v1alpha1.RulerActionSpec, tlsConfig *tls.Config) (*http.Client, error) {
+
+	proxy, err := globals.GetProxy(spec.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf(controller.ProxyUrlParseErrorMessage, spec.Proxy, err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: otelhttp.NewTransport(globals.NewUserAgentTransport(transport, spec.UserAgent))}, nil
+}
+
 // GetRuleActionFromEvent returns the RulerAction resource associated with the event that triggered the reconcile
 func (r *RulerActionReconciler) GetEventRuleAction(ctx context.Context, ruleAction *CompoundRulerActionResource, namespace, name string) (resourceType string, err error) {
 
@@ -221,13 +464,22 @@ func (r *RulerActionReconciler) GetEventRuleAction(ctx context.Context, ruleActi
 		)
 	}
 
-	// Get SearchRule resource from event resource
+	// Get SearchRule resource from event resource. Events without namespace in the involved
+	// object are created by ClusterSearchRules
 	searchRule := &v1alpha1.SearchRule{}
 	searchRuleNamespacedName := types.NamespacedName{
 		Namespace: EventResource.InvolvedObject.Namespace,
 		Name:      EventResource.InvolvedObject.Name,
 	}
-	err = r.Get(ctx, searchRuleNamespacedName, searchRule)
+	if searchRuleNamespacedName.Namespace == "" {
+		clusterSearchRule := &v1alpha1.ClusterSearchRule{}
+		err = r.Get(ctx, searchRuleNamespacedName, clusterSearchRule)
+		if err == nil {
+			searchRule = clusterSearchRule.ToSearchRule()
+		}
+	} else {
+		err = r.Get(ctx, searchRuleNamespacedName, searchRule)
+	}
 	if err != nil {
 		return resourceType, fmt.Errorf(
 			"error fetching SearchRule %s from event %s: %v",
@@ -237,6 +489,12 @@ func (r *RulerActionReconciler) GetEventRuleAction(ctx context.Context, ruleActi
 		)
 	}
 
+	// RulerActions are fetched without the cache, so the namespaces out of --watch-namespaces are rejected here
+	if !globals.IsNamespaceWatched(searchRule.Spec.ActionRef.Namespace) {
+		return resourceType, fmt.Errorf(controller.NamespaceNotWatchedErrorMessage, controller.RulerActionResourceType,
+			searchRule.Spec.ActionRef.Name, searchRule.Spec.ActionRef.Namespace)
+	}
+
 	gvr := schema.GroupVersionResource{
 		Group:    v1alpha1.GroupVersion.Group,
 		Version:  v1alpha1.GroupVersion.Version,
@@ -286,18 +544,232 @@ func (r *RulerActionReconciler) GetEventRuleAction(ctx context.Context, ruleActi
 	return resourceType, nil
 }
 
-// getRulerActionAssociatedAlerts returns all alerts associated with the RulerAction
-func (r *RulerActionReconciler) getRulerActionAssociatedAlerts(resourceName string) (alerts []*pools.Alert, err error) {
+// getRulerActionAssociatedAlerts returns all alerts associated with the RulerAction, indexed by their key in the pool.
+// The namespace is compared too, so RulerActions with the same name in different namespaces, or a ClusterRulerAction,
+// do not collect the alerts of each other
+func (r *RulerActionReconciler) getRulerActionAssociatedAlerts(namespace, name string) (alerts map[string]*pools.Alert, err error) {
 
 	// Get all alerts from the AlertsPool
 	alertsPool := r.AlertsPool.GetAll()
 
 	// Iterate over the alerts in the pool and check if the alert is associated with the RulerAction
-	for _, alert := range alertsPool {
-		if alert.RulerActionName == resourceName {
-			alerts = append(alerts, alert)
+	rulerActionKey := pools.GetKey(namespace, name)
+	alerts = map[string]*pools.Alert{}
+	for key, alert := range alertsPool {
+		if pools.GetKey(alert.SearchRule.Spec.ActionRef.Namespace, alert.RulerActionName) == rulerActionKey {
+			alerts[key] = alert
 		}
 	}
 
 	return alerts, nil
 }
+
+// notification represents a single webhook call of the RulerAction. It contains one alert, or a group
+// of alerts when groupBy is defined in the RulerAction
+type notification struct {
+	groupKey  string
+	alertKeys []string
+	alerts    []*pools.Alert
+	template  string
+	data      map[string]interface{}
+}
+
+// getAlertTemplateData returns the data injected in the template for an alert
+func getAlertTemplateData(alert *pools.Alert) map[string]interface{} {
+
+	// object is the SearchRule object and value is the value of the alert
+	// to be accessible in the template
+	templateInjectedObject := map[string]interface{}{}
+	templateInjectedObject["value"] = alert.Value
+	templateInjectedObject["object"] = alert.SearchRule
+	templateInjectedObject["aggregations"] = alert.Aggregations
+	templateInjectedObject["status"] = alert.Status
+	templateInjectedObject["severity"] = alert.Severity
+	templateInjectedObject["labels"] = alert.Labels
+	templateInjectedObject["team"] = alert.SearchRule.Labels[controller.TeamLabel]
+	templateInjectedObject["annotations"] = alert.Annotations
+	templateInjectedObject["startsAt"] = alert.FiringTime
+	templateInjectedObject["endsAt"] = alert.ResolvedTime
+	templateInjectedObject["activeDuration"] = getAlertActiveDuration(alert, time.Now())
+	templateInjectedObject["query"] = alert.Query
+	templateInjectedObject["index"] = alert.SearchRule.Spec.Elasticsearch.GetIndex()
+	templateInjectedObject["connectorUrl"] = alert.ConnectorURL
+	templateInjectedObject["samples"] = alert.Samples
+
+	return templateInjectedObject
+}
+
+// getAlertActiveDuration returns the time the alert has been firing. For resolved alerts, it is the
+// time between the start of the alert and its resolution
+func getAlertActiveDuration(alert *pools.Alert, now time.Time) time.Duration {
+	if alert.FiringTime.IsZero() {
+		return 0
+	}
+	if alert.Status == pools.AlertStatusResolved && !alert.ResolvedTime.IsZero() {
+		now = alert.ResolvedTime
+	}
+	return now.Sub(alert.FiringTime).Round(time.Second)
+}
+
+// getAlertTemplate returns the message template of the alert. The messageTemplate of the SearchRule takes
+// precedence over the data of the actionRef, so the same RulerAction can send rule specific messages
+func getAlertTemplate(alert *pools.Alert) string {
+	if alert.SearchRule.Spec.MessageTemplate != "" {
+		return alert.SearchRule.Spec.MessageTemplate
+	}
+	return alert.SearchRule.Spec.ActionRef.Data
+}
+
+// buildNotifications returns the notifications to send for the alerts. When groupBy is not defined
+// in the RulerAction, every alert is a notification. In other case, alerts sharing the same values
+// for the groupBy labels are collapsed in a single notification
+func (r *RulerActionReconciler) buildNotifications(action *rulerAction, alerts map[string]*pools.Alert) (notifications []*notification, err error) {
+
+	// Sort the alerts keys to keep the order of the alerts in the notifications
+	alertKeys := make([]string, 0, len(alerts))
+	for alertKey := range alerts {
+		alertKeys = append(alertKeys, alertKey)
+	}
+	sort.Strings(alertKeys)
+
+	// No grouping, one notification per alert
+	if len(action.spec.GroupBy) == 0 {
+		for _, alertKey := range alertKeys {
+			notifications = append(notifications, &notification{
+				alertKeys: []string{alertKey},
+				alerts:    []*pools.Alert{alerts[alertKey]},
+				template:  getAlertTemplate(alerts[alertKey]),
+				data:      getAlertTemplateData(alerts[alertKey]),
+			})
+		}
+		return notifications, nil
+	}
+
+	// Parse the group window. Groups notified inside this window are not notified again
+	groupWindow := time.Duration(0)
+	if action.spec.GroupWindow != "" {
+		groupWindow, err = time.ParseDuration(action.spec.GroupWindow)
+		if err != nil {
+			return notifications, err
+		}
+	}
+
+	// Group the alerts by the values of the groupBy labels of the SearchRule
+	groups := map[string]*notification{}
+	groupKeys := []string{}
+	for _, alertKey := range alertKeys {
+		alert := alerts[alertKey]
+		groupKey, groupLabels := getAlertGroup(action, alert)
+
+		group, groupExists := groups[groupKey]
+		if !groupExists {
+			// The template and the data of the first alert are used for the whole group
+			group = &notification{
+				groupKey: groupKey,
+				template: getAlertTemplate(alert),
+				data:     getAlertTemplateData(alert),
+			}
+			group.data["groupLabels"] = groupLabels
+			groups[groupKey] = group
+			groupKeys = append(groupKeys, groupKey)
+		}
+		group.alertKeys = append(group.alertKeys, alertKey)
+		group.alerts = append(group.alerts, alert)
+	}
+
+	// Add the list of alerts to the template data of every group and discard
+	// the groups notified inside the group window
+	for _, groupKey := range groupKeys {
+		group := groups[groupKey]
+		if lastNotified, notified := r.getGroupNotified(groupKey); notified && time.Since(lastNotified) < groupWindow {
+			continue
+		}
+
+		groupAlerts := []map[string]interface{}{}
+		for _, alert := range group.alerts {
+			groupAlerts = append(groupAlerts, getAlertTemplateData(alert))
+		}
+		group.data["alerts"] = groupAlerts
+
+		notifications = append(notifications, group)
+	}
+
+	return notifications, nil
+}
+
+// getAlertGroup returns the key of the group of the alert and the values of its groupBy labels. Labels
+// of the alert take precedence over the labels of the SearchRule metadata
+func getAlertGroup(action *rulerAction, alert *pools.Alert) (groupKey string, groupLabels map[string]string) {
+	groupLabels = map[string]string{}
+	groupValues := []string{}
+	for _, label := range action.spec.GroupBy {
+		groupLabel, labelExists := alert.Labels[label]
+		if !labelExists {
+			groupLabel = alert.SearchRule.Labels[label]
+		}
+		groupLabels[label] = groupLabel
+		groupValues = append(groupValues, fmt.Sprintf("%s=%q", label, groupLabel))
+	}
+	groupKey = fmt.Sprintf("%s{%s}", pools.GetKey(action.namespace, action.name), strings.Join(groupValues, ","))
+	return groupKey, groupLabels
+}
+
+// getGroupNotified returns the last time a group of alerts was notified
+func (r *RulerActionReconciler) getGroupNotified(groupKey string) (lastNotified time.Time, notified bool) {
+	r.groupsMutex.Lock()
+	defer r.groupsMutex.Unlock()
+	lastNotified, notified = r.notifiedGroups[groupKey]
+	return lastNotified, notified
+}
+
+// getThrottledAlerts returns the keys of the firing alerts notified less than minInterval ago. The first
+// notification of an alert and the notification of its resolution are never throttled
+func (r *RulerActionReconciler) getThrottledAlerts(alerts map[string]*pools.Alert, minInterval time.Duration, now time.Time) (throttledKeys []string) {
+	if minInterval <= 0 {
+		return throttledKeys
+	}
+
+	r.alertsMutex.Lock()
+	defer r.alertsMutex.Unlock()
+	for alertKey, alert := range alerts {
+		lastNotified, notified := r.notifiedAlerts[alertKey]
+		if alert.Status == pools.AlertStatusFiring && notified && now.Sub(lastNotified) < minInterval {
+			throttledKeys = append(throttledKeys, alertKey)
+		}
+	}
+	sort.Strings(throttledKeys)
+	return throttledKeys
+}
+
+// isAlertNotified returns true when the alert was notified while firing and its resolution was not notified yet
+func (r *RulerActionReconciler) isAlertNotified(alertKey string) bool {
+	r.alertsMutex.Lock()
+	defer r.alertsMutex.Unlock()
+	_, notified := r.notifiedAlerts[alertKey]
+	return notified
+}
+
+// setAlertNotified saves the last time a firing alert was notified. Resolved alerts are forgotten,
+// so the next time they fire they are notified immediately
+func (r *RulerActionReconciler) setAlertNotified(alertKey string, status string, lastNotified time.Time) {
+	r.alertsMutex.Lock()
+	defer r.alertsMutex.Unlock()
+	if status == pools.AlertStatusResolved {
+		delete(r.notifiedAlerts, alertKey)
+		return
+	}
+	if r.notifiedAlerts == nil {
+		r.notifiedAlerts = map[string]time.Time{}
+	}
+	r.notifiedAlerts[alertKey] = lastNotified
+}
+
+// setGroupNotified saves the last time a group of alerts was notified
+func (r *RulerActionReconciler) setGroupNotified(groupKey string, lastNotified time.Time) {
+	r.groupsMutex.Lock()
+	defer r.groupsMutex.Unlock()
+	if r.notifiedGroups == nil {
+		r.notifiedGroups = map[string]time.Time{}
+	}
+	r.notifiedGroups[groupKey] = lastNotified
+}
@@ -0,0 +1,1127 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/globals"
+	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/template"
+)
+
+var _ = Describe("sendWebhook", func() {
+
+	var (
+		server        *httptest.Server
+		authorization chan string
+		statusCodes   []int
+		requests      int
+		userAgent     string
+		spec          *v1alpha1.RulerActionSpec
+	)
+
+	BeforeEach(func() {
+		authorization = make(chan string, 1)
+		statusCodes = []int{}
+		requests = 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests++
+			userAgent = req.Header.Get("User-Agent")
+			if len(statusCodes) > 0 {
+				w.WriteHeader(statusCodes[0])
+				_, _ = w.Write([]byte("invalid alert"))
+				statusCodes = statusCodes[1:]
+				return
+			}
+			authorization <- req.Header.Get("Authorization")
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		spec = &v1alpha1.RulerActionSpec{
+			Webhook: v1alpha1.Webhook{
+				Url:  server.URL,
+				Verb: http.MethodPost,
+			},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should attach the Authorization header when the webhook is authenticated", func() {
+		err := sendWebhook(context.Background(), &spec.Webhook, server.Client(), server.URL, []byte("{}"), "user", "pass", time.Millisecond)
+		Expect(err).NotTo(HaveOccurred())
+
+		request, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+		request.SetBasicAuth("user", "pass")
+		Expect(<-authorization).To(Equal(request.Header.Get("Authorization")))
+	})
+
+	It("should not attach the Authorization header when the webhook is not authenticated", func() {
+		err := sendWebhook(context.Background(), &spec.Webhook, server.Client(), server.URL, []byte("{}"), "", "", time.Millisecond)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(<-authorization).To(BeEmpty())
+	})
+
+	It("should identify the deliveries with the User-Agent of the RulerAction", func() {
+		httpClient, err := getHttpClient(spec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sendWebhook(context.Background(), &spec.Webhook, httpClient, server.URL, []byte("{}"), "", "", time.Millisecond)).To(Succeed())
+		Expect(userAgent).To(Equal("searchruler/" + globals.Version))
+		<-authorization
+
+		spec.UserAgent = "auditing/1.0"
+		httpClient, err = getHttpClient(spec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sendWebhook(context.Background(), &spec.Webhook, httpClient, server.URL, []byte("{}"), "", "", time.Millisecond)).To(Succeed())
+		Expect(userAgent).To(Equal("auditing/1.0"))
+	})
+
+	It("should retry the deliveries failing with transient errors", func() {
+		spec.Webhook.Retry.MaxRetries = 2
+		statusCodes = []int{http.StatusBadGateway, http.StatusTooManyRequests}
+
+		err := sendWebhook(context.Background(), &spec.Webhook, server.Client(), server.URL, []byte("{}"), "", "", time.Millisecond)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests).To(Equal(3))
+	})
+
+	It("should fail when the retries are exhausted", func() {
+		spec.Webhook.Retry.MaxRetries = 1
+		statusCodes = []int{http.StatusInternalServerError, http.StatusInternalServerError}
+
+		err := sendWebhook(context.Background(), &spec.Webhook, server.Client(), server.URL, []byte("{}"), "", "", time.Millisecond)
+		var responseErr *webhookResponseError
+		Expect(errors.As(err, &responseErr)).To(BeTrue())
+		Expect(requests).To(Equal(2))
+	})
+
+	It("should stop waiting for the retry when the context is done", func() {
+		spec.Webhook.Retry.MaxRetries = 2
+		statusCodes = []int{http.StatusBadGateway}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := sendWebhook(ctx, &spec.Webhook, server.Client(), server.URL, []byte("{}"), "", "", time.Hour)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+		Expect(requests).To(Equal(1))
+	})
+
+	It("should cap the backoff between the retries", func() {
+		Expect(getWebhookBackoff(time.Second, 0)).To(Equal(time.Second))
+		Expect(getWebhookBackoff(time.Second, 3)).To(Equal(8 * time.Second))
+		Expect(getWebhookBackoff(time.Second, 10)).To(Equal(webhookMaxBackoff))
+		Expect(getWebhookBackoff(time.Second, 100)).To(Equal(webhookMaxBackoff))
+		Expect(getWebhookBackoff(time.Hour, 1)).To(Equal(webhookMaxBackoff))
+	})
+
+	It("should not retry the deliveries rejected by the webhook", func() {
+		spec.Webhook.Retry.MaxRetries = 2
+		statusCodes = []int{http.StatusBadRequest}
+
+		err := sendWebhook(context.Background(), &spec.Webhook, server.Client(), server.URL, []byte("{}"), "", "", time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("not retried: invalid alert")))
+		Expect(requests).To(Equal(1))
+	})
+
+	It("should take any 2xx response as delivered without successStatusCodes", func() {
+		statusCodes = []int{http.StatusNoContent}
+		Expect(sendWebhook(context.Background(), &spec.Webhook, server.Client(), server.URL, []byte("{}"), "", "", time.Millisecond)).To(Succeed())
+
+		statusCodes = []int{http.StatusNotModified}
+		err := sendWebhook(context.Background(), &spec.Webhook, server.Client(), server.URL, []byte("{}"), "", "", time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("304")))
+	})
+
+	It("should take just the successStatusCodes as delivered when they are defined", func() {
+		spec.Webhook.SuccessStatusCodes = []int{http.StatusAccepted}
+		statusCodes = []int{http.StatusAccepted}
+		Expect(sendWebhook(context.Background(), &spec.Webhook, server.Client(), server.URL, []byte("{}"), "", "", time.Millisecond)).To(Succeed())
+
+		statusCodes = []int{http.StatusOK}
+		err := sendWebhook(context.Background(), &spec.Webhook, server.Client(), server.URL, []byte("{}"), "", "", time.Millisecond)
+		var responseErr *webhookResponseError
+		Expect(errors.As(err, &responseErr)).To(BeTrue())
+		Expect(requests).To(Equal(2))
+	})
+
+	It("should evaluate the URL of the webhook with the data of the notification", func() {
+		spec.Webhook.Url = server.URL + "/channels/{{ .labels.service }}"
+		webhookURL, err := getWebhookURL(&spec.Webhook, &notification{
+			data: map[string]interface{}{"labels": map[string]string{"service": "checkout"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(webhookURL).To(Equal(server.URL + "/channels/checkout"))
+	})
+
+	It("should not send the alerts when the evaluated URL is invalid", func() {
+		spec.Webhook.Url = "{{ .labels.endpoint }}"
+		_, err := getWebhookURL(&spec.Webhook, &notification{
+			data: map[string]interface{}{"labels": map[string]string{"endpoint": "checkout"}},
+		})
+		Expect(err).To(MatchError(ContainSubstring("invalid url checkout")))
+	})
+
+	It("should not build the sender of webhooks with verbs without body", func() {
+		spec.Webhook.Verb = http.MethodGet
+		resource := &CompoundRulerActionResource{RulerActionResource: &v1alpha1.RulerAction{Spec: *spec}}
+
+		_, err := (&RulerActionReconciler{}).getWebhookSender(context.Background(), resource, controller.RulerActionResourceType)
+		Expect(err).To(HaveOccurred())
+		Expect(resource.RulerActionResource.Status.Conditions).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("getAlertTemplateData", func() {
+
+	It("should inject the aggregations of the alert in the template", func() {
+		aggregations := gjson.Get(`{
+			"aggregations": {
+				"hosts": {
+					"buckets": [
+						{"key": "host-a", "doc_count": 10},
+						{"key": "host-b", "doc_count": 20}
+					]
+				}
+			}
+		}`, "aggregations").Value()
+
+		alert := &pools.Alert{
+			Status:       pools.AlertStatusFiring,
+			Value:        30,
+			Aggregations: aggregations,
+		}
+
+		result, err := template.EvaluateTemplate(
+			`{{- range .aggregations.hosts.buckets }}{{ .key }}={{ .doc_count }};{{ end -}}`,
+			getAlertTemplateData(alert),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal("host-a=10;host-b=20;"))
+	})
+
+	It("should inject the team owning the rule in the template", func() {
+		alert := &pools.Alert{Status: pools.AlertStatusFiring}
+		alert.SearchRule.Labels = map[string]string{controller.TeamLabel: "payments"}
+
+		result, err := template.EvaluateTemplate(`{{ .team }}`, getAlertTemplateData(alert))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal("payments"))
+	})
+
+	It("should inject the query, the index and the connector URL of the alert in the template", func() {
+		alert := &pools.Alert{
+			Status:       pools.AlertStatusFiring,
+			Query:        `{"query":{"match_all":{}}}`,
+			ConnectorURL: "https://elasticsearch:9200",
+		}
+		alert.SearchRule.Spec.Elasticsearch.Index = "logs-*"
+
+		result, err := template.EvaluateTemplate(
+			`{{ .connectorUrl }}/{{ .index }} {{ .query }} {{ .object.Spec.Elasticsearch.Index }}`,
+			getAlertTemplateData(alert),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(`https://elasticsearch:9200/logs-* {"query":{"match_all":{}}} logs-*`))
+	})
+})
+
+var _ = Describe("getRulerActionAssociatedAlerts", func() {
+
+	newAlert := func(actionNamespace, actionName string) *pools.Alert {
+		alert := &pools.Alert{RulerActionName: actionName}
+		alert.SearchRule.Spec.ActionRef = v1alpha1.ActionRef{Name: actionName, Namespace: actionNamespace}
+		return alert
+	}
+
+	It("should not collect the alerts of RulerActions with the same name in other namespaces", func() {
+		reconciler := &RulerActionReconciler{AlertsPool: &pools.AlertsStore{Store: map[string]*pools.Alert{
+			pools.GetKey("team-a", "rule"): newAlert("team-a", "action"),
+			pools.GetKey("team-b", "rule"): newAlert("team-b", "action"),
+			pools.GetKey("team-c", "rule"): newAlert("", "action"),
+		}}}
+
+		alerts, err := reconciler.getRulerActionAssociatedAlerts("team-a", "action")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alerts).To(HaveLen(1))
+		Expect(alerts).To(HaveKey(pools.GetKey("team-a", "rule")))
+
+		alerts, err = reconciler.getRulerActionAssociatedAlerts("", "action")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alerts).To(HaveLen(1))
+		Expect(alerts).To(HaveKey(pools.GetKey("team-c", "rule")))
+	})
+})
+
+var _ = Describe("getAlertActiveDuration", func() {
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	It("should return the time since the alert started firing", func() {
+		alert := &pools.Alert{Status: pools.AlertStatusFiring, FiringTime: start}
+		Expect(getAlertActiveDuration(alert, start.Add(90*time.Second))).To(Equal(90 * time.Second))
+	})
+
+	It("should return the time between the start and the resolution of resolved alerts", func() {
+		alert := &pools.Alert{Status: pools.AlertStatusResolved, FiringTime: start, ResolvedTime: start.Add(time.Hour)}
+		Expect(getAlertActiveDuration(alert, start.Add(2*time.Hour))).To(Equal(time.Hour))
+	})
+
+	It("should return zero when the start of the alert is unknown", func() {
+		alert := &pools.Alert{Status: pools.AlertStatusFiring}
+		Expect(getAlertActiveDuration(alert, start)).To(BeZero())
+	})
+})
+
+var _ = Describe("getAlertTemplate", func() {
+
+	It("should prefer the message template of the SearchRule", func() {
+		alert := &pools.Alert{}
+		alert.SearchRule.Spec.ActionRef.Data = "action data"
+		Expect(getAlertTemplate(alert)).To(Equal("action data"))
+
+		alert.SearchRule.Spec.MessageTemplate = "rule message"
+		Expect(getAlertTemplate(alert)).To(Equal("rule message"))
+	})
+})
+
+var _ = Describe("getThrottledAlerts", func() {
+
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	It("should throttle the firing alerts notified inside the min interval", func() {
+		reconciler := &RulerActionReconciler{}
+		alerts := map[string]*pools.Alert{
+			"default_rule": {Status: pools.AlertStatusFiring},
+		}
+		Expect(reconciler.getThrottledAlerts(alerts, time.Minute, now)).To(BeEmpty())
+
+		reconciler.setAlertNotified("default_rule", pools.AlertStatusFiring, now)
+		Expect(reconciler.getThrottledAlerts(alerts, time.Minute, now.Add(30*time.Second))).To(ConsistOf("default_rule"))
+		Expect(reconciler.getThrottledAlerts(alerts, time.Minute, now.Add(time.Minute))).To(BeEmpty())
+		Expect(reconciler.getThrottledAlerts(alerts, 0, now)).To(BeEmpty())
+	})
+
+	It("should not throttle the resolution of the alerts", func() {
+		reconciler := &RulerActionReconciler{}
+		reconciler.setAlertNotified("default_rule", pools.AlertStatusFiring, now)
+
+		alerts := map[string]*pools.Alert{
+			"default_rule": {Status: pools.AlertStatusResolved},
+		}
+		Expect(reconciler.getThrottledAlerts(alerts, time.Minute, now)).To(BeEmpty())
+	})
+
+	It("should notify immediately the alerts firing again after being resolved", func() {
+		reconciler := &RulerActionReconciler{}
+		reconciler.setAlertNotified("default_rule", pools.AlertStatusFiring, now)
+		reconciler.setAlertNotified("default_rule", pools.AlertStatusResolved, now)
+
+		alerts := map[string]*pools.Alert{
+			"default_rule": {Status: pools.AlertStatusFiring},
+		}
+		Expect(reconciler.getThrottledAlerts(alerts, time.Minute, now)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("getDiscordMessage", func() {
+
+	It("should color the embed by the severity and the state of the alert", func() {
+		alert := &pools.Alert{Status: pools.AlertStatusFiring}
+		alert.SearchRule.Namespace = "default"
+		alert.SearchRule.Name = "rule"
+		alert.SearchRule.Spec.Severity = "critical"
+		sentNotification := &notification{
+			alerts: []*pools.Alert{alert},
+			data:   getAlertTemplateData(alert),
+		}
+
+		message, err := getDiscordMessage(sentNotification, "", "description")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gjson.GetBytes(message, "embeds.0.title").String()).To(Equal("[FIRING] default/rule"))
+		Expect(gjson.GetBytes(message, "embeds.0.description").String()).To(Equal("description"))
+		Expect(gjson.GetBytes(message, "embeds.0.color").Int()).To(Equal(int64(0xD50000)))
+
+		alert.Status = pools.AlertStatusResolved
+		message, err = getDiscordMessage(sentNotification, "", "description")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gjson.GetBytes(message, "embeds.0.color").Int()).To(Equal(int64(discordResolvedColor)))
+	})
+})
+
+var _ = Describe("getAlertmanagerAlerts", func() {
+
+	It("should build the Alertmanager alerts with endsAt for the resolved alerts", func() {
+		firingTime := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		alert := &pools.Alert{
+			Status:      pools.AlertStatusFiring,
+			Severity:    "critical",
+			Labels:      map[string]string{"team": "platform"},
+			Annotations: map[string]string{"runbook": "https://runbooks/rule"},
+			FiringTime:  firingTime,
+		}
+		alert.SearchRule.Namespace = "default"
+		alert.SearchRule.Name = "rule"
+		sentNotification := &notification{alerts: []*pools.Alert{alert}}
+
+		alerts := getAlertmanagerAlerts(sentNotification, "summary")
+		Expect(alerts).To(HaveLen(1))
+		Expect(alerts[0].Labels).To(Equal(map[string]string{
+			"alertname": "rule",
+			"namespace": "default",
+			"severity":  "critical",
+			"team":      "platform",
+		}))
+		Expect(alerts[0].Annotations).To(Equal(map[string]string{"summary": "summary", "runbook": "https://runbooks/rule"}))
+		Expect(alerts[0].StartsAt).To(Equal("2024-01-01T10:00:00Z"))
+		Expect(alerts[0].EndsAt).To(BeEmpty())
+
+		alert.Status = pools.AlertStatusResolved
+		alert.ResolvedTime = firingTime.Add(time.Hour)
+		alerts = getAlertmanagerAlerts(sentNotification, "summary")
+		Expect(alerts[0].EndsAt).To(Equal("2024-01-01T11:00:00Z"))
+
+		// The team of the rule is a label when it is not defined in the labels of the alert
+		alert.Labels = nil
+		alert.SearchRule.Labels = map[string]string{controller.TeamLabel: "payments"}
+		alerts = getAlertmanagerAlerts(sentNotification, "summary")
+		Expect(alerts[0].Labels).To(HaveKeyWithValue("team", "payments"))
+	})
+})
+
+var _ = Describe("getNotificationPayload", func() {
+
+	// The raw template is not valid JSON, just the rendered payload is validated
+	const alertmanagerTemplate = `{{ if eq .status "firing" }}` +
+		`[{"labels": {"alertname": "{{ .object.Name }}"}, "annotations": {}, "startsAt": "{{ .startsAt }}"}]` +
+		`{{ else }}[{"labels": {}, "annotations": {}, "startsAt": "{{ .startsAt }}"}]{{ end }}`
+
+	It("should validate the rendered payload instead of the template", func() {
+		resource := &CompoundRulerActionResource{RulerActionResource: &v1alpha1.RulerAction{
+			Spec: v1alpha1.RulerActionSpec{Webhook: v1alpha1.Webhook{Validator: "alertmanager"}},
+		}}
+		alert := &pools.Alert{Status: pools.AlertStatusFiring, FiringTime: time.Now()}
+		alert.SearchRule.Name = "rule"
+
+		payload, err := (&RulerActionReconciler{}).getNotificationPayload(resource, controller.RulerActionResourceType,
+			&notification{template: alertmanagerTemplate, data: getAlertTemplateData(alert)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gjson.GetBytes(payload, "0.labels.alertname").String()).To(Equal("rule"))
+
+		alert.Status = pools.AlertStatusResolved
+		_, err = (&RulerActionReconciler{}).getNotificationPayload(resource, controller.RulerActionResourceType,
+			&notification{template: alertmanagerTemplate, data: getAlertTemplateData(alert)})
+		Expect(err).To(MatchError(ContainSubstring("label 'alertname' not found")))
+		Expect(resource.RulerActionResource.Status.Conditions).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("validatePayloadSchema", func() {
+
+	schema := &apiextensionsv1.JSON{Raw: []byte(`{
+		"type": "object",
+		"required": ["text"],
+		"properties": {"text": {"type": "string", "minLength": 1}}
+	}`)}
+
+	It("should accept the payloads matching the schema", func() {
+		Expect(validatePayloadSchema(schema, `{"text": "alert firing"}`)).To(Succeed())
+	})
+
+	It("should reject the payloads not matching the schema", func() {
+		Expect(validatePayloadSchema(schema, `{"message": "alert firing"}`)).To(MatchError(ContainSubstring("Required value")))
+		Expect(validatePayloadSchema(schema, `{"text": ""}`)).To(HaveOccurred())
+		Expect(validatePayloadSchema(schema, `not json`)).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("getHttpClient", func() {
+
+	It("should send the requests through the proxy of the RulerAction", func() {
+		proxiedHost := make(chan string, 1)
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			proxiedHost <- req.Host
+		}))
+		defer proxy.Close()
+		httpClient, err := getHttpClient(&v1alpha1.RulerActionSpec{Proxy: proxy.URL}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(postJSON(context.Background(), httpClient, "http://hooks.example.invalid/alerts", []byte(`{}`))).To(Succeed())
+		Expect(proxiedHost).To(Receive(Equal("hooks.example.invalid")))
+	})
+
+	It("should fail with invalid proxy URLs", func() {
+		_, err := getHttpClient(&v1alpha1.RulerActionSpec{Proxy: "proxy:3128"}, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("FlushPendingAlerts", func() {
+
+	var (
+		server      *httptest.Server
+		statusCode  int
+		payloads    chan string
+		kubeClient  *kubefake.Clientset
+		reconciler  *RulerActionReconciler
+		alertsStore *pools.AlertsStore
+	)
+
+	newAlert := func(status string) *pools.Alert {
+		alert := &pools.Alert{RulerActionName: "webhook", Status: status}
+		alert.SearchRule.Spec.ActionRef = v1alpha1.ActionRef{Namespace: "default", Name: "webhook", Data: `{"status":"{{ .status }}"}`}
+		return alert
+	}
+
+	BeforeEach(func() {
+		statusCode = http.StatusOK
+		payloads = make(chan string, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			payloads <- string(body)
+			w.WriteHeader(statusCode)
+		}))
+
+		scheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		rulerAction := &v1alpha1.RulerAction{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "webhook"},
+			Spec: v1alpha1.RulerActionSpec{
+				Webhook: v1alpha1.Webhook{Url: server.URL, Verb: http.MethodPost},
+			},
+		}
+
+		kubeClient = kubefake.NewSimpleClientset()
+		globals.Application.KubeRawCoreClient = kubeClient
+
+		alertsStore = &pools.AlertsStore{Store: map[string]*pools.Alert{}}
+		reconciler = &RulerActionReconciler{
+			Client:         fake.NewClientBuilder().WithScheme(scheme).WithObjects(rulerAction).Build(),
+			AlertsPool:     alertsStore,
+			StateNamespace: "searchruler",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should deliver just the alerts not notified yet", func() {
+		alertsStore.Set("default_notified", newAlert(pools.AlertStatusFiring))
+		reconciler.setAlertNotified("default_notified", pools.AlertStatusFiring, time.Now())
+		alertsStore.Set("default_firing", newAlert(pools.AlertStatusFiring))
+		alertsStore.Set("default_resolved", newAlert(pools.AlertStatusResolved))
+
+		reconciler.FlushPendingAlerts(context.Background())
+
+		Expect(payloads).To(HaveLen(2))
+		Expect([]string{<-payloads, <-payloads}).To(ConsistOf(`{"status":"firing"}`, `{"status":"resolved"}`))
+		_, resolvedInPool := alertsStore.Get("default_resolved")
+		Expect(resolvedInPool).To(BeFalse())
+		Expect(reconciler.isAlertPending("default_firing", newAlert(pools.AlertStatusFiring))).To(BeFalse())
+	})
+
+	It("should save the resolved alerts not delivered and restore them after the restart", func() {
+		statusCode = http.StatusBadRequest
+		alertsStore.Set("default_resolved", newAlert(pools.AlertStatusResolved))
+
+		reconciler.FlushPendingAlerts(context.Background())
+
+		configMap, err := kubeClient.CoreV1().ConfigMaps("searchruler").Get(context.Background(), stateConfigMapName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gjson.Get(configMap.Data[stateAlertsKey], "default_resolved.Status").String()).To(Equal(pools.AlertStatusResolved))
+
+		restarted := &RulerActionReconciler{
+			AlertsPool:     &pools.AlertsStore{Store: map[string]*pools.Alert{}},
+			StateNamespace: "searchruler",
+		}
+		Expect(restarted.restoreState(context.Background())).To(Succeed())
+		alert, alertInPool := restarted.AlertsPool.Get("default_resolved")
+		Expect(alertInPool).To(BeTrue())
+		Expect(alert.SearchRule.Spec.ActionRef.Name).To(Equal("webhook"))
+
+		_, err = kubeClient.CoreV1().ConfigMaps("searchruler").Get(context.Background(), stateConfigMapName, metav1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should save the firing alerts and the state of the rules and restore them after the restart", func() {
+		firingTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+		notifiedTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+		firingAlert := newAlert(pools.AlertStatusFiring)
+		firingAlert.FiringTime = firingTime
+		alertsStore.Set("default_firing", firingAlert)
+		reconciler.setAlertNotified("default_firing", pools.AlertStatusFiring, notifiedTime)
+
+		history := pools.History{}
+		history.Add(pools.Sample{Time: firingTime, Value: 10})
+		reconciler.RulesPool = &pools.RulesStore{Store: map[string]*pools.Rule{
+			"default_firing":  {State: "Firing", FiringTime: firingTime, History: history},
+			"default_pending": {State: "PendingFiring", FiringTime: firingTime},
+		}}
+
+		reconciler.FlushPendingAlerts(context.Background())
+		Expect(payloads).To(BeEmpty())
+
+		stateRestored := make(chan struct{})
+		restarted := &RulerActionReconciler{
+			AlertsPool:     &pools.AlertsStore{Store: map[string]*pools.Alert{}},
+			RulesPool:      &pools.RulesStore{Store: map[string]*pools.Rule{}},
+			StateNamespace: "searchruler",
+			StateRestored:  stateRestored,
+		}
+		restarted.restoreStateOnce(context.Background())
+		Expect(stateRestored).To(BeClosed())
+
+		alert, alertInPool := restarted.AlertsPool.Get("default_firing")
+		Expect(alertInPool).To(BeTrue())
+		Expect(alert.FiringTime).To(BeTemporally("==", firingTime))
+		Expect(restarted.isAlertPending("default_firing", alert)).To(BeFalse())
+
+		rule, ruleInPool := restarted.RulesPool.Get("default_pending")
+		Expect(ruleInPool).To(BeTrue())
+		Expect(rule.State).To(Equal("PendingFiring"))
+		Expect(rule.FiringTime).To(BeTemporally("==", firingTime))
+		rule, _ = restarted.RulesPool.Get("default_firing")
+		Expect(rule.History.Samples()).To(HaveLen(1))
+	})
+
+	It("should deliver the pending alerts once the manager is stopped and its reconciles are done", func() {
+		reconciler.ShutdownGracePeriod = 5 * time.Second
+
+		mgr, err := ctrl.NewManager(&rest.Config{Host: "http://127.0.0.1:1"}, ctrl.Options{
+			Scheme:  reconciler.Client.Scheme(),
+			Metrics: metricsserver.Options{BindAddress: "0"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// The reconcile raises an alert when it is finishing, so it is only delivered when the flush waits for it
+		reconcileStarted := make(chan struct{})
+		reconcileDone := make(chan struct{})
+		events := make(chan event.GenericEvent, 1)
+		skipNameValidation := true
+		err = ctrl.NewControllerManagedBy(mgr).
+			Named("shutdown").
+			WatchesRawSource(source.Channel(events, &handler.EnqueueRequestForObject{})).
+			WithOptions(crcontroller.Options{SkipNameValidation: &skipNameValidation}).
+			Complete(reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+				close(reconcileStarted)
+				time.Sleep(500 * time.Millisecond)
+				alertsStore.Set("default_firing", newAlert(pools.AlertStatusFiring))
+				close(reconcileDone)
+				return reconcile.Result{}, nil
+			}))
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		managerStopped := make(chan error, 1)
+		go func() {
+			managerStopped <- reconciler.StartManager(ctx, mgr, reconciler.Client)
+		}()
+
+		events <- event.GenericEvent{Object: &v1alpha1.RulerAction{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "webhook"},
+		}}
+		Eventually(reconcileStarted, 5*time.Second).Should(BeClosed())
+		cancel()
+
+		Eventually(managerStopped, 10*time.Second).Should(Receive(BeNil()))
+		Expect(reconcileDone).To(BeClosed())
+		Expect(payloads).To(Receive(Equal(`{"status":"firing"}`)))
+		Expect(reconciler.isAlertPending("default_firing", newAlert(pools.AlertStatusFiring))).To(BeFalse())
+	})
+})
+
+var _ = Describe("circuit breaker", func() {
+
+	var (
+		server      *httptest.Server
+		statusCode  int
+		requests    int
+		reconciler  *RulerActionReconciler
+		resource    *CompoundRulerActionResource
+		alertsStore *pools.AlertsStore
+	)
+
+	newAlert := func(status string) *pools.Alert {
+		alert := &pools.Alert{RulerActionName: "webhook", Status: status}
+		alert.SearchRule.Spec.ActionRef = v1alpha1.ActionRef{Namespace: "default", Name: "webhook", Data: `{"status":"{{ .status }}"}`}
+		return alert
+	}
+
+	BeforeEach(func() {
+		statusCode = http.StatusInternalServerError
+		requests = 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests++
+			w.WriteHeader(statusCode)
+		}))
+
+		resource = &CompoundRulerActionResource{RulerActionResource: &v1alpha1.RulerAction{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "webhook"},
+			Spec: v1alpha1.RulerActionSpec{
+				Webhook:        v1alpha1.Webhook{Url: server.URL, Verb: http.MethodPost},
+				CircuitBreaker: v1alpha1.CircuitBreaker{FailureThreshold: 2, Cooldown: "1h"},
+			},
+		}}
+		alertsStore = &pools.AlertsStore{Store: map[string]*pools.Alert{}}
+		reconciler = &RulerActionReconciler{AlertsPool: alertsStore}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	circuitBreakerCondition := func() *metav1.Condition {
+		return meta.FindStatusCondition(resource.RulerActionResource.Status.Conditions, globals.ConditionTypeCircuitBreakerOpen)
+	}
+
+	It("should skip the deliveries once the failures in a row reach the threshold", func() {
+		alertsStore.Set("default_firing", newAlert(pools.AlertStatusFiring))
+
+		Expect(reconciler.Sync(context.Background(), resource, controller.RulerActionResourceType)).NotTo(Succeed())
+		Expect(circuitBreakerCondition().Reason).To(Equal(globals.ConditionReasonCircuitBreakerClosedType))
+		Expect(reconciler.Sync(context.Background(), resource, controller.RulerActionResourceType)).NotTo(Succeed())
+		Expect(circuitBreakerCondition().Reason).To(Equal(globals.ConditionReasonCircuitBreakerOpenType))
+		Expect(requests).To(Equal(2))
+
+		err := reconciler.Sync(context.Background(), resource, controller.RulerActionResourceType)
+		Expect(err).To(MatchError(ContainSubstring("circuit breaker is open")))
+		Expect(requests).To(Equal(2))
+		Expect(reconciler.getCircuitBreakerRetry("default_webhook", time.Now())).To(BeNumerically(">", 59*time.Minute))
+	})
+
+	It("should test the recovery with a single notification once the cooldown expires", func() {
+		alertsStore.Set("default_firing", newAlert(pools.AlertStatusFiring))
+		alertsStore.Set("default_resolved", newAlert(pools.AlertStatusResolved))
+		Expect(reconciler.Sync(context.Background(), resource, controller.RulerActionResourceType)).NotTo(Succeed())
+		Expect(circuitBreakerCondition().Status).To(Equal(metav1.ConditionTrue))
+		Expect(requests).To(Equal(2))
+
+		// The integration is still down, so the circuit breaker opens again after the first notification
+		reconciler.circuitBreakers["default_webhook"].retryAt = time.Now()
+		Expect(reconciler.Sync(context.Background(), resource, controller.RulerActionResourceType)).NotTo(Succeed())
+		Expect(requests).To(Equal(3))
+		Expect(circuitBreakerCondition().Status).To(Equal(metav1.ConditionTrue))
+
+		// The integration recovered, so the rest of notifications are delivered
+		statusCode = http.StatusOK
+		reconciler.circuitBreakers["default_webhook"].retryAt = time.Now()
+		Expect(reconciler.Sync(context.Background(), resource, controller.RulerActionResourceType)).To(Succeed())
+		Expect(requests).To(Equal(5))
+		Expect(circuitBreakerCondition().Status).To(Equal(metav1.ConditionFalse))
+		Expect(reconciler.getCircuitBreakerRetry("default_webhook", time.Now())).To(BeZero())
+	})
+})
+
+var _ = Describe("silenced alerts", func() {
+
+	var (
+		server      *httptest.Server
+		payloads    chan string
+		reconciler  *RulerActionReconciler
+		resource    *CompoundRulerActionResource
+		alertsStore *pools.AlertsStore
+	)
+
+	newAlert := func(namespace, status string) *pools.Alert {
+		alert := &pools.Alert{RulerActionName: "webhook", Status: status, Labels: map[string]string{"team": "backend"}}
+		alert.SearchRule.Namespace = namespace
+		alert.SearchRule.Spec.ActionRef = v1alpha1.ActionRef{Namespace: "default", Name: "webhook", Data: `{"status":"{{ .status }}"}`}
+		return alert
+	}
+
+	BeforeEach(func() {
+		payloads = make(chan string, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			payloads <- string(body)
+		}))
+
+		resource = &CompoundRulerActionResource{RulerActionResource: &v1alpha1.RulerAction{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "webhook"},
+			Spec: v1alpha1.RulerActionSpec{
+				Webhook: v1alpha1.Webhook{Url: server.URL, Verb: http.MethodPost},
+			},
+		}}
+
+		scheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		silence := func(namespace string) *v1alpha1.Silence {
+			return &v1alpha1.Silence{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "maintenance"},
+				Spec: v1alpha1.SilenceSpec{
+					Selector: metav1.LabelSelector{MatchLabels: map[string]string{"team": "backend"}},
+					EndsAt:   metav1.NewTime(time.Now().Add(time.Hour)),
+				},
+			}
+		}
+
+		alertsStore = &pools.AlertsStore{Store: map[string]*pools.Alert{}}
+		reconciler = &RulerActionReconciler{
+			Client:              fake.NewClientBuilder().WithScheme(scheme).WithObjects(silence("default"), silence("searchruler")).Build(),
+			AlertsPool:          alertsStore,
+			ControllerNamespace: "searchruler",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should not deliver the firing alerts muted by a silence", func() {
+		alertsStore.Set("default_errors", newAlert("default", pools.AlertStatusFiring))
+		alertsStore.Set("cluster_errors", newAlert("", pools.AlertStatusFiring))
+		alertsStore.Set("payments_errors", newAlert("payments", pools.AlertStatusFiring))
+
+		Expect(reconciler.Sync(context.Background(), resource, controller.RulerActionResourceType)).To(Succeed())
+		Expect(payloads).To(HaveLen(1))
+
+		// Silenced alerts are kept in the pool, so they are notified once the silence expires
+		_, alertInPool := alertsStore.Get("default_errors")
+		Expect(alertInPool).To(BeTrue())
+		Expect(reconciler.isAlertPending("default_errors", newAlert("default", pools.AlertStatusFiring))).To(BeTrue())
+		Expect(reconciler.isAlertPending("payments_errors", newAlert("payments", pools.AlertStatusFiring))).To(BeFalse())
+	})
+
+	It("should deliver the resolutions of the alerts muted by a silence", func() {
+		alertsStore.Set("default_errors", newAlert("default", pools.AlertStatusResolved))
+
+		Expect(reconciler.Sync(context.Background(), resource, controller.RulerActionResourceType)).To(Succeed())
+		Expect(payloads).To(HaveLen(1))
+		Expect(<-payloads).To(Equal(`{"status":"resolved"}`))
+	})
+})
+
+var _ = Describe("checkTestNotification", func() {
+
+	var (
+		server     *httptest.Server
+		statusCode int
+		payloads   chan string
+		reconciler *RulerActionReconciler
+		resource   *CompoundRulerActionResource
+	)
+
+	BeforeEach(func() {
+		statusCode = http.StatusOK
+		payloads = make(chan string, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			payloads <- string(body)
+			w.WriteHeader(statusCode)
+		}))
+
+		resource = &CompoundRulerActionResource{RulerActionResource: &v1alpha1.RulerAction{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "webhook",
+				Annotations: map[string]string{controller.TestNotificationAnnotation: "1"},
+			},
+			Spec: v1alpha1.RulerActionSpec{
+				Webhook: v1alpha1.Webhook{Url: server.URL, Verb: http.MethodPost},
+			},
+		}}
+
+		scheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		searchRule := &v1alpha1.SearchRule{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "errors"},
+			Spec: v1alpha1.SearchRuleSpec{
+				ActionRef: v1alpha1.ActionRef{Namespace: "default", Name: "webhook", Data: `{"rule":"{{ .object.Name }}","status":"{{ .status }}"}`},
+			},
+		}
+		reconciler = &RulerActionReconciler{
+			Client:     fake.NewClientBuilder().WithScheme(scheme).WithObjects(searchRule).Build(),
+			AlertsPool: &pools.AlertsStore{Store: map[string]*pools.Alert{}},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should send a test alert with the template of the SearchRule referencing the RulerAction", func() {
+		reconciler.checkTestNotification(context.Background(), resource, controller.RulerActionResourceType)
+
+		Expect(payloads).To(Receive(Equal(`{"rule":"errors","status":"firing"}`)))
+		testNotification := resource.RulerActionResource.Status.TestNotification
+		Expect(testNotification.Value).To(Equal("1"))
+		Expect(testNotification.Delivered).To(BeTrue())
+		Expect(testNotification.Message).To(BeEmpty())
+
+		// The value is already acknowledged, so nothing is sent again until it changes
+		reconciler.checkTestNotification(context.Background(), resource, controller.RulerActionResourceType)
+		Expect(payloads).To(BeEmpty())
+	})
+
+	It("should report the failed deliveries in the status", func() {
+		statusCode = http.StatusBadRequest
+
+		reconciler.checkTestNotification(context.Background(), resource, controller.RulerActionResourceType)
+
+		testNotification := resource.RulerActionResource.Status.TestNotification
+		Expect(testNotification.Delivered).To(BeFalse())
+		Expect(testNotification.Message).To(ContainSubstring("error sending the test notification"))
+	})
+
+	It("should send a default test alert when no SearchRule references the RulerAction", func() {
+		resource.RulerActionResource.Name = "unreferenced"
+
+		reconciler.checkTestNotification(context.Background(), resource, controller.RulerActionResourceType)
+
+		Expect(payloads).To(Receive(Equal(`{"text": "Test notification of the RulerAction unreferenced"}`)))
+		Expect(resource.RulerActionResource.Status.TestNotification.Delivered).To(BeTrue())
+	})
+})
+
+var _ = Describe("Opsgenie sender", func() {
+
+	var (
+		server      *httptest.Server
+		paths       chan string
+		reconciler  *RulerActionReconciler
+		resource    *CompoundRulerActionResource
+		alertsStore *pools.AlertsStore
+	)
+
+	newAlert := func(name, status string) *pools.Alert {
+		alert := &pools.Alert{RulerActionName: "opsgenie", Status: status, Labels: map[string]string{"team": "backend"}}
+		alert.SearchRule.Namespace = "default"
+		alert.SearchRule.Name = name
+		alert.SearchRule.Spec.ActionRef = v1alpha1.ActionRef{Namespace: "default", Name: "opsgenie"}
+		return alert
+	}
+
+	BeforeEach(func() {
+		paths = make(chan string, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			paths <- req.URL.Path
+		}))
+
+		resource = &CompoundRulerActionResource{RulerActionResource: &v1alpha1.RulerAction{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "opsgenie"},
+			Spec: v1alpha1.RulerActionSpec{
+				Opsgenie: v1alpha1.Opsgenie{
+					Url:       server.URL,
+					SecretRef: v1alpha1.SecretRef{Name: "opsgenie", KeyApiKey: "apiKey"},
+				},
+				GroupBy: []string{"team"},
+			},
+		}}
+
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "opsgenie"},
+			Data:       map[string][]byte{"apiKey": []byte("secret")},
+		}
+		alertsStore = &pools.AlertsStore{Store: map[string]*pools.Alert{}}
+		reconciler = &RulerActionReconciler{
+			Client:     fake.NewClientBuilder().WithObjects(secret).Build(),
+			AlertsPool: alertsStore,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	sendResolved := func() {
+		resolvedAlert := newAlert("errors", pools.AlertStatusResolved)
+		groupKey, _ := getAlertGroup(getRulerAction(resource, controller.RulerActionResourceType), resolvedAlert)
+		sendNotification, err := reconciler.getOpsgenieSender(context.Background(), resource, controller.RulerActionResourceType)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = sendNotification(context.Background(), &notification{
+			groupKey: groupKey,
+			alerts:   []*pools.Alert{resolvedAlert},
+			data:     map[string]interface{}{},
+		}, []byte(`{}`))
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("should not close a grouped alert while other alerts of the group are firing", func() {
+		alertsStore.Set("default_errors", newAlert("errors", pools.AlertStatusResolved))
+		alertsStore.Set("default_latency", newAlert("latency", pools.AlertStatusFiring))
+
+		sendResolved()
+		Expect(paths).To(BeEmpty())
+	})
+
+	It("should close a grouped alert once every alert of the group is resolved", func() {
+		alertsStore.Set("default_errors", newAlert("errors", pools.AlertStatusResolved))
+
+		sendResolved()
+		Expect(paths).To(Receive(HaveSuffix("/close")))
+	})
+})
+
+var _ = Describe("truncate", func() {
+
+	It("should keep the texts shorter than the max length", func() {
+		Expect(truncate("firing", 10)).To(Equal("firing"))
+	})
+
+	It("should not split the multi-byte characters", func() {
+		Expect(truncate("ééé", 2)).To(Equal("éé"))
+	})
+})
+
+var _ = Describe("sendEmail", func() {
+
+	var (
+		listener  net.Listener
+		messages  chan string
+		greet     bool
+		emailSpec *v1alpha1.Email
+	)
+
+	// serveSMTP answers the commands of a single SMTP client without extensions, and sends
+	// the messages received to the channel
+	serveSMTP := func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if !greet {
+			time.Sleep(time.Second)
+			return
+		}
+
+		textConn := textproto.NewConn(conn)
+		_ = textConn.PrintfLine("220 localhost")
+		for {
+			line, err := textConn.ReadLine()
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.Fields(line)[0]); command {
+			case "DATA":
+				_ = textConn.PrintfLine("354 go ahead")
+				lines, _ := textConn.ReadDotLines()
+				messages <- strings.Join(lines, "\n")
+				_ = textConn.PrintfLine("250 ok")
+			case "QUIT":
+				_ = textConn.PrintfLine("221 bye")
+				return
+			default:
+				_ = textConn.PrintfLine("250 ok")
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		messages = make(chan string, 1)
+		greet = true
+
+		emailSpec = &v1alpha1.Email{
+			Host:    "127.0.0.1",
+			Port:    listener.Addr().(*net.TCPAddr).Port,
+			From:    "searchruler@example.com",
+			To:      []string{"oncall@example.com"},
+			TlsMode: emailTlsModeNone,
+		}
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	It("should send the email with the headers and the body", func() {
+		go serveSMTP()
+
+		Expect(sendEmail(context.Background(), emailSpec, nil, "[FIRING] default/errors", []byte("Too many errors"))).To(Succeed())
+
+		var message string
+		Expect(messages).To(Receive(&message))
+		Expect(message).To(ContainSubstring("To: oncall@example.com"))
+		Expect(message).To(ContainSubstring("Subject: [FIRING] default/errors"))
+		Expect(message).To(MatchRegexp(`Date: \w{3}, \d{2} \w{3} \d{4}`))
+		Expect(message).To(HaveSuffix("\n\nToo many errors"))
+	})
+
+	It("should fail when the server does not answer before the deadline of the context", func() {
+		greet = false
+		go serveSMTP()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		Expect(sendEmail(ctx, emailSpec, nil, "subject", []byte("body"))).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("getEmailMessage", func() {
+
+	emailSpec := &v1alpha1.Email{From: "searchruler@example.com", To: []string{"oncall@example.com"}}
+
+	It("should remove the line breaks of the subject", func() {
+		message := string(getEmailMessage(emailSpec, "errors\r\nBcc: attacker@example.com", []byte("body"), time.Now()))
+
+		Expect(message).To(ContainSubstring("Subject: errors Bcc: attacker@example.com\r\n"))
+		Expect(message).NotTo(ContainSubstring("\r\nBcc:"))
+	})
+
+	It("should encode the non-ASCII subjects", func() {
+		message := string(getEmailMessage(emailSpec, "Erreur été", []byte("body"), time.Now()))
+
+		Expect(message).To(ContainSubstring("Subject: =?UTF-8?q?Erreur_=C3=A9t=C3=A9?=\r\n"))
+	})
+
+	It("should add the date of the email", func() {
+		now := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+		message := string(getEmailMessage(emailSpec, "errors", []byte("body"), now))
+
+		Expect(message).To(ContainSubstring("Date: Fri, 01 Mar 2024 10:00:00 +0000\r\n"))
+	})
+})
@@ -0,0 +1,131 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	//
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/template"
+)
+
+const (
+
+	// Default key of the Teams incoming webhook URL in the secret
+	teamsDefaultKeyUrl = "url"
+
+	// Default title of the Teams cards
+	teamsDefaultTitle = `[{{ .status | upper }}] {{ .object.Namespace }}/{{ .object.Name }}`
+
+	// Color of the Teams cards for resolved alerts
+	teamsResolvedColor = "2EB886"
+)
+
+var (
+	// teamsSeverityColors is a map of SearchRule severities and the color of the Teams cards
+	teamsSeverityColors = map[string]string{
+		"critical": "D50000",
+		"high":     "FF6D00",
+		"warning":  "FFC400",
+		"low":      "2962FF",
+		"info":     "2962FF",
+	}
+	teamsDefaultColor = "FFC400"
+)
+
+// teamsMessageCard is the payload of a Teams incoming webhook
+type teamsMessageCard struct {
+	Type       string `json:"@type"`
+	Context    string `json:"@context"`
+	ThemeColor string `json:"themeColor"`
+	Summary    string `json:"summary"`
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+}
+
+// getTeamsSender returns the sender for the Teams integration. The URL of the incoming webhook
+// is read from the secret associated
+func (r *RulerActionReconciler) getTeamsSender(ctx context.Context, resource *CompoundRulerActionResource, resourceType string) (notificationSender, error) {
+
+	action := getRulerAction(resource, resourceType)
+
+	// Get the URL of the incoming webhook from the secret
+	secretRef := action.spec.Teams.SecretRef
+	teamsSecret, err := r.getSecret(ctx, resource, resourceType, secretRef)
+	if err != nil {
+		return nil, err
+	}
+	keyUrl := secretRef.KeyUrl
+	if keyUrl == "" {
+		keyUrl = teamsDefaultKeyUrl
+	}
+	webhookUrl := string(teamsSecret.Data[keyUrl])
+	if webhookUrl == "" {
+		r.UpdateConditionNoCredsFound(resource, resourceType)
+		return nil, fmt.Errorf(controller.MissingCredentialsMessage, secretRef.Name)
+	}
+
+	httpClient, err := getHttpClient(action.spec, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, notification *notification, payload []byte) error {
+		card, err := getTeamsMessageCard(notification, action.spec.Teams.Title, string(payload))
+		if err != nil {
+			return err
+		}
+		return postJSON(ctx, httpClient, webhookUrl, card)
+	}, nil
+}
+
+// getTeamsMessageCard returns the Teams card for the notification. The text of the card is the evaluated
+// template of the notification and the color depends on the severity of the SearchRule
+func getTeamsMessageCard(notification *notification, titleTemplate, text string) ([]byte, error) {
+
+	// Evaluate the title template with the data of the notification
+	if titleTemplate == "" {
+		titleTemplate = teamsDefaultTitle
+	}
+	title, err := template.EvaluateTemplate(titleTemplate, notification.data)
+	if err != nil {
+		return nil, fmt.Errorf(controller.EvaluateTemplateErrorMessage, err)
+	}
+
+	// Color the card by the severity of the SearchRule, or green when it is resolved
+	alert := notification.alerts[0]
+	themeColor, severityFound := teamsSeverityColors[alert.SearchRule.Spec.Severity]
+	if !severityFound {
+		themeColor = teamsDefaultColor
+	}
+	if alert.Status == pools.AlertStatusResolved {
+		themeColor = teamsResolvedColor
+	}
+
+	return json.Marshal(teamsMessageCard{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: themeColor,
+		Summary:    title,
+		Title:      title,
+		Text:       text,
+	})
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+const (
+	// Label added to the test alert, so receivers can tell it apart from the real ones
+	testNotificationLabel = "test_notification"
+
+	// Template of the test notification when no SearchRule references the RulerAction
+	testNotificationDefaultTemplate = `{"text": "Test notification of the RulerAction {{ .object.Spec.ActionRef.Name }}"}`
+)
+
+// getTestNotificationRequest returns the value of the test-notification annotation when it was not
+// acknowledged in the status yet, so a new value requests a new test notification
+func getTestNotificationRequest(resource *CompoundRulerActionResource, resourceType string) (value string, requested bool) {
+
+	annotations := resource.RulerActionResource.GetAnnotations()
+	status := resource.RulerActionResource.Status
+	if resourceType == controller.ClusterRulerActionResourceType {
+		annotations = resource.ClusterRulerActionResource.GetAnnotations()
+		status = resource.ClusterRulerActionResource.Status
+	}
+
+	value, requested = annotations[controller.TestNotificationAnnotation]
+	if !requested || (status.TestNotification != nil && status.TestNotification.Value == value) {
+		return value, false
+	}
+	return value, true
+}
+
+// checkTestNotification sends a test notification when it is requested with the test-notification annotation,
+// and saves the outcome in the status of the RulerAction
+func (r *RulerActionReconciler) checkTestNotification(ctx context.Context, resource *CompoundRulerActionResource, resourceType string) {
+
+	value, requested := getTestNotificationRequest(resource, resourceType)
+	if !requested {
+		return
+	}
+
+	logger := log.FromContext(ctx).WithValues("ruleraction", getRulerAction(resource, resourceType).name)
+
+	err := r.sendTestNotification(ctx, resource, resourceType)
+	if err != nil {
+		err = fmt.Errorf(controller.TestNotificationErrorMessage, err)
+		logger.Info(err.Error())
+	} else {
+		logger.Info("Test notification delivered")
+	}
+	r.UpdateTestNotification(resource, resourceType, value, err)
+}
+
+// sendTestNotification sends a synthetic firing alert through the same path as the real alerts: the template is
+// evaluated, the validator and the payload schema are executed, and the payload is sent to the integration. The
+// circuit breaker is not checked, so the test can tell whether the integration is back
+func (r *RulerActionReconciler) sendTestNotification(ctx context.Context, resource *CompoundRulerActionResource, resourceType string) error {
+
+	action := getRulerAction(resource, resourceType)
+	searchRule, err := r.getTestNotificationSearchRule(ctx, action)
+	if err != nil {
+		return err
+	}
+
+	labels := map[string]string{testNotificationLabel: "true"}
+	for key, value := range searchRule.Spec.Labels {
+		labels[key] = value
+	}
+	alert := &pools.Alert{
+		RulerActionName: action.name,
+		SearchRule:      *searchRule,
+		Status:          pools.AlertStatusFiring,
+		Severity:        searchRule.Spec.Severity,
+		Labels:          labels,
+		Annotations:     searchRule.Spec.Annotations,
+		FiringTime:      time.Now(),
+	}
+	testNotification := &notification{
+		alertKeys: []string{pools.GetKey(searchRule.Namespace, searchRule.Name)},
+		alerts:    []*pools.Alert{alert},
+		template:  getAlertTemplate(alert),
+		data:      getAlertTemplateData(alert),
+	}
+
+	// Grouped notifications get the same data as a group with a single alert
+	if len(action.spec.GroupBy) > 0 {
+		groupLabels := map[string]string{}
+		for _, label := range action.spec.GroupBy {
+			groupLabel, labelExists := alert.Labels[label]
+			if !labelExists {
+				groupLabel = searchRule.Labels[label]
+			}
+			groupLabels[label] = groupLabel
+		}
+		testNotification.data["groupLabels"] = groupLabels
+		testNotification.data["alerts"] = []map[string]interface{}{getAlertTemplateData(alert)}
+	}
+
+	payload, err := r.getNotificationPayload(resource, resourceType, testNotification)
+	if err != nil {
+		return err
+	}
+
+	sendNotification, err := r.getNotificationSender(ctx, resource, resourceType)
+	if err != nil {
+		return err
+	}
+	return sendNotification(ctx, testNotification, payload)
+}
+
+// getTestNotificationSearchRule returns the SearchRule of the test alert. It is the first SearchRule or
+// ClusterSearchRule referencing the RulerAction, so its messageTemplate is tested too. When no rule
+// references it, a synthetic rule with a default template is returned
+func (r *RulerActionReconciler) getTestNotificationSearchRule(ctx context.Context, action *rulerAction) (*v1alpha1.SearchRule, error) {
+
+	searchRules := []*v1alpha1.SearchRule{}
+
+	searchRuleList := &v1alpha1.SearchRuleList{}
+	err := r.List(ctx, searchRuleList)
+	if err != nil {
+		return nil, err
+	}
+	for i := range searchRuleList.Items {
+		searchRules = append(searchRules, &searchRuleList.Items[i])
+	}
+
+	clusterSearchRuleList := &v1alpha1.ClusterSearchRuleList{}
+	err = r.List(ctx, clusterSearchRuleList)
+	if err != nil {
+		return nil, err
+	}
+	for i := range clusterSearchRuleList.Items {
+		searchRules = append(searchRules, clusterSearchRuleList.Items[i].ToSearchRule())
+	}
+
+	referencingRules := []*v1alpha1.SearchRule{}
+	for _, searchRule := range searchRules {
+		if searchRule.Spec.ActionRef.Namespace == action.namespace && searchRule.Spec.ActionRef.Name == action.name {
+			referencingRules = append(referencingRules, searchRule)
+		}
+	}
+	if len(referencingRules) > 0 {
+		sort.Slice(referencingRules, func(i, j int) bool {
+			return pools.GetKey(referencingRules[i].Namespace, referencingRules[i].Name) <
+				pools.GetKey(referencingRules[j].Namespace, referencingRules[j].Name)
+		})
+		return referencingRules[0].DeepCopy(), nil
+	}
+
+	return &v1alpha1.SearchRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      action.name + "-test-notification",
+			Namespace: action.namespace,
+		},
+		Spec: v1alpha1.SearchRuleSpec{
+			Description: "Test notification",
+			ActionRef: v1alpha1.ActionRef{
+				Name:      action.name,
+				Namespace: action.namespace,
+				Data:      testNotificationDefaultTemplate,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/globals"
+	"prosimcorp.com/SearchRuler/internal/template"
+)
+
+const (
+
+	// Default wait before the first retry of a failed webhook delivery
+	webhookDefaultBackoff = time.Second
+
+	// Max wait between the retries of a failed webhook delivery
+	webhookMaxBackoff = time.Minute
+
+	// Max size of the response body of the webhook included in the errors
+	webhookResponseSnippetSize = 512
+)
+
+var (
+	// allowedWebhookVerbs are the HTTP methods allowed to send the webhooks. All of them carry the payload in the body
+	allowedWebhookVerbs = map[string]bool{
+		http.MethodPost:  true,
+		http.MethodPut:   true,
+		http.MethodPatch: true,
+	}
+)
+
+// webhookResponseError is the error of the deliveries answered with an error status code by the webhook
+type webhookResponseError struct {
+	message string
+}
+
+func (e *webhookResponseError) Error() string {
+	return e.message
+}
+
+// getWebhookSender returns the sender for the webhook integration. Credentials for the webhook
+// are read from the secret associated if defined
+func (r *RulerActionReconciler) getWebhookSender(ctx context.Context, resource *CompoundRulerActionResource, resourceType string) (notificationSender, error) {
+
+	action := getRulerAction(resource, resourceType)
+	webhookSpec := &action.spec.Webhook
+
+	// Check the verb of the webhook before sending anything, as the payload is always sent in the body
+	if !allowedWebhookVerbs[webhookSpec.Verb] {
+		r.UpdateConditionConnectionError(resource, resourceType)
+		return nil, fmt.Errorf(controller.WebhookVerbNotAllowedErrorMessage, webhookSpec.Verb)
+	}
+
+	// Parse the backoff of the retries of the webhook
+	backoff := webhookDefaultBackoff
+	if webhookSpec.Retry.Backoff != "" {
+		var err error
+		backoff, err = time.ParseDuration(webhookSpec.Retry.Backoff)
+		if err != nil {
+			r.UpdateConditionConnectionError(resource, resourceType)
+			return nil, fmt.Errorf(controller.WebhookBackoffParseErrorMessage, err)
+		}
+	}
+
+	// Get credentials for the Action in the secret associated if defined
+	username := ""
+	password := ""
+	if !reflect.ValueOf(webhookSpec.Credentials).IsZero() {
+		secretRef := webhookSpec.Credentials.SecretRef
+		RulerActionCredsSecret, err := r.getSecret(ctx, resource, resourceType, secretRef)
+		if err != nil {
+			return nil, err
+		}
+
+		// Get username and password
+		username = string(RulerActionCredsSecret.Data[secretRef.KeyUsername])
+		password = string(RulerActionCredsSecret.Data[secretRef.KeyPassword])
+		if username == "" || password == "" {
+			r.UpdateConditionNoCredsFound(resource, resourceType)
+			return nil, fmt.Errorf(controller.MissingCredentialsMessage, secretRef.Name)
+		}
+	}
+
+	// Create the HTTP client
+	httpClient, err := getHttpClient(action.spec, &tls.Config{
+		InsecureSkipVerify: webhookSpec.TlsSkipVerify,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, notification *notification, payload []byte) error {
+		webhookURL, err := getWebhookURL(webhookSpec, notification)
+		if err != nil {
+			return err
+		}
+		return sendWebhook(ctx, webhookSpec, httpClient, webhookURL, payload, username, password, backoff)
+	}, nil
+}
+
+// getWebhookURL evaluates the URL of the webhook as a template with the data of the notification, so the alerts
+// can be sent to different endpoints, like a channel per team in the path. The resulting URL is checked before
+// sending anything
+func getWebhookURL(webhookSpec *v1alpha1.Webhook, notification *notification) (string, error) {
+	webhookURL, err := template.EvaluateTemplate(webhookSpec.Url, notification.data)
+	if err != nil {
+		return "", fmt.Errorf(controller.EvaluateTemplateErrorMessage, err)
+	}
+
+	webhookURL = strings.TrimSpace(webhookURL)
+	err = globals.ValidateURL(webhookURL)
+	if err != nil {
+		return "", fmt.Errorf(controller.InvalidUrlErrorMessage, webhookURL, err.Error())
+	}
+	return webhookURL, nil
+}
+
+// sendWebhook sends the payload to the URL of the webhook configured in the RulerAction resource. Deliveries
+// failing with transient errors are retried up to maxRetries times, doubling the backoff between them. The
+// wait is stopped when the context is done
+func sendWebhook(ctx context.Context, webhookSpec *v1alpha1.Webhook, httpClient *http.Client, webhookURL string, payload []byte,
+	username, password string, backoff time.Duration) error {
+
+	maxRetries := webhookSpec.Retry.MaxRetries
+	for attempt := 0; ; attempt++ {
+		retryable, err := sendWebhookRequest(ctx, webhookSpec, httpClient, webhookURL, payload, username, password)
+		if err == nil || !retryable {
+			return err
+		}
+		if attempt >= maxRetries {
+			if maxRetries > 0 {
+				return fmt.Errorf(controller.WebhookRetriesExhaustedErrorMessage, attempt+1, err)
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(getWebhookBackoff(backoff, attempt)):
+		}
+	}
+}
+
+// getWebhookBackoff returns the wait before the retry after the given attempt. The backoff doubles every
+// attempt up to webhookMaxBackoff, without overflowing on large attempts
+func getWebhookBackoff(backoff time.Duration, attempt int) time.Duration {
+	if backoff >= webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	for ; attempt > 0; attempt-- {
+		backoff *= 2
+		if backoff >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// isWebhookSuccess returns whether the status code of the response of the webhook means the payload was delivered.
+// It is one of the successStatusCodes of the webhook when they are defined, or any 2xx status code
+func isWebhookSuccess(webhookSpec *v1alpha1.Webhook, statusCode int) bool {
+	if len(webhookSpec.SuccessStatusCodes) == 0 {
+		return statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices
+	}
+	return slices.Contains(webhookSpec.SuccessStatusCodes, statusCode)
+}
+
+// sendWebhookRequest makes a single delivery of the payload to the webhook. It returns whether the
+// delivery can be retried when it fails: connection errors, 429 and 5xx responses are transient
+func sendWebhookRequest(ctx context.Context, webhookSpec *v1alpha1.Webhook, httpClient *http.Client, webhookURL string,
+	payload []byte, username, password string) (retryable bool, err error) {
+
+	// Create the request with the configured verb and URL
+	httpRequest, err := http.NewRequestWithContext(ctx, webhookSpec.Verb, webhookURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return false, fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
+	}
+
+	// Add headers to the request if set
+	httpRequest.Header.Set("Content-Type", "application/json")
+	for headerKey, headerValue := range webhookSpec.Headers {
+		httpRequest.Header.Set(headerKey, headerValue)
+	}
+
+	// Add authentication if set for the webhook
+	if username != "" && password != "" {
+		httpRequest.SetBasicAuth(username, password)
+	}
+
+	// Send HTTP request to the webhook
+	httpResponse, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return true, fmt.Errorf(controller.HttpRequestSendingErrorMessage, err)
+	}
+	defer httpResponse.Body.Close()
+
+	// Check the response of the webhook. A snippet of the body is included in the errors, as
+	// receivers usually explain there why the alert was refused
+	if isWebhookSuccess(webhookSpec, httpResponse.StatusCode) {
+		return false, nil
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(httpResponse.Body, webhookResponseSnippetSize))
+
+	// Other status codes, like client errors, will fail again, so they are not retried
+	if httpResponse.StatusCode >= http.StatusInternalServerError || httpResponse.StatusCode == http.StatusTooManyRequests {
+		return true, &webhookResponseError{message: fmt.Sprintf(controller.WebhookResponseErrorMessage,
+			webhookURL, httpResponse.Status, string(snippet))}
+	}
+	return false, &webhookResponseError{message: fmt.Sprintf(controller.WebhookRejectedErrorMessage,
+		webhookURL, httpResponse.Status, string(snippet))}
+}
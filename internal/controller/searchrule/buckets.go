@@ -0,0 +1,326 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+const (
+
+	// Default field of the key in the buckets, as in the terms aggregations of Elasticsearch
+	bucketDefaultKeyField = "key"
+
+	// Default label of the alerts with the key of their bucket
+	bucketDefaultLabel = "bucket"
+)
+
+// bucketEvaluation is the evaluation of the condition for a bucket of the conditionField
+type bucketEvaluation struct {
+	key        string
+	value      float64
+	firing     bool
+	inResponse bool
+}
+
+// getBucketAlertKey returns the key of the alert of a bucket in the alerts pool: <namespace>_<name>{<bucket key>}
+func getBucketAlertKey(resource *v1alpha1.SearchRule, bucketKey string) string {
+	return pools.GetKey(resource.Namespace, resource.Name) + "{" + bucketKey + "}"
+}
+
+// getRuleAlerts returns the alerts of the rule in the alerts pool, including the alerts of its buckets
+func (r *SearchRuleReconciler) getRuleAlerts(resource *v1alpha1.SearchRule) map[string]*pools.Alert {
+
+	// The key is quoted, so the expression always compiles
+	alerts, _ := r.AlertsPool.GetByRegex(regexp.QuoteMeta(pools.GetKey(resource.Namespace, resource.Name)) + `(\{.*\})?`)
+	return alerts
+}
+
+// getAlertState returns the state of the rule which the alert belongs to: the rule itself, or the state
+// of the bucket in buckets mode. It returns nil when the bucket is not in the rule anymore
+func getAlertState(resource *v1alpha1.SearchRule, rule *pools.Rule, alertKey string) *pools.Rule {
+
+	ruleKey := pools.GetKey(resource.Namespace, resource.Name)
+	if alertKey == ruleKey {
+		return rule
+	}
+	bucketKey := strings.TrimSuffix(strings.TrimPrefix(alertKey, ruleKey+"{"), "}")
+	return rule.Buckets[bucketKey]
+}
+
+// getBuckets evaluates the condition for every bucket of the conditionField. The conditionField can be a list
+// of buckets with the key in the keyField, or an object of buckets indexed by their key, as keyed aggregations
+func getBuckets(resource *v1alpha1.SearchRule, conditionValue gjson.Result, threshold string) (buckets []bucketEvaluation, err error) {
+
+	if !conditionValue.IsArray() && !conditionValue.IsObject() {
+		return nil, fmt.Errorf(controller.ConditionValueNotBucketsMessage, conditionValue.Raw)
+	}
+
+	bucketsSpec := resource.Spec.Condition.Buckets
+	keyField := bucketsSpec.KeyField
+	if keyField == "" {
+		keyField = bucketDefaultKeyField
+	}
+
+	conditionValue.ForEach(func(index, item gjson.Result) bool {
+
+		// Get the key of the bucket from the keyField, or from the index in keyed aggregations
+		key := index
+		if conditionValue.IsArray() {
+			key = item.Get(keyField)
+			if !key.Exists() {
+				err = fmt.Errorf(controller.BucketKeyNotFoundMessage, keyField, item.Raw)
+				return false
+			}
+		}
+
+		// Evaluate the condition against the valueField of the bucket
+		valueResult := item.Get(bucketsSpec.ValueField)
+		value, valueErr := getNumericValue(valueResult)
+		if valueErr != nil && !isStringOperator(resource.Spec.Condition.Operator) {
+			err = valueErr
+			return false
+		}
+		firing, conditionErr := evaluateCondition(valueResult, resource.Spec.Condition.Operator, threshold)
+		if conditionErr != nil {
+			err = fmt.Errorf(controller.EvaluatingConditionErrorMessage, conditionErr)
+			return false
+		}
+
+		buckets = append(buckets, bucketEvaluation{key: key.String(), value: value, firing: firing, inResponse: true})
+		return true
+	})
+
+	return buckets, err
+}
+
+// getBucketsState returns the state of the rule in buckets mode, which is the most relevant state of its buckets
+func getBucketsState(rule *pools.Rule) string {
+
+	states := map[string]bool{}
+	for _, bucketState := range rule.Buckets {
+		states[bucketState.State] = true
+	}
+	for _, state := range []string{RuleFiringState, RulePendingResolvedState, RulePendingFiringState} {
+		if states[state] {
+			return state
+		}
+	}
+	return RuleNormalState
+}
+
+// syncBuckets evaluates the rule in buckets mode. The condition is evaluated for every bucket of the conditionField
+// and every bucket keeps its own state in the rules pool, so it fires separately. Firing buckets are alerts labeled
+// with the key of their bucket, and the buckets missing in the response are resolved as the rest of buckets
+func (r *SearchRuleReconciler) syncBuckets(ctx context.Context, resource *v1alpha1.SearchRule, result *queryResult, connectorURL string,
+	forDuration, resolveForDuration, cooldownDuration time.Duration) (err error) {
+
+	logger := log.FromContext(ctx)
+
+	// Evaluate the condition for every bucket. There are no buckets without data
+	buckets := []bucketEvaluation{}
+	if !result.noData {
+		buckets, err = getBuckets(resource, result.conditionValue, result.threshold)
+		if err != nil {
+			r.UpdateConditionInvalidBuckets(resource)
+			return err
+		}
+	}
+	matchingBuckets := 0
+	for _, bucket := range buckets {
+		if bucket.firing {
+			matchingBuckets++
+		}
+	}
+
+	// Save the number of buckets matching the condition as the last evaluated value in the status of the rule
+	lastValue := fmt.Sprintf("%d/%d buckets", matchingBuckets, len(buckets))
+	resource.Status.LastValue = lastValue
+	resource.Status.LastEvaluationTime = metav1.Now()
+
+	hold, err := r.holdEvaluation(ctx, resource, lastValue, matchingBuckets > 0)
+	if hold || err != nil {
+		return err
+	}
+
+	// Get the rule from the pool or create a default skeleton rule. The state of every bucket is kept in the rule
+	ruleKey := pools.GetKey(resource.Namespace, resource.Name)
+	rule, ruleInPool := r.RulesPool.Get(ruleKey)
+	if !ruleInPool {
+		rule = &pools.Rule{
+			State: RuleNormalState,
+		}
+	}
+	if rule.Buckets == nil {
+		rule.Buckets = map[string]*pools.Rule{}
+	}
+	rule.SearchRule = *resource
+	rule.Value = float64(matchingBuckets)
+	rule.Aggregations = result.aggregations
+
+	// The buckets in the pool missing in the response are evaluated as not firing. Without data, they
+	// are evaluated as firing when the noDataPolicy is firing
+	missingFiring := result.noData && resource.Spec.Condition.NoDataPolicy == noDataPolicyFiring
+	bucketsByKey := map[string]bucketEvaluation{}
+	for _, bucket := range buckets {
+		bucketsByKey[bucket.key] = bucket
+	}
+	for bucketKey, bucketState := range rule.Buckets {
+		if _, bucketInResponse := bucketsByKey[bucketKey]; !bucketInResponse {
+			bucketsByKey[bucketKey] = bucketEvaluation{key: bucketKey, value: bucketState.Value, firing: missingFiring}
+		}
+	}
+	bucketKeys := make([]string, 0, len(bucketsByKey))
+	for bucketKey := range bucketsByKey {
+		bucketKeys = append(bucketKeys, bucketKey)
+	}
+	sort.Strings(bucketKeys)
+
+	label := resource.Spec.Condition.Buckets.Label
+	if label == "" {
+		label = bucketDefaultLabel
+	}
+
+	// Move every bucket to its next state and execute the side effects of the transition
+	now := time.Now()
+	firingBuckets := []string{}
+	resolvedBuckets := []string{}
+	for _, bucketKey := range bucketKeys {
+		bucket := bucketsByKey[bucketKey]
+		bucketState, bucketInPool := rule.Buckets[bucketKey]
+		if !bucketInPool {
+			bucketState = &pools.Rule{State: RuleNormalState}
+			rule.Buckets[bucketKey] = bucketState
+		}
+		bucketState.Value = bucket.value
+
+		annotations, err := getAlertAnnotations(resource, bucket.value, result.aggregations)
+		if err != nil {
+			r.UpdateConditionEvaluateTemplateError(resource)
+			return err
+		}
+
+		alertKey := getBucketAlertKey(resource, bucketKey)
+		alert, alertInPool := r.AlertsPool.Get(alertKey)
+
+		switch transitionRule(bucketState, bucket.firing, now, forDuration, resolveForDuration, cooldownDuration) {
+
+		// Add the alert of the bucket to the pool, labeled with the key of the bucket. The time the alert
+		// started firing is kept across evaluations
+		case ruleTransitionFiring:
+			firingTime := now
+			if alertInPool && alert.Status == pools.AlertStatusFiring {
+				firingTime = alert.FiringTime
+			}
+			labels := map[string]string{}
+			for key, value := range resource.Spec.Labels {
+				labels[key] = value
+			}
+			labels[label] = bucketKey
+
+			r.AlertsPool.Set(alertKey, &pools.Alert{
+				RulerActionName: resource.Spec.ActionRef.Name,
+				SearchRule:      *resource,
+				Status:          pools.AlertStatusFiring,
+				Severity:        resource.Spec.Severity,
+				Labels:          labels,
+				Annotations:     annotations,
+				Value:           bucket.value,
+				Aggregations:    result.aggregations,
+				Query:           result.query,
+				ConnectorURL:    connectorURL,
+				Samples:         result.samples,
+				SpanContext:     trace.SpanContextFromContext(ctx),
+				FiringTime:      firingTime,
+			})
+			firingBuckets = append(firingBuckets, bucketKey)
+
+		// Mark the alert of the bucket as resolved. The RulerAction controller will send the resolved
+		// notification and remove it from the pool afterwards
+		case ruleTransitionResolved:
+			if alertInPool {
+				resolvedAlert := *alert
+				resolvedAlert.SearchRule = *resource
+				resolvedAlert.Status = pools.AlertStatusResolved
+				resolvedAlert.Annotations = annotations
+				resolvedAlert.Value = bucket.value
+				resolvedAlert.SpanContext = trace.SpanContextFromContext(ctx)
+				resolvedAlert.ResolvedTime = now
+				r.AlertsPool.Set(alertKey, &resolvedAlert)
+
+				resolvedBuckets = append(resolvedBuckets, bucketKey)
+				bucketState.ResolvedTime = now
+			}
+		}
+
+		// Forget the buckets missing in the response once they are normal and out of their cooldown
+		if !bucket.inResponse && bucketState.State == RuleNormalState &&
+			(bucketState.ResolvedTime.IsZero() || now.Sub(bucketState.ResolvedTime) >= cooldownDuration) {
+			delete(rule.Buckets, bucketKey)
+		}
+	}
+	rule.State = getBucketsState(rule)
+	r.RulesPool.Set(ruleKey, rule)
+
+	// Create the events in Kubernetes of AlertFiring and AlertResolved, with all the buckets of the evaluation.
+	// These events will be readed by the RulerAction controller and will trigger the action inmediately
+	if len(firingBuckets) > 0 {
+		err = createKubeEvent(ctx, *resource, kubeEventReasonAlertFiring,
+			fmt.Sprintf("Rule is in firing state for the buckets %s", strings.Join(firingBuckets, ", ")))
+		if err != nil {
+			return fmt.Errorf(controller.KubeEventCreationErrorMessage, err)
+		}
+	}
+	if len(resolvedBuckets) > 0 {
+		err = createKubeEvent(ctx, *resource, kubeEventReasonAlertResolved,
+			fmt.Sprintf("Rule is resolved for the buckets %s", strings.Join(resolvedBuckets, ", ")))
+		if err != nil {
+			return fmt.Errorf(controller.KubeEventCreationErrorMessage, err)
+		}
+	}
+
+	// Update the AlertStatus of the rule with the state of its buckets
+	switch rule.State {
+	case RuleFiringState:
+		r.UpdateConditionAlertFiring(resource)
+	case RulePendingResolvedState:
+		r.UpdateStateAlertPendingResolved(resource)
+	case RulePendingFiringState:
+		r.UpdateStateAlertPendingFiring(resource)
+	default:
+		r.UpdateStateNormal(resource)
+	}
+	logger.Info("Rule evaluated in buckets mode", "state", rule.State, "value", lastValue,
+		"firing", len(firingBuckets), "resolved", len(resolvedBuckets))
+
+	return nil
+}
@@ -18,22 +18,34 @@ package searchrule
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"sync"
 	"time"
 
 	//
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	//
 	searchrulerv1alpha1 "prosimcorp.com/SearchRuler/api/v1alpha1"
 	"prosimcorp.com/SearchRuler/internal/controller"
 	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/tracing"
 )
 
 // SearchRuleReconciler reconciles a SearchRule object
@@ -43,11 +55,49 @@ type SearchRuleReconciler struct {
 	QueryConnectorCredentialsPool *pools.CredentialsStore
 	RulesPool                     *pools.RulesStore
 	AlertsPool                    *pools.AlertsStore
+	QueryCachePool                *pools.QueryCacheStore
+	HttpClientsPool               *pools.HttpClientsStore
+
+	// QueriesSemaphore bounds the number of queries executed at once against the backends.
+	// Queries are not limited when it is nil
+	QueriesSemaphore chan struct{}
+
+	// MaxConcurrentReconciles is the number of rules evaluated at once. Defaults to 1 when it is 0
+	MaxConcurrentReconciles int
+
+	// MsearchWindow is the time the responses of the batched elasticsearch queries are kept for the rules
+	// of the same QueryConnector. Queries are not batched when it is 0
+	MsearchWindow time.Duration
+
+	// Elected is closed when this replica is elected as leader, or immediately when
+	// leader election is disabled
+	Elected <-chan struct{}
+
+	// ErrorBackoffMaxInterval is the max time between the evaluations of the rules failing in a row, which
+	// are requeued with increasing backoff from their check interval. Backoff is disabled when it is 0
+	ErrorBackoffMaxInterval time.Duration
+
+	// StateRestored is closed once the state saved on the last shutdown is restored in the pools, so the rules
+	// are not evaluated before. Rules do not wait when it is nil
+	StateRestored <-chan struct{}
+
+	// ControllerNamespace is the namespace of the Silences muting the ClusterSearchRules.
+	// Empty disables silencing them
+	ControllerNamespace string
+
+	// consecutiveErrors stores the number of evaluations in a row failing for every rule
+	errorsMutex       sync.Mutex
+	consecutiveErrors map[string]int
 }
 
 // +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=searchrules,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=searchrules/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=searchrules/finalizers,verbs=update
+// +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=clustersearchrules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=clustersearchrules/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=clustersearchrules/finalizers,verbs=update
+// +kubebuilder:rbac:groups=searchruler.prosimcorp.com,resources=silences,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
 
 // +kubebuilder:rbac:groups="events.k8s.io",resources=events,verbs=get;list;watch;create;update;patch
 
@@ -59,36 +109,84 @@ type SearchRuleReconciler struct {
 func (r *SearchRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	logger := log.FromContext(ctx)
 
-	// 1. Get the content of the Patch
+	// Trace the evaluation of the rule. The span is the parent of the queries and the notifications of the alert
+	// The errors of the evaluation are not returned, so they are recorded in the span too
+	var syncErr error
+	ctx, span := tracing.Start(ctx, "SearchRule.Reconcile", trace.WithAttributes(
+		attribute.String("searchruler.namespace", req.Namespace),
+		attribute.String("searchruler.name", req.Name),
+	))
+	defer func() { tracing.End(span, errors.Join(err, syncErr)) }()
+
+	// 1. Get the content of the Patch. ClusterSearchRules are evaluated as SearchRules without namespace,
+	// and the changes are copied back to the ClusterSearchRule when updating it
+	resourceType := controller.SearchRuleResourceType
 	searchRuleResource := &searchrulerv1alpha1.SearchRule{}
-	err = r.Get(ctx, req.NamespacedName, searchRuleResource)
+	var clusterSearchRuleResource *searchrulerv1alpha1.ClusterSearchRule
+	switch req.Namespace {
+	case "":
+		resourceType = controller.ClusterSearchRuleResourceType
+		clusterSearchRuleResource = &searchrulerv1alpha1.ClusterSearchRule{}
+		err = r.Get(ctx, req.NamespacedName, clusterSearchRuleResource)
+		if err == nil {
+			searchRuleResource = clusterSearchRuleResource.ToSearchRule()
+		}
+	default:
+		err = r.Get(ctx, req.NamespacedName, searchRuleResource)
+	}
 
 	// 2. Check existence on the cluster
 	if err != nil {
 
 		// 2.1 It does NOT exist: manage removal
 		if err = client.IgnoreNotFound(err); err == nil {
-			logger.Info(fmt.Sprintf(controller.ResourceNotFoundError, controller.SearchRuleResourceType, req.NamespacedName))
+			logger.Info(fmt.Sprintf(controller.ResourceNotFoundError, resourceType, req.NamespacedName))
 			return result, err
 		}
 
 		// 2.2 Failed to get the resource, requeue the request
-		logger.Info(fmt.Sprintf(controller.ResourceSyncTimeRetrievalError, controller.SearchRuleResourceType, req.NamespacedName, err.Error()))
+		logger.Info(fmt.Sprintf(controller.ResourceSyncTimeRetrievalError, resourceType, req.NamespacedName, err.Error()))
 		return result, err
 	}
 
-	// 3. Check if the SearchRule instance is marked to be deleted: indicated by the deletion timestamp being set
+	// 3. Only the leader evaluates the rules. Followers keep the rules scheduled to take over
+	// as soon as they are elected
+	if !r.isLeader() {
+		RequeueTime, err := getRequeueTime(searchRuleResource)
+		if err != nil {
+			logger.Info(fmt.Sprintf(controller.ResourceSyncTimeRetrievalError, resourceType, req.NamespacedName, err.Error()))
+			return result, err
+		}
+		return ctrl.Result{RequeueAfter: RequeueTime}, nil
+	}
+
+	// Once elected, wait for the state saved on the last shutdown, so the timers of the rules are kept
+	if r.StateRestored != nil {
+		select {
+		case <-r.StateRestored:
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+	}
+
+	// 4. Check if the SearchRule instance is marked to be deleted: indicated by the deletion timestamp being set
 	if !searchRuleResource.DeletionTimestamp.IsZero() {
 		if controllerutil.ContainsFinalizer(searchRuleResource, controller.ResourceFinalizer) {
 
-			// 3.1 Delete the resources associated with the SearchRule
+			// 4.1 Delete the resources associated with the SearchRule. The finalizer is kept when it fails,
+			// so the deletion is retried
 			err = r.Sync(ctx, watch.Deleted, searchRuleResource)
+			if err != nil {
+				logger.Info(fmt.Sprintf(controller.SyncTargetError, resourceType, req.NamespacedName, err.Error()))
+				return result, err
+			}
+			r.getErrorBackoff(req.NamespacedName.String(), 0, nil) // Forget the errors of the rule
 
 			// Remove the finalizers on Patch CR
 			controllerutil.RemoveFinalizer(searchRuleResource, controller.ResourceFinalizer)
-			err = r.Update(ctx, searchRuleResource)
+			err = r.updateResource(ctx, searchRuleResource, clusterSearchRuleResource)
 			if err != nil {
-				logger.Info(fmt.Sprintf(controller.ResourceFinalizersUpdateError, controller.SearchRuleResourceType, req.NamespacedName, err.Error()))
+				logger.Info(fmt.Sprintf(controller.ResourceFinalizersUpdateError, resourceType, req.NamespacedName, err.Error()))
 			}
 		}
 
@@ -97,53 +195,228 @@ func (r *SearchRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return result, err
 	}
 
-	// 4. Add finalizer to the SearchRule CR
+	// 5. Add finalizer to the SearchRule CR
 	if !controllerutil.ContainsFinalizer(searchRuleResource, controller.ResourceFinalizer) {
 		controllerutil.AddFinalizer(searchRuleResource, controller.ResourceFinalizer)
-		err = r.Update(ctx, searchRuleResource)
+		err = r.updateResource(ctx, searchRuleResource, clusterSearchRuleResource)
 		if err != nil {
 			return result, err
 		}
 	}
 
-	// 5. Update the status before the requeue
+	// 6. Update the status before the requeue
 	defer func() {
-		err = r.Status().Update(ctx, searchRuleResource)
+		err = r.updateResourceStatus(ctx, searchRuleResource, clusterSearchRuleResource)
 		if err != nil {
-			logger.Info(fmt.Sprintf(controller.ResourceConditionUpdateError, controller.SearchRuleResourceType, req.NamespacedName, err.Error()))
+			logger.Info(fmt.Sprintf(controller.ResourceConditionUpdateError, resourceType, req.NamespacedName, err.Error()))
 		}
 	}()
 
-	// 6. Schedule periodical request
-	RequeueTime, err := time.ParseDuration(searchRuleResource.Spec.CheckInterval)
+	// 7. Schedule periodical request
+	RequeueTime, err := getRequeueTime(searchRuleResource)
 	if err != nil {
-		logger.Info(fmt.Sprintf(controller.ResourceSyncTimeRetrievalError, controller.SearchRuleResourceType, req.NamespacedName, err.Error()))
+		logger.Info(fmt.Sprintf(controller.ResourceSyncTimeRetrievalError, resourceType, req.NamespacedName, err.Error()))
 		return result, err
 	}
 	result = ctrl.Result{
 		RequeueAfter: RequeueTime,
 	}
 
-	// 7. Check the rule
-	err = r.Sync(ctx, watch.Modified, searchRuleResource)
-	if err != nil {
+	// 8. Check the rule. Changes of the evaluate-now annotation trigger the reconcile, so the rule is evaluated
+	// immediately. The value is acknowledged in the status once it is evaluated
+	syncErr = r.Sync(ctx, watch.Modified, searchRuleResource)
+	r.UpdateConditionReady(searchRuleResource, syncErr)
+
+	// Rules failing in a row are requeued with increasing backoff, so broken backends are not queried
+	// at the full cadence of the rules. The first success restores the check interval
+	result.RequeueAfter = r.getErrorBackoff(req.NamespacedName.String(), RequeueTime, syncErr)
+	if result.RequeueAfter > RequeueTime {
+		logger.Info("Rule is failing in a row, next evaluation is delayed", "requeueAfter", result.RequeueAfter.String())
+	}
+	if evaluateNow, evaluateNowFound := searchRuleResource.GetAnnotations()[controller.EvaluateNowAnnotation]; evaluateNowFound {
+		searchRuleResource.Status.LastEvaluateNow = evaluateNow
+	}
+
+	// The error is kept in the conditions of the rule instead of being returned, as controller-runtime
+	// ignores the RequeueAfter of the failed reconciles and would requeue them with its own rate limiter
+	if syncErr != nil {
 		r.UpdateConditionKubernetesApiCallFailure(searchRuleResource)
-		logger.Info(fmt.Sprintf(controller.SyncTargetError, controller.SearchRuleResourceType, req.NamespacedName, err.Error()))
-		return result, err
+		logger.Info(fmt.Sprintf(controller.SyncTargetError, resourceType, req.NamespacedName, syncErr.Error()))
+		return result, nil
 	}
 
-	// 8. Success, update the status
+	// 9. Success, update the status
 	r.UpdateConditionSuccess(searchRuleResource)
 
 	return result, err
 
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. The controller runs in all the replicas
+// to keep the rules scheduled, but just the leader evaluates them
 func (r *SearchRuleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	needLeaderElection := false
+	rulesFilter := builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&searchrulerv1alpha1.SearchRule{}).
-		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		For(&searchrulerv1alpha1.SearchRule{}, rulesFilter).
+		Watches(&searchrulerv1alpha1.ClusterSearchRule{}, &handler.EnqueueRequestForObject{}, rulesFilter).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.getConfigMapRules)). // Evaluate the rules again when the ConfigMap of their query changes
+		WithOptions(crcontroller.Options{
+			NeedLeaderElection:      &needLeaderElection,
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+		}).
 		Named("searchrule").
 		Complete(r)
 }
+
+// getConfigMapRules returns the requests of the SearchRules and ClusterSearchRules with the query in the ConfigMap
+func (r *SearchRuleReconciler) getConfigMapRules(ctx context.Context, configMap client.Object) []reconcile.Request {
+	logger := log.FromContext(ctx)
+	requests := []reconcile.Request{}
+
+	searchRules := &searchrulerv1alpha1.SearchRuleList{}
+	err := r.List(ctx, searchRules, client.InNamespace(configMap.GetNamespace()))
+	if err != nil {
+		logger.Info(fmt.Sprintf(controller.ResourceListError, controller.SearchRuleResourceType, err.Error()))
+	}
+	for _, searchRule := range searchRules.Items {
+		if isConfigMapQuery(&searchRule, configMap.GetNamespace(), configMap.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&searchRule)})
+		}
+	}
+
+	clusterSearchRules := &searchrulerv1alpha1.ClusterSearchRuleList{}
+	err = r.List(ctx, clusterSearchRules)
+	if err != nil {
+		logger.Info(fmt.Sprintf(controller.ResourceListError, controller.ClusterSearchRuleResourceType, err.Error()))
+	}
+	for _, clusterSearchRule := range clusterSearchRules.Items {
+		if isConfigMapQuery(clusterSearchRule.ToSearchRule(), configMap.GetNamespace(), configMap.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&clusterSearchRule)})
+		}
+	}
+
+	return requests
+}
+
+// isConfigMapQuery returns true when the query of the rule is stored in the given ConfigMap
+func isConfigMapQuery(resource *searchrulerv1alpha1.SearchRule, namespace, name string) bool {
+	configMapRef := resource.Spec.Elasticsearch.QueryConfigMapRef
+	if configMapRef == nil {
+		return false
+	}
+	configMapNamespace := configMapRef.Namespace
+	if configMapNamespace == "" {
+		configMapNamespace = resource.Namespace
+	}
+	return configMapNamespace == namespace && configMapRef.Name == name
+}
+
+// updateResource updates the SearchRule in Kubernetes. For ClusterSearchRules, the metadata of the
+// evaluated SearchRule is copied to the ClusterSearchRule, which is the one updated
+func (r *SearchRuleReconciler) updateResource(ctx context.Context, resource *searchrulerv1alpha1.SearchRule,
+	clusterResource *searchrulerv1alpha1.ClusterSearchRule) error {
+
+	if clusterResource == nil {
+		return r.Update(ctx, resource)
+	}
+
+	resource.ObjectMeta.DeepCopyInto(&clusterResource.ObjectMeta)
+	err := r.Update(ctx, clusterResource)
+	if err != nil {
+		return err
+	}
+	clusterResource.ObjectMeta.DeepCopyInto(&resource.ObjectMeta)
+	return nil
+}
+
+// updateResourceStatus updates the status of the SearchRule in Kubernetes. For ClusterSearchRules, the status
+// of the evaluated SearchRule is copied to the ClusterSearchRule, which is the one updated
+func (r *SearchRuleReconciler) updateResourceStatus(ctx context.Context, resource *searchrulerv1alpha1.SearchRule,
+	clusterResource *searchrulerv1alpha1.ClusterSearchRule) error {
+
+	if clusterResource == nil {
+		return r.Status().Update(ctx, resource)
+	}
+
+	resource.Status.DeepCopyInto(&clusterResource.Status)
+	return r.Status().Update(ctx, clusterResource)
+}
+
+// isLeader returns true when this replica is the leader or leader election is disabled
+func (r *SearchRuleReconciler) isLeader() bool {
+	select {
+	case <-r.Elected:
+		return true
+	default:
+		return false
+	}
+}
+
+// getRequeueTime returns the check interval of the rule plus the jitter, if defined. The jitter is deterministic,
+// seeded from the namespace and name of the rule, so it is stable across reconciles and rules with the same
+// check interval are spread out
+func getRequeueTime(resource *searchrulerv1alpha1.SearchRule) (time.Duration, error) {
+	checkInterval, err := getCheckInterval(resource.Spec.CheckInterval, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	if resource.Spec.CheckJitter == "" {
+		return checkInterval, nil
+	}
+	checkJitter, err := time.ParseDuration(resource.Spec.CheckJitter)
+	if err != nil {
+		return 0, err
+	}
+	if checkJitter <= 0 {
+		return checkInterval, nil
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(resource.Namespace + "/" + resource.Name))
+	return checkInterval + time.Duration(hash.Sum64()%uint64(checkJitter)), nil
+}
+
+// getErrorBackoff returns the time until the next evaluation of the rule after the given result. Every error in a row
+// doubles the requeue time, up to the max backoff interval, and a success resets it. Requeue times longer than the
+// max backoff interval are not changed, so failing rules are never evaluated more often than healthy ones
+func (r *SearchRuleReconciler) getErrorBackoff(ruleKey string, requeueTime time.Duration, err error) time.Duration {
+	r.errorsMutex.Lock()
+	defer r.errorsMutex.Unlock()
+
+	if err == nil {
+		delete(r.consecutiveErrors, ruleKey)
+		return requeueTime
+	}
+	if r.consecutiveErrors == nil {
+		r.consecutiveErrors = map[string]int{}
+	}
+	r.consecutiveErrors[ruleKey]++
+
+	backoff := requeueTime
+	for i := 1; i < r.consecutiveErrors[ruleKey] && backoff < r.ErrorBackoffMaxInterval; i++ {
+		backoff *= 2
+	}
+	if backoff > r.ErrorBackoffMaxInterval {
+		backoff = max(r.ErrorBackoffMaxInterval, requeueTime)
+	}
+	return backoff
+}
+
+// getCheckInterval returns the time until the next check of the rule. The checkInterval can be a duration
+// or a standard cron expression, which schedules the checks aligned with the clock
+func getCheckInterval(checkInterval string, now time.Time) (time.Duration, error) {
+	interval, err := time.ParseDuration(checkInterval)
+	if err == nil {
+		return interval, nil
+	}
+
+	schedule, cronErr := cron.ParseStandard(checkInterval)
+	if cronErr != nil {
+		return 0, fmt.Errorf(controller.CheckIntervalParseErrorMessage, checkInterval, err, cronErr)
+	}
+
+	// Skip the current second to avoid evaluating twice when the requeue is triggered slightly early
+	return schedule.Next(now.Add(time.Second)).Sub(now), nil
+}
@@ -0,0 +1,576 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/globals"
+	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/template"
+)
+
+const (
+
+	// Elasticsearch aggregation field
+	elasticAggregationsField = "aggregations"
+
+	// Placeholder for the index in the Elasticsearch search path
+	elasticIndexPlaceholder = "{index}"
+
+	// Default number of hits returned by Elasticsearch when the size is not defined in the query
+	elasticDefaultPageSize = 10
+
+	// Max number of pages requested for a paginated query, so a single evaluation can not flood the backend
+	// nor hold all the hits of an index in memory when the maxPages of the rule is not validated
+	elasticMaxPages = 100
+
+	// Elasticsearch hits field and max number of hits attached to the alerts as samples
+	elasticHitsField     = "hits.hits"
+	elasticMaxSampleSize = 10
+
+	// Elasticsearch total hits field. Old versions, or requests with rest_total_hits_as_int, return the
+	// total hits as a number instead of an object
+	elasticTotalHitsField    = "hits.total.value"
+	elasticTotalHitsIntField = "hits.total"
+)
+
+var (
+	// Default Elasticsearch search path. It is appended to the QueryConnector URL
+	ElasticsearchSearchPath = "/{index}/_search"
+
+	// Regex to find placeholders in the Elasticsearch search path
+	placeholderRegex = regexp.MustCompile(`\{[^{}]*\}`)
+)
+
+// queryElasticsearch executes the elasticsearch query of the rule and returns the value of the conditionField,
+// the aggregations of the response and the threshold for the condition
+func (r *SearchRuleReconciler) queryElasticsearch(ctx context.Context, resource *v1alpha1.SearchRule,
+	connector *queryConnector) (*queryResult, error) {
+
+	// Build the search of the rule
+	search, err := r.getElasticsearchSearch(ctx, resource, connector)
+	if err != nil {
+		return nil, err
+	}
+	searchURL := search.searchURL
+	elasticQuery := search.query
+
+	// Batch the query with the queries of the other rules of the QueryConnector when enabled. The response
+	// is taken from the query cache then, and failed batches fall back to the query of the rule
+	if r.MsearchWindow > 0 && isMsearchSearch(resource) && connector.ResponseFormat != responseFormatNDJSON {
+		err = r.prefetchElasticsearchQueries(ctx, resource, connector, search)
+		if err != nil {
+			log.FromContext(ctx).Info("Batch of elasticsearch queries failed", "error", err.Error())
+		}
+	}
+
+	// Execute the query in elasticsearch
+	var responseBody []byte
+	if resource.Spec.Elasticsearch.Pagination.MaxPages > 0 {
+		responseBody, err = r.searchElasticsearchPages(ctx, resource, connector, searchURL, elasticQuery)
+	} else {
+		responseBody, err = r.executeQuery(ctx, resource, connector, http.MethodPost, searchURL, elasticQuery)
+	}
+	if err != nil {
+		// A missing index is the most common misconfiguration of the rules, so it is reported on its own
+		// instead of as an error response when the index is checked
+		if resource.Spec.Elasticsearch.CheckIndex && isErrorResponse(resource) {
+			indexErr := r.checkElasticsearchIndex(ctx, resource, connector, search.index)
+			if indexErr != nil {
+				return nil, indexErr
+			}
+		}
+		return nil, err
+	}
+
+	// When less documents than the minDocCount match the query, the data is not enough to evaluate the
+	// condition. It is checked before the conditionField, which is usually missing in empty responses
+	if resource.Spec.Elasticsearch.MinDocCount > 0 &&
+		getElasticsearchTotalHits(responseBody) < resource.Spec.Elasticsearch.MinDocCount {
+		return &queryResult{
+			query:  string(elasticQuery),
+			noData: true,
+		}, nil
+	}
+
+	// Extract conditionField from the response field of elasticsearch
+	conditionValue, err := r.getConditionValue(resource, responseBody, resource.Spec.Elasticsearch.ConditionField)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save elastic response if the result has aggregations, this allows user
+	// to use the response in the action
+	aggregationsResource := interface{}(nil)
+	aggregationsResponse := gjson.GetBytes(responseBody, elasticAggregationsField)
+	if aggregationsResponse.Exists() {
+		aggregationsResource = aggregationsResponse.Value()
+	}
+
+	// Capture the first hits of the response as samples of the alert for the triage
+	samples := getElasticsearchSamples(responseBody, resource.Spec.Elasticsearch.SampleSize)
+
+	// Get the threshold of the condition. When a baseline is defined, the threshold is calculated
+	// multiplying the value of the baseline query by the configured threshold
+	threshold := resource.Spec.Condition.Threshold
+	if !reflect.ValueOf(resource.Spec.Elasticsearch.Baseline).IsZero() {
+		threshold, err = r.getBaselineThreshold(ctx, resource, connector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &queryResult{
+		conditionValue: conditionValue,
+		aggregations:   aggregationsResource,
+		threshold:      threshold,
+		query:          string(elasticQuery),
+		samples:        samples,
+	}, nil
+}
+
+// checkElasticsearchIndex checks with a HEAD request that the index of the rule exists in elasticsearch. It returns
+// an error just when elasticsearch answers that the index does not exist, as other failures are already reported
+// by the query
+func (r *SearchRuleReconciler) checkElasticsearchIndex(ctx context.Context, resource *v1alpha1.SearchRule,
+	connector *queryConnector, index string) error {
+
+	httpClient, err := r.getHttpClient(connector)
+	if err != nil {
+		return nil
+	}
+	headers, err := getQueryHeaders(resource, connector, time.Now())
+	if err != nil {
+		return nil
+	}
+	req, err := newQueryRequest(ctx, connector, headers, http.MethodHead, connector.URL+"/"+escapeElasticsearchIndex(index), nil)
+	if err != nil {
+		return nil
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		return nil
+	}
+	r.UpdateConditionIndexNotFound(resource, index)
+	return fmt.Errorf(controller.IndexNotFoundErrorMessage, index, connector.URL)
+}
+
+// isErrorResponse returns whether the last query of the rule failed because the backend answered with an error
+func isErrorResponse(resource *v1alpha1.SearchRule) bool {
+	condition := meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState)
+	return condition != nil && condition.Reason == globals.ConditionReasonErrorResponseType
+}
+
+// getElasticsearchTotalHits returns the number of documents matching the query of the response
+func getElasticsearchTotalHits(responseBody []byte) int64 {
+	totalHits := gjson.GetBytes(responseBody, elasticTotalHitsField)
+	if !totalHits.Exists() {
+		totalHits = gjson.GetBytes(responseBody, elasticTotalHitsIntField)
+	}
+	return totalHits.Int()
+}
+
+// getElasticsearchSamples returns the first hits of the response, up to the sample size. The size is
+// capped, so the alerts do not grow with the size of the query
+func getElasticsearchSamples(responseBody []byte, sampleSize int) []interface{} {
+	sampleSize = min(sampleSize, elasticMaxSampleSize)
+	if sampleSize <= 0 {
+		return nil
+	}
+
+	samples := []interface{}{}
+	for _, hit := range gjson.GetBytes(responseBody, elasticHitsField).Array() {
+		if len(samples) >= sampleSize {
+			break
+		}
+		samples = append(samples, hit.Value())
+	}
+	return samples
+}
+
+// getElasticsearchSearch returns the search of the rule: the search URL, the index and the query, after
+// resolving the ConfigMap and the templates of the query
+func (r *SearchRuleReconciler) getElasticsearchSearch(ctx context.Context, resource *v1alpha1.SearchRule,
+	connector *queryConnector) (search elasticsearchSearch, err error) {
+
+	// Check if query is defined in the resource
+	querySources := getElasticsearchQuerySources(resource.Spec.Elasticsearch)
+	if querySources == 0 {
+		r.UpdateConditionNoQueryFound(resource)
+		return search, fmt.Errorf(controller.QueryNotDefinedErrorMessage, resource.Name)
+	}
+
+	// Check if more than one of query, queryJSON or queryConfigMapRef are defined. If true, return error
+	if querySources > 1 {
+		r.UpdateConditionNoQueryFound(resource)
+		return search, fmt.Errorf(controller.QueryDefinedInBothErrorMessage, resource.Name)
+	}
+
+	// Select query to use and marshall to JSON. The query of the ConfigMap is used as a queryJSON
+	queryJSON := resource.Spec.Elasticsearch.QueryJSON
+	if resource.Spec.Elasticsearch.QueryConfigMapRef != nil {
+		queryJSON, err = r.getConfigMapQuery(ctx, resource)
+		if err != nil {
+			return search, err
+		}
+	}
+	search.query, err = getElasticsearchQuery(resource.Spec.Elasticsearch.Query, queryJSON)
+	if err != nil {
+		return search, err
+	}
+	search.query, err = renderElasticsearchQuery(resource, search.query, time.Now())
+	if err != nil {
+		r.UpdateConditionEvaluateTemplateError(resource)
+		return search, err
+	}
+
+	// The index and the list of indices are searched together with the multi-index syntax of elasticsearch
+	index := resource.Spec.Elasticsearch.GetIndex()
+	if index == "" {
+		r.UpdateConditionQueryError(resource)
+		return search, fmt.Errorf(controller.IndexNotDefinedErrorMessage, resource.Name)
+	}
+	search.searchURL, err = r.getElasticsearchSearchURL(resource, connector, index)
+	if err != nil {
+		return search, err
+	}
+	search.index, err = renderElasticsearchIndex(resource, index, time.Now())
+	if err != nil {
+		return search, err
+	}
+
+	return search, nil
+}
+
+// getBaselineThreshold executes the baseline query of the rule and returns the threshold for the condition,
+// which is the value of the thresholdField in the baseline response multiplied by the configured threshold.
+// When the baseline query fails, an error is returned so the state of the rule is not changed
+func (r *SearchRuleReconciler) getBaselineThreshold(ctx context.Context, resource *v1alpha1.SearchRule, connector *queryConnector) (string, error) {
+
+	baseline := resource.Spec.Elasticsearch.Baseline
+
+	// Parse the threshold as the multiplier of the baseline value
+	multiplier, err := strconv.ParseFloat(resource.Spec.Condition.Threshold, 64)
+	if err != nil {
+		r.UpdateConditionQueryError(resource)
+		return "", fmt.Errorf(controller.EvaluatingConditionErrorMessage,
+			fmt.Errorf("configured threshold is not a valid float: %v", resource.Spec.Condition.Threshold))
+	}
+
+	// Exactly one of query or queryJSON must be defined in the baseline
+	if (baseline.Query == nil) == (baseline.QueryJSON == "") {
+		r.UpdateConditionNoQueryFound(resource)
+		return "", fmt.Errorf(controller.BaselineQueryNotDefinedErrorMessage, resource.Name)
+	}
+	baselineQuery, err := getElasticsearchQuery(baseline.Query, baseline.QueryJSON)
+	if err != nil {
+		return "", err
+	}
+	baselineQuery, err = renderElasticsearchQuery(resource, baselineQuery, time.Now())
+	if err != nil {
+		r.UpdateConditionEvaluateTemplateError(resource)
+		return "", err
+	}
+
+	// Execute the baseline query in the index of the baseline or in the index of the rule when not defined
+	index := baseline.Index
+	if index == "" {
+		index = resource.Spec.Elasticsearch.GetIndex()
+	}
+	searchURL, err := r.getElasticsearchSearchURL(resource, connector, index)
+	if err != nil {
+		return "", err
+	}
+	responseBody, err := r.executeQuery(ctx, resource, connector, http.MethodPost, searchURL, baselineQuery)
+	if err != nil {
+		return "", err
+	}
+
+	// Extract thresholdField from the response of the baseline query
+	baselineValue := gjson.GetBytes(responseBody, baseline.ThresholdField)
+	if !baselineValue.Exists() {
+		r.UpdateConditionQueryErrorWithResponse(resource, responseBody)
+		return "", fmt.Errorf(
+			controller.ThresholdFieldNotFoundMessage,
+			baseline.ThresholdField,
+			string(responseBody),
+		)
+	}
+
+	return strconv.FormatFloat(baselineValue.Float()*multiplier, 'f', -1, 64), nil
+}
+
+// searchElasticsearchPages executes the query page by page with search_after, until a page returns less hits than
+// the size of the query or the max pages of the rule are requested. It returns the response of the first page with
+// the hits of all the pages, so the conditionField can count them across pages, for example with hits.hits.#
+func (r *SearchRuleReconciler) searchElasticsearchPages(ctx context.Context, resource *v1alpha1.SearchRule, connector *queryConnector,
+	searchURL string, query []byte) ([]byte, error) {
+
+	// search_after needs the query to be sorted to know where the next page starts
+	if !gjson.GetBytes(query, "sort").Exists() {
+		r.UpdateConditionQueryError(resource)
+		return nil, fmt.Errorf(controller.PaginationSortMissingErrorMessage, resource.Name)
+	}
+	pageSize := elasticDefaultPageSize
+	if size := gjson.GetBytes(query, "size"); size.Exists() {
+		pageSize = int(size.Int())
+	}
+
+	// Numbers are kept as they are, so the sort values of the hits are not rounded
+	pageQuery := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(query))
+	decoder.UseNumber()
+	err := decoder.Decode(&pageQuery)
+	if err != nil {
+		return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+	}
+
+	var firstResponse []byte
+	hits := []json.RawMessage{}
+	maxPages := min(resource.Spec.Elasticsearch.Pagination.MaxPages, elasticMaxPages)
+	for page := 0; page < maxPages; page++ {
+		pageBody, err := json.Marshal(pageQuery)
+		if err != nil {
+			return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+		}
+		responseBody, err := r.executeQuery(ctx, resource, connector, http.MethodPost, searchURL, pageBody)
+		if err != nil {
+			return nil, err
+		}
+		if firstResponse == nil {
+			firstResponse = responseBody
+		}
+
+		pageHits := gjson.GetBytes(responseBody, "hits.hits").Array()
+		for _, hit := range pageHits {
+			hits = append(hits, json.RawMessage(hit.Raw))
+		}
+
+		// The last page is the one with less hits than the page size
+		if len(pageHits) == 0 || len(pageHits) < pageSize {
+			break
+		}
+		lastSort := pageHits[len(pageHits)-1].Get("sort")
+		if !lastSort.Exists() {
+			break
+		}
+		pageQuery["search_after"] = json.RawMessage(lastSort.Raw)
+	}
+
+	return mergeElasticsearchHits(firstResponse, hits)
+}
+
+// mergeElasticsearchHits returns the response with its hits.hits field replaced by the given hits.
+// Responses without hits are returned as they are
+func mergeElasticsearchHits(response []byte, hits []json.RawMessage) ([]byte, error) {
+
+	mergedResponse := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(response))
+	decoder.UseNumber()
+	err := decoder.Decode(&mergedResponse)
+	if err != nil {
+		return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+	}
+
+	hitsObject, hitsFound := mergedResponse["hits"].(map[string]interface{})
+	if !hitsFound {
+		return response, nil
+	}
+	hitsObject["hits"] = hits
+
+	mergedBody, err := json.Marshal(mergedResponse)
+	if err != nil {
+		return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+	}
+	return mergedBody, nil
+}
+
+// getElasticsearchQuery returns the query to send to elasticsearch. If query is defined, just Marshal it.
+// If queryJSON is defined, it is already a JSON, just convert it to bytes
+func getElasticsearchQuery(query *apiextensionsv1.JSON, queryJSON string) ([]byte, error) {
+	if query != nil {
+		elasticQuery, err := json.Marshal(query)
+		if err != nil {
+			return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+		}
+		return elasticQuery, nil
+	}
+	return []byte(queryJSON), nil
+}
+
+// renderElasticsearchQuery evaluates the query as a template, so time windows or the labels of the rule can be
+// injected in it. The current time, the labels and the object of the rule are available in the template
+func renderElasticsearchQuery(resource *v1alpha1.SearchRule, query []byte, now time.Time) ([]byte, error) {
+
+	templateInjectedObject := map[string]interface{}{}
+	templateInjectedObject["now"] = now.UTC()
+	templateInjectedObject["labels"] = resource.Spec.Labels
+	templateInjectedObject["object"] = *resource
+
+	renderedQuery, err := template.EvaluateTemplate(string(query), templateInjectedObject)
+	if err != nil {
+		return nil, fmt.Errorf(controller.EvaluateTemplateErrorMessage, err)
+	}
+	return []byte(renderedQuery), nil
+}
+
+// getElasticsearchQuerySources returns the number of query, queryJSON and queryConfigMapRef defined in the rule
+func getElasticsearchQuerySources(elasticsearch v1alpha1.Elasticsearch) int {
+	querySources := 0
+	if elasticsearch.Query != nil {
+		querySources++
+	}
+	if elasticsearch.QueryJSON != "" {
+		querySources++
+	}
+	if elasticsearch.QueryConfigMapRef != nil {
+		querySources++
+	}
+	return querySources
+}
+
+// getConfigMapQuery returns the query stored in the key of the ConfigMap referenced by the rule. The ConfigMap
+// is read from the cache of the manager, which is kept updated by the watch on ConfigMaps. The namespace of the
+// ConfigMap defaults to the namespace of the rule, so it is mandatory for ClusterSearchRules
+func (r *SearchRuleReconciler) getConfigMapQuery(ctx context.Context, resource *v1alpha1.SearchRule) (string, error) {
+
+	configMapRef := resource.Spec.Elasticsearch.QueryConfigMapRef
+	namespace := configMapRef.Namespace
+	if namespace == "" {
+		namespace = resource.Namespace
+	}
+	configMapKey := pools.GetKey(namespace, configMapRef.Name)
+
+	configMap := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: configMapRef.Name}, configMap)
+	if err != nil {
+		r.UpdateConditionNoQueryFound(resource)
+		return "", fmt.Errorf(controller.ConfigMapNotFoundErrorMessage, configMapKey, err)
+	}
+
+	query, keyExists := configMap.Data[configMapRef.Key]
+	if !keyExists {
+		r.UpdateConditionNoQueryFound(resource)
+		return "", fmt.Errorf(controller.ConfigMapKeyNotFoundErrorMessage, configMapRef.Key, configMapKey)
+	}
+
+	return query, nil
+}
+
+// getElasticsearchSearchURL returns the URL to search in the index from the search path of the rule,
+// or the default one, and the search params of the rule
+func (r *SearchRuleReconciler) getElasticsearchSearchURL(resource *v1alpha1.SearchRule, connector *queryConnector,
+	index string) (string, error) {
+
+	// Generate URL for search to elasticsearch from the search path of the rule or the default one
+	searchPath := ElasticsearchSearchPath
+	if resource.Spec.Elasticsearch.SearchPath != "" {
+		searchPath = resource.Spec.Elasticsearch.SearchPath
+	}
+	err := validateSearchPath(searchPath)
+	if err != nil {
+		r.UpdateConditionQueryError(resource)
+		return "", fmt.Errorf(controller.SearchPathInvalidErrorMessage, searchPath, err)
+	}
+
+	// The index is evaluated as a template like the query, so daily indices can be built from the
+	// current time. Date math expressions are resolved by elasticsearch
+	index, err = renderElasticsearchIndex(resource, index, time.Now())
+	if err != nil {
+		r.UpdateConditionEvaluateTemplateError(resource)
+		return "", err
+	}
+	index = escapeElasticsearchIndex(index)
+	searchURL := connector.URL + strings.Replace(searchPath, elasticIndexPlaceholder, index, 1)
+
+	// Add the search params of the rule to the URL query string. Empty values are omitted
+	if len(resource.Spec.Elasticsearch.SearchParams) > 0 {
+		parsedSearchURL, err := url.Parse(searchURL)
+		if err != nil {
+			r.UpdateConditionQueryError(resource)
+			return "", fmt.Errorf(controller.SearchPathInvalidErrorMessage, searchPath, err)
+		}
+		searchParams := parsedSearchURL.Query()
+		for key, value := range resource.Spec.Elasticsearch.SearchParams {
+			if value == "" {
+				continue
+			}
+			searchParams.Set(key, value)
+		}
+		parsedSearchURL.RawQuery = searchParams.Encode()
+		searchURL = parsedSearchURL.String()
+	}
+
+	return searchURL, nil
+}
+
+// renderElasticsearchIndex evaluates the index as a template with the same data as the query
+func renderElasticsearchIndex(resource *v1alpha1.SearchRule, index string, now time.Time) (string, error) {
+	renderedIndex, err := renderElasticsearchQuery(resource, []byte(index), now)
+	if err != nil {
+		return "", err
+	}
+	return string(renderedIndex), nil
+}
+
+// escapeElasticsearchIndex URL-encodes the date math expressions of the index, like <logs-{now/d}>, as they
+// contain slashes and braces. Index names without date math are kept as they are
+func escapeElasticsearchIndex(index string) string {
+	indices := strings.Split(index, ",")
+	for i, name := range indices {
+		if strings.HasPrefix(name, "<") && strings.HasSuffix(name, ">") {
+			indices[i] = url.PathEscape(name)
+		}
+	}
+	return strings.Join(indices, ",")
+}
+
+// validateSearchPath checks that the search path contains the index placeholder exactly once
+// and no other placeholders
+func validateSearchPath(searchPath string) error {
+	placeholders := placeholderRegex.FindAllString(searchPath, -1)
+	if len(placeholders) != 1 || placeholders[0] != elasticIndexPlaceholder {
+		return fmt.Errorf("expected exactly one %s placeholder, found %v", elasticIndexPlaceholder, placeholders)
+	}
+	return nil
+}
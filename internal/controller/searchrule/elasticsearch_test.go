@@ -0,0 +1,259 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+var _ = Describe("searchElasticsearchPages", func() {
+
+	var (
+		server     *httptest.Server
+		requests   []string
+		reconciler *SearchRuleReconciler
+		resource   *v1alpha1.SearchRule
+	)
+
+	// pages returns two full pages of two hits and a last page with one hit
+	pages := map[string]string{
+		"":                   `{"hits":{"total":{"value":5},"hits":[{"_id":"1","sort":[1]},{"_id":"2","sort":[2]}]}}`,
+		"[2]":                `{"hits":{"total":{"value":5},"hits":[{"_id":"3","sort":[3]},{"_id":"4","sort":[9007199254740993]}]}}`,
+		"[9007199254740993]": `{"hits":{"total":{"value":5},"hits":[{"_id":"5","sort":[10]}]}}`,
+	}
+
+	BeforeEach(func() {
+		requests = []string{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			requests = append(requests, string(body))
+			_, _ = w.Write([]byte(pages[gjson.GetBytes(body, "search_after").Raw]))
+		}))
+
+		reconciler = &SearchRuleReconciler{
+			QueryCachePool:  &pools.QueryCacheStore{Store: map[string]*pools.QueryCacheEntry{}},
+			HttpClientsPool: &pools.HttpClientsStore{Store: map[string]*pools.HttpClient{}},
+		}
+		resource = &v1alpha1.SearchRule{}
+		resource.Spec.Elasticsearch.Pagination.MaxPages = 5
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should merge the hits of all the pages until the last page", func() {
+		response, err := reconciler.searchElasticsearchPages(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}),
+			server.URL, []byte(`{"size":2,"sort":[{"timestamp":"asc"}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests).To(HaveLen(3))
+		Expect(gjson.GetBytes(response, "hits.hits.#").Int()).To(Equal(int64(5)))
+		Expect(gjson.GetBytes(response, "hits.total.value").Int()).To(Equal(int64(5)))
+	})
+
+	It("should keep the sort values of the hits without rounding them", func() {
+		_, err := reconciler.searchElasticsearchPages(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}),
+			server.URL, []byte(`{"size":2,"sort":[{"timestamp":"asc"}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gjson.Get(requests[2], "search_after").Raw).To(Equal("[9007199254740993]"))
+	})
+
+	It("should not request more pages than the max pages", func() {
+		resource.Spec.Elasticsearch.Pagination.MaxPages = 2
+		response, err := reconciler.searchElasticsearchPages(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}),
+			server.URL, []byte(`{"size":2,"sort":[{"timestamp":"asc"}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests).To(HaveLen(2))
+		Expect(gjson.GetBytes(response, "hits.hits.#").Int()).To(Equal(int64(4)))
+	})
+
+	It("should not request more pages than the hard limit", func() {
+		endless := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			requests = append(requests, string(body))
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"hits":{"hits":[{"sort":[%d]}]}}`, len(requests))))
+		}))
+		defer endless.Close()
+
+		resource.Spec.Elasticsearch.Pagination.MaxPages = 1000
+		response, err := reconciler.searchElasticsearchPages(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: endless.URL}),
+			endless.URL, []byte(`{"size":1,"sort":[{"timestamp":"asc"}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests).To(HaveLen(elasticMaxPages))
+		Expect(gjson.GetBytes(response, "hits.hits.#").Int()).To(Equal(int64(elasticMaxPages)))
+	})
+
+	It("should fail when the query is not sorted", func() {
+		_, err := reconciler.searchElasticsearchPages(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}),
+			server.URL, []byte(`{"size":2}`))
+		Expect(err).To(HaveOccurred())
+		Expect(requests).To(BeEmpty())
+	})
+})
+
+var _ = Describe("isConfigMapQuery", func() {
+
+	It("should match the ConfigMap in the namespace of the rule when the namespace is not defined", func() {
+		resource := &v1alpha1.SearchRule{}
+		resource.Namespace = "monitoring"
+		resource.Spec.Elasticsearch.QueryConfigMapRef = &v1alpha1.QueryConfigMapRef{Name: "queries", Key: "errors.json"}
+		Expect(isConfigMapQuery(resource, "monitoring", "queries")).To(BeTrue())
+		Expect(isConfigMapQuery(resource, "default", "queries")).To(BeFalse())
+		Expect(isConfigMapQuery(resource, "monitoring", "other")).To(BeFalse())
+	})
+
+	It("should match the ConfigMap in the namespace of the reference", func() {
+		resource := &v1alpha1.SearchRule{}
+		resource.Spec.Elasticsearch.QueryConfigMapRef = &v1alpha1.QueryConfigMapRef{Name: "queries", Namespace: "monitoring", Key: "errors.json"}
+		Expect(isConfigMapQuery(resource, "monitoring", "queries")).To(BeTrue())
+	})
+
+	It("should not match rules without ConfigMap", func() {
+		resource := &v1alpha1.SearchRule{}
+		resource.Spec.Elasticsearch.QueryJSON = `{"size":0}`
+		Expect(isConfigMapQuery(resource, "", "")).To(BeFalse())
+		Expect(getElasticsearchQuerySources(resource.Spec.Elasticsearch)).To(Equal(1))
+	})
+})
+
+var _ = Describe("renderElasticsearchQuery", func() {
+
+	now := time.Date(2024, 5, 10, 12, 30, 0, 0, time.UTC)
+
+	It("should inject the current time and the labels of the rule", func() {
+		resource := &v1alpha1.SearchRule{}
+		resource.Spec.Labels = map[string]string{"team": "payments"}
+		query, err := renderElasticsearchQuery(resource,
+			[]byte(`{"team":"{{ .labels.team }}","gte":"{{ .now | dateModify "-15m" | date "2006-01-02T15:04:05Z" }}"}`), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(query)).To(Equal(`{"team":"payments","gte":"2024-05-10T12:15:00Z"}`))
+	})
+
+	It("should keep the queries without templates as they are", func() {
+		query, err := renderElasticsearchQuery(&v1alpha1.SearchRule{}, []byte(`{"size":0}`), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(query)).To(Equal(`{"size":0}`))
+	})
+
+	It("should fail with invalid templates", func() {
+		_, err := renderElasticsearchQuery(&v1alpha1.SearchRule{}, []byte(`{"team":"{{ .labels.team "}`), now)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("escapeElasticsearchIndex", func() {
+
+	It("should URL-encode the date math expressions", func() {
+		Expect(escapeElasticsearchIndex("<logs-{now/d}>")).To(Equal("%3Clogs-%7Bnow%2Fd%7D%3E"))
+	})
+
+	It("should keep the index names without date math as they are", func() {
+		Expect(escapeElasticsearchIndex("logs-*,<logs-{now/d-1d}>")).To(Equal("logs-*,%3Clogs-%7Bnow%2Fd-1d%7D%3E"))
+	})
+})
+
+var _ = Describe("getElasticsearchSearch", func() {
+
+	connector := newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: "http://elasticsearch:9200"})
+
+	newRule := func(index string, indices ...string) *v1alpha1.SearchRule {
+		rule := &v1alpha1.SearchRule{}
+		rule.Spec.Elasticsearch.Index = index
+		rule.Spec.Elasticsearch.Indices = indices
+		rule.Spec.Elasticsearch.QueryJSON = `{"size":0}`
+		return rule
+	}
+
+	It("should search in the index and the list of indices with the multi-index syntax", func() {
+		search, err := (&SearchRuleReconciler{}).getElasticsearchSearch(context.Background(),
+			newRule("logs-app, logs-web", "<logs-{now/d}>"), connector)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(search.searchURL).To(Equal("http://elasticsearch:9200/logs-app,logs-web,%3Clogs-%7Bnow%2Fd%7D%3E/_search"))
+		Expect(search.index).To(Equal("logs-app,logs-web,<logs-{now/d}>"))
+	})
+
+	It("should keep working with a single index", func() {
+		search, err := (&SearchRuleReconciler{}).getElasticsearchSearch(context.Background(), newRule("logs"), connector)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(search.searchURL).To(Equal("http://elasticsearch:9200/logs/_search"))
+	})
+
+	It("should fail when no index is defined", func() {
+		_, err := (&SearchRuleReconciler{}).getElasticsearchSearch(context.Background(), newRule("", " "), connector)
+		Expect(err).To(MatchError(ContainSubstring("index not defined")))
+	})
+})
+
+var _ = Describe("getMsearchBody", func() {
+
+	It("should write a header and a compacted query line for every search", func() {
+		body, err := getMsearchBody([]elasticsearchSearch{
+			{index: "logs", query: []byte("{\n  \"size\": 0\n}")},
+			{index: "<logs-{now/d}>", query: []byte(`{"size":1}`)},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("{\"index\":\"logs\"}\n{\"size\":0}\n{\"index\":\"<logs-{now/d}>\"}\n{\"size\":1}\n"))
+	})
+})
+
+var _ = Describe("getElasticsearchSamples", func() {
+
+	responseBody := []byte(`{"hits":{"hits":[{"_id":"1"},{"_id":"2"},{"_id":"3"}]}}`)
+
+	It("should return the first hits up to the sample size", func() {
+		samples := getElasticsearchSamples(responseBody, 2)
+		Expect(samples).To(Equal([]interface{}{
+			map[string]interface{}{"_id": "1"},
+			map[string]interface{}{"_id": "2"},
+		}))
+		Expect(getElasticsearchSamples(responseBody, 5)).To(HaveLen(3))
+	})
+
+	It("should not return samples when the sample size is not defined", func() {
+		Expect(getElasticsearchSamples(responseBody, 0)).To(BeNil())
+		Expect(getElasticsearchSamples([]byte(`{"hits":{"total":{"value":3}}}`), 2)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("getElasticsearchTotalHits", func() {
+
+	It("should return the total hits of the response", func() {
+		Expect(getElasticsearchTotalHits([]byte(`{"hits":{"total":{"value":42,"relation":"eq"}}}`))).To(Equal(int64(42)))
+	})
+
+	It("should return the total hits returned as a number", func() {
+		Expect(getElasticsearchTotalHits([]byte(`{"hits":{"total":42}}`))).To(Equal(int64(42)))
+	})
+
+	It("should return 0 when the total hits are not in the response", func() {
+		Expect(getElasticsearchTotalHits([]byte(`{"aggregations":{}}`))).To(BeZero())
+	})
+})
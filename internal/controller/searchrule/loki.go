@@ -0,0 +1,109 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+)
+
+const (
+
+	// Loki query range path
+	lokiQueryRangePath = "/loki/api/v1/query_range"
+
+	// Loki result field
+	lokiResultField = "data.result"
+
+	// Default time range for the Loki queries
+	lokiDefaultRange = 5 * time.Minute
+)
+
+// queryLoki executes the LogQL query of the rule in the query_range API of Loki and returns the value
+// of the conditionField. The result of the query is returned as aggregations to be used in the action
+func (r *SearchRuleReconciler) queryLoki(ctx context.Context, resource *v1alpha1.SearchRule, connector *queryConnector) (*queryResult, error) {
+
+	// Check if query is defined in the resource
+	if resource.Spec.Loki.Query == "" {
+		r.UpdateConditionNoQueryFound(resource)
+		return nil, fmt.Errorf(controller.QueryNotDefinedErrorMessage, resource.Name)
+	}
+
+	// Get the time range of the query. Default is the last 5 minutes
+	queryRange := lokiDefaultRange
+	if resource.Spec.Loki.Range != "" {
+		var err error
+		queryRange, err = time.ParseDuration(resource.Spec.Loki.Range)
+		if err != nil {
+			r.UpdateConditionQueryError(resource)
+			return nil, fmt.Errorf(controller.LokiRangeParseErrorMessage, err)
+		}
+	}
+
+	// Round the end of the time range down to the cache TTL of the QueryConnector, so the queries executed
+	// during the TTL request the same URL and share the cached response. Without cache, it is not rounded
+	end := time.Now()
+	if cacheTTL, err := time.ParseDuration(connector.CacheTTL); err == nil && cacheTTL > 0 {
+		end = end.Truncate(cacheTTL)
+	}
+
+	// Generate URL for the query_range API of Loki
+	queryParams := url.Values{}
+	queryParams.Set("query", resource.Spec.Loki.Query)
+	queryParams.Set("start", strconv.FormatInt(end.Add(-queryRange).UnixNano(), 10))
+	queryParams.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	if resource.Spec.Loki.Step != "" {
+		queryParams.Set("step", resource.Spec.Loki.Step)
+	}
+	queryURL := connector.URL + lokiQueryRangePath + "?" + queryParams.Encode()
+
+	// Execute the query in Loki
+	responseBody, err := r.executeQuery(ctx, resource, connector, http.MethodGet, queryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract conditionField from the response of Loki
+	conditionValue, err := r.getConditionValue(resource, responseBody, resource.Spec.Loki.ConditionField)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save the result of the query, this allows user to use it in the action
+	aggregationsResource := interface{}(nil)
+	resultResponse := gjson.GetBytes(responseBody, lokiResultField)
+	if resultResponse.Exists() {
+		aggregationsResource = resultResponse.Value()
+	}
+
+	return &queryResult{
+		conditionValue: conditionValue,
+		aggregations:   aggregationsResource,
+		threshold:      resource.Spec.Condition.Threshold,
+		query:          resource.Spec.Loki.Query,
+	}, nil
+}
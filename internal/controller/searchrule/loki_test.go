@@ -0,0 +1,139 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+var _ = Describe("queryLoki", func() {
+
+	var (
+		server     *httptest.Server
+		requests   []url.Values
+		reconciler *SearchRuleReconciler
+		resource   *v1alpha1.SearchRule
+	)
+
+	BeforeEach(func() {
+		requests = []url.Values{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests = append(requests, req.URL.Query())
+			Expect(req.URL.Path).To(Equal(lokiQueryRangePath))
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1700000000,"3"],[1700000060,"7"]]}]}}`))
+		}))
+
+		reconciler = &SearchRuleReconciler{
+			QueryCachePool:  &pools.QueryCacheStore{Store: map[string]*pools.QueryCacheEntry{}},
+			HttpClientsPool: &pools.HttpClientsStore{Store: map[string]*pools.HttpClient{}},
+		}
+		resource = &v1alpha1.SearchRule{}
+		resource.Spec.Loki = v1alpha1.Loki{
+			Query:          `sum(count_over_time({app="nginx"} |= "error" [5m]))`,
+			ConditionField: "data.result.0.values.@reverse.0.1",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	// getRange returns the start and end of the time range of a request
+	getRange := func(params url.Values) (time.Time, time.Time) {
+		start, err := strconv.ParseInt(params.Get("start"), 10, 64)
+		Expect(err).NotTo(HaveOccurred())
+		end, err := strconv.ParseInt(params.Get("end"), 10, 64)
+		Expect(err).NotTo(HaveOccurred())
+		return time.Unix(0, start), time.Unix(0, end)
+	}
+
+	It("should query the time range of the rule and return the conditionField", func() {
+		resource.Spec.Loki.Range = "1h"
+		resource.Spec.Loki.Step = "1m"
+
+		result, err := reconciler.queryLoki(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.conditionValue.String()).To(Equal("7"))
+		Expect(result.query).To(Equal(resource.Spec.Loki.Query))
+		Expect(result.aggregations).To(HaveLen(1))
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Get("query")).To(Equal(resource.Spec.Loki.Query))
+		Expect(requests[0].Get("step")).To(Equal("1m"))
+		start, end := getRange(requests[0])
+		Expect(end.Sub(start)).To(Equal(time.Hour))
+		Expect(end).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+
+	It("should query the last 5 minutes by default", func() {
+		_, err := reconciler.queryLoki(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}))
+		Expect(err).NotTo(HaveOccurred())
+
+		start, end := getRange(requests[0])
+		Expect(end.Sub(start)).To(Equal(lokiDefaultRange))
+		Expect(requests[0].Has("step")).To(BeFalse())
+	})
+
+	It("should round the time range to the cache TTL, so the cached responses are shared", func() {
+		connector := newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL, CacheTTL: "1h"})
+
+		for range 2 {
+			result, err := reconciler.queryLoki(context.Background(), resource, connector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.conditionValue.String()).To(Equal("7"))
+		}
+
+		Expect(requests).To(HaveLen(1))
+		_, end := getRange(requests[0])
+		Expect(end).To(Equal(end.Truncate(time.Hour)))
+	})
+
+	It("should fail without query", func() {
+		resource.Spec.Loki.Query = ""
+
+		_, err := reconciler.queryLoki(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}))
+		Expect(err).To(HaveOccurred())
+		Expect(requests).To(BeEmpty())
+	})
+
+	It("should fail with an invalid range", func() {
+		resource.Spec.Loki.Range = "1 hour"
+
+		_, err := reconciler.queryLoki(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}))
+		Expect(err).To(HaveOccurred())
+		Expect(requests).To(BeEmpty())
+	})
+
+	It("should fail when the conditionField is not in the response", func() {
+		resource.Spec.Loki.ConditionField = "data.result.1.values.0.1"
+
+		_, err := reconciler.queryLoki(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,167 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+const (
+
+	// Elasticsearch multi search path. It is appended to the QueryConnector URL
+	elasticMsearchPath = "/_msearch"
+
+	// Max number of searches batched in a single multi search request
+	elasticMsearchMaxSearches = 100
+)
+
+// elasticsearchSearch is the search of a rule: the URL of the search, the index and the query
+type elasticsearchSearch struct {
+	searchURL string
+	index     string
+	query     []byte
+}
+
+// prefetchElasticsearchQueries executes in a single _msearch request the search of the rule and the searches
+// of the other rules of the pool using the same QueryConnector. The responses are saved in the query cache
+// during the msearch window, so the rules evaluated inside the window do not query the backend again
+func (r *SearchRuleReconciler) prefetchElasticsearchQueries(ctx context.Context, resource *v1alpha1.SearchRule,
+	connector *queryConnector, search elasticsearchSearch) error {
+
+	// The batch is sent with the headers of the rule, so just the rules with the same evaluated headers can be
+	// batched with it. Rules of the same QueryConnector share its credentials
+	now := time.Now()
+	headers, err := getQueryHeaders(resource, connector, now)
+	if err != nil {
+		return nil
+	}
+
+	// The response of the rule was already fetched by the batch of another rule
+	_, cacheHit := r.QueryCachePool.Get(getQueryCacheKey(connector.key, connector.creds, headers, search.searchURL, search.query))
+	if cacheHit {
+		return nil
+	}
+
+	// Collect the searches of the other rules of the QueryConnector which are not cached yet. Rules are
+	// sorted to build the same batches on every evaluation. Rules failing to build their search or their
+	// headers are skipped, they report the error on their own evaluation
+	rules := r.RulesPool.GetAll()
+	ruleKeys := make([]string, 0, len(rules))
+	for ruleKey := range rules {
+		ruleKeys = append(ruleKeys, ruleKey)
+	}
+	sort.Strings(ruleKeys)
+
+	searches := []elasticsearchSearch{search}
+	for _, ruleKey := range ruleKeys {
+		if len(searches) >= elasticMsearchMaxSearches {
+			break
+		}
+		rule := rules[ruleKey].SearchRule.DeepCopy()
+		if ruleKey == pools.GetKey(resource.Namespace, resource.Name) ||
+			rule.Spec.QueryConnectorRef != resource.Spec.QueryConnectorRef || !isMsearchSearch(rule) {
+			continue
+		}
+		ruleHeaders, err := getQueryHeaders(rule, connector, now)
+		if err != nil || !maps.Equal(ruleHeaders, headers) {
+			continue
+		}
+		ruleSearch, err := r.getElasticsearchSearch(ctx, rule, connector)
+		if err != nil || !json.Valid(ruleSearch.query) {
+			continue
+		}
+		if _, cacheHit := r.QueryCachePool.Get(getQueryCacheKey(connector.key, connector.creds, headers, ruleSearch.searchURL, ruleSearch.query)); cacheHit {
+			continue
+		}
+		searches = append(searches, ruleSearch)
+	}
+
+	// Nothing to batch, the rule is queried as usual
+	if len(searches) == 1 {
+		return nil
+	}
+
+	body, err := getMsearchBody(searches)
+	if err != nil {
+		return err
+	}
+	responseBody, err := r.executeQuery(ctx, resource, connector, http.MethodPost, connector.URL+elasticMsearchPath, body)
+	if err != nil {
+		return err
+	}
+
+	// Save every successful response in the query cache with the key of the search of its rule. Failed
+	// searches are not cached, so their rules get the error with their own query
+	responses := gjson.GetBytes(responseBody, "responses").Array()
+	if len(responses) != len(searches) {
+		return fmt.Errorf(controller.MsearchResponseErrorMessage, len(searches), len(responses))
+	}
+	for i, response := range responses {
+		if response.Get("status").Int() != http.StatusOK {
+			continue
+		}
+		cacheKey := getQueryCacheKey(connector.key, connector.creds, headers, searches[i].searchURL, searches[i].query)
+		r.QueryCachePool.Set(cacheKey, []byte(response.Raw), r.MsearchWindow)
+	}
+
+	return nil
+}
+
+// getMsearchBody returns the NDJSON body of the _msearch request, with a header line with the index
+// and a line with the query for every search. Queries are compacted to fit in a single line
+func getMsearchBody(searches []elasticsearchSearch) ([]byte, error) {
+	body := bytes.Buffer{}
+	encoder := json.NewEncoder(&body)
+	encoder.SetEscapeHTML(false)
+	for _, search := range searches {
+		err := encoder.Encode(map[string]string{"index": search.index})
+		if err != nil {
+			return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+		}
+
+		err = json.Compact(&body, search.query)
+		if err != nil {
+			return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+		}
+		body.WriteByte('\n')
+	}
+	return body.Bytes(), nil
+}
+
+// isMsearchSearch returns whether the search of the rule can be batched in a _msearch request. Just the
+// elasticsearch rules with the default search path, without search params, without pagination and without
+// their own query timeout can be
+func isMsearchSearch(resource *v1alpha1.SearchRule) bool {
+	elasticsearch := resource.Spec.Elasticsearch
+	return elasticsearch.GetIndex() != "" && elasticsearch.SearchPath == "" &&
+		len(elasticsearch.SearchParams) == 0 && elasticsearch.Pagination.MaxPages == 0 &&
+		resource.Spec.QueryTimeout == ""
+}
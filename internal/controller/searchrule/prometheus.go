@@ -0,0 +1,96 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/tidwall/gjson"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+)
+
+const (
+
+	// Prometheus instant query path
+	prometheusQueryPath = "/api/v1/query"
+
+	// Prometheus result fields
+	prometheusResultField     = "data.result"
+	prometheusResultTypeField = "data.resultType"
+
+	// Default conditionField for each Prometheus result type. The value of the first
+	// sample for vectors and the value of the result for scalars
+	prometheusVectorValueField = "data.result.0.value.1"
+	prometheusScalarValueField = "data.result.1"
+	prometheusResultTypeScalar = "scalar"
+)
+
+// queryPrometheus executes the PromQL query of the rule in the instant query API of Prometheus and returns
+// the value of the conditionField. The result of the query is returned as aggregations to be used in the action
+func (r *SearchRuleReconciler) queryPrometheus(ctx context.Context, resource *v1alpha1.SearchRule, connector *queryConnector) (*queryResult, error) {
+
+	// Check if query is defined in the resource
+	if resource.Spec.Prometheus.Query == "" {
+		r.UpdateConditionNoQueryFound(resource)
+		return nil, fmt.Errorf(controller.QueryNotDefinedErrorMessage, resource.Name)
+	}
+
+	// Generate URL for the instant query API of Prometheus
+	queryParams := url.Values{}
+	queryParams.Set("query", resource.Spec.Prometheus.Query)
+	queryURL := connector.URL + prometheusQueryPath + "?" + queryParams.Encode()
+
+	// Execute the query in Prometheus
+	responseBody, err := r.executeQuery(ctx, resource, connector, http.MethodGet, queryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract conditionField from the response of Prometheus. When it is not defined, the value
+	// of the scalar or the first sample of the vector is used
+	conditionField := resource.Spec.Prometheus.ConditionField
+	if conditionField == "" {
+		conditionField = prometheusVectorValueField
+		if gjson.GetBytes(responseBody, prometheusResultTypeField).String() == prometheusResultTypeScalar {
+			conditionField = prometheusScalarValueField
+		}
+	}
+	conditionValue, err := r.getConditionValue(resource, responseBody, conditionField)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save the result of the query, this allows user to use it in the action
+	aggregationsResource := interface{}(nil)
+	resultResponse := gjson.GetBytes(responseBody, prometheusResultField)
+	if resultResponse.Exists() {
+		aggregationsResource = resultResponse.Value()
+	}
+
+	return &queryResult{
+		conditionValue: conditionValue,
+		aggregations:   aggregationsResource,
+		threshold:      resource.Spec.Condition.Threshold,
+		query:          resource.Spec.Prometheus.Query,
+	}, nil
+}
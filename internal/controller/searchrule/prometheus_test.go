@@ -0,0 +1,112 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+var _ = Describe("queryPrometheus", func() {
+
+	var (
+		server     *httptest.Server
+		queries    []string
+		response   string
+		reconciler *SearchRuleReconciler
+		resource   *v1alpha1.SearchRule
+	)
+
+	BeforeEach(func() {
+		queries = []string{}
+		response = `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"job":"api"},"value":[1700000000,"0.25"]},{"metric":{"job":"web"},"value":[1700000000,"0.5"]}]}}`
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			Expect(req.URL.Path).To(Equal(prometheusQueryPath))
+			queries = append(queries, req.URL.Query().Get("query"))
+			_, _ = w.Write([]byte(response))
+		}))
+
+		reconciler = &SearchRuleReconciler{
+			QueryCachePool:  &pools.QueryCacheStore{Store: map[string]*pools.QueryCacheEntry{}},
+			HttpClientsPool: &pools.HttpClientsStore{Store: map[string]*pools.HttpClient{}},
+		}
+		resource = &v1alpha1.SearchRule{}
+		resource.Spec.Prometheus = v1alpha1.Prometheus{Query: `rate(http_requests_errors_total[5m])`}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should return the value of the first sample of the vectors by default", func() {
+		result, err := reconciler.queryPrometheus(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queries).To(Equal([]string{resource.Spec.Prometheus.Query}))
+		Expect(result.conditionValue.String()).To(Equal("0.25"))
+		Expect(result.query).To(Equal(resource.Spec.Prometheus.Query))
+		Expect(result.aggregations).To(HaveLen(2))
+	})
+
+	It("should return the value of the scalars by default", func() {
+		response = `{"status":"success","data":{"resultType":"scalar","result":[1700000000,"42"]}}`
+
+		result, err := reconciler.queryPrometheus(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.conditionValue.String()).To(Equal("42"))
+	})
+
+	It("should return the conditionField of the rule", func() {
+		resource.Spec.Prometheus.ConditionField = `data.result.#(metric.job=="web").value.1`
+
+		result, err := reconciler.queryPrometheus(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.conditionValue.String()).To(Equal("0.5"))
+	})
+
+	It("should share the cached responses during the cache TTL", func() {
+		connector := newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL, CacheTTL: "1m"})
+
+		for range 2 {
+			_, err := reconciler.queryPrometheus(context.Background(), resource, connector)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(queries).To(HaveLen(1))
+	})
+
+	It("should fail without query", func() {
+		resource.Spec.Prometheus.Query = ""
+
+		_, err := reconciler.queryPrometheus(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}))
+		Expect(err).To(HaveOccurred())
+		Expect(queries).To(BeEmpty())
+	})
+
+	It("should fail when the vector is empty", func() {
+		response = `{"status":"success","data":{"resultType":"vector","result":[]}}`
+
+		_, err := reconciler.queryPrometheus(context.Background(), resource, newTestQueryConnector(v1alpha1.QueryConnectorSpec{URL: server.URL}))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,468 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/globals"
+	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/template"
+)
+
+const (
+
+	// QueryConnector types
+	connectorTypeElasticsearch = "elasticsearch"
+	connectorTypeLoki          = "loki"
+	connectorTypePrometheus    = "prometheus"
+
+	// Default max size of the responses of the backends
+	defaultMaxResponseSize int64 = 50 * 1024 * 1024
+
+	// Max time waiting for a free slot when the max number of concurrent queries is reached
+	queriesSemaphoreTimeout = 30 * time.Second
+
+	// Response formats of the QueryConnector and documents selected from the ndjson responses
+	responseFormatNDJSON = "ndjson"
+	ndjsonSelectFirst    = "first"
+	ndjsonSelectLast     = "last"
+)
+
+// queryConnector is the QueryConnector of the rule being evaluated, with its key in the pools and its credentials.
+// It is passed along the evaluation, so the rules can be evaluated concurrently
+type queryConnector struct {
+	*v1alpha1.QueryConnectorSpec
+
+	key   string
+	creds *pools.Credentials
+}
+
+// queryResult is the result of the query of a SearchRule in the backend of the QueryConnector
+type queryResult struct {
+	conditionValue gjson.Result
+	aggregations   interface{}
+	threshold      string
+	query          string
+	samples        []interface{}
+
+	// noData is true when the query returned not enough data to evaluate the condition
+	noData bool
+}
+
+// executeQuery executes the request to the backend of the QueryConnector with the credentials and TLS configuration
+// of the QueryConnector and returns the response body. The response is taken from the query cache when it is enabled
+// in the QueryConnector
+func (r *SearchRuleReconciler) executeQuery(ctx context.Context, resource *v1alpha1.SearchRule, connector *queryConnector,
+	method string, queryURL string, body []byte) (responseBody []byte, err error) {
+
+	// Parse the cache TTL of the QueryConnector. The cache is disabled when it is not defined
+	cacheTTL := time.Duration(0)
+	if connector.CacheTTL != "" {
+		cacheTTL, err = time.ParseDuration(connector.CacheTTL)
+		if err != nil {
+			r.UpdateConditionQueryError(resource)
+			return nil, fmt.Errorf(controller.CacheTTLParseErrorMessage, err)
+		}
+	}
+
+	// Parse the max response size of the QueryConnector. Default is 50Mi
+	maxResponseSize := defaultMaxResponseSize
+	if connector.MaxResponseSize != "" {
+		quantity, err := apiresource.ParseQuantity(connector.MaxResponseSize)
+		if err == nil && quantity.Value() <= 0 {
+			err = fmt.Errorf("it must be greater than 0")
+		}
+		if err != nil {
+			r.UpdateConditionQueryError(resource)
+			return nil, fmt.Errorf(controller.MaxResponseSizeParseErrorMessage, connector.MaxResponseSize, err)
+		}
+		maxResponseSize = quantity.Value()
+	}
+
+	// Parse the query timeout of the rule. Requests have no deadline when it is not defined
+	queryTimeout := time.Duration(0)
+	if resource.Spec.QueryTimeout != "" {
+		queryTimeout, err = time.ParseDuration(resource.Spec.QueryTimeout)
+		if err != nil {
+			r.UpdateConditionQueryError(resource)
+			return nil, fmt.Errorf(controller.QueryTimeoutParseErrorMessage, err)
+		}
+	}
+
+	// Evaluate the headers of the QueryConnector, which can include templates with the environment and the rule
+	headers, err := getQueryHeaders(resource, connector, time.Now())
+	if err != nil {
+		r.UpdateConditionEvaluateTemplateError(resource)
+		return nil, err
+	}
+
+	// Look for the response in the query cache when enabled. Rules running the same query against the same
+	// URL share the response during the TTL just when they use the same QueryConnector, credentials and headers,
+	// so the responses of a tenant are never returned to another one. Responses of batched queries are cached too
+	cacheKey := getQueryCacheKey(connector.key, connector.creds, headers, queryURL, body)
+	if cacheTTL > 0 || r.MsearchWindow > 0 {
+		cachedResponse, cacheHit := r.QueryCachePool.Get(cacheKey)
+		if cacheHit {
+			return cachedResponse, nil
+		}
+	}
+
+	// Wait for a free slot when the number of concurrent queries is limited. When the wait times out,
+	// the error requeues the rule with backoff, so the backends are not overwhelmed
+	if r.QueriesSemaphore != nil {
+		select {
+		case r.QueriesSemaphore <- struct{}{}:
+			defer func() { <-r.QueriesSemaphore }()
+		case <-time.After(queriesSemaphoreTimeout):
+			r.UpdateConditionConnectionError(resource)
+			return nil, fmt.Errorf(controller.QueriesLimitReachedErrorMessage, queryURL, queriesSemaphoreTimeout)
+		}
+	}
+
+	// Get the http client of the QueryConnector, so connections are reused across evaluations
+	httpClient, err := r.getHttpClient(connector)
+	if err != nil {
+		r.UpdateConditionConnectionError(resource)
+		return nil, err
+	}
+
+	// The deadline of the query timeout starts once the request can be sent, so the wait for a free slot
+	// does not count. It cancels the request in flight, including the read of the response body
+	if queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+	}
+	req, err := newQueryRequest(ctx, connector, headers, method, queryURL, body)
+	if err != nil {
+		r.UpdateConditionConnectionError(resource)
+		return nil, err
+	}
+
+	// Make request to the backend
+	resp, err := httpClient.Do(req)
+	if queryTimeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+		r.UpdateConditionQueryTimeout(resource)
+		return nil, fmt.Errorf(controller.QueryTimeoutErrorMessage, queryURL, string(body), queryTimeout)
+	}
+	if err != nil {
+		r.UpdateConditionBackendUnreachable(resource)
+		return nil, fmt.Errorf(controller.QueryErrorMessage, queryURL, string(body), err)
+	}
+	defer resp.Body.Close()
+
+	// Read response and check if it is ok. The response is limited to the max response size
+	// to avoid exhausting the memory with huge responses. Compressed responses are limited once
+	// decompressed. Backends not honoring the compression return plain responses, read as they are
+	responseReader, err := getResponseReader(resp)
+	if err != nil {
+		r.UpdateConditionQueryError(resource)
+		return nil, fmt.Errorf(controller.ResponseDecompressErrorMessage, err)
+	}
+	defer responseReader.Close()
+	responseBody, err = io.ReadAll(io.LimitReader(responseReader, maxResponseSize+1))
+	if queryTimeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+		r.UpdateConditionQueryTimeout(resource)
+		return nil, fmt.Errorf(controller.QueryTimeoutErrorMessage, queryURL, string(body), queryTimeout)
+	}
+	if err != nil {
+		r.UpdateConditionQueryError(resource)
+		return nil, fmt.Errorf(controller.ResponseBodyReadErrorMessage, err)
+	}
+	if int64(len(responseBody)) > maxResponseSize {
+		r.UpdateConditionResponseTooLarge(resource)
+		return nil, fmt.Errorf(controller.ResponseTooLargeErrorMessage, queryURL, maxResponseSize)
+	}
+	if resp.StatusCode != http.StatusOK {
+
+		// Error pages of the proxies in front of the backend, like a 502 of nginx, are not errors of the backend
+		if !gjson.ValidBytes(responseBody) && isHTMLResponse(resp) {
+			r.UpdateConditionInvalidResponse(resource, responseBody)
+			return nil, fmt.Errorf(controller.InvalidResponseStatusErrorMessage, queryURL, resp.StatusCode, string(responseBody))
+		}
+		r.UpdateConditionErrorResponse(resource, responseBody)
+		return nil, fmt.Errorf(
+			controller.QueryResponseErrorMessage,
+			queryURL,
+			string(body),
+			string(responseBody),
+		)
+	}
+
+	// Newline-delimited JSON responses are parsed as a single document when the QueryConnector expects them
+	if connector.ResponseFormat == responseFormatNDJSON {
+		responseBody, err = parseNDJSONResponse(responseBody, connector.NdjsonSelect)
+		if err != nil {
+			r.UpdateConditionInvalidResponse(resource, responseBody)
+			return nil, fmt.Errorf(controller.InvalidResponseErrorMessage, queryURL, err)
+		}
+	}
+
+	// Responses are read as JSON, so invalid ones are reported instead of looking like a missing conditionField
+	if !gjson.ValidBytes(responseBody) {
+		r.UpdateConditionInvalidResponse(resource, responseBody)
+		return nil, fmt.Errorf(controller.InvalidResponseErrorMessage, queryURL, string(responseBody))
+	}
+
+	// Save the response in the query cache when enabled
+	if cacheTTL > 0 {
+		r.QueryCachePool.Set(cacheKey, responseBody, cacheTTL)
+	}
+
+	return responseBody, nil
+}
+
+// parseNDJSONResponse returns the document selected from the newline-delimited JSON response: the first line,
+// the last line or an array with all of them. Responses with a single document, even pretty printed in many
+// lines, are taken as a single line
+func parseNDJSONResponse(responseBody []byte, selection string) ([]byte, error) {
+
+	lines := [][]byte{}
+	if gjson.ValidBytes(responseBody) {
+		lines = append(lines, bytes.TrimSpace(responseBody))
+	} else {
+		for i, line := range bytes.Split(responseBody, []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			if !gjson.ValidBytes(line) {
+				return responseBody, fmt.Errorf("line %d is not a valid JSON: %s", i+1, string(line))
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return responseBody, fmt.Errorf("response without documents")
+	}
+
+	switch selection {
+	case ndjsonSelectFirst:
+		return lines[0], nil
+	case ndjsonSelectLast:
+		return lines[len(lines)-1], nil
+	default:
+		return append(append([]byte("["), bytes.Join(lines, []byte(","))...), ']'), nil
+	}
+}
+
+// getQueryHeaders evaluates the headers of the QueryConnector as templates. The environment variables with the
+// SEARCHRULER_ prefix, the current time, the labels and the object of the rule are available in them
+func getQueryHeaders(resource *v1alpha1.SearchRule, connector *queryConnector, now time.Time) (map[string]string, error) {
+
+	templateInjectedObject := map[string]interface{}{}
+	templateInjectedObject["now"] = now.UTC()
+	templateInjectedObject["labels"] = resource.Spec.Labels
+	templateInjectedObject["object"] = *resource
+
+	headers, err := template.EvaluateHeaders(connector.Headers, templateInjectedObject)
+	if err != nil {
+		return nil, fmt.Errorf(controller.EvaluateTemplateErrorMessage, err)
+	}
+	return headers, nil
+}
+
+// newQueryRequest returns a request to the backend of the QueryConnector with the headers and the credentials
+func newQueryRequest(ctx context.Context, connector *queryConnector, headers map[string]string,
+	method string, queryURL string, body []byte) (*http.Request, error) {
+
+	req, err := http.NewRequestWithContext(ctx, method, queryURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
+	}
+
+	// Add headers and custom headers for the queries. Responses are requested compressed, as aggregations
+	// can be large. Custom headers can disable it with another Accept-Encoding
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	// Add authentication if set for the queries
+	switch {
+	case connector.creds.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+connector.creds.BearerToken)
+	case connector.creds.ApiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+connector.creds.ApiKey)
+	case connector.creds.Username != "":
+		req.SetBasicAuth(connector.creds.Username, connector.creds.Password)
+	}
+
+	return req, nil
+}
+
+// getResponseReader returns the reader of the response body, which decompresses it when it is compressed with gzip
+func getResponseReader(resp *http.Response) (io.ReadCloser, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return io.NopCloser(resp.Body), nil
+	}
+	return gzip.NewReader(resp.Body)
+}
+
+// isHTMLResponse returns whether the response is an HTML page, as the error pages of the proxies and load balancers
+func isHTMLResponse(resp *http.Response) bool {
+	return strings.HasPrefix(strings.ToLower(resp.Header.Get("Content-Type")), "text/html")
+}
+
+// NewQueriesSemaphore returns the semaphore to limit the number of queries executed at once. No limit
+// is applied when the max number of concurrent queries is 0 or lower
+func NewQueriesSemaphore(maxConcurrentQueries int) chan struct{} {
+	if maxConcurrentQueries <= 0 {
+		return nil
+	}
+	return make(chan struct{}, maxConcurrentQueries)
+}
+
+// getHttpClient returns the http client of the QueryConnector from the pool. The client is built again just when
+// the TLS, the proxy or the User-Agent configuration of the QueryConnector changes, so connections and TLS sessions
+// are reused
+func (r *SearchRuleReconciler) getHttpClient(connector *queryConnector) (*http.Client, error) {
+
+	// Hash the TLS configuration of the QueryConnector. The CA bundle wins over
+	// tlsSkipVerify, so the server certificate is always verified when it is defined
+	insecureSkipVerify := connector.TlsSkipVerify && connector.creds.RootCAs == nil
+	hash := sha256.New()
+	hash.Write([]byte(strconv.FormatBool(insecureSkipVerify)))
+	hash.Write(connector.creds.RootCAsPEM)
+	if connector.creds.TlsCertificate != nil {
+		for _, certificate := range connector.creds.TlsCertificate.Certificate {
+			hash.Write(certificate)
+		}
+	}
+	hash.Write([]byte(connector.Proxy))
+	hash.Write([]byte(connector.UserAgent))
+	configHash := hex.EncodeToString(hash.Sum(nil))
+
+	httpClient, clientExists := r.HttpClientsPool.Get(connector.key)
+	if clientExists && httpClient.ConfigHash == configHash {
+		return httpClient.Client, nil
+	}
+
+	// Requests go through the proxy of the QueryConnector, or the proxy of the environment when not defined
+	proxy, err := globals.GetProxy(connector.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf(controller.ProxyUrlParseErrorMessage, connector.Proxy, err)
+	}
+
+	// Make TLS configuration for the connection. Add the client certificate and
+	// the CA bundle when they are defined in the QueryConnector
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+		RootCAs:            connector.creds.RootCAs,
+	}
+	if connector.creds.TlsCertificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*connector.creds.TlsCertificate}
+	}
+
+	// Close the idle connections of the previous client, as it is not used anymore
+	if clientExists {
+		httpClient.Client.CloseIdleConnections()
+	}
+
+	httpClient = &pools.HttpClient{
+		Client: &http.Client{
+			Transport: otelhttp.NewTransport(globals.NewUserAgentTransport(&http.Transport{
+				Proxy:           proxy,
+				TLSClientConfig: tlsConfig,
+			}, connector.UserAgent)),
+		},
+		ConfigHash: configHash,
+	}
+	r.HttpClientsPool.Set(connector.key, httpClient)
+
+	return httpClient.Client, nil
+}
+
+// getConditionValue extracts the conditionField from the response of the backend
+func (r *SearchRuleReconciler) getConditionValue(resource *v1alpha1.SearchRule, responseBody []byte, conditionField string) (gjson.Result, error) {
+
+	conditionValue := gjson.GetBytes(responseBody, conditionField)
+	if !conditionValue.Exists() {
+		r.UpdateConditionConditionFieldNotFound(resource, responseBody)
+		return conditionValue, fmt.Errorf(
+			controller.ConditionFieldNotFoundMessage,
+			conditionField,
+			string(responseBody),
+		)
+	}
+
+	return conditionValue, nil
+}
+
+// getQueryCacheKey returns the key of the query cache for a query URL, which includes the connector URL, and
+// the query body. The QueryConnector, its credentials and the evaluated headers are part of the key too, as
+// the same query can return different data for different tenants. The key of the QueryConnector is also the
+// prefix of the key, so its responses are evicted when it is deleted
+func getQueryCacheKey(connectorKey string, creds *pools.Credentials, headers map[string]string, queryURL string, query []byte) string {
+	hash := sha256.New()
+	writeField := func(field []byte) {
+		hash.Write([]byte(strconv.Itoa(len(field))))
+		hash.Write([]byte{0})
+		hash.Write(field)
+	}
+
+	writeField([]byte(connectorKey))
+	if creds != nil {
+		writeField([]byte(creds.Username))
+		writeField([]byte(creds.Password))
+		writeField([]byte(creds.BearerToken))
+		writeField([]byte(creds.ApiKey))
+		if creds.TlsCertificate != nil {
+			for _, certificate := range creds.TlsCertificate.Certificate {
+				writeField(certificate)
+			}
+		}
+	}
+
+	headerKeys := make([]string, 0, len(headers))
+	for key := range headers {
+		headerKeys = append(headerKeys, key)
+	}
+	sort.Strings(headerKeys)
+	for _, key := range headerKeys {
+		writeField([]byte(http.CanonicalHeaderKey(key)))
+		writeField([]byte(headers[key]))
+	}
+
+	writeField([]byte(queryURL))
+	writeField(query)
+	return pools.GetQueryCacheKey(connectorKey, hex.EncodeToString(hash.Sum(nil)))
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+const (
+	// Layout of the start and end times of the active windows
+	activeWindowTimeLayout = "15:04"
+)
+
+// isRuleActive checks if the given time is inside any of the active windows of the rule.
+// Rules without active windows are always active. Every window is checked, so an invalid
+// window is reported although another one is active
+func isRuleActive(activeWindows []v1alpha1.ActiveWindow, now time.Time) (bool, error) {
+
+	if len(activeWindows) == 0 {
+		return true, nil
+	}
+
+	active := false
+	for i, activeWindow := range activeWindows {
+		inWindow, err := isInActiveWindow(activeWindow, now)
+		if err != nil {
+			return false, fmt.Errorf(controller.ActiveWindowParseErrorMessage, i, err)
+		}
+		active = active || inWindow
+	}
+
+	return active, nil
+}
+
+// isInActiveWindow checks if the given time is inside the active window. Empty days mean every day and
+// empty start or end mean the beginning or the end of the day. Windows where the end is before the start
+// span midnight, and the days refer to the day where the window starts. Windows where the start and the end
+// are equal are empty, so they are rejected
+func isInActiveWindow(activeWindow v1alpha1.ActiveWindow, now time.Time) (bool, error) {
+
+	location := time.UTC
+	if activeWindow.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(activeWindow.Timezone)
+		if err != nil {
+			return false, err
+		}
+	}
+	now = now.In(location)
+
+	start, err := parseActiveWindowTime(activeWindow.Start, 0)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseActiveWindowTime(activeWindow.End, 24*time.Hour)
+	if err != nil {
+		return false, err
+	}
+	if start == end {
+		return false, fmt.Errorf("start and end are equal, so the window is never active")
+	}
+
+	sinceMidnight := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute +
+		time.Duration(now.Second())*time.Second
+	windowDay := now.Weekday()
+	switch {
+	case start <= end:
+		if sinceMidnight < start || sinceMidnight >= end {
+			return false, nil
+		}
+	case sinceMidnight >= start:
+	case sinceMidnight < end:
+		// The window started the day before
+		windowDay = (windowDay + 6) % 7
+	default:
+		return false, nil
+	}
+
+	if len(activeWindow.Days) == 0 {
+		return true, nil
+	}
+	for _, day := range activeWindow.Days {
+		weekday, err := parseWeekday(day)
+		if err != nil {
+			return false, err
+		}
+		if weekday == windowDay {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// parseActiveWindowTime returns the time since midnight of a HH:MM time, or the default value when empty
+func parseActiveWindowTime(value string, defaultValue time.Duration) (time.Duration, error) {
+
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsedTime, err := time.Parse(activeWindowTimeLayout, value)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(parsedTime.Hour())*time.Hour + time.Duration(parsedTime.Minute())*time.Minute, nil
+}
+
+// parseWeekday returns the weekday of a day name. Full names and three letters abbreviations are accepted
+func parseWeekday(day string) (time.Weekday, error) {
+
+	day = strings.ToLower(day)
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		name := strings.ToLower(weekday.String())
+		if day == name || day == name[:3] {
+			return weekday, nil
+		}
+	}
+
+	return time.Sunday, fmt.Errorf("invalid day %s", day)
+}
+
+// deactivateRule restores the rule to the normal state when it leaves its active windows. Firing alerts are
+// marked as resolved, so the RulerAction sends the resolved notification
+func (r *SearchRuleReconciler) deactivateRule(ctx context.Context, resource *v1alpha1.SearchRule) (err error) {
+
+	ruleKey := pools.GetKey(resource.Namespace, resource.Name)
+	rule, ruleInPool := r.RulesPool.Get(ruleKey)
+	if !ruleInPool {
+		return nil
+	}
+
+	// Absent rules count the missing data again from the next active window
+	if rule.State == RuleNormalState {
+		rule.LastSeenTime = time.Time{}
+		return nil
+	}
+
+	// Resolve the firing alerts of the rule, including the alerts of its buckets in buckets mode
+	alerts := r.getRuleAlerts(resource)
+	resolvedAlerts := 0
+	for alertKey, alert := range alerts {
+		if alert.Status != pools.AlertStatusFiring {
+			continue
+		}
+		resolvedAlert := *alert
+		resolvedAlert.SearchRule = *resource
+		resolvedAlert.Status = pools.AlertStatusResolved
+		resolvedAlert.ResolvedTime = time.Now()
+		r.AlertsPool.Set(alertKey, &resolvedAlert)
+		resolvedAlerts++
+	}
+
+	if resolvedAlerts > 0 {
+		err = createKubeEvent(
+			ctx,
+			*resource,
+			kubeEventReasonAlertResolved,
+			fmt.Sprintf("Rule is resolved because it is out of its active windows. Last value is %v", rule.Value),
+		)
+		if err != nil {
+			return fmt.Errorf(controller.KubeEventCreationErrorMessage, err)
+		}
+	}
+
+	resolvedTime := rule.ResolvedTime
+	if len(alerts) > 0 {
+		resolvedTime = time.Now()
+	}
+	r.RulesPool.Set(ruleKey, &pools.Rule{
+		SearchRule:   *resource,
+		State:        RuleNormalState,
+		ResolvedTime: resolvedTime,
+		Value:        rule.Value,
+	})
+
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+)
+
+var _ = Describe("isInActiveWindow", func() {
+
+	// 2024-03-04 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.March, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	DescribeTable("should check whether the time is inside the window",
+		func(activeWindow v1alpha1.ActiveWindow, now time.Time, expectedActive bool) {
+			active, err := isInActiveWindow(activeWindow, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(active).To(Equal(expectedActive))
+		},
+		Entry("inside the window", v1alpha1.ActiveWindow{Start: "09:00", End: "18:00"}, at(4, 12, 0), true),
+		Entry("at the start of the window", v1alpha1.ActiveWindow{Start: "09:00", End: "18:00"}, at(4, 9, 0), true),
+		Entry("at the end of the window", v1alpha1.ActiveWindow{Start: "09:00", End: "18:00"}, at(4, 18, 0), false),
+		Entry("before the window", v1alpha1.ActiveWindow{Start: "09:00", End: "18:00"}, at(4, 8, 59), false),
+		Entry("whole day without start and end", v1alpha1.ActiveWindow{}, at(4, 23, 59), true),
+		Entry("on a day of the window", v1alpha1.ActiveWindow{Days: []string{"Monday"}}, at(4, 12, 0), true),
+		Entry("on a day out of the window", v1alpha1.ActiveWindow{Days: []string{"sat", "sun"}}, at(4, 12, 0), false),
+		Entry("in the timezone of the window",
+			v1alpha1.ActiveWindow{Start: "09:00", End: "18:00", Timezone: "America/New_York"}, at(4, 12, 0), false),
+		Entry("crossing midnight before midnight", v1alpha1.ActiveWindow{Start: "22:00", End: "06:00"}, at(4, 23, 0), true),
+		Entry("crossing midnight after midnight", v1alpha1.ActiveWindow{Start: "22:00", End: "06:00"}, at(5, 5, 59), true),
+		Entry("crossing midnight at the end", v1alpha1.ActiveWindow{Start: "22:00", End: "06:00"}, at(5, 6, 0), false),
+		Entry("crossing midnight out of the window", v1alpha1.ActiveWindow{Start: "22:00", End: "06:00"}, at(4, 12, 0), false),
+		Entry("crossing midnight on the day where the window starts",
+			v1alpha1.ActiveWindow{Days: []string{"mon"}, Start: "22:00", End: "06:00"}, at(5, 2, 0), true),
+		Entry("crossing midnight on the day after the window starts",
+			v1alpha1.ActiveWindow{Days: []string{"tue"}, Start: "22:00", End: "06:00"}, at(5, 2, 0), false),
+		Entry("crossing midnight from sunday to monday",
+			v1alpha1.ActiveWindow{Days: []string{"sun"}, Start: "22:00", End: "06:00"}, at(4, 2, 0), true),
+	)
+
+	DescribeTable("should reject the invalid windows",
+		func(activeWindow v1alpha1.ActiveWindow) {
+			_, err := isInActiveWindow(activeWindow, at(4, 12, 0))
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("invalid start", v1alpha1.ActiveWindow{Start: "9am"}),
+		Entry("invalid end", v1alpha1.ActiveWindow{End: "25:00"}),
+		Entry("invalid day", v1alpha1.ActiveWindow{Days: []string{"someday"}}),
+		Entry("invalid timezone", v1alpha1.ActiveWindow{Timezone: "Mars/Olympus"}),
+		Entry("equal start and end", v1alpha1.ActiveWindow{Start: "09:00", End: "09:00"}),
+		Entry("end at the start of the day", v1alpha1.ActiveWindow{End: "00:00"}),
+	)
+})
+
+var _ = Describe("isRuleActive", func() {
+
+	now := time.Date(2024, time.March, 4, 12, 0, 0, 0, time.UTC)
+
+	It("should be active without windows", func() {
+		Expect(isRuleActive(nil, now)).To(BeTrue())
+	})
+
+	It("should be active inside any of the windows", func() {
+		active, err := isRuleActive([]v1alpha1.ActiveWindow{{Start: "00:00", End: "06:00"}, {Start: "09:00", End: "18:00"}}, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(active).To(BeTrue())
+	})
+
+	It("should report an invalid window although another one is active", func() {
+		_, err := isRuleActive([]v1alpha1.ActiveWindow{{Start: "09:00", End: "18:00"}, {Start: "10:00", End: "10:00"}}, now)
+		Expect(err).To(MatchError(ContainSubstring("error parsing active window 1")))
+	})
+})
@@ -0,0 +1,45 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+)
+
+// getActiveSilence returns the first Silence which is active right now and matches the labels of the SearchRule.
+// Labels of the SearchRule spec take precedence over the metadata labels. SearchRules are muted by the Silences
+// of their namespace, and ClusterSearchRules by the Silences of the namespace of the controller
+func (r *SearchRuleReconciler) getActiveSilence(ctx context.Context, resource *v1alpha1.SearchRule) (*v1alpha1.Silence, error) {
+
+	ruleLabels := labels.Set{}
+	for key, value := range resource.GetLabels() {
+		ruleLabels[key] = value
+	}
+	for key, value := range resource.Spec.Labels {
+		ruleLabels[key] = value
+	}
+
+	return controller.GetActiveSilence(ctx, r.Client,
+		controller.GetSilencesNamespace(resource, r.ControllerNamespace), ruleLabels, time.Now())
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package searchrule
 
 import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	//
@@ -24,6 +27,11 @@ import (
 	"prosimcorp.com/SearchRuler/internal/globals"
 )
 
+const (
+	// Max length of the response body included in the condition messages
+	conditionMessageMaxResponseLength = 300
+)
+
 // UpdateConditionSuccess updates the status of the SearchRule resource with a success condition
 func (r *SearchRuleReconciler) UpdateConditionSuccess(SearchRule *v1alpha1.SearchRule) {
 
@@ -35,6 +43,45 @@ func (r *SearchRuleReconciler) UpdateConditionSuccess(SearchRule *v1alpha1.Searc
 	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
 }
 
+// UpdateConditionReady updates the status of the SearchRule resource with a Ready condition, which is true when
+// the last evaluation succeeded, regardless of the state of the alert. Otherwise, the error is the message
+func (r *SearchRuleReconciler) UpdateConditionReady(SearchRule *v1alpha1.SearchRule, syncErr error) {
+
+	// Create the new condition with the ready status
+	condition := globals.NewCondition(globals.ConditionTypeReady, metav1.ConditionTrue,
+		globals.ConditionReasonRuleEvaluatedType, globals.ConditionReasonRuleEvaluatedMessage)
+	if syncErr != nil {
+		condition = globals.NewCondition(globals.ConditionTypeReady, metav1.ConditionFalse,
+			globals.ConditionReasonEvaluationFailedType, syncErr.Error())
+	}
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionQueryFailing updates the status of the SearchRule resource with a QueryFailing condition, which is
+// true when the query failed as many times in a row as the failure threshold. It is not set without threshold
+func (r *SearchRuleReconciler) UpdateConditionQueryFailing(SearchRule *v1alpha1.SearchRule, consecutiveFailures int) {
+
+	if SearchRule.Spec.FailureThreshold <= 0 {
+		meta.RemoveStatusCondition(&SearchRule.Status.Conditions, globals.ConditionTypeQueryFailing)
+		return
+	}
+
+	// Create the new condition with the failing status
+	condition := globals.NewCondition(globals.ConditionTypeQueryFailing, metav1.ConditionFalse,
+		globals.ConditionReasonBelowFailureThresholdType,
+		fmt.Sprintf(globals.ConditionReasonBelowFailureThresholdMessage, consecutiveFailures))
+	if consecutiveFailures >= SearchRule.Spec.FailureThreshold {
+		condition = globals.NewCondition(globals.ConditionTypeQueryFailing, metav1.ConditionTrue,
+			globals.ConditionReasonConsecutiveFailuresType,
+			fmt.Sprintf(globals.ConditionReasonConsecutiveFailuresMessage, consecutiveFailures))
+	}
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
 // UpdateConditionKubernetesApiCallFailure updates the status of the SearchRule resource with a failure condition
 func (r *SearchRuleReconciler) UpdateConditionKubernetesApiCallFailure(SearchRule *v1alpha1.SearchRule) {
 
@@ -57,6 +104,50 @@ func (r *SearchRuleReconciler) UpdateStateNormal(SearchRule *v1alpha1.SearchRule
 	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
 }
 
+// UpdateConditionSilenced updates the status of the SearchRule resource with the Silenced condition
+func (r *SearchRuleReconciler) UpdateConditionSilenced(searchRule *v1alpha1.SearchRule, silenceName string) {
+
+	// Create the new condition with the silenced status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonSilencedType, fmt.Sprintf(globals.ConditionReasonSilencedMessage, silenceName))
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&searchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionInactiveSchedule updates the status of the SearchRule resource with the InactiveSchedule condition
+func (r *SearchRuleReconciler) UpdateConditionInactiveSchedule(searchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the inactive status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonInactiveScheduleType, globals.ConditionReasonInactiveScheduleMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&searchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionNoData updates the status of the SearchRule resource with the NoData condition
+func (r *SearchRuleReconciler) UpdateConditionNoData(searchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the no data status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonNoDataType, globals.ConditionReasonNoDataMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&searchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionInvalidActiveWindows updates the status of the SearchRule resource with the InvalidActiveWindows condition
+func (r *SearchRuleReconciler) UpdateConditionInvalidActiveWindows(searchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonInvalidActiveWindowsType, globals.ConditionReasonInvalidActiveWindowsMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&searchRule.Status.Conditions, condition)
+}
+
 // UpdateConditionNoCredsFound updates the status of the SearchRule resource with alert firing condition
 func (r *SearchRuleReconciler) UpdateConditionAlertFiring(searchRule *v1alpha1.SearchRule) {
 
@@ -133,7 +224,18 @@ func (r *SearchRuleReconciler) UpdateConditionConnectionError(SearchRule *v1alph
 	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
 }
 
-// UpdateConditionEvaluateTemplateError updates the status of the SearchRule resource with a QueryError condition
+// UpdateConditionEvaluateTemplateError updates the status of the SearchRule resource with a EvaluateTemplateError condition
+func (r *SearchRuleReconciler) UpdateConditionEvaluateTemplateError(SearchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonEvaluateTemplateErrorType, globals.ConditionReasonEvaluateTemplateErrorMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionQueryError updates the status of the SearchRule resource with a QueryError condition
 func (r *SearchRuleReconciler) UpdateConditionQueryError(SearchRule *v1alpha1.SearchRule) {
 
 	// Create the new condition with the failure status
@@ -143,3 +245,127 @@ func (r *SearchRuleReconciler) UpdateConditionQueryError(SearchRule *v1alpha1.Se
 	// Update the status of the SearchRule resource
 	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
 }
+
+// UpdateConditionResponseTooLarge updates the status of the SearchRule resource with a ResponseTooLarge condition
+func (r *SearchRuleReconciler) UpdateConditionResponseTooLarge(SearchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonResponseTooLargeType, globals.ConditionReasonResponseTooLargeMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionNonNumericValue updates the status of the SearchRule resource with a NonNumericValue condition
+func (r *SearchRuleReconciler) UpdateConditionNonNumericValue(SearchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonNonNumericValueType, globals.ConditionReasonNonNumericValueMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionInvalidBuckets updates the status of the SearchRule resource with a InvalidBuckets condition
+func (r *SearchRuleReconciler) UpdateConditionInvalidBuckets(SearchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonInvalidBucketsType, globals.ConditionReasonInvalidBucketsMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionBackendUnreachable updates the status of the SearchRule resource with a BackendUnreachable condition
+func (r *SearchRuleReconciler) UpdateConditionBackendUnreachable(SearchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonBackendUnreachableType, globals.ConditionReasonBackendUnreachableMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionQueryTimeout updates the status of the SearchRule resource with a QueryTimeout condition
+func (r *SearchRuleReconciler) UpdateConditionQueryTimeout(SearchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonQueryTimeoutType, globals.ConditionReasonQueryTimeoutMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionErrorResponse updates the status of the SearchRule resource with an ErrorResponse condition
+// including a truncated version of the response body in the message
+func (r *SearchRuleReconciler) UpdateConditionErrorResponse(SearchRule *v1alpha1.SearchRule, responseBody []byte) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonErrorResponseType, getResponseMessage(globals.ConditionReasonErrorResponseMessage, responseBody))
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionInvalidResponse updates the status of the SearchRule resource with an InvalidResponse condition
+// including a truncated version of the response body in the message
+func (r *SearchRuleReconciler) UpdateConditionInvalidResponse(SearchRule *v1alpha1.SearchRule, responseBody []byte) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonInvalidResponseType, getResponseMessage(globals.ConditionReasonInvalidResponseMessage, responseBody))
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionIndexNotFound updates the status of the SearchRule resource with an IndexNotFound condition
+func (r *SearchRuleReconciler) UpdateConditionIndexNotFound(SearchRule *v1alpha1.SearchRule, index string) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonIndexNotFoundType, fmt.Sprintf(globals.ConditionReasonIndexNotFoundMessage, index))
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionConditionFieldNotFound updates the status of the SearchRule resource with a ConditionFieldNotFound
+// condition including a truncated version of the response body in the message
+func (r *SearchRuleReconciler) UpdateConditionConditionFieldNotFound(SearchRule *v1alpha1.SearchRule, responseBody []byte) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonConditionFieldNotFoundType, getResponseMessage(globals.ConditionReasonConditionFieldNotFoundMessage, responseBody))
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionQueryErrorWithResponse updates the status of the SearchRule resource with a QueryError condition
+// including a truncated version of the response body in the message
+func (r *SearchRuleReconciler) UpdateConditionQueryErrorWithResponse(SearchRule *v1alpha1.SearchRule, responseBody []byte) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonQueryErrorType, getResponseMessage(globals.ConditionReasonQueryErrorMessage, responseBody))
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// getResponseMessage returns the message of a condition with a truncated version of the response body,
+// to avoid bloating the resource
+func getResponseMessage(message string, responseBody []byte) string {
+	response := string(responseBody)
+	if len(response) > conditionMessageMaxResponseLength {
+		response = response[:conditionMessageMaxResponseLength] + "..."
+	}
+	return fmt.Sprintf("%s: %s", message, response)
+}
@@ -17,32 +17,35 @@ limitations under the License.
 package searchrule
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"math"
 	"reflect"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	corev1 "k8s.io/api/core/v1"
 	eventsv1 "k8s.io/api/events/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
-	"github.com/tidwall/gjson"
-
 	//
 	"prosimcorp.com/SearchRuler/api/v1alpha1"
 	"prosimcorp.com/SearchRuler/internal/controller"
 	"prosimcorp.com/SearchRuler/internal/globals"
 	"prosimcorp.com/SearchRuler/internal/pools"
+	"prosimcorp.com/SearchRuler/internal/template"
+	"prosimcorp.com/SearchRuler/internal/tracing"
 )
 
 const (
@@ -59,49 +62,108 @@ const (
 	conditionLessThan           = "lessThan"
 	conditionLessThanOrEqual    = "lessThanOrEqual"
 	conditionEqual              = "equal"
+	conditionNotEqual           = "notEqual"
+	conditionInsideRange        = "insideRange"
+	conditionOutsideRange       = "outsideRange"
+	conditionStringEqual        = "stringEqual"
+	conditionStringNotEqual     = "stringNotEqual"
+	conditionMatches            = "matches"
+	conditionNotMatches         = "notMatches"
+
+	// Change operators
+	changeOperatorPercent = "percent"
+	changeOperatorDelta   = "delta"
+
+	// NoData policies
+	noDataPolicyFiring   = "firing"
+	noDataPolicyResolved = "resolved"
+	noDataPolicyKeep     = "keep"
+
+	// Rule transitions
+	ruleTransitionNormal          = "Normal"
+	ruleTransitionCooldown        = "Cooldown"
+	ruleTransitionPendingFiring   = "PendingFiring"
+	ruleTransitionFiring          = "Firing"
+	ruleTransitionPendingResolved = "PendingResolved"
+	ruleTransitionResolved        = "Resolved"
 
 	// kubeEvent
-	kubeEventReasonAlertFiring = "AlertFiring"
-
-	// Elasticsearch aggregation field
-	elasticAggregationsField = "aggregations"
-)
-
-var (
-	queryConnectorCreds *pools.Credentials
-	credsExists         bool
-
-	// Elasticsearch search path
-	ElasticsearchSearchURL = "%s/%s/_search"
+	kubeEventReasonAlertFiring   = "AlertFiring"
+	kubeEventReasonAlertResolved = "AlertResolved"
+	kubeEventReasonAlertExpired  = "AlertExpired"
 )
 
 // Sync execute the query to the elasticsearch and evaluate the condition. Then trigger the action adding the alert to the pool
 // and sending an event to the Kubernetes API
 func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventType, resource *v1alpha1.SearchRule) (err error) {
 
-	logger := log.FromContext(ctx)
+	// Attach the context of the rule to every log line. The namespace is already attached by the controller
+	connectorRef := resource.Spec.QueryConnectorRef.Name
+	if resource.Spec.QueryConnectorRef.Namespace != "" {
+		connectorRef = fmt.Sprintf("%s/%s", resource.Spec.QueryConnectorRef.Namespace, resource.Spec.QueryConnectorRef.Name)
+	}
+	logger := log.FromContext(ctx).WithValues("rule", resource.Name, "connector", connectorRef)
+	ctx = log.IntoContext(ctx, logger)
 
 	// If the eventType is Deleted, remove the rule from the rules pool and from the alerts pool
 	// In other cases, execute Sync logic
 	if eventType == watch.Deleted {
-		key := fmt.Sprintf("%s_%s", resource.Namespace, resource.Name)
-		r.RulesPool.Delete(key)
-		r.AlertsPool.Delete(key)
+		r.RulesPool.Delete(pools.GetKey(resource.Namespace, resource.Name))
+		for alertKey := range r.getRuleAlerts(resource) {
+			r.AlertsPool.Delete(alertKey)
+		}
 		return nil
 	}
 
-	// Get QueryConnector associated to the rule with KubeRawClient
+	// Rules are only evaluated inside their active windows. Out of them, firing alerts are resolved
+	active, err := isRuleActive(resource.Spec.ActiveWindows, time.Now())
+	if err != nil {
+		r.UpdateConditionInvalidActiveWindows(resource)
+		return err
+	}
+	if !active {
+		err = r.deactivateRule(ctx, resource)
+		if err != nil {
+			return err
+		}
+		resource.Status.LastSeenTime = metav1.Time{}
+		r.UpdateConditionInactiveSchedule(resource)
+		return nil
+	}
+
+	// When the rule can not be evaluated, its firing alert is resolved after the max firing duration,
+	// so it does not linger in the pool during long outages of the backend
+	defer func() {
+		if err == nil {
+			return
+		}
+		expired, expireErr := r.expireFiringAlert(ctx, resource, time.Now())
+		if expireErr != nil {
+			logger.Info("Firing alert can not be expired", "error", expireErr.Error())
+			return
+		}
+		if expired {
+			logger.Info("Rule is resolved after the max firing duration without a successful evaluation", "state", RuleNormalState)
+		}
+	}()
+
+	// Get QueryConnector associated to the rule with KubeRawClient. It does not use the cache, so the
+	// namespaces out of --watch-namespaces are rejected here
+	if !globals.IsNamespaceWatched(resource.Spec.QueryConnectorRef.Namespace) {
+		r.UpdateConditionQueryConnectorNotFound(resource)
+		return fmt.Errorf(controller.NamespaceNotWatchedErrorMessage, controller.QueryConnectorResourceType,
+			resource.Spec.QueryConnectorRef.Name, resource.Spec.QueryConnectorRef.Namespace)
+	}
 	gvr := schema.GroupVersionResource{
 		Group:    v1alpha1.GroupVersion.Group,
 		Version:  v1alpha1.GroupVersion.Version,
 		Resource: "clusterqueryconnectors",
 	}
 
-	queryConnectorWrapper := globals.Application.KubeRawClient.Resource(gvr)
+	var queryConnectorWrapper dynamic.ResourceInterface = globals.Application.KubeRawClient.Resource(gvr)
 	if resource.Spec.QueryConnectorRef.Namespace != "" {
 		gvr.Resource = "queryconnectors"
-		queryConnectorWrapper = globals.Application.KubeRawClient.Resource(gvr)
-		queryConnectorWrapper.Namespace(resource.Spec.QueryConnectorRef.Namespace)
+		queryConnectorWrapper = globals.Application.KubeRawClient.Resource(gvr).Namespace(resource.Spec.QueryConnectorRef.Namespace)
 	}
 
 	QueryConnectorResource, err := queryConnectorWrapper.Get(ctx, resource.Spec.QueryConnectorRef.Name, metav1.GetOptions{})
@@ -132,15 +194,23 @@ func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventTy
 		return fmt.Errorf(controller.JSONMarshalErrorMessage, err)
 	}
 
-	// Get credentials for QueryConnector attached if defined
-	if !reflect.ValueOf(QueryConnectorSpec.Credentials).IsZero() {
-		key := fmt.Sprintf("%s_%s", QueryConnectorResource.GetNamespace(), QueryConnectorResource.GetName())
-		queryConnectorCreds, credsExists = r.QueryConnectorCredentialsPool.Get(key)
-		if !credsExists {
+	// Get credentials and TLS certificates for QueryConnector attached. They are mandatory
+	// just when they are defined in the QueryConnector
+	connector := &queryConnector{
+		QueryConnectorSpec: QueryConnectorSpec,
+		key:                pools.GetKey(QueryConnectorResource.GetNamespace(), QueryConnectorResource.GetName()),
+	}
+	creds, credsExists := r.QueryConnectorCredentialsPool.Get(connector.key)
+	if !credsExists {
+		if !reflect.ValueOf(QueryConnectorSpec.Credentials).IsZero() ||
+			!reflect.ValueOf(QueryConnectorSpec.TlsSecretRef).IsZero() ||
+			QueryConnectorSpec.CaBundle != "" {
 			r.UpdateConditionNoCredsFound(resource)
-			return fmt.Errorf(controller.MissingCredentialsMessage, key)
+			return fmt.Errorf(controller.MissingCredentialsMessage, connector.key)
 		}
+		creds = &pools.Credentials{}
 	}
+	connector.creds = creds
 
 	// Get `for` duration for the rules firing. When rule is firing during this for time,
 	// then the rule is really ocurring and must be an alert
@@ -149,119 +219,155 @@ func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventTy
 		return fmt.Errorf(controller.ForValueParseErrorMessage, err)
 	}
 
-	// Check if query is defined in the resource
-	if resource.Spec.Elasticsearch.Query == nil && resource.Spec.Elasticsearch.QueryJSON == "" {
-		r.UpdateConditionNoQueryFound(resource)
-		return fmt.Errorf(controller.QueryNotDefinedErrorMessage, resource.Name)
-	}
-
-	// Check if both query and queryJson are defined. If true, return error
-	if resource.Spec.Elasticsearch.Query != nil && resource.Spec.Elasticsearch.QueryJSON != "" {
-		r.UpdateConditionNoQueryFound(resource)
-		return fmt.Errorf(controller.QueryDefinedInBothErrorMessage, resource.Name)
+	// Get `resolveFor` duration for the rules resolving. When rule is not firing during this time,
+	// then the alert is resolved. Defaults to the `for` time when not defined
+	resolveForDuration := forDuration
+	if resource.Spec.Condition.ResolveFor != "" {
+		resolveForDuration, err = time.ParseDuration(resource.Spec.Condition.ResolveFor)
+		if err != nil {
+			return fmt.Errorf(controller.ResolveForValueParseErrorMessage, err)
+		}
 	}
 
-	// Select query to use and marshall to JSON
-	var elasticQuery []byte
-	// If query is defined in the resource, just Marshal it
-	if resource.Spec.Elasticsearch.Query != nil {
-		elasticQuery, err = json.Marshal(resource.Spec.Elasticsearch.Query)
+	// Get `cooldown` duration for the rules. After an alert is resolved, the rule can not fire
+	// again during this time. Disabled when not defined
+	cooldownDuration := time.Duration(0)
+	if resource.Spec.Condition.Cooldown != "" {
+		cooldownDuration, err = time.ParseDuration(resource.Spec.Condition.Cooldown)
 		if err != nil {
-			return fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+			return fmt.Errorf(controller.CooldownValueParseErrorMessage, err)
 		}
 	}
-	// If queryJSON is defined in the resource, it is already a JSON, just convert it to bytes
-	if resource.Spec.Elasticsearch.QueryJSON != "" {
-		elasticQuery = []byte(resource.Spec.Elasticsearch.QueryJSON)
-	}
 
-	// Make http client for elasticsearch connection
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: QueryConnectorSpec.TlsSkipVerify,
-			},
-		},
+	// Execute the query of the rule in the backend of the QueryConnector
+	queryCtx, querySpan := tracing.Start(ctx, "SearchRule.Query", trace.WithAttributes(
+		attribute.String("searchruler.queryconnector.type", QueryConnectorSpec.Type),
+		attribute.String("searchruler.queryconnector.url", QueryConnectorSpec.URL),
+	))
+
+	// While the alert of the rule is firing, the resolve query is executed instead when defined, so the resolution
+	// is confirmed with other data. The conditions set during the query are kept in the status of the rule
+	queryResource := resource
+	resolveQuery := false
+	if resource.Spec.Condition.Buckets == nil && r.isRuleResolving(resource) {
+		if resolveResource := getResolveQueryResource(resource, QueryConnectorSpec.Type); resolveResource != nil {
+			queryResource = resolveResource
+			resolveQuery = true
+			querySpan.SetAttributes(attribute.Bool("searchruler.resolvequery", true))
+		}
 	}
 
-	// Generate URL for search to elasticsearch
-	searchURL := fmt.Sprintf(
-		ElasticsearchSearchURL,
-		QueryConnectorSpec.URL,
-		resource.Spec.Elasticsearch.Index,
-	)
-	req, err := http.NewRequest("POST", searchURL, bytes.NewBuffer(elasticQuery))
+	var result *queryResult
+	switch QueryConnectorSpec.Type {
+	case connectorTypeLoki:
+		result, err = r.queryLoki(queryCtx, queryResource, connector)
+	case connectorTypePrometheus:
+		result, err = r.queryPrometheus(queryCtx, queryResource, connector)
+	default:
+		result, err = r.queryElasticsearch(queryCtx, queryResource, connector)
+	}
+	resource.Status = queryResource.Status
+	tracing.End(querySpan, err)
+	r.updateConsecutiveFailures(resource, err)
 	if err != nil {
-		r.UpdateConditionConnectionError(resource)
-		return fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
+		return err
 	}
 
-	// Add headers and custom headers for elasticsearch queries
-	req.Header.Set("Content-Type", "application/json")
-	for key, value := range QueryConnectorSpec.Headers {
-		req.Header.Set(key, value)
+	// Without enough data, the condition is not evaluated. By default, the rule keeps its state in the pool,
+	// so stalled ingestions do not fire rules like lessThan ones. Other policies evaluate the rule as firing
+	// or resolved instead
+	noDataPolicy := resource.Spec.Condition.NoDataPolicy
+	if result.noData && (noDataPolicy == "" || noDataPolicy == noDataPolicyKeep) {
+		resource.Status.LastEvaluationTime = metav1.Now()
+		r.UpdateConditionNoData(resource)
+		logger.Info("Rule has not enough data to be evaluated", "minDocCount", resource.Spec.Elasticsearch.MinDocCount)
+		return nil
 	}
 
-	// Add authentication if set for elasticsearch queries
-	if QueryConnectorSpec.Credentials.SecretRef.Name != "" {
-		req.SetBasicAuth(queryConnectorCreds.Username, queryConnectorCreds.Password)
+	// In buckets mode, the condition is evaluated for every bucket of the conditionField, which fires separately
+	if resource.Spec.Condition.Buckets != nil {
+		return r.syncBuckets(ctx, resource, result, QueryConnectorSpec.URL, forDuration, resolveForDuration, cooldownDuration)
+	}
+	conditionValue := result.conditionValue
+	aggregationsResource := result.aggregations
+
+	// Get the numeric value of the conditionField. Non numeric values are a misconfiguration of the rule
+	// and must not be evaluated as 0, except for string operators, which evaluate the raw value
+	value, numericErr := getNumericValue(conditionValue)
+	if numericErr != nil && !isStringOperator(resource.Spec.Condition.Operator) && !result.noData {
+		r.UpdateConditionNonNumericValue(resource)
+		return numericErr
 	}
 
-	// Make request to elasticsearch
-	resp, err := httpClient.Do(req)
+	// Evaluate the annotations of the rule, which can include templates with the current value
+	annotations, err := getAlertAnnotations(resource, value, aggregationsResource)
 	if err != nil {
-		r.UpdateConditionConnectionError(resource)
-		return fmt.Errorf(controller.ElasticsearchQueryErrorMessage, string(elasticQuery), err)
+		r.UpdateConditionEvaluateTemplateError(resource)
+		return err
 	}
-	defer resp.Body.Close()
 
-	// Read response and check if it is ok
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		r.UpdateConditionQueryError(resource)
-		return fmt.Errorf(controller.ResponseBodyReadErrorMessage, err)
+	// Save the value in the history of the rule for the trend conditions. Values of the resolve query are
+	// not comparable with the values of the query, so they are not saved. In dry-run mode, the rules pool
+	// is not touched, so the value is just added to a copy of the history to evaluate the trend conditions
+	history := r.getRuleHistory(resource)
+	if numericErr == nil && !result.noData && !resolveQuery {
+		history.Add(pools.Sample{Time: time.Now(), Value: value})
+		if !isDryRun(resource) {
+			r.setRuleHistory(resource, history)
+		}
 	}
-	if resp.StatusCode != http.StatusOK {
-		r.UpdateConditionQueryError(resource)
-		return fmt.Errorf(
-			controller.ElasticsearchQueryResponseErrorMessage,
-			string(elasticQuery),
-			string(responseBody),
-		)
+
+	// With a changeOperator, the condition is evaluated against the change of the value since some evaluations
+	// ago. Until there are enough values to compare with, the rule keeps its state like without data
+	evaluatedValue := conditionValue
+	resource.Status.LastSmoothedValue = ""
+	if resource.Spec.Condition.ChangeOperator != "" && !result.noData {
+		change, changeExists := getValueChange(resource, &history)
+		if !changeExists {
+			resource.Status.LastValue = conditionValue.String()
+			resource.Status.LastEvaluationTime = metav1.Now()
+			r.UpdateConditionNoData(resource)
+			logger.Info("Rule has not enough values to evaluate the change", "value", conditionValue.String())
+			return nil
+		}
+		evaluatedValue = gjson.Parse(strconv.FormatFloat(change, 'f', -1, 64))
 	}
 
-	// Extract conditionField from the response field of elasticsearch
-	conditionValue := gjson.Get(string(responseBody), resource.Spec.Elasticsearch.ConditionField)
-	if !conditionValue.Exists() {
-		r.UpdateConditionQueryError(resource)
-		return fmt.Errorf(
-			controller.ConditionFieldNotFoundMessage,
-			resource.Spec.Elasticsearch.ConditionField,
-			string(responseBody),
-		)
+	// With smoothingSamples, the condition is evaluated against the moving average of the last values
+	if resource.Spec.Condition.SmoothingSamples > 0 && !result.noData {
+		smoothedValue := getSmoothedValue(resource, &history)
+		evaluatedValue = gjson.Parse(smoothedValue)
+		resource.Status.LastSmoothedValue = smoothedValue
 	}
 
-	// Save elastic response if the result has aggregations, this allows user
-	// to use the response in the action
-	aggregationsResource := interface{}(nil)
-	aggregationsResponse := gjson.Get(string(responseBody), elasticAggregationsField)
-	if aggregationsResponse.Exists() {
-		aggregationsResource = aggregationsResponse.Value()
+	// Evaluate condition and check if the alert is firing or not. Without data, the noDataPolicy decides it
+	firing := noDataPolicy == noDataPolicyFiring
+	if !result.noData {
+		firing, err = evaluateCondition(evaluatedValue, resource.Spec.Condition.Operator, result.threshold)
+		if err != nil {
+			r.UpdateConditionQueryError(resource)
+			return fmt.Errorf(
+				controller.EvaluatingConditionErrorMessage,
+				err,
+			)
+		}
 	}
 
-	// Evaluate condition and check if the alert is firing or not
-	firing, err := evaluateCondition(conditionValue.Float(), resource.Spec.Condition.Operator, resource.Spec.Condition.Threshold)
-	if err != nil {
-		r.UpdateConditionQueryError(resource)
-		return fmt.Errorf(
-			controller.EvaluatingConditionErrorMessage,
-			err,
-		)
+	// Save the last evaluated value in the status of the rule. Without data, the last value is kept
+	if !result.noData {
+		resource.Status.LastValue = conditionValue.String()
+	}
+	resource.Status.LastEvaluationTime = metav1.Now()
+
+	hold, err := r.holdEvaluation(ctx, resource, conditionValue.String(), firing)
+	if hold || err != nil {
+		return err
 	}
 
-	// Get ruleKey for the pool <namespace>_<name> and get rule from the pool if exists
-	// If not, create a default skeleton rule and save it to the pool
-	ruleKey := fmt.Sprintf("%s_%s", resource.Namespace, resource.Name)
+	// Get ruleKey for the pool, see pools.GetKey: <namespace>_<name>, or _<name> for ClusterSearchRules. The alerts
+	// of the buckets extend it as <namespace>_<name>{<bucket key>}, but the rule is kept under the plain key.
+	// Get the rule from the pool if exists. If not, create a default skeleton rule and save it to the pool
+	ruleKey := pools.GetKey(resource.Namespace, resource.Name)
 	rule, ruleInPool := r.RulesPool.Get(ruleKey)
 	if !ruleInPool {
 		// Initialize rule with default values
@@ -270,7 +376,7 @@ func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventTy
 			FiringTime:    time.Time{},
 			State:         RuleNormalState,
 			ResolvingTime: time.Time{},
-			Value:         conditionValue.Float(),
+			Value:         value,
 			Aggregations:  nil,
 		}
 		r.RulesPool.Set(ruleKey, rule)
@@ -283,110 +389,373 @@ func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventTy
 	}
 
 	// Set the current value of the condition to the rule
-	rule.Value = conditionValue.Float()
+	rule.Value = value
 	rule.Aggregations = aggregationsResource
 	r.RulesPool.Set(ruleKey, rule)
 
-	// If rule is firing right now
-	if firing {
+	// Absent rules keep the last time the condition was false, so they fire since then instead of since
+	// the first firing evaluation
+	updateLastSeenTime(resource, rule, firing, time.Now())
 
-		// If rule is not set as firing in the pool, set start fireTime and state PendingFiring
-		if rule.State == RuleNormalState || rule.State == RulePendingResolvedState {
-			rule.FiringTime = time.Now()
-			rule.State = RulePendingFiringState
-			r.RulesPool.Set(ruleKey, rule)
+	// Move the rule to its next state depending on the evaluation and execute the side effects of the transition
+	switch transitionRule(rule, firing, time.Now(), forDuration, resolveForDuration, cooldownDuration) {
+
+	// If rule is in cooldown after resolving an alert, keep it in normal state
+	case ruleTransitionCooldown:
+		r.UpdateStateNormal(resource)
+		logger.Info("Rule is in cooldown", "state", rule.State, "value", conditionValue.String())
+		return nil
+
+	case ruleTransitionPendingFiring:
+		r.RulesPool.Set(ruleKey, rule)
+		r.UpdateStateAlertPendingFiring(resource)
+		return nil
+
+	// If rule is firing the For time, notify it
+	case ruleTransitionFiring:
+		r.RulesPool.Set(ruleKey, rule)
+
+		// Add alert to the pool with the value, the object and the rulerAction name which will trigger the alert.
+		// The time the alert started firing is kept across evaluations
+		alertKey := pools.GetKey(resource.Namespace, resource.Name)
+		firingTime := time.Now()
+		if alert, alertInPool := r.AlertsPool.Get(alertKey); alertInPool && alert.Status == pools.AlertStatusFiring {
+			firingTime = alert.FiringTime
+		}
+		r.AlertsPool.Set(alertKey, &pools.Alert{
+			RulerActionName: resource.Spec.ActionRef.Name,
+			SearchRule:      *resource,
+			Status:          pools.AlertStatusFiring,
+			Severity:        resource.Spec.Severity,
+			Labels:          resource.Spec.Labels,
+			Annotations:     annotations,
+			Value:           value,
+			Aggregations:    aggregationsResource,
+			Query:           result.query,
+			ConnectorURL:    QueryConnectorSpec.URL,
+			Samples:         result.samples,
+			SpanContext:     trace.SpanContextFromContext(ctx),
+			FiringTime:      firingTime,
+		})
+
+		// Create an event in Kubernetes of AlertFiring. This event will be readed by the RulerAction controller
+		// and will trigger the action inmediately
+		err = createKubeEvent(
+			ctx,
+			*resource,
+			kubeEventReasonAlertFiring,
+			fmt.Sprintf("Rule is in firing state. Current value is %v", conditionValue),
+		)
+		if err != nil {
+			return fmt.Errorf(controller.KubeEventCreationErrorMessage, err)
 		}
 
-		// If rule is firing the For time and it is not notified yet, do it and change state to Firing
-		if time.Since(rule.FiringTime) > forDuration {
-			rule.State = RuleFiringState
-			r.RulesPool.Set(ruleKey, rule)
+		// Log the alert and change the AlertStatus to Firing of the searchRule
+		r.UpdateConditionAlertFiring(resource)
+		logger.Info("Rule is in firing state", "state", rule.State, "value", conditionValue.String())
+		return nil
+
+	case ruleTransitionPendingResolved:
+		r.RulesPool.Set(ruleKey, rule)
+		r.UpdateStateAlertPendingResolved(resource)
+		return nil
+
+	// If rule stayed in PendingResolved state during the `resolveFor` time, it is resolved
+	case ruleTransitionResolved:
 
-			// Add alert to the pool with the value, the object and the rulerAction name which will trigger the alert
-			alertKey := fmt.Sprintf("%s_%s", resource.Namespace, resource.Name)
+		// Mark the alert as resolved in the pool instead of removing it. The RulerAction controller
+		// will send the resolved notification and remove it from the pool afterwards
+		alertKey := pools.GetKey(resource.Namespace, resource.Name)
+		alert, alertInPool := r.AlertsPool.Get(alertKey)
+		if alertInPool {
 			r.AlertsPool.Set(alertKey, &pools.Alert{
-				RulerActionName: resource.Spec.ActionRef.Name,
+				RulerActionName: alert.RulerActionName,
 				SearchRule:      *resource,
-				Value:           conditionValue.Float(),
+				Status:          pools.AlertStatusResolved,
+				Severity:        resource.Spec.Severity,
+				Labels:          resource.Spec.Labels,
+				Annotations:     annotations,
+				Value:           value,
 				Aggregations:    aggregationsResource,
+				Query:           result.query,
+				ConnectorURL:    QueryConnectorSpec.URL,
+				Samples:         result.samples,
+				SpanContext:     trace.SpanContextFromContext(ctx),
+				FiringTime:      alert.FiringTime,
+				ResolvedTime:    time.Now(),
 			})
 
-			// Create an event in Kubernetes of AlertFiring. This event will be readed by the RulerAction controller
-			// and will trigger the action inmediately
+			// Create an event in Kubernetes of AlertResolved. This event will trigger the RulerAction
+			// controller to send the resolved notification
 			err = createKubeEvent(
 				ctx,
 				*resource,
-				kubeEventReasonAlertFiring,
-				fmt.Sprintf("Rule is in firing state. Current value is %v", conditionValue),
+				kubeEventReasonAlertResolved,
+				fmt.Sprintf("Rule is resolved. Final value is %v", conditionValue),
 			)
 			if err != nil {
 				return fmt.Errorf(controller.KubeEventCreationErrorMessage, err)
 			}
 
-			// Log the alert and change the AlertStatus to Firing of the searchRule
-			r.UpdateConditionAlertFiring(resource)
-			logger.Info(fmt.Sprintf(
-				"Rule %s is in firing state. Current value is %v",
-				resource.Name,
-				conditionValue,
-			))
-			return nil
-
+			// Keep the time of the resolved alert for the cooldown
+			rule.ResolvedTime = time.Now()
 		}
+		r.RulesPool.Set(ruleKey, rule)
 
-		r.UpdateStateAlertPendingFiring(resource)
+		// Log and update the AlertStatus to Resolved
+		r.UpdateStateNormal(resource)
+		logger.Info("Rule is in normal state", "state", rule.State, "value", conditionValue.String())
 		return nil
+	}
+
+	r.UpdateStateNormal(resource)
+	return nil
+}
+
+// expireFiringAlert resolves the firing alert of the rule when it was not evaluated successfully for more than the
+// max firing duration of the condition. It is called when the rule can not be evaluated, so the alert is resolved
+// even without an evaluation below the threshold. The time is counted since the last successful evaluation, so long
+// incidents are not resolved by a transient error. It returns true when the alert is expired
+func (r *SearchRuleReconciler) expireFiringAlert(ctx context.Context, resource *v1alpha1.SearchRule, now time.Time) (bool, error) {
 
+	if resource.Spec.Condition.MaxFiringDuration == "" {
+		return false, nil
+	}
+	maxFiringDuration, err := time.ParseDuration(resource.Spec.Condition.MaxFiringDuration)
+	if err != nil {
+		return false, fmt.Errorf(controller.MaxFiringDurationParseErrorMessage, err)
 	}
 
-	// If alert is not firing right now and it is not in healthy state
-	if !firing && rule.State != RuleNormalState {
+	ruleKey := pools.GetKey(resource.Namespace, resource.Name)
+	rule, ruleInPool := r.RulesPool.Get(ruleKey)
+	if !ruleInPool {
+		rule = &pools.Rule{SearchRule: *resource}
+	}
 
-		// If rule is not marked as resolving in the pool, change state to PendingResolved and set resolvingTime now
-		if rule.State != RulePendingResolvedState {
-			rule.State = RulePendingResolvedState
-			rule.ResolvingTime = time.Now()
-			r.RulesPool.Set(ruleKey, rule)
+	// Every alert of the rule expires separately, including the alerts of its buckets in buckets mode. The last
+	// successful evaluation is kept in the status, so it survives restarts. Alerts firing since a later time
+	// were never evaluated successfully after it, like the restored ones
+	lastEvaluationTime := resource.Status.LastEvaluationTime.Time
+	var lastValue float64
+	expiredAlerts := 0
+	for alertKey, alert := range r.getRuleAlerts(resource) {
+		lastSuccessTime := lastEvaluationTime
+		if alert.FiringTime.After(lastSuccessTime) {
+			lastSuccessTime = alert.FiringTime
+		}
+		if alert.Status != pools.AlertStatusFiring || now.Sub(lastSuccessTime) <= maxFiringDuration {
+			continue
 		}
 
-		// If rule stay in PendingResolved state during the `for` time, mark as resolved
-		if time.Since(rule.ResolvingTime) > forDuration {
+		// Mark the alert as resolved, so the RulerAction sends the resolved notification, and restore the state
+		// of the alert to the normal state. The cooldown starts now
+		expiredAlert := *alert
+		expiredAlert.Status = pools.AlertStatusResolved
+		expiredAlert.ResolvedTime = now
+		r.AlertsPool.Set(alertKey, &expiredAlert)
+
+		state := getAlertState(resource, rule, alertKey)
+		if state != nil {
+			state.State = RuleNormalState
+			state.FiringTime = time.Time{}
+			state.ResolvingTime = time.Time{}
+			state.ResolvedTime = now
+			state.Value = alert.Value
+		}
+		lastValue = alert.Value
+		expiredAlerts++
+	}
+	if expiredAlerts == 0 {
+		return false, nil
+	}
+	if rule.Buckets != nil {
+		rule.State = getBucketsState(rule)
+	}
+	r.RulesPool.Set(ruleKey, rule)
 
-			// Remove alert from the pool
-			alertKey := fmt.Sprintf("%s_%s", resource.Namespace, resource.Name)
-			r.AlertsPool.Delete(alertKey)
+	err = createKubeEvent(
+		ctx,
+		*resource,
+		kubeEventReasonAlertExpired,
+		fmt.Sprintf("Rule is resolved because it is firing for more than %s without a successful evaluation. Last value is %v",
+			maxFiringDuration, lastValue),
+	)
+	if err != nil {
+		return true, fmt.Errorf(controller.KubeEventCreationErrorMessage, err)
+	}
+
+	return true, nil
+}
+
+// transitionRule moves the rule to its next state depending on whether the condition is firing at the given
+// time, and returns the transition done so the caller executes its side effects:
+//
+//	Normal -> PendingFiring -> Firing -> PendingResolving -> Normal
+//
+// A rule firing again while resolving goes back to PendingFiring, and a rule that stops firing while pending
+// goes to PendingResolving. Resolved rules keep their last resolved time, used for the cooldown
+func transitionRule(rule *pools.Rule, firing bool, now time.Time, forDuration, resolveForDuration, cooldownDuration time.Duration) string {
+
+	if firing {
 
-			// Restore rule to default values
-			rule = &pools.Rule{
-				FiringTime:    time.Time{},
-				State:         RuleNormalState,
-				ResolvingTime: time.Time{},
-				SearchRule:    *resource,
-				Value:         conditionValue.Float(),
-				Aggregations:  aggregationsResource,
+		// If rule is in cooldown after resolving an alert, keep it in normal state
+		if rule.State == RuleNormalState && !rule.ResolvedTime.IsZero() && now.Sub(rule.ResolvedTime) < cooldownDuration {
+			return ruleTransitionCooldown
+		}
+
+		// If rule is not set as firing, set start fireTime and state PendingFiring. Absent rules are
+		// firing since the last time the condition was false
+		if rule.State == RuleNormalState || rule.State == RulePendingResolvedState {
+			rule.FiringTime = now
+			if !rule.LastSeenTime.IsZero() {
+				rule.FiringTime = rule.LastSeenTime
 			}
-			r.RulesPool.Set(ruleKey, rule)
-
-			// Log and update the AlertStatus to Resolved
-			r.UpdateStateNormal(resource)
-			logger.Info(fmt.Sprintf(
-				"Rule %s is in normal state. Current value is %v",
-				resource.Name,
-				conditionValue,
-			))
-			return nil
+			rule.State = RulePendingFiringState
 		}
 
-		r.UpdateStateAlertPendingResolved(resource)
-		return nil
+		// If rule is firing the For time, change state to Firing
+		if now.Sub(rule.FiringTime) > forDuration {
+			rule.State = RuleFiringState
+			return ruleTransitionFiring
+		}
+
+		return ruleTransitionPendingFiring
 	}
 
-	r.UpdateStateNormal(resource)
-	return nil
+	// Rule is not firing right now and it is already in healthy state
+	if rule.State == RuleNormalState {
+		return ruleTransitionNormal
+	}
+
+	// If rule is not marked as resolving, change state to PendingResolved and set resolvingTime now
+	if rule.State != RulePendingResolvedState {
+		rule.State = RulePendingResolvedState
+		rule.ResolvingTime = now
+	}
+
+	// If rule stay in PendingResolved state during the `resolveFor` time, restore it to default values
+	if now.Sub(rule.ResolvingTime) > resolveForDuration {
+		rule.State = RuleNormalState
+		rule.FiringTime = time.Time{}
+		rule.ResolvingTime = time.Time{}
+		return ruleTransitionResolved
+	}
+
+	return ruleTransitionPendingResolved
 }
 
-// evaluateCondition evaluates the conditionField with the operator and threshold
-func evaluateCondition(value float64, operator string, threshold string) (bool, error) {
+// updateLastSeenTime keeps in the rule and in the status the last time the condition of an absent rule was
+// false. The time of the status is restored when the rule is not tracked yet, so the continuity of the missing
+// data survives restarts of the controller. Without previous evaluations, the missing data is counted from now
+func updateLastSeenTime(resource *v1alpha1.SearchRule, rule *pools.Rule, firing bool, now time.Time) {
+
+	if !resource.Spec.Condition.Absent {
+		rule.LastSeenTime = time.Time{}
+		resource.Status.LastSeenTime = metav1.Time{}
+		return
+	}
+
+	if rule.LastSeenTime.IsZero() {
+		rule.LastSeenTime = resource.Status.LastSeenTime.Time
+	}
+	if !firing || rule.LastSeenTime.IsZero() {
+		rule.LastSeenTime = now
+	}
+	resource.Status.LastSeenTime = metav1.NewTime(rule.LastSeenTime)
+}
+
+// getNumericValue returns the value of a gjson result as float. Numbers are returned as they are and strings
+// are parsed, so numeric strings like "503" are accepted. Any other type returns an error
+func getNumericValue(result gjson.Result) (float64, error) {
+
+	switch result.Type {
+	case gjson.Number:
+		return result.Num, nil
+	case gjson.String:
+		value, err := strconv.ParseFloat(strings.TrimSpace(result.Str), 64)
+		if err != nil {
+			return 0, fmt.Errorf(controller.ConditionValueNotNumericMessage, result.Raw)
+		}
+		return value, nil
+	}
+
+	return 0, fmt.Errorf(controller.ConditionValueNotNumericMessage, result.Raw)
+}
+
+// isInsideRange checks if the value is inside the range of the threshold. The range is expressed in interval
+// notation, where square brackets are inclusive bounds and parentheses are exclusive bounds. For example,
+// [100, 500) is a range from 100 to 500 including 100 and excluding 500
+func isInsideRange(value float64, threshold string) (bool, error) {
+
+	threshold = strings.TrimSpace(threshold)
+	rangeError := fmt.Errorf("configured threshold is not a valid range: %v", threshold)
+	if len(threshold) < 2 {
+		return false, rangeError
+	}
+
+	opening, closing := threshold[0], threshold[len(threshold)-1]
+	if (opening != '[' && opening != '(') || (closing != ']' && closing != ')') {
+		return false, rangeError
+	}
+
+	bounds := strings.Split(threshold[1:len(threshold)-1], ",")
+	if len(bounds) != 2 {
+		return false, rangeError
+	}
+	minBound, err := strconv.ParseFloat(strings.TrimSpace(bounds[0]), 64)
+	if err != nil {
+		return false, rangeError
+	}
+	maxBound, err := strconv.ParseFloat(strings.TrimSpace(bounds[1]), 64)
+	if err != nil || minBound > maxBound {
+		return false, rangeError
+	}
+
+	aboveMin := value > minBound || (opening == '[' && value == minBound)
+	belowMax := value < maxBound || (closing == ']' && value == maxBound)
+	return aboveMin && belowMax, nil
+}
+
+// isStringOperator checks if the operator compares the raw string value of the conditionField
+func isStringOperator(operator string) bool {
+	switch operator {
+	case conditionStringEqual, conditionStringNotEqual, conditionMatches, conditionNotMatches:
+		return true
+	}
+	return false
+}
+
+// evaluateCondition evaluates the conditionField with the operator and threshold. String operators compare
+// the raw string value with the threshold, used as a regular expression for matches and notMatches
+func evaluateCondition(conditionValue gjson.Result, operator string, threshold string) (bool, error) {
+
+	// Evaluate string conditions
+	switch operator {
+	case conditionStringEqual:
+		return conditionValue.String() == threshold, nil
+	case conditionStringNotEqual:
+		return conditionValue.String() != threshold, nil
+	case conditionMatches, conditionNotMatches:
+		expression, err := regexp.Compile(threshold)
+		if err != nil {
+			return false, fmt.Errorf("configured threshold is not a valid regular expression: %v", threshold)
+		}
+		return expression.MatchString(conditionValue.String()) == (operator == conditionMatches), nil
+	}
+
+	value, err := getNumericValue(conditionValue)
+	if err != nil {
+		return false, err
+	}
+
+	// Evaluate range conditions
+	if operator == conditionInsideRange || operator == conditionOutsideRange {
+		inside, err := isInsideRange(value, threshold)
+		if err != nil {
+			return false, err
+		}
+		return inside == (operator == conditionInsideRange), nil
+	}
 
 	// Parse threshold to float
 	floatThreshold, err := strconv.ParseFloat(threshold, 64)
@@ -406,25 +775,252 @@ func evaluateCondition(value float64, operator string, threshold string) (bool,
 		return value <= floatThreshold, nil
 	case conditionEqual:
 		return value == floatThreshold, nil
+	case conditionNotEqual:
+		return value != floatThreshold, nil
 	default:
 		return false, fmt.Errorf("unknown configured operator: %q", operator)
 	}
 }
 
+// updateConsecutiveFailures counts in the rules pool the evaluations in a row whose query failed, resetting
+// the count on success. The count is exposed in the status with the QueryFailing condition. In dry-run mode,
+// the rules pool is not touched, so the count is kept just in the status
+func (r *SearchRuleReconciler) updateConsecutiveFailures(resource *v1alpha1.SearchRule, queryErr error) {
+
+	if isDryRun(resource) {
+		resource.Status.ConsecutiveFailures++
+		if queryErr == nil {
+			resource.Status.ConsecutiveFailures = 0
+		}
+		r.UpdateConditionQueryFailing(resource, resource.Status.ConsecutiveFailures)
+		return
+	}
+
+	// Rules not in the pool yet continue the count of the status, so it survives restarts of the controller
+	ruleKey := pools.GetKey(resource.Namespace, resource.Name)
+	rule, ruleInPool := r.RulesPool.Get(ruleKey)
+	if !ruleInPool {
+		rule = &pools.Rule{
+			SearchRule:          *resource,
+			State:               RuleNormalState,
+			ConsecutiveFailures: resource.Status.ConsecutiveFailures,
+		}
+	}
+
+	rule.ConsecutiveFailures++
+	if queryErr == nil {
+		rule.ConsecutiveFailures = 0
+	}
+	r.RulesPool.Set(ruleKey, rule)
+
+	resource.Status.ConsecutiveFailures = rule.ConsecutiveFailures
+	r.UpdateConditionQueryFailing(resource, rule.ConsecutiveFailures)
+}
+
+// isRuleResolving returns true when the alert of the rule is firing, so the evaluations check its resolution
+func (r *SearchRuleReconciler) isRuleResolving(resource *v1alpha1.SearchRule) bool {
+	rule, ruleInPool := r.RulesPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+	return ruleInPool && (rule.State == RuleFiringState || rule.State == RulePendingResolvedState)
+}
+
+// hasResolveQuery returns true when the rule defines a resolve query for any backend
+func hasResolveQuery(resource *v1alpha1.SearchRule) bool {
+	return resource.Spec.Elasticsearch.ResolveQuery != nil || resource.Spec.Loki.ResolveQuery != "" ||
+		resource.Spec.Prometheus.ResolveQuery != ""
+}
+
+// getResolveQueryResource returns a copy of the rule with the resolve query and the resolveConditionField of the
+// backend of the QueryConnector instead of the query and the conditionField. It returns nil without resolve query
+func getResolveQueryResource(resource *v1alpha1.SearchRule, connectorType string) *v1alpha1.SearchRule {
+	resolveResource := resource.DeepCopy()
+	switch connectorType {
+	case connectorTypeLoki:
+		loki := &resolveResource.Spec.Loki
+		if loki.ResolveQuery == "" {
+			return nil
+		}
+		loki.Query = loki.ResolveQuery
+		if loki.ResolveConditionField != "" {
+			loki.ConditionField = loki.ResolveConditionField
+		}
+	case connectorTypePrometheus:
+		prometheus := &resolveResource.Spec.Prometheus
+		if prometheus.ResolveQuery == "" {
+			return nil
+		}
+		prometheus.Query = prometheus.ResolveQuery
+		if prometheus.ResolveConditionField != "" {
+			prometheus.ConditionField = prometheus.ResolveConditionField
+		}
+	default:
+		elasticsearch := &resolveResource.Spec.Elasticsearch
+		if elasticsearch.ResolveQuery == nil {
+			return nil
+		}
+		elasticsearch.Query = elasticsearch.ResolveQuery
+		elasticsearch.QueryJSON = ""
+		elasticsearch.QueryConfigMapRef = nil
+		if elasticsearch.ResolveConditionField != "" {
+			elasticsearch.ConditionField = elasticsearch.ResolveConditionField
+		}
+	}
+	return resolveResource
+}
+
+// getRuleHistory returns a copy of the history of the rule in the rules pool, which is empty for new rules
+func (r *SearchRuleReconciler) getRuleHistory(resource *v1alpha1.SearchRule) pools.History {
+	rule, ruleInPool := r.RulesPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+	if !ruleInPool {
+		return pools.History{}
+	}
+	return rule.History.Clone()
+}
+
+// setRuleHistory saves the history of the rule in the rules pool
+func (r *SearchRuleReconciler) setRuleHistory(resource *v1alpha1.SearchRule, history pools.History) {
+
+	ruleKey := pools.GetKey(resource.Namespace, resource.Name)
+	rule, ruleInPool := r.RulesPool.Get(ruleKey)
+	if !ruleInPool {
+		rule = &pools.Rule{
+			SearchRule: *resource,
+			State:      RuleNormalState,
+		}
+	}
+
+	rule.History = history
+	r.RulesPool.Set(ruleKey, rule)
+}
+
+// getValueChange returns the change of the last value in the history of the rule since changeIntervals evaluations
+// ago, in percentage or as the difference depending on the changeOperator. It returns false while there are not
+// enough values yet, and when the percentage can not be calculated because the previous value is 0
+func getValueChange(resource *v1alpha1.SearchRule, history *pools.History) (float64, bool) {
+
+	current, currentExists := history.Ago(0)
+	previous, previousExists := history.Ago(max(resource.Spec.Condition.ChangeIntervals, 1))
+	if !currentExists || !previousExists {
+		return 0, false
+	}
+
+	if resource.Spec.Condition.ChangeOperator == changeOperatorDelta {
+		return current.Value - previous.Value, true
+	}
+	if previous.Value == 0 {
+		return 0, false
+	}
+	return (current.Value - previous.Value) / math.Abs(previous.Value) * 100, true
+}
+
+// getSmoothedValue returns the moving average of the last values in the history of the rule, over the
+// smoothingSamples of the condition. The first evaluations average the values available
+func getSmoothedValue(resource *v1alpha1.SearchRule, history *pools.History) string {
+
+	if history.Len() == 0 {
+		return resource.Status.LastValue
+	}
+
+	samples := history.Last(resource.Spec.Condition.SmoothingSamples)
+	sum := 0.0
+	for _, sample := range samples {
+		sum += sample.Value
+	}
+	return strconv.FormatFloat(sum/float64(len(samples)), 'f', -1, 64)
+}
+
+// isDryRun returns true when the rule is evaluated in dry-run mode, which never touches the rules and alerts pools
+func isDryRun(resource *v1alpha1.SearchRule) bool {
+	return resource.GetAnnotations()[controller.DryRunAnnotation] == "true"
+}
+
+// holdEvaluation returns whether the evaluation of the rule must be held in its status, without touching the rules
+// and alerts pools. In dry-run mode, the evaluation result is saved in the status of the rule and no events are
+// created, so actions are never triggered. When the rule is silenced, no notifications are sent until the
+// silence expires
+func (r *SearchRuleReconciler) holdEvaluation(ctx context.Context, resource *v1alpha1.SearchRule, value string, firing bool) (bool, error) {
+
+	logger := log.FromContext(ctx)
+
+	if isDryRun(resource) {
+		resource.Status.DryRun = &v1alpha1.DryRunResult{
+			Value:          value,
+			Firing:         firing,
+			EvaluationTime: metav1.Now(),
+		}
+		logger.Info("Rule evaluated in dry-run mode", "value", value, "firing", firing)
+		return true, nil
+	}
+	resource.Status.DryRun = nil
+
+	silence, err := r.getActiveSilence(ctx, resource)
+	if err != nil {
+		return true, err
+	}
+	if silence != nil {
+		r.UpdateConditionSilenced(resource, silence.Name)
+		logger.Info("Rule is silenced",
+			"silence", silence.Name, "until", silence.Spec.EndsAt.Format(time.RFC3339), "value", value)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// getAlertAnnotations evaluates the annotations of the SearchRule as templates. The value, the object and the
+// aggregations of the current evaluation are available in them
+func getAlertAnnotations(rule *v1alpha1.SearchRule, value float64, aggregations interface{}) (map[string]string, error) {
+
+	if len(rule.Spec.Annotations) == 0 {
+		return nil, nil
+	}
+
+	templateInjectedObject := map[string]interface{}{}
+	templateInjectedObject["value"] = value
+	templateInjectedObject["object"] = *rule
+	templateInjectedObject["aggregations"] = aggregations
+
+	annotations := make(map[string]string, len(rule.Spec.Annotations))
+	for key, annotationTemplate := range rule.Spec.Annotations {
+		annotation, err := template.EvaluateTemplate(annotationTemplate, templateInjectedObject)
+		if err != nil {
+			return nil, fmt.Errorf(controller.EvaluateTemplateErrorMessage, err)
+		}
+		annotations[key] = annotation
+	}
+
+	return annotations, nil
+}
+
+// getRuleTeam returns the team owning the rule, declared in its team label
+func getRuleTeam(rule *v1alpha1.SearchRule) string {
+	return rule.Labels[controller.TeamLabel]
+}
+
 // createKubeEvent creates a modern event in Kubernetes with data given by params
 func createKubeEvent(ctx context.Context, rule v1alpha1.SearchRule, action, message string) (err error) {
 
-	// Define the event object
+	// Add the severity and the team of the rule to the message of the event
+	if rule.Spec.Severity != "" {
+		message = fmt.Sprintf("%s. Severity is %s", message, rule.Spec.Severity)
+	}
+	var eventLabels map[string]string
+	if team := getRuleTeam(&rule); team != "" {
+		message = fmt.Sprintf("%s. Team is %s", message, team)
+		eventLabels = map[string]string{controller.TeamLabel: team}
+	}
+
+	// Define the event object. The team label is kept, so the events can be selected by team
 	eventObj := eventsv1.Event{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: "searchruler-alert-",
+			Labels:       eventLabels,
 		},
 
 		EventTime:           metav1.NewMicroTime(time.Now()),
 		ReportingController: "searchruler",
 		ReportingInstance:   "searchruler-controller",
 		Action:              action,
-		Reason:              "AlertFiring",
+		Reason:              action,
 
 		Regarding: corev1.ObjectReference{
 			APIVersion: rule.APIVersion,
@@ -437,8 +1033,15 @@ func createKubeEvent(ctx context.Context, rule v1alpha1.SearchRule, action, mess
 		Type: "Normal",
 	}
 
+	// Events of cluster scoped rules are created in the default namespace, as Kubernetes does
+	// for the rest of cluster scoped resources
+	eventNamespace := rule.Namespace
+	if eventNamespace == "" {
+		eventNamespace = metav1.NamespaceDefault
+	}
+
 	// Create the event in Kubernetes using the global client initiated in main.go
-	_, err = globals.Application.KubeRawCoreClient.EventsV1().Events(rule.Namespace).
+	_, err = globals.Application.KubeRawCoreClient.EventsV1().Events(eventNamespace).
 		Create(ctx, &eventObj, metav1.CreateOptions{})
 
 	return err
@@ -0,0 +1,1255 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/tidwall/gjson"
+	eventsv1 "k8s.io/api/events/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+	"prosimcorp.com/SearchRuler/internal/globals"
+	"prosimcorp.com/SearchRuler/internal/pools"
+)
+
+// newTestQueryConnector returns the QueryConnector of the evaluation of a rule without credentials
+func newTestQueryConnector(spec v1alpha1.QueryConnectorSpec) *queryConnector {
+	return &queryConnector{
+		QueryConnectorSpec: &spec,
+		key:                pools.GetKey("monitoring", "elasticsearch"),
+		creds:              &pools.Credentials{},
+	}
+}
+
+var _ = Describe("getNumericValue", func() {
+
+	It("should return the value of numeric fields", func() {
+		value, err := getNumericValue(gjson.Get(`{"hits":{"total":{"value":42.5}}}`, "hits.total.value"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal(42.5))
+	})
+
+	It("should parse string fields with numeric values", func() {
+		value, err := getNumericValue(gjson.Get(`{"status":" 503"}`, "status"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal(503.0))
+	})
+
+	It("should fail for string fields with non numeric values", func() {
+		_, err := getNumericValue(gjson.Get(`{"status":"red"}`, "status"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail for object fields", func() {
+		_, err := getNumericValue(gjson.Get(`{"hits":{"total":{"value":42}}}`, "hits.total"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail for array fields", func() {
+		_, err := getNumericValue(gjson.Get(`{"buckets":[1,2]}`, "buckets"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail for boolean and null fields", func() {
+		_, err := getNumericValue(gjson.Get(`{"timed_out":false}`, "timed_out"))
+		Expect(err).To(HaveOccurred())
+
+		_, err = getNumericValue(gjson.Get(`{"value":null}`, "value"))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("evaluateCondition", func() {
+
+	It("should fire with notEqual when the value is different from the threshold", func() {
+		firing, err := evaluateCondition(gjson.Parse("2"), conditionNotEqual, "3")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeTrue())
+	})
+
+	It("should not fire with notEqual when the value is equal to the threshold", func() {
+		firing, err := evaluateCondition(gjson.Parse("3"), conditionNotEqual, "3")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeFalse())
+	})
+
+	It("should include or exclude the bounds of the range depending on the brackets", func() {
+		firing, err := evaluateCondition(gjson.Parse("100"), conditionInsideRange, "[100, 500)")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeTrue())
+
+		firing, err = evaluateCondition(gjson.Parse("500"), conditionInsideRange, "[100, 500)")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeFalse())
+	})
+
+	It("should fire with outsideRange when the value is out of the range", func() {
+		firing, err := evaluateCondition(gjson.Parse("501"), conditionOutsideRange, "[100,500]")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeTrue())
+
+		firing, err = evaluateCondition(gjson.Parse("250"), conditionOutsideRange, "[100,500]")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeFalse())
+	})
+
+	It("should fail with invalid ranges", func() {
+		_, err := evaluateCondition(gjson.Parse("250"), conditionInsideRange, "100-500")
+		Expect(err).To(HaveOccurred())
+
+		_, err = evaluateCondition(gjson.Parse("250"), conditionInsideRange, "[500, 100]")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should compare the raw string value with stringEqual and stringNotEqual", func() {
+		firing, err := evaluateCondition(gjson.Parse(`"red"`), conditionStringEqual, "red")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeTrue())
+
+		firing, err = evaluateCondition(gjson.Parse(`"Red"`), conditionStringEqual, "red")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeFalse())
+
+		firing, err = evaluateCondition(gjson.Parse(`"green"`), conditionStringNotEqual, "red")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeTrue())
+
+		firing, err = evaluateCondition(gjson.Parse(`"red"`), conditionStringNotEqual, "red")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeFalse())
+	})
+
+	It("should compare the numbers and booleans as strings with the string operators", func() {
+		firing, err := evaluateCondition(gjson.Parse("5"), conditionStringEqual, "5")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeTrue())
+
+		firing, err = evaluateCondition(gjson.Parse("true"), conditionStringNotEqual, "true")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeFalse())
+	})
+
+	It("should fire with matches when the value matches the regular expression", func() {
+		firing, err := evaluateCondition(gjson.Parse(`"connection refused"`), conditionMatches, "refused|timeout")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeTrue())
+
+		firing, err = evaluateCondition(gjson.Parse(`"ok"`), conditionMatches, "refused|timeout")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeFalse())
+	})
+
+	It("should fire with notMatches when the value does not match the regular expression", func() {
+		firing, err := evaluateCondition(gjson.Parse(`"yellow"`), conditionNotMatches, "^(green|blue)$")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeTrue())
+
+		firing, err = evaluateCondition(gjson.Parse(`"green"`), conditionNotMatches, "^(green|blue)$")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(firing).To(BeFalse())
+	})
+
+	It("should fail with invalid regular expressions", func() {
+		_, err := evaluateCondition(gjson.Parse(`"error"`), conditionMatches, "(error")
+		Expect(err).To(MatchError(ContainSubstring("not a valid regular expression")))
+
+		_, err = evaluateCondition(gjson.Parse(`"error"`), conditionNotMatches, "[a-")
+		Expect(err).To(MatchError(ContainSubstring("not a valid regular expression")))
+	})
+})
+
+var _ = Describe("transitionRule", func() {
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	It("should go through the whole lifecycle of an alert", func() {
+		rule := &pools.Rule{State: RuleNormalState}
+
+		Expect(transitionRule(rule, true, start, time.Minute, time.Minute, 0)).To(Equal(ruleTransitionPendingFiring))
+		Expect(rule.State).To(Equal(RulePendingFiringState))
+		Expect(rule.FiringTime).To(Equal(start))
+
+		Expect(transitionRule(rule, true, start.Add(2*time.Minute), time.Minute, time.Minute, 0)).To(Equal(ruleTransitionFiring))
+		Expect(rule.State).To(Equal(RuleFiringState))
+
+		Expect(transitionRule(rule, false, start.Add(3*time.Minute), time.Minute, time.Minute, 0)).To(Equal(ruleTransitionPendingResolved))
+		Expect(rule.State).To(Equal(RulePendingResolvedState))
+		Expect(rule.ResolvingTime).To(Equal(start.Add(3 * time.Minute)))
+
+		Expect(transitionRule(rule, false, start.Add(5*time.Minute), time.Minute, time.Minute, 0)).To(Equal(ruleTransitionResolved))
+		Expect(rule.State).To(Equal(RuleNormalState))
+		Expect(rule.FiringTime.IsZero()).To(BeTrue())
+		Expect(rule.ResolvingTime.IsZero()).To(BeTrue())
+
+		Expect(transitionRule(rule, false, start.Add(6*time.Minute), time.Minute, time.Minute, 0)).To(Equal(ruleTransitionNormal))
+	})
+
+	It("should wait the for time again when the rule fires while resolving", func() {
+		rule := &pools.Rule{State: RuleNormalState}
+
+		transitionRule(rule, true, start, time.Minute, time.Minute, 0)
+		transitionRule(rule, true, start.Add(2*time.Minute), time.Minute, time.Minute, 0)
+		transitionRule(rule, false, start.Add(3*time.Minute), time.Minute, time.Minute, 0)
+
+		Expect(transitionRule(rule, true, start.Add(3*time.Minute+30*time.Second), time.Minute, time.Minute, 0)).To(Equal(ruleTransitionPendingFiring))
+		Expect(rule.FiringTime).To(Equal(start.Add(3*time.Minute + 30*time.Second)))
+
+		Expect(transitionRule(rule, true, start.Add(5*time.Minute), time.Minute, time.Minute, 0)).To(Equal(ruleTransitionFiring))
+	})
+
+	It("should resolve a pending rule that stops firing without notifying it", func() {
+		rule := &pools.Rule{State: RuleNormalState}
+
+		transitionRule(rule, true, start, time.Minute, time.Minute, 0)
+		Expect(transitionRule(rule, false, start.Add(30*time.Second), time.Minute, time.Minute, 0)).To(Equal(ruleTransitionPendingResolved))
+		Expect(transitionRule(rule, false, start.Add(2*time.Minute), time.Minute, time.Minute, 0)).To(Equal(ruleTransitionResolved))
+	})
+
+	It("should keep the rule in normal state during the cooldown", func() {
+		rule := &pools.Rule{State: RuleNormalState, ResolvedTime: start}
+
+		Expect(transitionRule(rule, true, start.Add(time.Minute), 0, 0, 5*time.Minute)).To(Equal(ruleTransitionCooldown))
+		Expect(rule.State).To(Equal(RuleNormalState))
+
+		Expect(transitionRule(rule, true, start.Add(6*time.Minute), 0, 0, 5*time.Minute)).To(Equal(ruleTransitionPendingFiring))
+	})
+})
+
+// syncCase is an evaluation of a rule against a fake Elasticsearch, which answers the responses in order
+type syncCase struct {
+	responses      []string
+	statusCode     int
+	backendDown    bool
+	expectError    bool
+	expectedReason string
+	expectedAlert  string
+	expectedEvents int
+}
+
+var _ = Describe("getHttpClient", func() {
+
+	var reconciler *SearchRuleReconciler
+
+	BeforeEach(func() {
+		reconciler = &SearchRuleReconciler{
+			HttpClientsPool: &pools.HttpClientsStore{Store: map[string]*pools.HttpClient{}},
+		}
+	})
+
+	It("should send the queries through the proxy of the QueryConnector", func() {
+		proxiedHost := make(chan string, 1)
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			proxiedHost <- req.Host
+		}))
+		defer proxy.Close()
+
+		httpClient, err := reconciler.getHttpClient(newTestQueryConnector(v1alpha1.QueryConnectorSpec{Proxy: proxy.URL}))
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := httpClient.Get("http://elasticsearch.example.invalid:9200/")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(proxiedHost).To(Receive(Equal("elasticsearch.example.invalid:9200")))
+	})
+
+	It("should identify the queries with the User-Agent of the QueryConnector", func() {
+		userAgents := make(chan string, 2)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			userAgents <- req.Header.Get("User-Agent")
+		}))
+		defer server.Close()
+
+		for _, userAgent := range []string{"", "auditing/1.0"} {
+			httpClient, err := reconciler.getHttpClient(newTestQueryConnector(v1alpha1.QueryConnectorSpec{UserAgent: userAgent}))
+			Expect(err).NotTo(HaveOccurred())
+			resp, err := httpClient.Get(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+		}
+		Expect(userAgents).To(Receive(Equal("searchruler/" + globals.Version)))
+		Expect(userAgents).To(Receive(Equal("auditing/1.0")))
+	})
+
+	It("should build the client again when the proxy changes", func() {
+		httpClient, err := reconciler.getHttpClient(newTestQueryConnector(v1alpha1.QueryConnectorSpec{}))
+		Expect(err).NotTo(HaveOccurred())
+		proxiedClient, err := reconciler.getHttpClient(newTestQueryConnector(v1alpha1.QueryConnectorSpec{Proxy: "http://proxy:3128"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxiedClient).NotTo(BeIdenticalTo(httpClient))
+	})
+
+	It("should fail with invalid proxy URLs", func() {
+		_, err := reconciler.getHttpClient(newTestQueryConnector(v1alpha1.QueryConnectorSpec{Proxy: "proxy:3128"}))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("getErrorBackoff", func() {
+
+	It("should double the requeue time of the rules failing in a row up to the max interval", func() {
+		reconciler := &SearchRuleReconciler{ErrorBackoffMaxInterval: 10 * time.Minute}
+		queryErr := fmt.Errorf("backend unreachable")
+
+		Expect(reconciler.getErrorBackoff("default/errors", time.Minute, queryErr)).To(Equal(time.Minute))
+		Expect(reconciler.getErrorBackoff("default/errors", time.Minute, queryErr)).To(Equal(2 * time.Minute))
+		Expect(reconciler.getErrorBackoff("default/errors", time.Minute, queryErr)).To(Equal(4 * time.Minute))
+		Expect(reconciler.getErrorBackoff("default/errors", time.Minute, queryErr)).To(Equal(8 * time.Minute))
+		Expect(reconciler.getErrorBackoff("default/errors", time.Minute, queryErr)).To(Equal(10 * time.Minute))
+
+		// Other rules keep their schedule, and the first success resets the backoff
+		Expect(reconciler.getErrorBackoff("default/healthy", time.Minute, nil)).To(Equal(time.Minute))
+		Expect(reconciler.getErrorBackoff("default/errors", time.Minute, nil)).To(Equal(time.Minute))
+		Expect(reconciler.getErrorBackoff("default/errors", time.Minute, queryErr)).To(Equal(time.Minute))
+	})
+
+	It("should not change the requeue time without backoff or above the max interval", func() {
+		reconciler := &SearchRuleReconciler{}
+		reconciler.getErrorBackoff("default/errors", time.Minute, fmt.Errorf("backend unreachable"))
+		Expect(reconciler.getErrorBackoff("default/errors", time.Minute, fmt.Errorf("backend unreachable"))).To(Equal(time.Minute))
+
+		reconciler.ErrorBackoffMaxInterval = time.Minute
+		Expect(reconciler.getErrorBackoff("default/errors", time.Hour, fmt.Errorf("backend unreachable"))).To(Equal(time.Hour))
+	})
+})
+
+var _ = Describe("getCheckInterval", func() {
+
+	now := time.Date(2024, time.March, 4, 12, 3, 20, 0, time.UTC)
+
+	DescribeTable("should return the time until the next check",
+		func(checkInterval string, now time.Time, expectedInterval time.Duration) {
+			interval, err := getCheckInterval(checkInterval, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(interval).To(Equal(expectedInterval))
+		},
+		Entry("duration", "30s", now, 30*time.Second),
+		Entry("cron expression aligned with the clock", "*/5 * * * *", now, time.Minute+40*time.Second),
+		Entry("cron expression at the time of the check", "*/5 * * * *", now.Add(time.Minute+40*time.Second), 5*time.Minute),
+		Entry("cron expression triggered slightly early", "*/5 * * * *", now.Add(time.Minute+39*time.Second+500*time.Millisecond),
+			5*time.Minute+500*time.Millisecond),
+		Entry("cron descriptor", "@hourly", now, 56*time.Minute+40*time.Second),
+		Entry("cron expression in a timezone", "CRON_TZ=Europe/Madrid 0 14 * * *", now, 56*time.Minute+40*time.Second),
+		Entry("cron expression on other day", "0 9 * * 1", now, 7*24*time.Hour-3*time.Hour-3*time.Minute-20*time.Second),
+	)
+
+	DescribeTable("should reject the invalid check intervals",
+		func(checkInterval string) {
+			_, err := getCheckInterval(checkInterval, now)
+			Expect(err).To(MatchError(ContainSubstring("error parsing `checkInterval`")))
+		},
+		Entry("unknown unit", "5 minutes"),
+		Entry("out of range minute", "61 * * * *"),
+		Entry("missing fields", "*/5 * *"),
+		Entry("cron expression with seconds", "0 */5 * * * *"),
+	)
+})
+
+var _ = Describe("parseNDJSONResponse", func() {
+
+	ndjson := "{\"hits\":{\"total\":{\"value\":1}}}\n\n{\"hits\":{\"total\":{\"value\":2}}}\n"
+
+	DescribeTable("should select the document of the ndjson responses",
+		func(response string, selection string, expected string) {
+			document, err := parseNDJSONResponse([]byte(response), selection)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(document)).To(Equal(expected))
+		},
+		Entry("first line", ndjson, ndjsonSelectFirst, `{"hits":{"total":{"value":1}}}`),
+		Entry("last line", ndjson, ndjsonSelectLast, `{"hits":{"total":{"value":2}}}`),
+		Entry("array of lines", ndjson, "", `[{"hits":{"total":{"value":1}}},{"hits":{"total":{"value":2}}}]`),
+		Entry("single pretty printed document", "{\n  \"value\": 1\n}\n", "", "[{\n  \"value\": 1\n}]"),
+	)
+
+	It("should fail with invalid lines", func() {
+		_, err := parseNDJSONResponse([]byte("{\"value\":1}\n<html>"), "")
+		Expect(err).To(MatchError(ContainSubstring("line 2")))
+
+		_, err = parseNDJSONResponse([]byte("\n"), "")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("getQueryHeaders", func() {
+
+	It("should evaluate the headers of the QueryConnector with the rule", func() {
+		resource := &v1alpha1.SearchRule{ObjectMeta: metav1.ObjectMeta{Name: "errors", Namespace: "default"}}
+		resource.Spec.Labels = map[string]string{"team": "payments"}
+		connector := newTestQueryConnector(v1alpha1.QueryConnectorSpec{Headers: map[string]string{
+			"X-Opaque-Id": `{{ .object.Namespace }}/{{ .object.Name }}`,
+			"X-Team":      `{{ .labels.team }}`,
+			"X-Static":    "static",
+		}})
+
+		headers, err := getQueryHeaders(resource, connector, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(Equal(map[string]string{"X-Opaque-Id": "default/errors", "X-Team": "payments", "X-Static": "static"}))
+
+		connector.Headers["X-Invalid"] = `{{ .labels.team `
+		_, err = getQueryHeaders(resource, connector, time.Now())
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("getQueryCacheKey", func() {
+
+	It("should not share the key between QueryConnectors, credentials or headers", func() {
+		creds := &pools.Credentials{Username: "tenant-a", Password: "secret"}
+		headers := map[string]string{"X-Scope-OrgID": "tenant-a"}
+		key := getQueryCacheKey("monitoring_elasticsearch", creds, headers, "http://elasticsearch/logs/_search", []byte(`{}`))
+
+		Expect(getQueryCacheKey("monitoring_elasticsearch", &pools.Credentials{Username: "tenant-a", Password: "secret"},
+			map[string]string{"X-Scope-OrgID": "tenant-a"}, "http://elasticsearch/logs/_search", []byte(`{}`))).To(Equal(key))
+		Expect(getQueryCacheKey("other_elasticsearch", creds, headers, "http://elasticsearch/logs/_search", []byte(`{}`))).NotTo(Equal(key))
+		Expect(getQueryCacheKey("monitoring_elasticsearch", &pools.Credentials{Username: "tenant-b", Password: "secret"},
+			headers, "http://elasticsearch/logs/_search", []byte(`{}`))).NotTo(Equal(key))
+		Expect(getQueryCacheKey("monitoring_elasticsearch", creds, map[string]string{"X-Scope-OrgID": "tenant-b"},
+			"http://elasticsearch/logs/_search", []byte(`{}`))).NotTo(Equal(key))
+	})
+})
+
+var _ = Describe("getActiveSilence", func() {
+
+	var reconciler *SearchRuleReconciler
+
+	newSilence := func(namespace, name string, selector metav1.LabelSelector, endsAt time.Time) *v1alpha1.Silence {
+		return &v1alpha1.Silence{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       v1alpha1.SilenceSpec{Selector: selector, EndsAt: metav1.NewTime(endsAt)},
+		}
+	}
+
+	newRule := func(namespace string, ruleLabels map[string]string) *v1alpha1.SearchRule {
+		return &v1alpha1.SearchRule{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "errors"},
+			Spec:       v1alpha1.SearchRuleSpec{Labels: ruleLabels},
+		}
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		backend := metav1.LabelSelector{MatchLabels: map[string]string{"team": "backend"}}
+		reconciler = &SearchRuleReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				newSilence("default", "maintenance", backend, time.Now().Add(time.Hour)),
+				newSilence("default", "expired", metav1.LabelSelector{MatchLabels: map[string]string{"team": "frontend"}},
+					time.Now().Add(-time.Hour)),
+				newSilence("default", "everything", metav1.LabelSelector{}, time.Now().Add(time.Hour)),
+				newSilence("searchruler", "cluster-maintenance", backend, time.Now().Add(time.Hour)),
+			).Build(),
+			ControllerNamespace: "searchruler",
+		}
+	})
+
+	It("should return the active silence matching the labels of the rule", func() {
+		silence, err := reconciler.getActiveSilence(context.Background(), newRule("default", map[string]string{"team": "backend"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(silence).NotTo(BeNil())
+		Expect(silence.Name).To(Equal("maintenance"))
+	})
+
+	It("should not return the expired silences", func() {
+		silence, err := reconciler.getActiveSilence(context.Background(), newRule("default", map[string]string{"team": "frontend"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(silence).To(BeNil())
+	})
+
+	It("should not match every rule with an empty selector", func() {
+		silence, err := reconciler.getActiveSilence(context.Background(), newRule("default", nil))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(silence).To(BeNil())
+	})
+
+	It("should not return the silences of other namespaces", func() {
+		silence, err := reconciler.getActiveSilence(context.Background(), newRule("payments", map[string]string{"team": "backend"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(silence).To(BeNil())
+	})
+
+	It("should silence the cluster rules with the silences of the namespace of the controller", func() {
+		silence, err := reconciler.getActiveSilence(context.Background(), newRule("", map[string]string{"team": "backend"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(silence).NotTo(BeNil())
+		Expect(silence.Name).To(Equal("cluster-maintenance"))
+
+		reconciler.ControllerNamespace = ""
+		silence, err = reconciler.getActiveSilence(context.Background(), newRule("", map[string]string{"team": "backend"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(silence).To(BeNil())
+	})
+})
+
+var _ = Describe("Sync", func() {
+
+	var (
+		server      *httptest.Server
+		responses   []string
+		statusCode  int
+		reconciler  *SearchRuleReconciler
+		resource    *v1alpha1.SearchRule
+		kubeClient  *kubefake.Clientset
+		connectorNs = "monitoring"
+
+		// connectorSpec is the spec of the QueryConnector, besides its URL
+		connectorSpec map[string]interface{}
+	)
+
+	// setupBackend points the QueryConnector of the rule to the URL of the fake Elasticsearch
+	setupBackend := func(url string) {
+		scheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		queryConnector := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": v1alpha1.GroupVersion.String(),
+			"kind":       "QueryConnector",
+			"metadata":   map[string]interface{}{"name": "elasticsearch", "namespace": connectorNs},
+			"spec":       map[string]interface{}{"url": url},
+		}}
+		for key, value := range connectorSpec {
+			queryConnector.Object["spec"].(map[string]interface{})[key] = value
+		}
+		globals.Application.KubeRawClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), queryConnector)
+		kubeClient = kubefake.NewSimpleClientset()
+
+		// The fake clientset does not generate names, so events would collide without this reactor
+		kubeClient.PrependReactor("create", "events", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			event := action.(clienttesting.CreateAction).GetObject().(*eventsv1.Event)
+			if event.Name == "" {
+				event.Name = event.GenerateName + rand.String(5)
+			}
+			return false, nil, nil
+		})
+		globals.Application.KubeRawCoreClient = kubeClient
+
+		reconciler = &SearchRuleReconciler{
+			Client:                        fake.NewClientBuilder().WithScheme(scheme).Build(),
+			Scheme:                        scheme,
+			QueryConnectorCredentialsPool: &pools.CredentialsStore{Store: map[string]*pools.Credentials{}},
+			RulesPool:                     &pools.RulesStore{Store: map[string]*pools.Rule{}},
+			AlertsPool:                    &pools.AlertsStore{Store: map[string]*pools.Alert{}},
+			QueryCachePool:                &pools.QueryCacheStore{Store: map[string]*pools.QueryCacheEntry{}},
+			HttpClientsPool:               &pools.HttpClientsStore{Store: map[string]*pools.HttpClient{}},
+		}
+	}
+
+	BeforeEach(func() {
+		responses = []string{}
+		statusCode = http.StatusOK
+		connectorSpec = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			response := responses[0]
+			if len(responses) > 1 {
+				responses = responses[1:]
+			}
+			w.WriteHeader(statusCode)
+			_, _ = w.Write([]byte(response))
+		}))
+		setupBackend(server.URL)
+
+		resource = &v1alpha1.SearchRule{
+			ObjectMeta: metav1.ObjectMeta{Name: "errors", Namespace: "default"},
+			Spec: v1alpha1.SearchRuleSpec{
+				QueryConnectorRef: v1alpha1.QueryConnectorRef{Name: "elasticsearch", Namespace: connectorNs},
+				CheckInterval:     "1m",
+				Elasticsearch: v1alpha1.Elasticsearch{
+					Index:          "logs",
+					ConditionField: "hits.total.value",
+					Query:          &apiextensionsv1.JSON{Raw: []byte(`{"size":0}`)},
+				},
+				Condition: v1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "5", For: "0s"},
+				ActionRef: v1alpha1.ActionRef{Name: "slack", Namespace: "default"},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	DescribeTable("should evaluate the rule against the backend",
+		func(c syncCase) {
+			responses = c.responses
+			if c.statusCode != 0 {
+				statusCode = c.statusCode
+			}
+			if c.backendDown {
+				server.Close()
+			}
+
+			var err error
+			for range c.responses {
+				err = reconciler.Sync(context.Background(), watch.Modified, resource)
+			}
+			reconciler.UpdateConditionReady(resource, err)
+			if c.expectError {
+				Expect(err).To(HaveOccurred())
+			} else {
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			condition := meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal(c.expectedReason))
+
+			// The rule is ready when it is evaluated, regardless of the state of the alert
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, globals.ConditionTypeReady)).To(Equal(!c.expectError))
+
+			alert, alertInPool := reconciler.AlertsPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+			if c.expectedAlert == "" {
+				Expect(alertInPool).To(BeFalse())
+			} else {
+				Expect(alertInPool).To(BeTrue())
+				Expect(alert.Status).To(Equal(c.expectedAlert))
+			}
+
+			events, err := kubeClient.EventsV1().Events(resource.Namespace).List(context.Background(), metav1.ListOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events.Items).To(HaveLen(c.expectedEvents))
+		},
+		Entry("normal", syncCase{
+			responses:      []string{`{"hits":{"total":{"value":1}}}`},
+			expectedReason: globals.ConditionReasonStateNormalType,
+		}),
+		Entry("pending firing", syncCase{
+			responses:      []string{`{"hits":{"total":{"value":10}}}`},
+			expectedReason: globals.ConditionReasonPendingAlertFiring,
+		}),
+		Entry("firing", syncCase{
+			responses:      []string{`{"hits":{"total":{"value":10}}}`, `{"hits":{"total":{"value":10}}}`},
+			expectedReason: globals.ConditionReasonAlertFiring,
+			expectedAlert:  pools.AlertStatusFiring,
+			expectedEvents: 1,
+		}),
+		Entry("resolving", syncCase{
+			responses: []string{`{"hits":{"total":{"value":10}}}`, `{"hits":{"total":{"value":10}}}`,
+				`{"hits":{"total":{"value":1}}}`, `{"hits":{"total":{"value":1}}}`},
+			expectedReason: globals.ConditionReasonStateNormalType,
+			expectedAlert:  pools.AlertStatusResolved,
+			expectedEvents: 2,
+		}),
+		Entry("missing conditionField", syncCase{
+			responses:      []string{`{"hits":{"hits":[]}}`},
+			expectError:    true,
+			expectedReason: globals.ConditionReasonConditionFieldNotFoundType,
+		}),
+		Entry("non 200 response", syncCase{
+			responses:      []string{`{"error":{"type":"index_not_found_exception"}}`},
+			statusCode:     http.StatusNotFound,
+			expectError:    true,
+			expectedReason: globals.ConditionReasonErrorResponseType,
+		}),
+		Entry("invalid JSON response", syncCase{
+			responses:      []string{`<html>Bad Gateway</html>`},
+			expectError:    true,
+			expectedReason: globals.ConditionReasonInvalidResponseType,
+		}),
+		Entry("HTML error page of a proxy", syncCase{
+			responses:      []string{`<html><head><title>502 Bad Gateway</title></head><body>nginx</body></html>`},
+			statusCode:     http.StatusBadGateway,
+			expectError:    true,
+			expectedReason: globals.ConditionReasonInvalidResponseType,
+		}),
+		Entry("backend down", syncCase{
+			responses:      []string{``},
+			backendDown:    true,
+			expectError:    true,
+			expectedReason: globals.ConditionReasonBackendUnreachableType,
+		}),
+	)
+
+	It("should resolve the firing alert after the max firing duration without a successful evaluation", func() {
+		resource.Spec.Condition.MaxFiringDuration = "1h"
+		responses = []string{`{"hits":{"total":{"value":10}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+
+		// The alert started firing 3 hours ago and the rule was last evaluated 2 hours ago
+		alertKey := pools.GetKey(resource.Namespace, resource.Name)
+		alert, _ := reconciler.AlertsPool.Get(alertKey)
+		alert.FiringTime = time.Now().Add(-3 * time.Hour)
+		resource.Status.LastEvaluationTime = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+
+		statusCode = http.StatusServiceUnavailable
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).NotTo(Succeed())
+
+		alert, alertInPool := reconciler.AlertsPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(alertInPool).To(BeTrue())
+		Expect(alert.Status).To(Equal(pools.AlertStatusResolved))
+		rule, _ := reconciler.RulesPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(rule.State).To(Equal(RuleNormalState))
+
+		events, err := kubeClient.EventsV1().Events(resource.Namespace).List(context.Background(), metav1.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events.Items).To(HaveLen(2))
+		Expect([]string{events.Items[0].Reason, events.Items[1].Reason}).To(ContainElement(kubeEventReasonAlertExpired))
+	})
+
+	It("should reject the QueryConnectors out of the watched namespaces", func() {
+		globals.Application.WatchNamespaces = []string{"default"}
+		defer func() { globals.Application.WatchNamespaces = nil }()
+		responses = []string{`{"hits":{"total":{"value":10}}}`}
+
+		err := reconciler.Sync(context.Background(), watch.Modified, resource)
+		Expect(err).To(MatchError(ContainSubstring("not watched")))
+		condition := meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState)
+		Expect(condition.Reason).To(Equal(globals.ConditionReasonQueryConnectorNotFoundType))
+
+		globals.Application.WatchNamespaces = []string{"default", connectorNs}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+	})
+
+	It("should keep the alert firing longer than the max firing duration on a transient error", func() {
+		resource.Spec.Condition.MaxFiringDuration = "1h"
+		responses = []string{`{"hits":{"total":{"value":10}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+
+		// The alert is firing for 3 hours, but the rule was evaluated successfully just now
+		alertKey := pools.GetKey(resource.Namespace, resource.Name)
+		alert, _ := reconciler.AlertsPool.Get(alertKey)
+		alert.FiringTime = time.Now().Add(-3 * time.Hour)
+
+		statusCode = http.StatusServiceUnavailable
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).NotTo(Succeed())
+
+		alert, alertInPool := reconciler.AlertsPool.Get(alertKey)
+		Expect(alertInPool).To(BeTrue())
+		Expect(alert.Status).To(Equal(pools.AlertStatusFiring))
+		rule, _ := reconciler.RulesPool.Get(alertKey)
+		Expect(rule.State).To(Equal(RuleFiringState))
+	})
+
+	It("should keep the firing alert when the rule can not be evaluated without max firing duration", func() {
+		responses = []string{`{"hits":{"total":{"value":10}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+
+		statusCode = http.StatusServiceUnavailable
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).NotTo(Succeed())
+
+		alert, alertInPool := reconciler.AlertsPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(alertInPool).To(BeTrue())
+		Expect(alert.Status).To(Equal(pools.AlertStatusFiring))
+	})
+
+	It("should cancel the request in flight when the queryTimeout expires", func() {
+		cancelled := make(chan struct{})
+		slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			// The body is read, so the server notices when the client closes the connection
+			_, _ = io.ReadAll(req.Body)
+			select {
+			case <-req.Context().Done():
+				close(cancelled)
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer slowServer.Close()
+		setupBackend(slowServer.URL)
+		resource.Spec.QueryTimeout = "100ms"
+
+		err := reconciler.Sync(context.Background(), watch.Modified, resource)
+		Expect(err).To(MatchError(ContainSubstring("query timeout of 100ms")))
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonQueryTimeoutType))
+		Eventually(cancelled).Should(BeClosed())
+	})
+
+	It("should count the consecutive failures of the query and set QueryFailing at the threshold", func() {
+		resource.Spec.FailureThreshold = 2
+		statusCode = http.StatusServiceUnavailable
+		responses = []string{`{}`}
+
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).NotTo(Succeed())
+		Expect(resource.Status.ConsecutiveFailures).To(Equal(1))
+		Expect(meta.IsStatusConditionFalse(resource.Status.Conditions, globals.ConditionTypeQueryFailing)).To(BeTrue())
+
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).NotTo(Succeed())
+		Expect(resource.Status.ConsecutiveFailures).To(Equal(2))
+		Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, globals.ConditionTypeQueryFailing)).To(BeTrue())
+		rule, _ := reconciler.RulesPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(rule.ConsecutiveFailures).To(Equal(2))
+
+		statusCode = http.StatusOK
+		responses = []string{`{"hits":{"total":{"value":1}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(resource.Status.ConsecutiveFailures).To(BeZero())
+		Expect(meta.IsStatusConditionFalse(resource.Status.Conditions, globals.ConditionTypeQueryFailing)).To(BeTrue())
+	})
+
+	It("should report the missing index when the index is checked", func() {
+		statusCode = http.StatusNotFound
+		responses = []string{`{"error":{"type":"index_not_found_exception"}}`}
+
+		err := reconciler.Sync(context.Background(), watch.Modified, resource)
+		Expect(err).To(HaveOccurred())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonErrorResponseType))
+
+		resource.Spec.Elasticsearch.CheckIndex = true
+		err = reconciler.Sync(context.Background(), watch.Modified, resource)
+		Expect(err).To(MatchError(ContainSubstring("index logs not found")))
+		condition := meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState)
+		Expect(condition.Reason).To(Equal(globals.ConditionReasonIndexNotFoundType))
+		Expect(condition.Message).To(ContainSubstring("logs"))
+	})
+
+	It("should evaluate the percentage change of the value with the changeOperator", func() {
+		resource.Spec.Condition = v1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "50", For: "0s",
+			ChangeOperator: changeOperatorPercent, ChangeIntervals: 2}
+
+		// There is no value to compare with in the first evaluations
+		responses = []string{`{"hits":{"total":{"value":100}}}`, `{"hits":{"total":{"value":120}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonNoDataType))
+		Expect(resource.Status.LastValue).To(Equal("120"))
+
+		// 140 is a 40% increase over the value of two evaluations ago
+		responses = []string{`{"hits":{"total":{"value":140}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonStateNormalType))
+
+		// 190 is a 58% increase over the value of two evaluations ago
+		responses = []string{`{"hits":{"total":{"value":190}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonPendingAlertFiring))
+		Expect(resource.Status.LastValue).To(Equal("190"))
+
+		rule, _ := reconciler.RulesPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(rule.History.Len()).To(Equal(4))
+	})
+
+	It("should requeue the rules failing in a row with backoff", func() {
+		elected := make(chan struct{})
+		close(elected)
+		reconciler.Elected = elected
+		reconciler.ErrorBackoffMaxInterval = 10 * time.Minute
+		reconciler.Client = fake.NewClientBuilder().WithScheme(reconciler.Scheme).
+			WithObjects(resource).WithStatusSubresource(resource).Build()
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: resource.Namespace, Name: resource.Name}}
+
+		// Failed evaluations are reported in the status, so the RequeueAfter is not ignored by controller-runtime
+		statusCode = http.StatusInternalServerError
+		responses = []string{`{}`}
+		for _, requeueAfter := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+			result, err := reconciler.Reconcile(context.Background(), request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(requeueAfter))
+		}
+
+		updated := &v1alpha1.SearchRule{}
+		Expect(reconciler.Get(context.Background(), request.NamespacedName, updated)).To(Succeed())
+		Expect(meta.IsStatusConditionFalse(updated.Status.Conditions, globals.ConditionTypeReady)).To(BeTrue())
+
+		// The first success restores the check interval
+		statusCode = http.StatusOK
+		responses = []string{`{"hits":{"total":{"value":1}}}`}
+		result, err := reconciler.Reconcile(context.Background(), request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Minute))
+	})
+
+	It("should not touch the rules pool in dry-run mode", func() {
+		resource.Annotations = map[string]string{controller.DryRunAnnotation: "true"}
+		resource.Spec.Condition = v1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "50", For: "0s",
+			ChangeOperator: changeOperatorPercent}
+
+		// Failing queries are counted in the status
+		statusCode = http.StatusInternalServerError
+		responses = []string{`{}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).NotTo(Succeed())
+		Expect(resource.Status.ConsecutiveFailures).To(Equal(1))
+
+		// The values are compared with the history of the pool, without saving them
+		statusCode = http.StatusOK
+		history := pools.History{}
+		history.Add(pools.Sample{Time: time.Now(), Value: 100})
+		reconciler.setRuleHistory(resource, history)
+		responses = []string{`{"hits":{"total":{"value":160}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(resource.Status.ConsecutiveFailures).To(BeZero())
+		Expect(resource.Status.DryRun.Firing).To(BeTrue())
+		Expect(resource.Status.DryRun.Value).To(Equal("160"))
+
+		rule, _ := reconciler.RulesPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(rule.History.Len()).To(Equal(1))
+		Expect(rule.ConsecutiveFailures).To(BeZero())
+		Expect(rule.State).To(Equal(RuleNormalState))
+		_, alertInPool := reconciler.AlertsPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(alertInPool).To(BeFalse())
+	})
+
+	It("should not add the rules to the pool in dry-run mode", func() {
+		resource.Annotations = map[string]string{controller.DryRunAnnotation: "true"}
+
+		responses = []string{`{"hits":{"total":{"value":10}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(resource.Status.DryRun.Firing).To(BeTrue())
+
+		_, ruleInPool := reconciler.RulesPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(ruleInPool).To(BeFalse())
+	})
+
+	It("should not save the values of the string operators in the history", func() {
+		resource.Spec.Elasticsearch.ConditionField = "hits.hits.0._source.status"
+		resource.Spec.Condition = v1alpha1.Condition{Operator: conditionStringEqual, Threshold: "failed", For: "0s"}
+
+		responses = []string{`{"hits":{"hits":[{"_source":{"status":"failed"}}]}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(resource.Status.LastValue).To(Equal("failed"))
+
+		rule, ruleInPool := reconciler.RulesPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(ruleInPool).To(BeTrue())
+		Expect(rule.History.Len()).To(BeZero())
+	})
+
+	It("should evaluate the difference of the value with the delta changeOperator", func() {
+		resource.Spec.Condition = v1alpha1.Condition{Operator: conditionLessThan, Threshold: "-10", For: "0s",
+			ChangeOperator: changeOperatorDelta}
+
+		responses = []string{`{"hits":{"total":{"value":100}}}`, `{"hits":{"total":{"value":80}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonPendingAlertFiring))
+	})
+
+	It("should evaluate the moving average of the value with smoothingSamples", func() {
+		resource.Spec.Condition.SmoothingSamples = 3
+
+		// A single spike over the threshold does not fire the rule
+		responses = []string{`{"hits":{"total":{"value":1}}}`, `{"hits":{"total":{"value":1}}}`, `{"hits":{"total":{"value":10}}}`}
+		for range responses {
+			Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		}
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonStateNormalType))
+		Expect(resource.Status.LastValue).To(Equal("10"))
+		Expect(resource.Status.LastSmoothedValue).To(Equal("4"))
+
+		// The average of the last 3 values is over the threshold
+		responses = []string{`{"hits":{"total":{"value":10}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonPendingAlertFiring))
+		Expect(resource.Status.LastSmoothedValue).To(Equal("7"))
+	})
+
+	It("should fire absent rules since the last time the data was seen", func() {
+		resource.Spec.Condition = v1alpha1.Condition{Operator: conditionLessThanOrEqual, Threshold: "0", For: "1h", Absent: true}
+
+		// The data is seen, so the time is saved in the status
+		responses = []string{`{"hits":{"total":{"value":10}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(resource.Status.LastSeenTime.IsZero()).To(BeFalse())
+
+		// The data is missing after a restart of the controller, so the time is restored from the status
+		reconciler.RulesPool.Delete(pools.GetKey(resource.Namespace, resource.Name))
+		resource.Status.LastSeenTime = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+		responses = []string{`{"hits":{"total":{"value":0}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonAlertFiring))
+
+		// Rules not absent start firing since the first firing evaluation
+		resource.Spec.Condition.Absent = false
+		reconciler.RulesPool.Delete(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonPendingAlertFiring))
+		Expect(resource.Status.LastSeenTime.IsZero()).To(BeTrue())
+	})
+
+	It("should not fire absent rules before the for duration without previous evaluations", func() {
+		resource.Spec.Condition = v1alpha1.Condition{Operator: conditionLessThanOrEqual, Threshold: "0", For: "1h", Absent: true}
+		responses = []string{`{"hits":{"total":{"value":0}}}`}
+
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonPendingAlertFiring))
+		Expect(time.Since(resource.Status.LastSeenTime.Time)).To(BeNumerically("<", time.Minute))
+	})
+
+	It("should surface the team of the rule in the events of the alerts", func() {
+		resource.Labels = map[string]string{controller.TeamLabel: "payments"}
+		Expect(ValidateTeam(resource)).To(Succeed())
+
+		responses = []string{`{"hits":{"total":{"value":10}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+
+		events, err := kubeClient.EventsV1().Events(resource.Namespace).List(context.Background(), metav1.ListOptions{
+			LabelSelector: controller.TeamLabel + "=payments",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events.Items).To(HaveLen(1))
+		Expect(events.Items[0].Note).To(HaveSuffix("Team is payments"))
+
+		resource.Labels = nil
+		Expect(ValidateTeam(resource)).To(HaveOccurred())
+	})
+
+	It("should check the resolution of the firing alerts with the resolve query", func() {
+		resource.Spec.Elasticsearch.ResolveQuery = &apiextensionsv1.JSON{Raw: []byte(`{"size":1}`)}
+		resource.Spec.Elasticsearch.ResolveConditionField = "health.errors"
+
+		// The firing query is evaluated until the alert fires
+		responses = []string{`{"hits":{"total":{"value":10}},"health":{"errors":1}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonPendingAlertFiring))
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonAlertFiring))
+
+		// Then the resolve query is evaluated, which resolves the alert although the firing query keeps firing
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonStateNormalType))
+		alert, alertInPool := reconciler.AlertsPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(alertInPool).To(BeTrue())
+		Expect(alert.Status).To(Equal(pools.AlertStatusResolved))
+		Expect(alert.Query).To(Equal(`{"size":1}`))
+
+		// The firing query is evaluated again once resolved
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonPendingAlertFiring))
+	})
+
+	It("should enter the NoData state without evaluating the condition below the minDocCount", func() {
+		resource.Spec.Elasticsearch.MinDocCount = 5
+		resource.Spec.Elasticsearch.ConditionField = "aggregations.errors.value"
+		resource.Spec.Condition = v1alpha1.Condition{Operator: conditionLessThan, Threshold: "1", For: "0s"}
+		responses = []string{`{"hits":{"total":{"value":0}}}`}
+
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonNoDataType))
+		Expect(reconciler.AlertsPool.GetAll()).To(BeEmpty())
+
+		responses = []string{`{"hits":{"total":{"value":10}},"aggregations":{"errors":{"value":0}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonPendingAlertFiring))
+	})
+
+	DescribeTable("should evaluate the rule following the noDataPolicy below the minDocCount",
+		func(noDataPolicy string, expectedAlert string) {
+			resource.Spec.Elasticsearch.MinDocCount = 5
+			resource.Spec.Condition.NoDataPolicy = noDataPolicy
+
+			// Fire the alert with data, then lose the data
+			responses = []string{`{"hits":{"total":{"value":10}}}`}
+			Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+			Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+
+			responses = []string{`{"hits":{"total":{"value":0}}}`}
+			Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+			Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+			Expect(resource.Status.LastValue).To(Equal("10"))
+
+			alert, alertInPool := reconciler.AlertsPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+			Expect(alertInPool).To(BeTrue())
+			Expect(alert.Status).To(Equal(expectedAlert))
+		},
+		Entry("keep by default", "", pools.AlertStatusFiring),
+		Entry("keep", noDataPolicyKeep, pools.AlertStatusFiring),
+		Entry("firing", noDataPolicyFiring, pools.AlertStatusFiring),
+		Entry("resolved", noDataPolicyResolved, pools.AlertStatusResolved),
+	)
+
+	It("should fire and resolve every bucket separately in buckets mode", func() {
+		resource.Spec.Elasticsearch.ConditionField = "aggregations.services.buckets"
+		resource.Spec.Condition.Buckets = &v1alpha1.Buckets{ValueField: "doc_count", Label: "service"}
+		bucketsResponse := func(api, web int) string {
+			return fmt.Sprintf(`{"aggregations":{"services":{"buckets":[{"key":"api","doc_count":%d},{"key":"web","doc_count":%d}]}}}`, api, web)
+		}
+
+		responses = []string{bucketsResponse(10, 1)}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(resource.Status.LastValue).To(Equal("1/2 buckets"))
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonAlertFiring))
+
+		apiAlert, alertInPool := reconciler.AlertsPool.Get(getBucketAlertKey(resource, "api"))
+		Expect(alertInPool).To(BeTrue())
+		Expect(apiAlert.Status).To(Equal(pools.AlertStatusFiring))
+		Expect(apiAlert.Labels).To(HaveKeyWithValue("service", "api"))
+		_, alertInPool = reconciler.AlertsPool.Get(getBucketAlertKey(resource, "web"))
+		Expect(alertInPool).To(BeFalse())
+
+		// The api bucket is resolved when it is missing in the response, while the web bucket starts firing
+		responses = []string{`{"aggregations":{"services":{"buckets":[{"key":"web","doc_count":20}]}}}`}
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+
+		apiAlert, _ = reconciler.AlertsPool.Get(getBucketAlertKey(resource, "api"))
+		Expect(apiAlert.Status).To(Equal(pools.AlertStatusResolved))
+		webAlert, _ := reconciler.AlertsPool.Get(getBucketAlertKey(resource, "web"))
+		Expect(webAlert.Status).To(Equal(pools.AlertStatusFiring))
+
+		rule, _ := reconciler.RulesPool.Get(pools.GetKey(resource.Namespace, resource.Name))
+		Expect(rule.State).To(Equal(RuleFiringState))
+		Expect(rule.Buckets).To(HaveKey("web"))
+		Expect(rule.Buckets).NotTo(HaveKey("api"))
+
+		// Deleting the rule removes the alerts of all its buckets
+		Expect(reconciler.Sync(context.Background(), watch.Deleted, resource)).To(Succeed())
+		Expect(reconciler.AlertsPool.GetAll()).To(BeEmpty())
+	})
+
+	It("should fail in buckets mode when the conditionField is not a list of buckets", func() {
+		resource.Spec.Condition.Buckets = &v1alpha1.Buckets{ValueField: "doc_count"}
+		responses = []string{`{"hits":{"total":{"value":10}}}`}
+
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).NotTo(Succeed())
+		Expect(meta.FindStatusCondition(resource.Status.Conditions, globals.ConditionTypeState).Reason).
+			To(Equal(globals.ConditionReasonInvalidBucketsType))
+	})
+
+	It("should request compressed responses and decompress them", func() {
+		server.Close()
+		acceptEncoding := ""
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			acceptEncoding = req.Header.Get("Accept-Encoding")
+			w.Header().Set("Content-Encoding", "gzip")
+			writer := gzip.NewWriter(w)
+			_, _ = writer.Write([]byte(`{"hits":{"total":{"value":42}}}`))
+			_ = writer.Close()
+		}))
+		setupBackend(server.URL)
+
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(acceptEncoding).To(Equal("gzip"))
+		Expect(resource.Status.LastValue).To(Equal("42"))
+	})
+
+	It("should read plain responses when the backend does not honor the compression", func() {
+		responses = []string{`{"hits":{"total":{"value":42}}}`}
+
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(resource.Status.LastValue).To(Equal("42"))
+	})
+
+	It("should batch the queries of the rules of the same QueryConnector in a single _msearch", func() {
+		server.Close()
+		paths := []string{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			paths = append(paths, req.URL.Path)
+			_, _ = w.Write([]byte(`{"responses":[
+				{"hits":{"total":{"value":1}},"status":200},
+				{"hits":{"total":{"value":10}},"status":200}
+			]}`))
+		}))
+		setupBackend(server.URL)
+		reconciler.MsearchWindow = time.Minute
+
+		// Rules with the same query share the response, so the other rule needs its own query
+		other := resource.DeepCopy()
+		other.Name = "warnings"
+		other.Spec.Elasticsearch.Query = &apiextensionsv1.JSON{Raw: []byte(`{"size":0,"query":{"term":{"level":"warning"}}}`)}
+		reconciler.RulesPool.Set(pools.GetKey(other.Namespace, other.Name), &pools.Rule{SearchRule: *other, State: RuleNormalState})
+
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, other)).To(Succeed())
+		Expect(paths).To(Equal([]string{"/_msearch"}))
+		Expect(resource.Status.LastValue).To(Equal("1"))
+		Expect(other.Status.LastValue).To(Equal("10"))
+	})
+
+	It("should not batch the queries of the rules with different headers", func() {
+		server.Close()
+		requests := []string{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests = append(requests, req.URL.Path+" "+req.Header.Get("X-Scope-OrgID"))
+			_, _ = w.Write([]byte(`{"hits":{"total":{"value":1}}}`))
+		}))
+		connectorSpec = map[string]interface{}{"headers": map[string]interface{}{"X-Scope-OrgID": "{{ .labels.tenant }}"}}
+		setupBackend(server.URL)
+		reconciler.MsearchWindow = time.Minute
+
+		resource.Spec.Labels = map[string]string{"tenant": "payments"}
+		other := resource.DeepCopy()
+		other.Name = "warnings"
+		other.Spec.Labels = map[string]string{"tenant": "billing"}
+		other.Spec.Elasticsearch.Query = &apiextensionsv1.JSON{Raw: []byte(`{"size":0,"query":{"term":{"level":"warning"}}}`)}
+		reconciler.RulesPool.Set(pools.GetKey(other.Namespace, other.Name), &pools.Rule{SearchRule: *other, State: RuleNormalState})
+
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, other)).To(Succeed())
+		Expect(requests).To(Equal([]string{"/logs/_search payments", "/logs/_search billing"}))
+	})
+
+	It("should not share the cached responses of the rules with different headers", func() {
+		server.Close()
+		requests := 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests++
+			_, _ = w.Write([]byte(`{"hits":{"total":{"value":1}}}`))
+		}))
+		connectorSpec = map[string]interface{}{
+			"cacheTTL": "1m",
+			"headers":  map[string]interface{}{"X-Scope-OrgID": "{{ .labels.tenant }}"},
+		}
+		setupBackend(server.URL)
+
+		resource.Spec.Labels = map[string]string{"tenant": "payments"}
+		other := resource.DeepCopy()
+		other.Name = "warnings"
+		other.Spec.Labels = map[string]string{"tenant": "billing"}
+
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(reconciler.Sync(context.Background(), watch.Modified, other)).To(Succeed())
+		Expect(requests).To(Equal(2))
+
+		// The same tenant shares the cached response
+		Expect(reconciler.Sync(context.Background(), watch.Modified, resource)).To(Succeed())
+		Expect(requests).To(Equal(2))
+	})
+})
@@ -0,0 +1,168 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+)
+
+// ValidateSearchRule checks the configuration of the SearchRule which would fail at reconcile time: durations,
+// operators, thresholds, active windows and queries. All the errors found are returned together
+func ValidateSearchRule(resource *v1alpha1.SearchRule) error {
+
+	errs := []error{}
+
+	// Validate the durations of the rule
+	_, err := getCheckInterval(resource.Spec.CheckInterval, time.Now())
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	_, err = time.ParseDuration(resource.Spec.Condition.For)
+	if err != nil {
+		errs = append(errs, fmt.Errorf(controller.ForValueParseErrorMessage, err))
+	}
+
+	optionalDurations := []struct {
+		value        string
+		errorMessage string
+	}{
+		{resource.Spec.CheckJitter, controller.CheckJitterParseErrorMessage},
+		{resource.Spec.QueryTimeout, controller.QueryTimeoutParseErrorMessage},
+		{resource.Spec.Condition.ResolveFor, controller.ResolveForValueParseErrorMessage},
+		{resource.Spec.Condition.Cooldown, controller.CooldownValueParseErrorMessage},
+		{resource.Spec.Condition.MaxFiringDuration, controller.MaxFiringDurationParseErrorMessage},
+		{resource.Spec.Loki.Range, controller.LokiRangeParseErrorMessage},
+	}
+	for _, duration := range optionalDurations {
+		if duration.value == "" {
+			continue
+		}
+		_, err = time.ParseDuration(duration.value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf(duration.errorMessage, err))
+		}
+	}
+
+	// Validate the operator and the threshold of the condition
+	err = validateCondition(resource.Spec.Condition)
+	if err != nil {
+		errs = append(errs, fmt.Errorf(controller.EvaluatingConditionErrorMessage, err))
+	}
+
+	// The values of the resolve query are not tracked across evaluations like the values of the query
+	condition := resource.Spec.Condition
+	if hasResolveQuery(resource) && (condition.Buckets != nil || condition.ChangeOperator != "" || condition.SmoothingSamples > 0) {
+		errs = append(errs, errors.New(controller.ResolveQueryNotSupportedErrorMessage))
+	}
+
+	// Validate the active windows of the rule
+	_, err = isRuleActive(resource.Spec.ActiveWindows, time.Now())
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// Validate the queries of the rule
+	if getElasticsearchQuerySources(resource.Spec.Elasticsearch) > 1 {
+		errs = append(errs, fmt.Errorf(controller.QueryDefinedInBothErrorMessage, resource.Name))
+	}
+	baseline := resource.Spec.Elasticsearch.Baseline
+	if baseline.Query != nil && baseline.QueryJSON != "" {
+		errs = append(errs, fmt.Errorf(controller.BaselineQueryNotDefinedErrorMessage, resource.Name))
+	}
+	if resource.Spec.Elasticsearch.SearchPath != "" {
+		err = validateSearchPath(resource.Spec.Elasticsearch.SearchPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf(controller.SearchPathInvalidErrorMessage, resource.Spec.Elasticsearch.SearchPath, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateTeam checks that the rule declares the team owning it in the team label, so its
+// notifications can be routed to the team
+func ValidateTeam(resource *v1alpha1.SearchRule) error {
+	if getRuleTeam(resource) == "" {
+		return fmt.Errorf(controller.TeamLabelMissingErrorMessage, controller.TeamLabel)
+	}
+	return nil
+}
+
+// validateCondition checks that the operator of the condition is known and the threshold is valid for it
+func validateCondition(condition v1alpha1.Condition) error {
+
+	// The change of the value is numeric, and it is not tracked for every bucket
+	if condition.ChangeOperator != "" {
+		if isStringOperator(condition.Operator) {
+			return fmt.Errorf("changeOperator can not be used with the string operator %q", condition.Operator)
+		}
+		if condition.Buckets != nil {
+			return fmt.Errorf("changeOperator can not be used with buckets")
+		}
+		if condition.SmoothingSamples > 0 {
+			return fmt.Errorf("changeOperator can not be used with smoothingSamples")
+		}
+	}
+
+	// The last time the data was seen is not tracked for every bucket
+	if condition.Absent && condition.Buckets != nil {
+		return fmt.Errorf("absent can not be used with buckets")
+	}
+
+	// The moving average of the value is numeric, and it is not tracked for every bucket
+	if condition.SmoothingSamples > 0 {
+		if isStringOperator(condition.Operator) {
+			return fmt.Errorf("smoothingSamples can not be used with the string operator %q", condition.Operator)
+		}
+		if condition.Buckets != nil {
+			return fmt.Errorf("smoothingSamples can not be used with buckets")
+		}
+	}
+
+	switch condition.Operator {
+	case conditionGreaterThan, conditionGreaterThanOrEqual, conditionLessThan, conditionLessThanOrEqual,
+		conditionEqual, conditionNotEqual:
+		_, err := strconv.ParseFloat(condition.Threshold, 64)
+		if err != nil {
+			return fmt.Errorf("configured threshold is not a valid float: %v", condition.Threshold)
+		}
+	case conditionInsideRange, conditionOutsideRange:
+		_, err := isInsideRange(0, condition.Threshold)
+		if err != nil {
+			return err
+		}
+	case conditionMatches, conditionNotMatches:
+		_, err := regexp.Compile(condition.Threshold)
+		if err != nil {
+			return fmt.Errorf("configured threshold is not a valid regular expression: %v", condition.Threshold)
+		}
+	case conditionStringEqual, conditionStringNotEqual:
+	default:
+		return fmt.Errorf("unknown configured operator: %q", condition.Operator)
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+)
+
+var _ = Describe("ValidateSearchRule", func() {
+
+	newSearchRule := func() *v1alpha1.SearchRule {
+		return &v1alpha1.SearchRule{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "errors"},
+			Spec: v1alpha1.SearchRuleSpec{
+				CheckInterval: "1m",
+				Condition:     v1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "5", For: "1m"},
+			},
+		}
+	}
+	query := &apiextensionsv1.JSON{Raw: []byte(`{"size":0}`)}
+
+	It("should accept a valid rule", func() {
+		Expect(ValidateSearchRule(newSearchRule())).To(Succeed())
+	})
+
+	It("should accept a rule with a cron checkInterval", func() {
+		searchRule := newSearchRule()
+		searchRule.Spec.CheckInterval = "*/5 * * * *"
+		Expect(ValidateSearchRule(searchRule)).To(Succeed())
+	})
+
+	DescribeTable("should reject the invalid rules",
+		func(mutate func(searchRule *v1alpha1.SearchRule), expectedError string) {
+			searchRule := newSearchRule()
+			mutate(searchRule)
+			Expect(ValidateSearchRule(searchRule)).To(MatchError(ContainSubstring(expectedError)))
+		},
+		Entry("invalid checkInterval", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.CheckInterval = "often"
+		}, "error parsing `checkInterval` often"),
+		Entry("invalid for", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Condition.For = "forever"
+		}, "error parsing `for` time"),
+		Entry("invalid checkJitter", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.CheckJitter = "1 minute"
+		}, "error parsing `checkJitter` time"),
+		Entry("invalid queryTimeout", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.QueryTimeout = "10"
+		}, "error parsing `queryTimeout` time"),
+		Entry("invalid resolveFor", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Condition.ResolveFor = "soon"
+		}, "error parsing `resolveFor` time"),
+		Entry("invalid cooldown", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Condition.Cooldown = "later"
+		}, "error parsing `cooldown` time"),
+		Entry("invalid maxFiringDuration", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Condition.MaxFiringDuration = "1 day"
+		}, "error parsing `maxFiringDuration` time"),
+		Entry("invalid loki range", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Loki.Range = "5"
+		}, "error parsing loki `range` time"),
+		Entry("invalid condition", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Condition.Operator = "greater"
+		}, "error evaluating condition"),
+		Entry("resolveQuery with buckets", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Elasticsearch.ResolveQuery = query
+			searchRule.Spec.Condition.Buckets = &v1alpha1.Buckets{ValueField: "doc_count"}
+		}, "resolveQuery can not be used"),
+		Entry("resolveQuery with changeOperator", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Prometheus.ResolveQuery = "up == 1"
+			searchRule.Spec.Condition.ChangeOperator = changeOperatorDelta
+		}, "resolveQuery can not be used"),
+		Entry("resolveQuery with smoothingSamples", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Loki.ResolveQuery = `count_over_time({app="api"}[5m])`
+			searchRule.Spec.Condition.SmoothingSamples = 3
+		}, "resolveQuery can not be used"),
+		Entry("invalid active window", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.ActiveWindows = []v1alpha1.ActiveWindow{{Start: "25:00"}}
+		}, "error parsing active window 0"),
+		Entry("invalid active window timezone", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.ActiveWindows = []v1alpha1.ActiveWindow{{Timezone: "Mars/Olympus"}}
+		}, "error parsing active window 0"),
+		Entry("query and queryJSON", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Elasticsearch.Query = query
+			searchRule.Spec.Elasticsearch.QueryJSON = `{"size":0}`
+		}, "more than one of query, queryJSON or queryConfigMapRef"),
+		Entry("query and queryConfigMapRef", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Elasticsearch.Query = query
+			searchRule.Spec.Elasticsearch.QueryConfigMapRef = &v1alpha1.QueryConfigMapRef{Name: "queries", Key: "errors"}
+		}, "more than one of query, queryJSON or queryConfigMapRef"),
+		Entry("baseline query and queryJSON", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Elasticsearch.Baseline.Query = query
+			searchRule.Spec.Elasticsearch.Baseline.QueryJSON = `{"size":0}`
+		}, "baseline query not defined or defined in both"),
+		Entry("searchPath without index placeholder", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Elasticsearch.SearchPath = "/logs/_search"
+		}, "invalid elasticsearch search path"),
+		Entry("searchPath with several index placeholders", func(searchRule *v1alpha1.SearchRule) {
+			searchRule.Spec.Elasticsearch.SearchPath = "/{index}/{index}/_search"
+		}, "invalid elasticsearch search path"),
+	)
+
+	It("should return all the errors found together", func() {
+		searchRule := newSearchRule()
+		searchRule.Spec.CheckInterval = "often"
+		searchRule.Spec.Condition.For = "forever"
+
+		err := ValidateSearchRule(searchRule)
+		Expect(err).To(MatchError(ContainSubstring("error parsing `checkInterval`")))
+		Expect(err).To(MatchError(ContainSubstring("error parsing `for` time")))
+	})
+})
+
+var _ = Describe("validateCondition", func() {
+
+	DescribeTable("should accept the valid conditions",
+		func(condition v1alpha1.Condition) {
+			Expect(validateCondition(condition)).To(Succeed())
+		},
+		Entry("numeric operator", v1alpha1.Condition{Operator: conditionLessThanOrEqual, Threshold: "-1.5"}),
+		Entry("range operator", v1alpha1.Condition{Operator: conditionOutsideRange, Threshold: "[10, 20)"}),
+		Entry("regex operator", v1alpha1.Condition{Operator: conditionNotMatches, Threshold: "^(ok|green)$"}),
+		Entry("string operator with any threshold", v1alpha1.Condition{Operator: conditionStringEqual, Threshold: "[green"}),
+		Entry("changeOperator with a numeric operator",
+			v1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "50", ChangeOperator: changeOperatorPercent}),
+		Entry("smoothingSamples with a numeric operator",
+			v1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "50", SmoothingSamples: 3}),
+		Entry("absent without buckets", v1alpha1.Condition{Operator: conditionLessThanOrEqual, Threshold: "0", Absent: true}),
+	)
+
+	DescribeTable("should reject the invalid conditions",
+		func(condition v1alpha1.Condition, expectedError string) {
+			Expect(validateCondition(condition)).To(MatchError(ContainSubstring(expectedError)))
+		},
+		Entry("unknown operator", v1alpha1.Condition{Operator: "greater", Threshold: "5"},
+			`unknown configured operator: "greater"`),
+		Entry("empty operator", v1alpha1.Condition{Threshold: "5"},
+			`unknown configured operator: ""`),
+		Entry("numeric operator with a non numeric threshold", v1alpha1.Condition{Operator: conditionEqual, Threshold: "five"},
+			"configured threshold is not a valid float"),
+		Entry("range operator without brackets", v1alpha1.Condition{Operator: conditionInsideRange, Threshold: "10,20"},
+			"configured threshold is not a valid range"),
+		Entry("range operator with a single bound", v1alpha1.Condition{Operator: conditionInsideRange, Threshold: "[10]"},
+			"configured threshold is not a valid range"),
+		Entry("regex operator with an invalid regex", v1alpha1.Condition{Operator: conditionMatches, Threshold: "(error"},
+			"configured threshold is not a valid regular expression"),
+		Entry("changeOperator with a string operator",
+			v1alpha1.Condition{Operator: conditionStringEqual, Threshold: "red", ChangeOperator: changeOperatorDelta},
+			"changeOperator can not be used with the string operator"),
+		Entry("changeOperator with a regex operator",
+			v1alpha1.Condition{Operator: conditionMatches, Threshold: "red", ChangeOperator: changeOperatorDelta},
+			"changeOperator can not be used with the string operator"),
+		Entry("changeOperator with buckets",
+			v1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "5", ChangeOperator: changeOperatorDelta,
+				Buckets: &v1alpha1.Buckets{ValueField: "doc_count"}},
+			"changeOperator can not be used with buckets"),
+		Entry("changeOperator with smoothingSamples",
+			v1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "5", ChangeOperator: changeOperatorDelta, SmoothingSamples: 3},
+			"changeOperator can not be used with smoothingSamples"),
+		Entry("absent with buckets",
+			v1alpha1.Condition{Operator: conditionLessThanOrEqual, Threshold: "0", Absent: true,
+				Buckets: &v1alpha1.Buckets{ValueField: "doc_count"}},
+			"absent can not be used with buckets"),
+		Entry("smoothingSamples with a string operator",
+			v1alpha1.Condition{Operator: conditionStringNotEqual, Threshold: "green", SmoothingSamples: 3},
+			"smoothingSamples can not be used with the string operator"),
+		Entry("smoothingSamples with buckets",
+			v1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "5", SmoothingSamples: 3,
+				Buckets: &v1alpha1.Buckets{ValueField: "doc_count"}},
+			"smoothingSamples can not be used with buckets"),
+	)
+})
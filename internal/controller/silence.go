@@ -0,0 +1,92 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	//
+	"prosimcorp.com/SearchRuler/api/v1alpha1"
+)
+
+// GetSilencesNamespace returns the namespace of the Silences muting the SearchRule. SearchRules are muted by the
+// Silences of their own namespace, and ClusterSearchRules by the Silences of the namespace of the controller.
+// It is empty when the namespace of the controller is unknown, so ClusterSearchRules can not be silenced
+func GetSilencesNamespace(searchRule *v1alpha1.SearchRule, controllerNamespace string) string {
+	if searchRule.Namespace != "" {
+		return searchRule.Namespace
+	}
+	return controllerNamespace
+}
+
+// GetActiveSilence returns the first Silence of the namespace which is active at the given time and matches the
+// labels of a SearchRule. Silences with an empty selector match no rules, so a missing selector never mutes
+// a whole namespace
+func GetActiveSilence(ctx context.Context, c client.Reader, namespace string, ruleLabels labels.Set,
+	now time.Time) (*v1alpha1.Silence, error) {
+
+	if namespace == "" {
+		return nil, nil
+	}
+
+	silences := &v1alpha1.SilenceList{}
+	err := c.List(ctx, silences, client.InNamespace(namespace))
+	if err != nil {
+		return nil, fmt.Errorf(SilencesListErrorMessage, namespace, err)
+	}
+
+	for i := range silences.Items {
+		silence := &silences.Items[i]
+
+		if !IsSilenceActive(silence, now) || IsSilenceSelectorEmpty(silence) {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(&silence.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf(SilenceSelectorErrorMessage, silence.Name, err)
+		}
+
+		if selector.Matches(ruleLabels) {
+			return silence, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// IsSilenceActive checks if the given time is inside the time window of the silence. An empty startsAt
+// means the silence is active since its creation
+func IsSilenceActive(silence *v1alpha1.Silence, now time.Time) bool {
+
+	if !silence.Spec.StartsAt.IsZero() && now.Before(silence.Spec.StartsAt.Time) {
+		return false
+	}
+
+	return now.Before(silence.Spec.EndsAt.Time)
+}
+
+// IsSilenceSelectorEmpty checks if the selector of the silence has no labels nor expressions
+func IsSilenceSelectorEmpty(silence *v1alpha1.Silence) bool {
+	return len(silence.Spec.Selector.MatchLabels) == 0 && len(silence.Spec.Selector.MatchExpressions) == 0
+}
@@ -36,6 +36,64 @@ const (
 	ConditionReasonKubernetesApiCallErrorType    = "KubernetesApiCallError"
 	ConditionReasonKubernetesApiCallErrorMessage = "Call to Kubernetes API failed. More info in logs."
 
+	// Constants for the ready conditions
+	// Condition type for the health of the evaluation of a rule, regardless of its state
+	ConditionTypeReady = "Ready"
+
+	// Rule evaluated successfully
+	ConditionReasonRuleEvaluatedType    = "RuleEvaluated"
+	ConditionReasonRuleEvaluatedMessage = "Rule was evaluated successfully"
+
+	// Rule evaluation failed. The message is the error of the evaluation
+	ConditionReasonEvaluationFailedType = "EvaluationFailed"
+
+	// Constants for the query failing conditions
+	// Condition type for the rules whose query failed too many times in a row
+	ConditionTypeQueryFailing = "QueryFailing"
+
+	// Query failed as many times in a row as the failure threshold of the rule
+	ConditionReasonConsecutiveFailuresType    = "ConsecutiveFailures"
+	ConditionReasonConsecutiveFailuresMessage = "Query of the rule failed %d times in a row"
+
+	// Query of the rule failed fewer times in a row than the failure threshold
+	ConditionReasonBelowFailureThresholdType    = "BelowFailureThreshold"
+	ConditionReasonBelowFailureThresholdMessage = "Query of the rule failed %d times in a row, below the failure threshold"
+
+	// Constants for the warning conditions
+	// Condition type for warnings about the configuration
+	ConditionTypeWarning = "Warning"
+
+	// No warnings
+	ConditionReasonNoWarningsType    = "NoWarnings"
+	ConditionReasonNoWarningsMessage = "No warnings found in the configuration"
+
+	// TLS skip verify ignored because a CA bundle is defined
+	ConditionReasonTlsSkipVerifyIgnoredType    = "TlsSkipVerifyIgnored"
+	ConditionReasonTlsSkipVerifyIgnoredMessage = "tlsSkipVerify is ignored because a CA bundle is defined, server certificate is verified"
+
+	// Constants for the reachability conditions
+	// Condition type for the connectivity probe of the QueryConnector
+	ConditionTypeReachable = "Reachable"
+
+	// Connectivity probe succeeded
+	ConditionReasonProbeSucceededType    = "ProbeSucceeded"
+	ConditionReasonProbeSucceededMessage = "Backend of the QueryConnector is reachable"
+
+	// Connectivity probe failed
+	ConditionReasonProbeFailedType = "ProbeFailed"
+
+	// Constants for the circuit breaker conditions
+	// Condition type for the circuit breaker of the RulerAction
+	ConditionTypeCircuitBreakerOpen = "CircuitBreakerOpen"
+
+	// Circuit breaker closed, the notifications are delivered
+	ConditionReasonCircuitBreakerClosedType    = "Closed"
+	ConditionReasonCircuitBreakerClosedMessage = "Notifications are delivered to the integration"
+
+	// Circuit breaker open, the deliveries are skipped until the cooldown expires
+	ConditionReasonCircuitBreakerOpenType    = "Open"
+	ConditionReasonCircuitBreakerOpenMessage = "Deliveries skipped after %d failures in a row, recovery is tested at %s"
+
 	// Constants for the state conditions
 	// Condition type for state
 	ConditionTypeState = "State"
@@ -53,15 +111,33 @@ const (
 	ConditionReasonPendingAlertResolved        = "PendingAlertResolved"
 	ConditionReasonStateNormalType             = "Normal"
 	ConditionReasonStateNormalMessage          = "Rule is normal"
+	ConditionReasonSilencedType                = "Silenced"
+	ConditionReasonSilencedMessage             = "Rule is silenced by %s"
+	ConditionReasonInactiveScheduleType        = "InactiveSchedule"
+	ConditionReasonInactiveScheduleMessage     = "Rule is inactive (schedule)"
+	ConditionReasonNoDataType                  = "NoData"
+	ConditionReasonNoDataMessage               = "Rule has not enough data to be evaluated"
 
 	// No credentials found
 	ConditionReasonNoCredsFoundType    = "NoCredsFound"
 	ConditionReasonNoCredsFoundMessage = "No credentials found in secret"
 
+	// Invalid credentials configuration
+	ConditionReasonInvalidCredentialsType    = "InvalidCredentials"
+	ConditionReasonInvalidCredentialsMessage = "Only one authentication method must be defined in the credentials"
+
+	// Invalid TLS configuration
+	ConditionReasonInvalidTlsType    = "InvalidTls"
+	ConditionReasonInvalidTlsMessage = "Error loading the TLS certificates from the secret"
+
 	// Connection error
 	ConditionReasonConnectionErrorType    = "ConnectionError"
 	ConditionReasonConnectionErrorMessage = "Connection error to the webhook target to send the alert"
 
+	// Webhook target answered with an error status code
+	ConditionReasonWebhookErrorResponseType    = "WebhookErrorResponse"
+	ConditionReasonWebhookErrorResponseMessage = "Webhook target answered with an error to the alert"
+
 	// Evaluate template error
 	ConditionReasonEvaluateTemplateErrorType    = "EvaluateTemplateError"
 	ConditionReasonEvaluateTemplateErrorMessage = "Error evaluating the template for the alert"
@@ -77,12 +153,64 @@ const (
 	// Query error
 	ConditionReasonQueryErrorMessage = "Error executing the query"
 	ConditionReasonQueryErrorType    = "QueryError"
+
+	// Invalid URL in the QueryConnector
+	ConditionReasonInvalidUrlMessage = "URL of the QueryConnector is not a valid http(s) URL"
+	ConditionReasonInvalidUrlType    = "InvalidUrl"
+
+	// Backend of the QueryConnector not reachable from the SearchRule
+	ConditionReasonBackendUnreachableMessage = "Backend of the QueryConnector can not be reached"
+	ConditionReasonBackendUnreachableType    = "BackendUnreachable"
+
+	// Request to the backend of the QueryConnector cancelled after the queryTimeout of the SearchRule
+	ConditionReasonQueryTimeoutMessage = "Query to the backend was cancelled after the queryTimeout"
+	ConditionReasonQueryTimeoutType    = "QueryTimeout"
+
+	// Backend of the QueryConnector answered with a non 200 status code
+	ConditionReasonErrorResponseMessage = "Backend of the QueryConnector answered with an error"
+	ConditionReasonErrorResponseType    = "ErrorResponse"
+
+	// Response of the query is not a valid JSON
+	ConditionReasonInvalidResponseMessage = "Response of the query is not a valid JSON"
+	ConditionReasonInvalidResponseType    = "InvalidResponse"
+
+	// Index of the query not found in the backend
+	ConditionReasonIndexNotFoundMessage = "Index %s not found in the backend"
+	ConditionReasonIndexNotFoundType    = "IndexNotFound"
+
+	// conditionField not found in the response of the query
+	ConditionReasonConditionFieldNotFoundMessage = "The conditionField is not found in the response of the query"
+	ConditionReasonConditionFieldNotFoundType    = "ConditionFieldNotFound"
+
+	// Response of the query larger than the max response size
+	ConditionReasonResponseTooLargeMessage = "Response of the query is larger than the max response size of the QueryConnector"
+	ConditionReasonResponseTooLargeType    = "ResponseTooLarge"
+
+	// Non numeric value in the conditionField
+	ConditionReasonNonNumericValueMessage = "The value of the conditionField is not numeric"
+	ConditionReasonNonNumericValueType    = "NonNumericValue"
+
+	// conditionField is not a list of buckets in buckets mode
+	ConditionReasonInvalidBucketsMessage = "The conditionField is not a list of buckets with the keyField"
+	ConditionReasonInvalidBucketsType    = "InvalidBuckets"
+
+	// QueryConnector deletion waiting for the rules referencing it
+	ConditionReasonInUseMessage = "QueryConnector is referenced by rules, deletion is waiting for them to be removed"
+	ConditionReasonInUseType    = "InUse"
+
+	// Invalid active windows in the SearchRule
+	ConditionReasonInvalidActiveWindowsMessage = "Error parsing the active windows of the SearchRule"
+	ConditionReasonInvalidActiveWindowsType    = "InvalidActiveWindows"
 )
 
 var (
 	Application = applicationT{
 		Context: context.Background(),
 	}
+
+	// Version of searchruler, included in the User-Agent of the outbound requests. It is set at build time with
+	// -ldflags "-X prosimcorp.com/SearchRuler/internal/globals.Version=<version>"
+	Version = "dev"
 )
 
 // NewCondition a set of default options for creating a Condition.
@@ -30,7 +30,10 @@ type applicationT struct {
 	// Context TODO
 	Context context.Context
 
-	// Kubernetes clients
-	KubeRawClient     *dynamic.DynamicClient
-	KubeRawCoreClient *kubernetes.Clientset
+	// Kubernetes clients. They are interfaces, so they can be replaced by fake clients in tests
+	KubeRawClient     dynamic.Interface
+	KubeRawCoreClient kubernetes.Interface
+
+	// WatchNamespaces are the namespaces the namespaced resources are watched in. Empty watches all of them
+	WatchNamespaces []string
 }
@@ -17,8 +17,12 @@ limitations under the License.
 package globals
 
 import (
-
-	//
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
 
 	//
 	"k8s.io/client-go/dynamic"
@@ -48,3 +52,94 @@ func NewKubernetesClient() (client *dynamic.DynamicClient, coreClient *kubernete
 
 	return client, coreClient, err
 }
+
+// GetProxy returns the proxy function for the transports of the outbound requests. The proxy URL, when defined,
+// wins over the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, which are honored otherwise
+func GetProxy(proxyURL string) (func(*http.Request) (*url.URL, error), error) {
+	if proxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	parsedURL, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return nil, errors.New("scheme and host are required")
+	}
+
+	return http.ProxyURL(parsedURL), nil
+}
+
+// ValidateURL checks that the URL is a well-formed http(s) URL with a host
+func ValidateURL(rawURL string) error {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+	if parsedURL.Host == "" {
+		return errors.New("host is empty")
+	}
+	return nil
+}
+
+// userAgentTransport sets the User-Agent header of the requests which do not define one
+type userAgentTransport struct {
+	transport http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") != "" {
+		return t.transport.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.transport.RoundTrip(req)
+}
+
+// NewUserAgentTransport returns a transport identifying the outbound requests with the User-Agent, or with
+// searchruler/<version> when it is not defined. User-Agent headers set in the requests are kept as they are
+func NewUserAgentTransport(transport http.RoundTripper, userAgent string) http.RoundTripper {
+	if userAgent == "" {
+		userAgent = "searchruler/" + Version
+	}
+	return &userAgentTransport{transport: transport, userAgent: userAgent}
+}
+
+// ParseNamespaces returns the namespaces of a comma-separated list, skipping the empty ones
+func ParseNamespaces(namespaces string) []string {
+	parsed := []string{}
+	for _, namespace := range strings.Split(namespaces, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" {
+			parsed = append(parsed, namespace)
+		}
+	}
+	return parsed
+}
+
+// IsNamespaceWatched returns whether the namespaced resources of the namespace are watched. Cluster scoped
+// resources, without namespace, are always watched
+func IsNamespaceWatched(namespace string) bool {
+	if namespace == "" || len(Application.WatchNamespaces) == 0 {
+		return true
+	}
+	return slices.Contains(Application.WatchNamespaces, namespace)
+}
+
+// GetControllerNamespace returns the namespace the controller runs in, taken from the POD_NAMESPACE environment
+// variable or from the service account mounted in the pod. It is empty when running out of the cluster
+func GetControllerNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(namespace))
+}
@@ -54,6 +54,11 @@ var (
 			Help:   "State of the search rule",
 			Labels: []string{"rule", "state"},
 		},
+		"searchrule_consecutive_failures": {
+			Name:   "searchrule_consecutive_failures",
+			Help:   "Number of evaluations in a row whose query failed",
+			Labels: []string{"rule"},
+		},
 	}
 
 	// Old rule metric to check if the metric has changed in each iteration
@@ -238,6 +243,8 @@ func updateMetrics(rulesPool *pools.RulesStore) (err error) {
 				switch name {
 				case "searchrule_value":
 					metric.WithLabelValues(rule.SearchRule.Name).Set(float64(rule.Value))
+				case "searchrule_consecutive_failures":
+					metric.WithLabelValues(rule.SearchRule.Name).Set(float64(rule.ConsecutiveFailures))
 				case "searchrule_state":
 					// Set the state of the rule with 1 if it's the same as the state in the ruleStates array
 					for _, state := range ruleStates {
@@ -17,17 +17,49 @@ limitations under the License.
 package pools
 
 import (
+	"maps"
+	"regexp"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 
 	"prosimcorp.com/SearchRuler/api/v1alpha1"
 )
 
+const (
+	// Alert statuses
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+)
+
 // Alert
 type Alert struct {
 	RulerActionName string
 	SearchRule      v1alpha1.SearchRule
+	Status          string
+	Severity        string
+	Labels          map[string]string
+	Annotations     map[string]string
 	Value           float64
 	Aggregations    interface{}
+
+	// Query is the query executed in the backend, after resolving its templates, and
+	// ConnectorURL the URL of the QueryConnector, so receivers can link back to the backend
+	Query        string
+	ConnectorURL string
+
+	// Samples are the first documents matching the query, captured for the triage of the alert
+	Samples []interface{}
+
+	// SpanContext is the span of the evaluation of the rule, so the notifications are linked to it.
+	// It is not kept when the alert is saved on shutdown
+	SpanContext trace.SpanContext `json:"-"`
+
+	// FiringTime is the time the alert started firing and ResolvedTime the time it was resolved,
+	// which is zero while the alert is firing
+	FiringTime   time.Time
+	ResolvedTime time.Time
 }
 
 // AlertsStore
@@ -49,10 +81,30 @@ func (c *AlertsStore) Get(key string) (*Alert, bool) {
 	return alert, exists
 }
 
+// GetAll returns a copy of the store, so it can be iterated while the store is updated
 func (c *AlertsStore) GetAll() map[string]*Alert {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.Store
+	return maps.Clone(c.Store)
+}
+
+// GetByRegex returns the alerts whose keys match the regular expression. The expression is anchored
+// to the whole key, so "default_web" matches the key default_web, but not default_webhook
+func (c *AlertsStore) GetByRegex(pattern string) (map[string]*Alert, error) {
+	expression, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	alerts := map[string]*Alert{}
+	for key, alert := range c.Store {
+		if expression.MatchString(key) {
+			alerts[key] = alert
+		}
+	}
+	return alerts, nil
 }
 
 func (c *AlertsStore) Delete(key string) {
@@ -0,0 +1,72 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AlertsStore", func() {
+
+	var store *AlertsStore
+
+	BeforeEach(func() {
+		store = &AlertsStore{Store: map[string]*Alert{
+			GetKey("default", "web"):     {RulerActionName: "web"},
+			GetKey("default", "webhook"): {RulerActionName: "webhook"},
+			GetKey("default", "api"):     {RulerActionName: "api"},
+			GetKey("other", "web"):       {RulerActionName: "web"},
+		}}
+	})
+
+	It("should anchor the expression to the whole key", func() {
+		alerts, err := store.GetByRegex("default_web")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alerts).To(HaveLen(1))
+		Expect(alerts).To(HaveKey("default_web"))
+	})
+
+	It("should return all the alerts matching partial expressions", func() {
+		alerts, err := store.GetByRegex("default_.*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alerts).To(HaveLen(3))
+
+		alerts, err = store.GetByRegex(".*_web")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alerts).To(HaveLen(2))
+		Expect(alerts).To(HaveKey("default_web"))
+		Expect(alerts).To(HaveKey("other_web"))
+	})
+
+	It("should anchor alternations to the whole key", func() {
+		alerts, err := store.GetByRegex("default_api|other_web")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alerts).To(HaveLen(2))
+	})
+
+	It("should return an empty result when nothing matches", func() {
+		alerts, err := store.GetByRegex("missing_.*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alerts).To(BeEmpty())
+	})
+
+	It("should fail with invalid expressions", func() {
+		_, err := store.GetByRegex("default_(")
+		Expect(err).To(HaveOccurred())
+	})
+})
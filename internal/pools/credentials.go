@@ -16,12 +16,24 @@ limitations under the License.
 
 package pools
 
-import "sync"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"maps"
+	"sync"
+)
 
 // Credentials
 type Credentials struct {
-	Username string
-	Password string
+	Username    string
+	Password    string
+	BearerToken string
+	ApiKey      string
+
+	// TLS client certificate and CA bundle. The PEM of the CA bundle is kept to detect changes
+	TlsCertificate *tls.Certificate
+	RootCAs        *x509.CertPool
+	RootCAsPEM     []byte
 }
 
 // CredentialsStore
@@ -43,10 +55,11 @@ func (c *CredentialsStore) Get(key string) (*Credentials, bool) {
 	return creds, exists
 }
 
+// GetAll returns a copy of the store, so it can be iterated while the store is updated
 func (c *CredentialsStore) GetAll() map[string]*Credentials {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.Store
+	return maps.Clone(c.Store)
 }
 
 func (c *CredentialsStore) Delete(key string) {
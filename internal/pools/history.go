@@ -0,0 +1,177 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// Max number of samples kept in the history of a rule
+	HistorySize = 100
+)
+
+// Sample is the value of a rule in an evaluation
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// History is a ring buffer with the last samples of a rule, used by the trend conditions. The zero value
+// is an empty history ready to use
+type History struct {
+	samples []Sample
+	next    int
+}
+
+// Add saves the sample in the history, overwriting the oldest one when the history is full
+func (h *History) Add(sample Sample) {
+	if len(h.samples) < HistorySize {
+		h.samples = append(h.samples, sample)
+		return
+	}
+	h.samples[h.next] = sample
+	h.next = (h.next + 1) % HistorySize
+}
+
+// Clone returns a copy of the history which does not share the samples, so adding samples to it does
+// not change the original history
+func (h *History) Clone() History {
+	return History{samples: append([]Sample(nil), h.samples...), next: h.next}
+}
+
+// MarshalJSON encodes the samples of the history, oldest first, so the history is kept when the state is saved
+func (h History) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Samples())
+}
+
+// UnmarshalJSON decodes the samples of the history, oldest first
+func (h *History) UnmarshalJSON(data []byte) error {
+	samples := []Sample{}
+	err := json.Unmarshal(data, &samples)
+	if err != nil {
+		return err
+	}
+
+	*h = History{}
+	for _, sample := range samples {
+		h.Add(sample)
+	}
+	return nil
+}
+
+// Len returns the number of samples in the history
+func (h *History) Len() int {
+	return len(h.samples)
+}
+
+// Samples returns the samples of the history, oldest first
+func (h *History) Samples() []Sample {
+	samples := make([]Sample, 0, len(h.samples))
+	samples = append(samples, h.samples[h.next:]...)
+	return append(samples, h.samples[:h.next]...)
+}
+
+// Ago returns the sample of the given number of evaluations ago. 0 is the last sample
+func (h *History) Ago(evaluations int) (Sample, bool) {
+	if evaluations < 0 || evaluations >= len(h.samples) {
+		return Sample{}, false
+	}
+	return h.samples[(h.next+len(h.samples)-1-evaluations)%len(h.samples)], true
+}
+
+// Last returns the last samples of the history, up to the given number, oldest first
+func (h *History) Last(count int) []Sample {
+	samples := h.Samples()
+	return samples[max(len(samples)-count, 0):]
+}
+
+// Window returns the samples taken inside the window before now, oldest first
+func (h *History) Window(window time.Duration, now time.Time) []Sample {
+	samples := h.Samples()
+	for i, sample := range samples {
+		if now.Sub(sample.Time) <= window {
+			return samples[i:]
+		}
+	}
+	return nil
+}
+
+// Average returns the average of the values inside the window. It returns false without samples in the window
+func (h *History) Average(window time.Duration, now time.Time) (float64, bool) {
+	samples := h.Window(window, now)
+	if len(samples) == 0 {
+		return 0, false
+	}
+	sum := 0.0
+	for _, sample := range samples {
+		sum += sample.Value
+	}
+	return sum / float64(len(samples)), true
+}
+
+// Min returns the min value inside the window. It returns false without samples in the window
+func (h *History) Min(window time.Duration, now time.Time) (float64, bool) {
+	samples := h.Window(window, now)
+	if len(samples) == 0 {
+		return 0, false
+	}
+	minValue := samples[0].Value
+	for _, sample := range samples[1:] {
+		minValue = min(minValue, sample.Value)
+	}
+	return minValue, true
+}
+
+// Max returns the max value inside the window. It returns false without samples in the window
+func (h *History) Max(window time.Duration, now time.Time) (float64, bool) {
+	samples := h.Window(window, now)
+	if len(samples) == 0 {
+		return 0, false
+	}
+	maxValue := samples[0].Value
+	for _, sample := range samples[1:] {
+		maxValue = max(maxValue, sample.Value)
+	}
+	return maxValue, true
+}
+
+// Slope returns the change of the values per second inside the window, fitted by least squares. It returns
+// false with less than two samples in the window or when all of them were taken at the same time
+func (h *History) Slope(window time.Duration, now time.Time) (float64, bool) {
+	samples := h.Window(window, now)
+	if len(samples) < 2 {
+		return 0, false
+	}
+
+	// Times are taken relative to the first sample to keep the precision
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range samples {
+		x := sample.Time.Sub(samples[0].Time).Seconds()
+		sumX += x
+		sumY += sample.Value
+		sumXY += x * sample.Value
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("History", func() {
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// newHistory returns a history with a sample every minute until now
+	newHistory := func(values ...float64) *History {
+		history := &History{}
+		for i, value := range values {
+			history.Add(Sample{Time: now.Add(time.Duration(i-len(values)+1) * time.Minute), Value: value})
+		}
+		return history
+	}
+
+	It("should keep the last samples when it is full", func() {
+		history := &History{}
+		for i := 0; i < HistorySize+5; i++ {
+			history.Add(Sample{Value: float64(i)})
+		}
+		Expect(history.Len()).To(Equal(HistorySize))
+
+		samples := history.Samples()
+		Expect(samples[0].Value).To(Equal(5.0))
+		Expect(samples[HistorySize-1].Value).To(Equal(float64(HistorySize + 4)))
+
+		sample, exists := history.Ago(0)
+		Expect(exists).To(BeTrue())
+		Expect(sample.Value).To(Equal(float64(HistorySize + 4)))
+		sample, exists = history.Ago(HistorySize - 1)
+		Expect(exists).To(BeTrue())
+		Expect(sample.Value).To(Equal(5.0))
+		_, exists = history.Ago(HistorySize)
+		Expect(exists).To(BeFalse())
+	})
+
+	It("should not share the samples with its clones", func() {
+		history := &History{}
+		for i := 0; i < HistorySize; i++ {
+			history.Add(Sample{Value: float64(i)})
+		}
+
+		clone := history.Clone()
+		clone.Add(Sample{Value: -1})
+		sample, _ := clone.Ago(0)
+		Expect(sample.Value).To(Equal(-1.0))
+		sample, _ = history.Ago(0)
+		Expect(sample.Value).To(Equal(float64(HistorySize - 1)))
+		Expect(history.Samples()[0].Value).To(BeZero())
+	})
+
+	It("should keep the samples in order when it is encoded", func() {
+		history := &History{}
+		for i := 0; i < HistorySize+5; i++ {
+			history.Add(Sample{Time: now.Add(time.Duration(i) * time.Minute), Value: float64(i)})
+		}
+
+		historyJSON, err := json.Marshal(history)
+		Expect(err).NotTo(HaveOccurred())
+		decoded := &History{}
+		Expect(json.Unmarshal(historyJSON, decoded)).To(Succeed())
+		Expect(decoded.Samples()).To(Equal(history.Samples()))
+
+		decoded.Add(Sample{Value: -1})
+		Expect(decoded.Len()).To(Equal(HistorySize))
+		sample, _ := decoded.Ago(0)
+		Expect(sample.Value).To(Equal(-1.0))
+	})
+
+	It("should return the last samples", func() {
+		history := newHistory(1, 2, 3)
+		Expect(history.Last(2)).To(Equal([]Sample{{Time: now.Add(-time.Minute), Value: 2}, {Time: now, Value: 3}}))
+		Expect(history.Last(5)).To(HaveLen(3))
+	})
+
+	It("should aggregate the samples inside the window", func() {
+		history := newHistory(100, 1, 2, 3)
+
+		average, exists := history.Average(2*time.Minute, now)
+		Expect(exists).To(BeTrue())
+		Expect(average).To(Equal(2.0))
+
+		minValue, _ := history.Min(2*time.Minute, now)
+		Expect(minValue).To(Equal(1.0))
+		maxValue, _ := history.Max(time.Hour, now)
+		Expect(maxValue).To(Equal(100.0))
+
+		slope, exists := history.Slope(2*time.Minute, now)
+		Expect(exists).To(BeTrue())
+		Expect(slope).To(BeNumerically("~", 1.0/60, 1e-9))
+	})
+
+	It("should not aggregate without samples in the window", func() {
+		history := newHistory(1)
+
+		_, exists := history.Average(time.Minute, now.Add(time.Hour))
+		Expect(exists).To(BeFalse())
+		_, exists = history.Slope(time.Hour, now)
+		Expect(exists).To(BeFalse())
+	})
+})
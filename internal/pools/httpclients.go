@@ -0,0 +1,56 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"net/http"
+	"sync"
+)
+
+// HttpClient
+type HttpClient struct {
+	Client     *http.Client
+	ConfigHash string
+}
+
+// HttpClientsStore
+type HttpClientsStore struct {
+	mu    sync.RWMutex
+	Store map[string]*HttpClient
+}
+
+func (c *HttpClientsStore) Set(key string, client *HttpClient) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Store[key] = client
+}
+
+func (c *HttpClientsStore) Get(key string) (*HttpClient, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	client, exists := c.Store[key]
+	return client, exists
+}
+
+func (c *HttpClientsStore) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, exists := c.Store[key]
+	if exists {
+		delete(c.Store, key)
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+const (
+	// keySeparator separates the namespace and the name of the resources in the keys of the pools.
+	// Namespaces and names of Kubernetes resources are DNS labels or subdomains, so they never
+	// contain it, and it is safe to be used in URLs
+	keySeparator = "_"
+
+	// queryCacheKeySeparator separates the key of the QueryConnector and the hash of the query in the keys
+	// of the query cache. Keys of the resources never contain it
+	queryCacheKeySeparator = "/"
+)
+
+// GetKey returns the key of a resource in the pools: <namespace>_<name>. Cluster scoped resources
+// have an empty namespace, so their keys start with the separator and never collide with namespaced ones
+func GetKey(namespace, name string) string {
+	return namespace + keySeparator + name
+}
+
+// GetQueryCacheKey returns the key of a response in the query cache: <connectorKey>/<queryHash>. The key of the
+// QueryConnector is the prefix, so the responses of a deleted QueryConnector can be evicted together
+func GetQueryCacheKey(connectorKey, queryHash string) string {
+	return connectorKey + queryCacheKeySeparator + queryHash
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetKey", func() {
+
+	It("should join the namespace and the name", func() {
+		Expect(GetKey("default", "rule")).To(Equal("default_rule"))
+	})
+
+	It("should not collide cluster scoped resources with namespaced ones", func() {
+		Expect(GetKey("", "default-rule")).NotTo(Equal(GetKey("default", "rule")))
+		Expect(GetKey("", "rule")).To(Equal("_rule"))
+	})
+
+	It("should not collide resources whose names share a prefix", func() {
+		Expect(GetKey("team", "a-rule")).NotTo(Equal(GetKey("team-a", "rule")))
+	})
+})
@@ -0,0 +1,86 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryCacheEntry
+type QueryCacheEntry struct {
+	Response   []byte
+	Expiration time.Time
+}
+
+// QueryCacheStore
+type QueryCacheStore struct {
+	mu    sync.RWMutex
+	Store map[string]*QueryCacheEntry
+}
+
+// Set saves the response in the cache during the ttl. Expired entries are purged
+// on every write to keep the cache small
+func (c *QueryCacheStore) Set(key string, response []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for storedKey, entry := range c.Store {
+		if now.After(entry.Expiration) {
+			delete(c.Store, storedKey)
+		}
+	}
+
+	c.Store[key] = &QueryCacheEntry{
+		Response:   response,
+		Expiration: now.Add(ttl),
+	}
+}
+
+// Get returns the cached response when it exists and it is not expired
+func (c *QueryCacheStore) Get(key string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, exists := c.Store[key]
+	if !exists || time.Now().After(entry.Expiration) {
+		return nil, false
+	}
+	return entry.Response, true
+}
+
+func (c *QueryCacheStore) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, exists := c.Store[key]
+	if exists {
+		delete(c.Store, key)
+	}
+}
+
+// DeleteConnector deletes every response cached for the QueryConnector
+func (c *QueryCacheStore) DeleteConnector(connectorKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := GetQueryCacheKey(connectorKey, "")
+	for key := range c.Store {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.Store, key)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QueryCacheStore", func() {
+
+	It("should delete only the responses of the given QueryConnector", func() {
+		cache := &QueryCacheStore{Store: map[string]*QueryCacheEntry{}}
+		cache.Set(GetQueryCacheKey("monitoring_elasticsearch", "a"), []byte("a"), time.Minute)
+		cache.Set(GetQueryCacheKey("monitoring_elasticsearch", "b"), []byte("b"), time.Minute)
+		cache.Set(GetQueryCacheKey("monitoring_elasticsearch-logs", "a"), []byte("c"), time.Minute)
+
+		cache.DeleteConnector("monitoring_elasticsearch")
+
+		Expect(cache.Store).To(HaveLen(1))
+		response, exists := cache.Get(GetQueryCacheKey("monitoring_elasticsearch-logs", "a"))
+		Expect(exists).To(BeTrue())
+		Expect(response).To(Equal([]byte("c")))
+	})
+})
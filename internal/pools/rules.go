@@ -17,6 +17,7 @@ limitations under the License.
 package pools
 
 import (
+	"maps"
 	"sync"
 	"time"
 
@@ -28,9 +29,22 @@ type Rule struct {
 	SearchRule    v1alpha1.SearchRule
 	FiringTime    time.Time
 	ResolvingTime time.Time
+	ResolvedTime  time.Time
 	State         string
 	Value         float64
 	Aggregations  interface{}
+
+	// ConsecutiveFailures is the number of evaluations in a row whose query failed
+	ConsecutiveFailures int
+
+	// LastSeenTime is the last evaluation where the condition of an absent rule was false
+	LastSeenTime time.Time
+
+	// History are the values of the last evaluations, used by the trend conditions
+	History History
+
+	// Buckets are the states of the buckets of the rule in buckets mode, indexed by the bucket key
+	Buckets map[string]*Rule
 }
 
 // RulesStore
@@ -52,10 +66,11 @@ func (c *RulesStore) Get(key string) (*Rule, bool) {
 	return rule, exists
 }
 
+// GetAll returns a copy of the store, so it can be iterated while the store is updated
 func (c *RulesStore) GetAll() map[string]*Rule {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.Store
+	return maps.Clone(c.Store)
 }
 
 func (c *RulesStore) Delete(key string) {
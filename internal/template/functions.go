@@ -19,6 +19,7 @@ package template
 import (
 	"bytes"
 	"encoding/json"
+	"os"
 	"strings"
 	"text/template"
 
@@ -27,6 +28,11 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
+const (
+	// Prefix of the environment variables of the controller available in the templates of the headers
+	EnvironmentPrefix = "SEARCHRULER_"
+)
+
 // FOLKS, ATTENTION HERE:
 // Some parts of the magic you are going to see are replicated from Helm templating engine.
 // We decided to use Golang templating and add, more or less, the same extra functionality to this operator
@@ -53,6 +59,45 @@ func EvaluateTemplate(templateString string, data interface{}) (result string, e
 	return buffer.String(), nil
 }
 
+// EvaluateHeaders evaluates the values of the headers as templates with the data and the environment, available
+// as .env. Literal values, without template actions, are kept as they are
+func EvaluateHeaders(headers map[string]string, data map[string]interface{}) (map[string]string, error) {
+
+	templateInjectedObject := map[string]interface{}{}
+	for key, value := range data {
+		templateInjectedObject[key] = value
+	}
+	templateInjectedObject["env"] = GetEnvironment()
+
+	evaluatedHeaders := make(map[string]string, len(headers))
+	for key, value := range headers {
+		if !strings.Contains(value, "{{") {
+			evaluatedHeaders[key] = value
+			continue
+		}
+		evaluatedValue, err := EvaluateTemplate(value, templateInjectedObject)
+		if err != nil {
+			return nil, err
+		}
+		evaluatedHeaders[key] = evaluatedValue
+	}
+
+	return evaluatedHeaders, nil
+}
+
+// GetEnvironment returns the environment variables of the controller with the SEARCHRULER_ prefix. Just them are
+// available in the templates, so the rest of the environment, which can include credentials, is not exposed
+func GetEnvironment() map[string]string {
+	environment := map[string]string{}
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if strings.HasPrefix(name, EnvironmentPrefix) {
+			environment[name] = value
+		}
+	}
+	return environment
+}
+
 // GetFunctionsMap return a map with equivalency between functions for inside templating and real Golang ones
 func GetFunctionsMap() template.FuncMap {
 	f := sprig.TxtFuncMap()
@@ -0,0 +1,114 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package template
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EvaluateTemplate", func() {
+
+	data := map[string]interface{}{
+		"value":  3.14159,
+		"status": "firing",
+		"object": map[string]interface{}{
+			"name":   "rule",
+			"labels": map[string]interface{}{"team": "payments"},
+		},
+		"startTime": time.Date(2024, 5, 17, 10, 30, 0, 0, time.UTC),
+	}
+
+	// The functions available in the templates of the actions. Every entry is an example of a function
+	DescribeTable("should provide the functions to format the messages",
+		func(templateString string, expected string) {
+			result, err := EvaluateTemplate(templateString, data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(expected))
+		},
+		Entry("toJson", `{{ .object | toJson }}`, `{"labels":{"team":"payments"},"name":"rule"}`),
+		Entry("fromJson", `{{ (fromJson "{\"a\":\"b\"}").a }}`, `b`),
+		Entry("toYaml", `{{ .object.labels | toYaml }}`, `team: payments`),
+		Entry("upper", `{{ .status | upper }}`, `FIRING`),
+		Entry("lower", `{{ "FIRING" | lower }}`, `firing`),
+		Entry("title", `{{ .status | title }}`, `Firing`),
+		Entry("quote", `{{ .status | quote }}`, `"firing"`),
+		Entry("trunc", `{{ .status | trunc 4 }}`, `firi`),
+		Entry("replace", `{{ .status | replace "ing" "ed" }}`, `fired`),
+		Entry("default with missing values", `{{ .severity | default "warning" }}`, `warning`),
+		Entry("default with defined values", `{{ .status | default "unknown" }}`, `firing`),
+		Entry("round", `{{ round .value 2 }}`, `3.14`),
+		Entry("floor", `{{ floor .value }}`, `3`),
+		Entry("ceil", `{{ ceil .value }}`, `4`),
+		Entry("printf", `{{ printf "%.1f" .value }}`, `3.1`),
+		Entry("date", `{{ .startTime | date "2006-01-02 15:04" }}`, `2024-05-17 10:30`),
+		Entry("dateInZone", `{{ dateInZone "15:04 MST" .startTime "UTC" }}`, `10:30 UTC`),
+		Entry("toDate", `{{ toDate "2006-01-02" "2024-05-17" | date "Jan 2" }}`, `May 17`),
+		Entry("join", `{{ list "a" "b" | join "," }}`, `a,b`),
+		Entry("keys", `{{ keys .object.labels | sortAlpha | join "," }}`, `team`),
+		Entry("hasKey", `{{ hasKey .object.labels "team" }}`, `true`),
+	)
+
+	It("should not provide the functions reading the environment", func() {
+		_, err := EvaluateTemplate(`{{ env "HOME" }}`, data)
+		Expect(err).To(HaveOccurred())
+
+		_, err = EvaluateTemplate(`{{ expandenv "$HOME" }}`, data)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail with invalid templates", func() {
+		_, err := EvaluateTemplate(`{{ .status `, data)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("EvaluateHeaders", func() {
+
+	BeforeEach(func() {
+		GinkgoT().Setenv("SEARCHRULER_CLUSTER", "production")
+		GinkgoT().Setenv("SECRET_TOKEN", "secret")
+	})
+
+	It("should evaluate the templates of the headers with the data and the environment", func() {
+		headers, err := EvaluateHeaders(map[string]string{
+			"X-Cluster": `{{ .env.SEARCHRULER_CLUSTER }}`,
+			"X-Team":    `{{ .labels.team }}`,
+			"X-Static":  "static",
+		}, map[string]interface{}{"labels": map[string]string{"team": "payments"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(Equal(map[string]string{
+			"X-Cluster": "production",
+			"X-Team":    "payments",
+			"X-Static":  "static",
+		}))
+	})
+
+	It("should not provide the environment variables without the prefix", func() {
+		headers, err := EvaluateHeaders(map[string]string{"X-Token": `{{ .env.SECRET_TOKEN }}`}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers["X-Token"]).To(Equal("<no value>"))
+	})
+
+	It("should keep the literal values as they are", func() {
+		headers, err := EvaluateHeaders(map[string]string{"X-Literal": `{ .status }`}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers["X-Literal"]).To(Equal(`{ .status }`))
+	})
+})
@@ -25,6 +25,29 @@ import (
 const (
 	amgrAlertDataUnmarshalErrorMessage         = "error decoding JSON from 'message.data' for Alertmanager validator: %s"
 	amgrAlertDataRequiredStructureErrorMessage = "notification field 'message.data' does not meet the syntax requirements for Alertmanager: %s"
+
+	slackDataUnmarshalErrorMessage         = "error decoding JSON from 'message.data' for Slack validator: %s"
+	slackDataRequiredStructureErrorMessage = "notification field 'message.data' does not meet the syntax requirements for Slack"
+
+	// Max number of blocks of a Slack message
+	slackMaxBlocks = 50
+)
+
+var (
+	// slackBlockTypes are the types of the layout blocks accepted by Slack messages
+	// Ref: https://api.slack.com/reference/block-kit/blocks
+	slackBlockTypes = map[string]bool{
+		"actions":   true,
+		"context":   true,
+		"divider":   true,
+		"file":      true,
+		"header":    true,
+		"image":     true,
+		"input":     true,
+		"rich_text": true,
+		"section":   true,
+		"video":     true,
+	}
 )
 
 // TODO
@@ -78,3 +101,112 @@ func ValidateAlertmanager(data string) (result bool, hint string, err error) {
 
 	return true, hint, nil
 }
+
+// SlackMessage represents the structure of a Slack message
+// Ref: https://api.slack.com/reference/messaging/payload
+type SlackMessage struct {
+	Text        string                   `json:"text,omitempty"`
+	Blocks      []map[string]interface{} `json:"blocks,omitempty"`
+	Attachments []map[string]interface{} `json:"attachments,omitempty"`
+}
+
+// ValidateSlack checks whether the notification data is a valid Slack message with blocks
+func ValidateSlack(data string) (result bool, hint string, err error) {
+
+	message := SlackMessage{}
+	err = json.Unmarshal([]byte(data), &message)
+	if err != nil {
+		return false, hint, fmt.Errorf(slackDataUnmarshalErrorMessage, err)
+	}
+
+	// Messages must have content: text, blocks or attachments
+	if message.Text == "" && len(message.Blocks) == 0 && len(message.Attachments) == 0 {
+		hint = fmt.Sprintf("%s: %s", slackDataRequiredStructureErrorMessage, "one of 'text', 'blocks' or 'attachments' is required")
+		return false, hint, nil
+	}
+
+	if len(message.Blocks) > slackMaxBlocks {
+		hint = fmt.Sprintf("%s: %s", slackDataRequiredStructureErrorMessage,
+			fmt.Sprintf("%d blocks found, the max is %d", len(message.Blocks), slackMaxBlocks))
+		return false, hint, nil
+	}
+
+	for i, block := range message.Blocks {
+		problem := getSlackBlockProblem(block)
+		if problem != "" {
+			hint = fmt.Sprintf("%s: block %d: %s", slackDataRequiredStructureErrorMessage, i, problem)
+			return false, hint, nil
+		}
+	}
+
+	return true, hint, nil
+}
+
+// getSlackBlockProblem returns what is wrong in the Slack block, or an empty string when it is valid
+func getSlackBlockProblem(block map[string]interface{}) string {
+
+	blockType, _ := block["type"].(string)
+	if !slackBlockTypes[blockType] {
+		return fmt.Sprintf("unknown block type '%s'", blockType)
+	}
+
+	switch blockType {
+	case "header":
+		text, _ := block["text"].(map[string]interface{})
+		if textType, _ := text["type"].(string); textType != "plain_text" {
+			return "field 'text' must be a plain_text object"
+		}
+		return getSlackTextProblem(text)
+
+	case "section":
+		if block["text"] == nil && block["fields"] == nil {
+			return "one of 'text' or 'fields' is required"
+		}
+		if block["text"] != nil {
+			return getSlackTextProblem(block["text"])
+		}
+		fields, isList := block["fields"].([]interface{})
+		if !isList || len(fields) == 0 {
+			return "field 'fields' must be a non empty list"
+		}
+		for _, field := range fields {
+			if problem := getSlackTextProblem(field); problem != "" {
+				return problem
+			}
+		}
+
+	case "context", "actions":
+		elements, isList := block["elements"].([]interface{})
+		if !isList || len(elements) == 0 {
+			return "field 'elements' must be a non empty list"
+		}
+
+	case "image":
+		if block["image_url"] == nil && block["slack_file"] == nil {
+			return "one of 'image_url' or 'slack_file' is required"
+		}
+		if altText, _ := block["alt_text"].(string); altText == "" {
+			return "field 'alt_text' not found"
+		}
+	}
+
+	return ""
+}
+
+// getSlackTextProblem returns what is wrong in the Slack text object, or an empty string when it is valid
+func getSlackTextProblem(object interface{}) string {
+
+	textObject, isObject := object.(map[string]interface{})
+	if !isObject {
+		return "text must be an object with 'type' and 'text'"
+	}
+	textType, _ := textObject["type"].(string)
+	if textType != "plain_text" && textType != "mrkdwn" {
+		return fmt.Sprintf("unknown text type '%s', it must be plain_text or mrkdwn", textType)
+	}
+	if text, _ := textObject["text"].(string); text == "" {
+		return "field 'text' of the text object not found"
+	}
+
+	return ""
+}
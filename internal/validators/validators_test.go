@@ -0,0 +1,53 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validators
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ValidateSlack", func() {
+
+	DescribeTable("should validate the Slack messages",
+		func(data string, expectedResult bool, expectedHint string) {
+			result, hint, err := ValidateSlack(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(expectedResult))
+			Expect(hint).To(ContainSubstring(expectedHint))
+		},
+		Entry("text message", `{"text": "alert firing"}`, true, ""),
+		Entry("blocks message",
+			`{"blocks": [{"type": "header", "text": {"type": "plain_text", "text": "Alert"}},
+			{"type": "section", "fields": [{"type": "mrkdwn", "text": "*value*: 3"}]}, {"type": "divider"}]}`, true, ""),
+		Entry("empty message", `{}`, false, "one of 'text', 'blocks' or 'attachments' is required"),
+		Entry("unknown block type", `{"blocks": [{"type": "table"}]}`, false, "block 0: unknown block type 'table'"),
+		Entry("header with markdown", `{"blocks": [{"type": "header", "text": {"type": "mrkdwn", "text": "Alert"}}]}`,
+			false, "must be a plain_text object"),
+		Entry("section without text", `{"blocks": [{"type": "divider"}, {"type": "section"}]}`,
+			false, "block 1: one of 'text' or 'fields' is required"),
+		Entry("empty text", `{"blocks": [{"type": "section", "text": {"type": "mrkdwn", "text": ""}}]}`,
+			false, "field 'text' of the text object not found"),
+		Entry("image without alt text", `{"blocks": [{"type": "image", "image_url": "https://example.com/graph.png"}]}`,
+			false, "field 'alt_text' not found"),
+	)
+
+	It("should fail when the message is not valid JSON", func() {
+		_, _, err := ValidateSlack(`{"text": `)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,85 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	//
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	//
+	searchrulerv1alpha1 "prosimcorp.com/SearchRuler/api/v1alpha1"
+)
+
+// log is for logging in this package.
+var clustersearchrulelog = logf.Log.WithName("clustersearchrule-resource")
+
+// SetupClusterSearchRuleWebhookWithManager registers the webhook for ClusterSearchRule in the manager. When
+// requireTeam is true, rules without the team label are rejected
+func SetupClusterSearchRuleWebhookWithManager(mgr ctrl.Manager, requireTeam bool) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&searchrulerv1alpha1.ClusterSearchRule{}).
+		WithValidator(&ClusterSearchRuleCustomValidator{SearchRuleCustomValidator{RequireTeam: requireTeam}}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-searchruler-prosimcorp-com-v1alpha1-clustersearchrule,mutating=false,failurePolicy=fail,sideEffects=None,groups=searchruler.prosimcorp.com,resources=clustersearchrules,verbs=create;update,versions=v1alpha1,name=vclustersearchrule-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// ClusterSearchRuleCustomValidator struct is responsible for validating the ClusterSearchRule resource
+// when it is created or updated. Rules are validated as the SearchRules they are evaluated as
+type ClusterSearchRuleCustomValidator struct {
+	SearchRuleCustomValidator
+}
+
+var _ webhook.CustomValidator = &ClusterSearchRuleCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type ClusterSearchRule.
+func (v *ClusterSearchRuleCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	clusterSearchRule, ok := obj.(*searchrulerv1alpha1.ClusterSearchRule)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterSearchRule object but got %T", obj)
+	}
+	clustersearchrulelog.Info("Validation for ClusterSearchRule upon creation", "name", clusterSearchRule.GetName())
+
+	return nil, v.validateSearchRule(clusterSearchRule.ToSearchRule())
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type ClusterSearchRule.
+func (v *ClusterSearchRuleCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	clusterSearchRule, ok := newObj.(*searchrulerv1alpha1.ClusterSearchRule)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterSearchRule object for the newObj but got %T", newObj)
+	}
+	clustersearchrulelog.Info("Validation for ClusterSearchRule upon update", "name", clusterSearchRule.GetName())
+
+	// Rules being deleted must be accepted to allow the removal of the finalizer
+	if !clusterSearchRule.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+
+	return nil, v.validateSearchRule(clusterSearchRule.ToSearchRule())
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type ClusterSearchRule.
+func (v *ClusterSearchRuleCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	//
+	searchrulerv1alpha1 "prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+)
+
+var _ = Describe("ClusterSearchRuleCustomValidator", func() {
+
+	var (
+		validator         *ClusterSearchRuleCustomValidator
+		clusterSearchRule *searchrulerv1alpha1.ClusterSearchRule
+	)
+
+	BeforeEach(func() {
+		validator = &ClusterSearchRuleCustomValidator{}
+		clusterSearchRule = &searchrulerv1alpha1.ClusterSearchRule{
+			ObjectMeta: metav1.ObjectMeta{Name: "errors"},
+			Spec:       newTestSearchRuleSpec(),
+		}
+	})
+
+	It("should accept a valid rule", func() {
+		_, err := validator.ValidateCreate(context.Background(), clusterSearchRule)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject an invalid rule on creation and update", func() {
+		clusterSearchRule.Spec.Condition.For = "forever"
+
+		_, err := validator.ValidateCreate(context.Background(), clusterSearchRule)
+		Expect(err).To(HaveOccurred())
+		_, err = validator.ValidateUpdate(context.Background(), clusterSearchRule, clusterSearchRule)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should accept an invalid rule being deleted", func() {
+		clusterSearchRule.Spec.Condition.For = "forever"
+		now := metav1.Now()
+		clusterSearchRule.DeletionTimestamp = &now
+
+		_, err := validator.ValidateUpdate(context.Background(), clusterSearchRule, clusterSearchRule)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject the rules without team when it is required", func() {
+		validator.RequireTeam = true
+
+		_, err := validator.ValidateCreate(context.Background(), clusterSearchRule)
+		Expect(err).To(HaveOccurred())
+
+		clusterSearchRule.Labels = map[string]string{controller.TeamLabel: "payments"}
+		_, err = validator.ValidateCreate(context.Background(), clusterSearchRule)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject other objects", func() {
+		_, err := validator.ValidateCreate(context.Background(), &searchrulerv1alpha1.SearchRule{})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,97 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	//
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	//
+	searchrulerv1alpha1 "prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller/searchrule"
+)
+
+// log is for logging in this package.
+var searchrulelog = logf.Log.WithName("searchrule-resource")
+
+// SetupSearchRuleWebhookWithManager registers the webhook for SearchRule in the manager. When requireTeam
+// is true, rules without the team label are rejected
+func SetupSearchRuleWebhookWithManager(mgr ctrl.Manager, requireTeam bool) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&searchrulerv1alpha1.SearchRule{}).
+		WithValidator(&SearchRuleCustomValidator{RequireTeam: requireTeam}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-searchruler-prosimcorp-com-v1alpha1-searchrule,mutating=false,failurePolicy=fail,sideEffects=None,groups=searchruler.prosimcorp.com,resources=searchrules,verbs=create;update,versions=v1alpha1,name=vsearchrule-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// SearchRuleCustomValidator struct is responsible for validating the SearchRule resource
+// when it is created or updated.
+type SearchRuleCustomValidator struct {
+	// RequireTeam rejects the rules without the label of the team owning them
+	RequireTeam bool
+}
+
+var _ webhook.CustomValidator = &SearchRuleCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type SearchRule.
+func (v *SearchRuleCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	searchRule, ok := obj.(*searchrulerv1alpha1.SearchRule)
+	if !ok {
+		return nil, fmt.Errorf("expected a SearchRule object but got %T", obj)
+	}
+	searchrulelog.Info("Validation for SearchRule upon creation", "name", searchRule.GetName())
+
+	return nil, v.validateSearchRule(searchRule)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type SearchRule.
+func (v *SearchRuleCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	searchRule, ok := newObj.(*searchrulerv1alpha1.SearchRule)
+	if !ok {
+		return nil, fmt.Errorf("expected a SearchRule object for the newObj but got %T", newObj)
+	}
+	searchrulelog.Info("Validation for SearchRule upon update", "name", searchRule.GetName())
+
+	// Rules being deleted must be accepted to allow the removal of the finalizer
+	if !searchRule.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+
+	return nil, v.validateSearchRule(searchRule)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type SearchRule.
+func (v *SearchRuleCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateSearchRule validates the SearchRule and, when required, the team owning it
+func (v *SearchRuleCustomValidator) validateSearchRule(searchRule *searchrulerv1alpha1.SearchRule) error {
+	err := searchrule.ValidateSearchRule(searchRule)
+	if v.RequireTeam {
+		err = errors.Join(err, searchrule.ValidateTeam(searchRule))
+	}
+	return err
+}
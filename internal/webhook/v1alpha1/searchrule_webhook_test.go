@@ -0,0 +1,93 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	//
+	searchrulerv1alpha1 "prosimcorp.com/SearchRuler/api/v1alpha1"
+	"prosimcorp.com/SearchRuler/internal/controller"
+)
+
+// newTestSearchRuleSpec returns the spec of a valid rule
+func newTestSearchRuleSpec() searchrulerv1alpha1.SearchRuleSpec {
+	return searchrulerv1alpha1.SearchRuleSpec{
+		CheckInterval: "1m",
+		Condition:     searchrulerv1alpha1.Condition{Operator: "greaterThan", Threshold: "5", For: "1m"},
+	}
+}
+
+var _ = Describe("SearchRuleCustomValidator", func() {
+
+	var (
+		validator  *SearchRuleCustomValidator
+		searchRule *searchrulerv1alpha1.SearchRule
+	)
+
+	BeforeEach(func() {
+		validator = &SearchRuleCustomValidator{}
+		searchRule = &searchrulerv1alpha1.SearchRule{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "errors"},
+			Spec:       newTestSearchRuleSpec(),
+		}
+	})
+
+	It("should accept a valid rule", func() {
+		_, err := validator.ValidateCreate(context.Background(), searchRule)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject an invalid rule on creation and update", func() {
+		searchRule.Spec.CheckInterval = "often"
+
+		_, err := validator.ValidateCreate(context.Background(), searchRule)
+		Expect(err).To(HaveOccurred())
+		_, err = validator.ValidateUpdate(context.Background(), searchRule, searchRule)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should accept an invalid rule being deleted", func() {
+		searchRule.Spec.CheckInterval = "often"
+		now := metav1.Now()
+		searchRule.DeletionTimestamp = &now
+
+		_, err := validator.ValidateUpdate(context.Background(), searchRule, searchRule)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject the rules without team when it is required", func() {
+		validator.RequireTeam = true
+
+		_, err := validator.ValidateCreate(context.Background(), searchRule)
+		Expect(err).To(HaveOccurred())
+
+		searchRule.Labels = map[string]string{controller.TeamLabel: "payments"}
+		_, err = validator.ValidateCreate(context.Background(), searchRule)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject other objects", func() {
+		_, err := validator.ValidateCreate(context.Background(), &searchrulerv1alpha1.ClusterSearchRule{})
+		Expect(err).To(HaveOccurred())
+	})
+})